@@ -0,0 +1,196 @@
+// Package badge draws Open Badges images and bakes assertions into them.
+package badge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	size         = 256
+	maxLabelLen  = 22
+	DefaultColor = "#2a3d6b"
+)
+
+var (
+	ErrInvalidPNG = errors.New("invalid png")
+	ErrInvalidSVG = errors.New("invalid svg")
+)
+
+// ParseColor parses a "#rrggbb" colour.
+func ParseColor(s string) (color.NRGBA, bool) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.NRGBA{}, false
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, true
+}
+
+// star returns the outline of the five-pointed star on every badge.
+func star() [][2]float64 {
+	points := make([][2]float64, 10)
+	for i := range points {
+		r := 52.0
+		if i%2 == 1 {
+			r = 21
+		}
+		angle := -math.Pi/2 + float64(i)*math.Pi/5
+		points[i] = [2]float64{128 + r*math.Cos(angle), 118 + r*math.Sin(angle)}
+	}
+	return points
+}
+
+// SVG draws the badge: a coloured disc with a ring, a star and the name.
+func SVG(name, fill string) []byte {
+	if _, ok := ParseColor(fill); !ok {
+		fill = DefaultColor
+	}
+	if utf8.RuneCountInString(name) > maxLabelLen {
+		name = string([]rune(name)[:maxLabelLen-1]) + "…"
+	}
+
+	var points []string
+	for _, p := range star() {
+		points = append(points, strconv.FormatFloat(p[0], 'f', 1, 64)+","+strconv.FormatFloat(p[1], 'f', 1, 64))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, size, size)
+	fmt.Fprintf(&b, `<circle cx="128" cy="128" r="124" fill="%s"/>`, fill)
+	b.WriteString(`<circle cx="128" cy="128" r="104" fill="none" stroke="#ffffff" stroke-width="5"/>`)
+	fmt.Fprintf(&b, `<polygon points="%s" fill="#ffffff"/>`, strings.Join(points, " "))
+	fmt.Fprintf(&b, `<text x="128" y="200" font-family="Helvetica, Arial, sans-serif" font-size="17" font-weight="bold" fill="#ffffff" text-anchor="middle">%s</text>`,
+		html.EscapeString(name))
+	b.WriteString(`</svg>`)
+	return b.Bytes()
+}
+
+// PNG draws the badge without the name, since no fonts are available for
+// raster output.
+func PNG(fill string) ([]byte, error) {
+	c, ok := ParseColor(fill)
+	if !ok {
+		c, _ = ParseColor(DefaultColor)
+	}
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	outline := star()
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	// Each pixel takes the average of 4x4 samples to smooth the edges.
+	const samples = 4
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var r, g, b, a int
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					px := float64(x) + (float64(sx)+0.5)/samples
+					py := float64(y) + (float64(sy)+0.5)/samples
+					d := math.Hypot(px-128, py-128)
+					var s color.NRGBA
+					switch {
+					case d > 124:
+						continue
+					case math.Abs(d-104) <= 2.5 || inPolygon(px, py, outline):
+						s = white
+					default:
+						s = c
+					}
+					r += int(s.R)
+					g += int(s.G)
+					b += int(s.B)
+					a++
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / a),
+				G: uint8(g / a),
+				B: uint8(b / a),
+				A: uint8(a * 255 / (samples * samples)),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inPolygon(x, y float64, points [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		xi, yi := points[i][0], points[i][1]
+		xj, yj := points[j][0], points[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// BakeSVG embeds a signed assertion (a JWS) in an SVG badge, as the Open
+// Badges baking specification describes.
+func BakeSVG(svg []byte, jws string) ([]byte, error) {
+	start := bytes.Index(svg, []byte("<svg"))
+	if start < 0 {
+		return nil, ErrInvalidSVG
+	}
+	end := bytes.IndexByte(svg[start:], '>')
+	if end < 0 {
+		return nil, ErrInvalidSVG
+	}
+	end += start
+
+	var b bytes.Buffer
+	b.Write(svg[:start+4])
+	b.WriteString(` xmlns:openbadges="http://openbadges.org"`)
+	b.Write(svg[start+4 : end+1])
+	fmt.Fprintf(&b, `<openbadges:assertion verify="%s"></openbadges:assertion>`, html.EscapeString(jws))
+	b.Write(svg[end+1:])
+	return b.Bytes(), nil
+}
+
+// BakePNG embeds a signed assertion in a PNG badge as an uncompressed iTXt
+// chunk with the "openbadges" keyword, placed before IEND.
+func BakePNG(img []byte, jws string) ([]byte, error) {
+	const iendLen = 12
+	if len(img) < 8+iendLen || !bytes.Equal(img[len(img)-iendLen+4:len(img)-4], []byte("IEND")) {
+		return nil, ErrInvalidPNG
+	}
+
+	// keyword, NUL, compression flag and method, empty language tag and
+	// translated keyword (each NUL terminated), then the text.
+	data := append([]byte("openbadges\x00\x00\x00\x00\x00"), jws...)
+
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(data)))
+	chunk.WriteString("iTXt")
+	chunk.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte("iTXt"))
+	crc.Write(data)
+	binary.Write(&chunk, binary.BigEndian, crc.Sum32())
+
+	out := make([]byte, 0, len(img)+chunk.Len())
+	out = append(out, img[:len(img)-iendLen]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, img[len(img)-iendLen:]...), nil
+}
@@ -0,0 +1,231 @@
+package certificate
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Page size of A4 in landscape orientation, in points.
+const (
+	pageWidth  = 842
+	pageHeight = 595
+)
+
+// The standard Type1 fonts need no embedding; text is WinAnsi encoded.
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontItalic  = "F3"
+)
+
+var fontNames = [][2]string{
+	{fontRegular, "Helvetica"},
+	{fontBold, "Helvetica-Bold"},
+	{fontItalic, "Helvetica-Oblique"},
+}
+
+// Glyph widths of printable ASCII (32-126) in 1/1000 em, from the Adobe
+// font metrics. Helvetica-Oblique shares the Helvetica widths.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// pdfPage collects the content stream of a single page document.
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func (p *pdfPage) op(format string, args ...interface{}) {
+	fmt.Fprintf(&p.content, format+"\n", args...)
+}
+
+// color sets both the fill and the stroke color (components 0..1).
+func (p *pdfPage) color(r, g, b float64) {
+	p.op("%s %s %s rg %s %s %s RG", num(r), num(g), num(b), num(r), num(g), num(b))
+}
+
+func (p *pdfPage) fillRect(x, y, w, h float64) {
+	p.op("%s %s %s %s re f", num(x), num(y), num(w), num(h))
+}
+
+func (p *pdfPage) strokeRect(x, y, w, h, lineWidth float64) {
+	p.op("%s w %s %s %s %s re S", num(lineWidth), num(x), num(y), num(w), num(h))
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2, lineWidth float64) {
+	p.op("%s w %s %s m %s %s l S", num(lineWidth), num(x1), num(y1), num(x2), num(y2))
+}
+
+// text draws s with its baseline starting at (x, y).
+func (p *pdfPage) text(font string, size, x, y float64, s string) {
+	p.op("BT /%s %s Tf %s %s Td (%s) Tj ET", font, num(size), num(x), num(y), escapeText(winAnsi(s)))
+}
+
+func (p *pdfPage) centered(font string, size, y float64, s string) {
+	p.text(font, size, (pageWidth-textWidth(font, size, s))/2, y, s)
+}
+
+// wrap splits s into lines no wider than width.
+func wrap(font string, size, width float64, s string) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && textWidth(font, size, candidate) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func textWidth(font string, size float64, s string) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, b := range winAnsi(s) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// bytes assembles the document: catalog, page tree, the page, its
+// compressed content stream, the fonts and the info dictionary.
+func (p *pdfPage) bytes(title string) ([]byte, error) {
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	if _, err := zw.Write(p.content.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	fontRefs := ""
+	for i, f := range fontNames {
+		fontRefs += fmt.Sprintf("/%s %d 0 R ", f[0], 5+i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s>> >> /Contents 4 0 R >>",
+			pageWidth, pageHeight, fontRefs),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()),
+	}
+	for _, f := range fontNames {
+		objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /"+f[1]+" /Encoding /WinAnsiEncoding >>")
+	}
+	objects = append(objects, "<< /Title ("+escapeText(winAnsi(title))+") /Producer (Mini Moodle) >>")
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, len(objects), xref)
+	return out.Bytes(), nil
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func escapeText(s []byte) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// winAnsi encodes s for the standard fonts. Latin-1 passes through,
+// Cyrillic is transliterated and anything else becomes '?'.
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\t':
+			out = append(out, ' ')
+		case r < 0x20:
+		case r < 0x7F || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			if t, ok := cyrillic[r]; ok {
+				out = append(out, t...)
+			} else if t, ok := cyrillic[toLowerCyrillic(r)]; ok {
+				if t != "" {
+					out = append(out, strings.ToUpper(t[:1])+t[1:]...)
+				}
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+func toLowerCyrillic(r rune) rune {
+	switch {
+	case r >= 'А' && r <= 'Я':
+		return r + 32
+	case r >= 'Ѐ' && r <= 'Џ':
+		return r + 80
+	case r >= 0x0490 && r <= 0x04FF && r%2 == 0:
+		return r + 1
+	}
+	return r
+}
+
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+	// Kazakh and Ukrainian letters.
+	'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u", 'һ': "h",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
@@ -0,0 +1,122 @@
+// Package certificate renders course completion certificates as PDF, with
+// a QR code pointing at the verification page. Everything is drawn with the
+// standard PDF fonts, so text outside Latin-1 is transliterated.
+package certificate
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultTitle = "Certificate of Completion"
+
+// Data is everything printed on a certificate.
+type Data struct {
+	Title       string
+	Body        string
+	Signer      string
+	SignerTitle string
+	StudentName string
+	CourseTitle string
+	CompletedAt time.Time
+	// Grade is a share between 0 and 1, nil for ungraded courses.
+	Grade     *float64
+	Code      string
+	VerifyURL string
+}
+
+// Expand fills the {student}, {course}, {date} and {grade} placeholders.
+func Expand(text string, d Data) string {
+	grade := ""
+	if d.Grade != nil {
+		grade = FormatGrade(*d.Grade)
+	}
+	return strings.NewReplacer(
+		"{student}", d.StudentName,
+		"{course}", d.CourseTitle,
+		"{date}", FormatDate(d.CompletedAt),
+		"{grade}", grade,
+	).Replace(text)
+}
+
+func FormatDate(t time.Time) string {
+	return t.UTC().Format("January 2, 2006")
+}
+
+// FormatGrade prints a 0..1 share as a percentage.
+func FormatGrade(g float64) string {
+	return strconv.FormatFloat(math.Round(g*1000)/10, 'f', -1, 64) + "%"
+}
+
+// Render draws the certificate on a single A4 landscape page.
+func Render(d Data) ([]byte, error) {
+	qr, err := EncodeQR(d.VerifyURL)
+	if err != nil {
+		return nil, err
+	}
+	title := strings.TrimSpace(d.Title)
+	if title == "" {
+		title = DefaultTitle
+	}
+
+	var p pdfPage
+	p.color(0.16, 0.24, 0.42)
+	p.strokeRect(20, 20, pageWidth-40, pageHeight-40, 3)
+	p.strokeRect(30, 30, pageWidth-60, pageHeight-60, 1)
+
+	p.centered(fontBold, 34, 480, title)
+	p.color(0.2, 0.2, 0.2)
+	p.centered(fontItalic, 14, 432, "This is to certify that")
+	p.color(0, 0, 0)
+	p.centered(fontBold, 28, 392, d.StudentName)
+	p.color(0.2, 0.2, 0.2)
+	p.centered(fontItalic, 14, 352, "has successfully completed the course")
+	p.color(0, 0, 0)
+	y := 318.0
+	for _, line := range wrap(fontBold, 20, 640, d.CourseTitle) {
+		p.centered(fontBold, 20, y, line)
+		y -= 24
+	}
+	if body := strings.TrimSpace(Expand(d.Body, d)); body != "" {
+		y -= 8
+		// Lines that would run into the footer are dropped.
+		for _, line := range wrap(fontRegular, 12, 560, body) {
+			if y < 175 {
+				break
+			}
+			p.centered(fontRegular, 12, y, line)
+			y -= 16
+		}
+	}
+
+	p.text(fontRegular, 12, 80, 150, "Completed on "+FormatDate(d.CompletedAt))
+	if d.Grade != nil {
+		p.text(fontRegular, 12, 80, 134, "Final grade: "+FormatGrade(*d.Grade))
+	}
+	if d.Signer != "" {
+		p.line(80, 105, 300, 105, 0.75)
+		p.text(fontBold, 12, 80, 90, d.Signer)
+		if d.SignerTitle != "" {
+			p.text(fontRegular, 10, 80, 76, d.SignerTitle)
+		}
+	}
+
+	const qrSize, qrX, qrY = 110.0, pageWidth - 80 - 110.0, 70.0
+	module := qrSize / float64(len(qr))
+	for row, cells := range qr {
+		for col, dark := range cells {
+			if dark {
+				p.fillRect(qrX+float64(col)*module, qrY+qrSize-float64(row+1)*module, module, module)
+			}
+		}
+	}
+	label := "Code: " + d.Code
+	p.text(fontRegular, 8, qrX+(qrSize-textWidth(fontRegular, 8, label))/2, qrY-14, label)
+
+	p.color(0.4, 0.4, 0.4)
+	p.centered(fontRegular, 8, 40, "Verify at "+d.VerifyURL)
+
+	return p.bytes(title + " - " + d.StudentName)
+}
@@ -0,0 +1,47 @@
+// Command ltilauncher is a minimal LTI 1.3 reference platform for checking
+// the tool side of this server locally. It launches courses via OIDC login
+// initiation, runs deep linking, and accepts AGS scores, logging everything
+// it receives.
+//
+//	go run ./cmd/ltilauncher -tool http://localhost:8080 -course <courseId>
+//
+// Register the printed platform with POST /lti/platforms, then open the
+// launcher in a browser.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"AP_Final/lti/ltitest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "listen address")
+	tool := flag.String("tool", "http://localhost:8080", "base URL of the tool under test")
+	course := flag.String("course", "", "course id to launch")
+	item := flag.String("item", "", "optional item id to launch")
+	user := flag.String("user", "learner-1", "platform user id (sub)")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l := ltitest.New("http://"+*addr, *tool, key)
+	l.CourseID = *course
+	l.ItemID = *item
+	l.User = *user
+	l.Logf = log.Printf
+
+	registration, _ := json.MarshalIndent(l.Registration(), "", "  ")
+	fmt.Printf("Register this platform with POST %s/lti/platforms:\n%s\n", l.Tool, registration)
+
+	log.Printf("launcher listening on %s", l.Base)
+	log.Fatal(http.ListenAndServe(*addr, l.Handler()))
+}
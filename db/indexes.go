@@ -12,12 +12,48 @@ func EnsureIndexes(ctx context.Context) error {
 	if err := ensureUsersIndexes(ctx); err != nil {
 		return err
 	}
+	if err := ensureCoursesIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureCategoriesIndexes(ctx); err != nil {
+		return err
+	}
 	if err := ensureEnrollmentsIndexes(ctx); err != nil {
 		return err
 	}
+	if err := ensureInvitesIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureGroupsIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureNotificationsIndexes(ctx); err != nil {
+		return err
+	}
 	if err := ensureProgressIndexes(ctx); err != nil {
 		return err
 	}
+	if err := ensureActivityIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureCompletionsIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureCertificatesIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureBadgesIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureScormIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureXapiIndexes(ctx); err != nil {
+		return err
+	}
+	if err := ensureLtiIndexes(ctx); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -29,6 +65,58 @@ func ensureUsersIndexes(ctx context.Context) error {
 	return err
 }
 
+// ensureCoursesIndexes creates the text index behind course search (title
+// matches weigh most, then the description, then item titles) and the
+// indexes backing keyset pagination of the catalog sorts.
+func ensureCoursesIndexes(ctx context.Context) error {
+	_, err := GetCollection("courses").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "title", Value: "text"},
+				{Key: "description", Value: "text"},
+				{Key: "modules.items.title", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("course_text").
+				SetDefaultLanguage("none").
+				SetWeights(bson.D{
+					{Key: "title", Value: 10},
+					{Key: "description", Value: 3},
+					{Key: "modules.items.title", Value: 2},
+				}),
+		},
+		{
+			Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "tags", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "staff.userId", Value: 1}},
+		},
+	})
+	return err
+}
+
+func ensureCategoriesIndexes(ctx context.Context) error {
+	_, err := GetCollection("categories").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "ancestors", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "parentId", Value: 1}},
+		},
+	})
+	return err
+}
+
 func ensureEnrollmentsIndexes(ctx context.Context) error {
 	_, err := GetCollection("enrollments").Indexes().CreateMany(ctx, []mongo.IndexModel{
 		{
@@ -38,14 +126,200 @@ func ensureEnrollmentsIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "status", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "enrolledAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "status", Value: 1}, {Key: "waitlistSeq", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "enrolledAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "endsAt", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "groupId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "risk.score", Value: -1}, {Key: "_id", Value: -1}},
+		},
+	})
+	return err
+}
+
+// ensureInvitesIndexes backs the invite list of a course; spent and
+// revoked invites are kept until a month after they expire.
+func ensureInvitesIndexes(ctx context.Context) error {
+	_, err := GetCollection("course_invites").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60),
+		},
+	})
+	return err
+}
+
+func ensureGroupsIndexes(ctx context.Context) error {
+	_, err := GetCollection("groups").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "courseId", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func ensureNotificationsIndexes(ctx context.Context) error {
+	_, err := GetCollection("notifications").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
 	})
 	return err
 }
 
 func ensureProgressIndexes(ctx context.Context) error {
-	_, err := GetCollection("progress").Indexes().CreateOne(ctx, mongo.IndexModel{
+	_, err := GetCollection("progress").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}, {Key: "itemId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "itemId", Value: 1}}},
+	})
+	return err
+}
+
+func ensureActivityIndexes(ctx context.Context) error {
+	_, err := GetCollection("activity").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+	})
+	return err
+}
+
+func ensureCompletionsIndexes(ctx context.Context) error {
+	_, err := GetCollection("course_completions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "completedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+	})
+	return err
+}
+
+func ensureCertificatesIndexes(ctx context.Context) error {
+	_, err := GetCollection("certificates").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func ensureBadgesIndexes(ctx context.Context) error {
+	_, err := GetCollection("badge_classes").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "courseId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = GetCollection("badge_awards").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "badgeId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "issuedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+	})
+	return err
+}
+
+func ensureScormIndexes(ctx context.Context) error {
+	_, err := GetCollection("scorm_runtime").Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}, {Key: "itemId", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetCollection("courses").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "modules.items.packageId", Value: 1}},
+	})
+	return err
+}
+
+func ensureXapiIndexes(ctx context.Context) error {
+	_, err := GetCollection("xapi_providers").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetCollection("xapi_statements").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "stored", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actorKey", Value: 1}, {Key: "stored", Value: -1}}},
+		{Keys: bson.D{{Key: "verbId", Value: 1}, {Key: "stored", Value: -1}}},
+		{Keys: bson.D{{Key: "activityId", Value: 1}, {Key: "stored", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetCollection("courses").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "modules.items.activityId", Value: 1}},
+	})
 	return err
 }
+
+func ensureLtiIndexes(ctx context.Context) error {
+	_, err := GetCollection("lti_platforms").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "issuer", Value: 1}, {Key: "clientId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetCollection("lti_tools").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetCollection("lti_links").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "platformId", Value: 1}, {Key: "userId", Value: 1}, {Key: "courseId", Value: 1}, {Key: "itemId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "courseId", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// States, launch hints and access tokens expire on their own.
+	for _, name := range []string{"lti_states", "lti_tokens"} {
+		_, err = GetCollection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
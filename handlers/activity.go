@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// Consecutive events further apart than sessionTimeout belong to different
+// sessions; the gap is not counted as time on task.
+const sessionTimeout = 30 * time.Minute
+
+var activitySort = []sortField{{Path: "createdAt", Desc: true}, {Path: "_id", Desc: true}}
+
+// logActivity appends an event to the activity stream. The stream is a
+// history only, so failures are logged and not returned.
+func logActivity(ctx context.Context, a models.Activity) {
+	a.ID = primitive.NewObjectID()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	if _, err := db.GetCollection("activity").InsertOne(ctx, a); err != nil {
+		log.Printf("activity: recording %s of %s: %v", a.Type, a.UserID.Hex(), err)
+	}
+}
+
+// logEnrolled records that a student joined a course (or its waitlist).
+func logEnrolled(ctx context.Context, e models.Enrollment) {
+	logActivity(ctx, models.Activity{UserID: e.UserID, CourseID: e.CourseID, Type: models.ActivityEnrolled, Status: e.Status})
+}
+
+// logItemView records that a student opened an item. Staff previews are
+// not recorded.
+func logItemView(ctx context.Context, course *models.Course, userID, itemOID primitive.ObjectID) {
+	if isCourseStaff(course, userID) {
+		return
+	}
+	logActivity(ctx, models.Activity{UserID: userID, CourseID: course.ID, ItemID: &itemOID, Type: models.ActivityItemViewed})
+}
+
+// logProgressActivity records a progress change; before is the progress
+// document as it was (nil if there was none). A student's attempt that
+// marks the item done is a submission; other updates are only recorded
+// when they change the status or the score.
+func logProgressActivity(ctx context.Context, userID, courseOID, itemOID primitive.ObjectID, before *models.Progress, status string, score float64, countAttempt bool, source string) {
+	a := models.Activity{
+		UserID:   userID,
+		CourseID: courseOID,
+		ItemID:   &itemOID,
+		Type:     models.ActivityProgress,
+		Source:   source,
+		Status:   status,
+		Score:    &score,
+	}
+	if before != nil {
+		a.FromStatus = before.Status
+	}
+	switch {
+	case source == models.ActivitySourceStaff:
+		a.Type = models.ActivityGraded
+	case countAttempt && status == "done":
+		a.Type = models.ActivitySubmitted
+	}
+	if a.Type != models.ActivitySubmitted && before != nil && before.Status == status && before.Score == score {
+		return
+	}
+	logActivity(ctx, a)
+}
+
+// ViewItem records that the student opened an item. SCORM and LTI items
+// are recorded by their player and launch instead.
+func ViewItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("courseId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, item := loadLearnerItem(ctx, w, userID, courseOID, itemOID)
+	if item == nil {
+		return
+	}
+	logItemView(ctx, course, userID, item.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activityRange reads from and to (RFC 3339 or a date, to inclusive) into a
+// createdAt filter.
+func activityRange(r *http.Request, filter bson.M) error {
+	query := r.URL.Query()
+	window := bson.M{}
+	if v := strings.TrimSpace(query.Get("from")); v != "" {
+		from, err := parseAnalyticsTime(v, false)
+		if err != nil {
+			return errors.New("invalid from")
+		}
+		window["$gte"] = *from
+	}
+	if v := strings.TrimSpace(query.Get("to")); v != "" {
+		to, err := parseAnalyticsTime(v, true)
+		if err != nil {
+			return errors.New("invalid to")
+		}
+		window["$lt"] = *to
+	}
+	if len(window) > 0 {
+		filter["createdAt"] = window
+	}
+	if t := strings.TrimSpace(query.Get("type")); t != "" {
+		filter["type"] = t
+	}
+	return nil
+}
+
+// GetMyActivity is the caller's learning history, newest first. from and
+// to bound it in time, courseId and type narrow it.
+func GetMyActivity(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	pg, err := parseListPage(r, "createdAt_desc", "from", "to", "courseId", "type")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := bson.M{"userId": userID}
+	if err := activityRange(r, filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := strings.TrimSpace(r.URL.Query().Get("courseId")); v != "" {
+		courseOID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid courseId")
+			return
+		}
+		filter["courseId"] = courseOID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	writeActivityPage(ctx, w, r, pg, filter)
+}
+
+// GetStudentActivity is a student's history in the course, for its staff.
+func GetStudentActivity(w http.ResponseWriter, r *http.Request) {
+	pg, err := parseListPage(r, "createdAt_desc", "from", "to", "type")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+
+	filter := bson.M{"userId": enrollment.UserID, "courseId": course.ID}
+	if err := activityRange(r, filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeActivityPage(ctx, w, r, pg, filter)
+}
+
+func writeActivityPage(ctx context.Context, w http.ResponseWriter, r *http.Request, pg listPage, filter bson.M) {
+	if keyset := pg.keysetFilter(activitySort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(activitySort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := db.GetCollection("activity").Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch activity")
+		return
+	}
+	events := []models.Activity{}
+	if err := cursor.All(ctx, &events); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode activity")
+		return
+	}
+
+	fetched := len(events)
+	if fetched > pg.Limit {
+		events = events[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(events)
+	}
+
+	var first, last []interface{}
+	if len(events) > 0 {
+		first = []interface{}{events[0].CreatedAt, events[0].ID}
+		last = []interface{}{events[len(events)-1].CreatedAt, events[len(events)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+type itemTimeOnTask struct {
+	ItemID  primitive.ObjectID `bson:"_id" json:"itemId"`
+	Title   string             `bson:"-" json:"title"`
+	Seconds int64              `bson:"seconds" json:"seconds"`
+	Events  int                `bson:"events" json:"events"`
+}
+
+// timeOnTask estimates the time a student spent on each item of a course.
+// An event's item is credited with the time until the student's next
+// event, in any course, unless that gap exceeds sessionTimeout. The last
+// event of a session adds no time.
+func timeOnTask(ctx context.Context, userID primitive.ObjectID, course *models.Course, window bson.M) ([]itemTimeOnTask, error) {
+	match := bson.M{"userId": userID}
+	if len(window) > 0 {
+		match["createdAt"] = window
+	}
+	cursor, err := db.GetCollection("activity").Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$setWindowFields": bson.M{
+			"sortBy": bson.M{"createdAt": 1, "_id": 1},
+			"output": bson.M{
+				"next": bson.M{"$shift": bson.M{"output": "$createdAt", "by": 1}},
+			},
+		}},
+		{"$match": bson.M{"courseId": course.ID, "itemId": bson.M{"$exists": true}}},
+		{"$set": bson.M{
+			"gap": bson.M{"$dateDiff": bson.M{"startDate": "$createdAt", "endDate": "$next", "unit": "second"}},
+		}},
+		{"$group": bson.M{
+			"_id": "$itemId",
+			"seconds": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$and": []interface{}{
+					bson.M{"$ne": []interface{}{"$gap", nil}},
+					bson.M{"$lte": []interface{}{"$gap", int64(sessionTimeout.Seconds())}},
+				}}, "$gap", 0,
+			}}},
+			"events": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"seconds": -1, "_id": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []itemTimeOnTask{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if _, item := findItem(course, items[i].ItemID); item != nil {
+			items[i].Title = item.Title
+		}
+	}
+	return items, nil
+}
+
+func writeTimeOnTask(ctx context.Context, w http.ResponseWriter, r *http.Request, userID primitive.ObjectID, course *models.Course) {
+	filter := bson.M{}
+	if err := activityRange(r, filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	window, _ := filter["createdAt"].(bson.M)
+
+	items, err := timeOnTask(ctx, userID, course, window)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to compute time on task")
+		return
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Seconds
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"courseId":     course.ID,
+		"totalSeconds": total,
+		"items":        items,
+	})
+}
+
+// GetMyTimeOnTask estimates the caller's time on each item of a course.
+func GetMyTimeOnTask(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("courseId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+	writeTimeOnTask(ctx, w, r, userID, course)
+}
+
+// GetStudentTimeOnTask is GetMyTimeOnTask for a student of the course.
+func GetStudentTimeOnTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+	writeTimeOnTask(ctx, w, r, enrollment.UserID, course)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestActivityRange(t *testing.T) {
+	jan1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		query   string
+		want    bson.M
+		wantErr string
+	}{
+		{name: "no bounds", want: bson.M{}},
+		{name: "dates, to inclusive", query: "from=2026-01-01&to=2026-01-01", want: bson.M{
+			"createdAt": bson.M{"$gte": jan1, "$lt": jan1.AddDate(0, 0, 1)},
+		}},
+		{name: "rfc 3339", query: "from=2026-01-01T10:00:00Z", want: bson.M{
+			"createdAt": bson.M{"$gte": jan1.Add(10 * time.Hour)},
+		}},
+		{name: "type", query: "type=+submitted+", want: bson.M{"type": "submitted"}},
+		{name: "invalid from", query: "from=soon", wantErr: "invalid from"},
+		{name: "invalid to", query: "to=2026-02-30", wantErr: "invalid to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := bson.M{}
+			err := activityRange(httptest.NewRequest(http.MethodGet, "/me/activity?"+tt.query, nil), filter)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("filter = %v, want %v", filter, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,706 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	defaultInactiveDays = 14
+	scoreBuckets        = 10
+
+	// Reports of courses with at least analyticsCacheMinEnrollments
+	// students in range are kept for analyticsCacheTTL.
+	analyticsCacheTTL            = 5 * time.Minute
+	analyticsCacheMinEnrollments = 200
+	analyticsCacheMaxEntries     = 256
+)
+
+type analyticsQuery struct {
+	From         *time.Time
+	To           *time.Time
+	Interval     string
+	InactiveDays int
+	Refresh      bool
+}
+
+// parseAnalyticsTime accepts RFC 3339 or a plain date. A plain "to" date
+// is inclusive, so it ends at the following midnight.
+func parseAnalyticsTime(v string, end bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func parseAnalyticsQuery(r *http.Request) (analyticsQuery, error) {
+	query := r.URL.Query()
+	q := analyticsQuery{InactiveDays: defaultInactiveDays}
+
+	var err error
+	if v := strings.TrimSpace(query.Get("from")); v != "" {
+		if q.From, err = parseAnalyticsTime(v, false); err != nil {
+			return q, errors.New("invalid from")
+		}
+	}
+	if v := strings.TrimSpace(query.Get("to")); v != "" {
+		if q.To, err = parseAnalyticsTime(v, true); err != nil {
+			return q, errors.New("invalid to")
+		}
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return q, errors.New("from must be before to")
+	}
+
+	q.Interval = strings.TrimSpace(query.Get("interval"))
+	if q.Interval != "" && q.Interval != "day" && q.Interval != "week" && q.Interval != "month" {
+		return q, errors.New("interval must be day, week or month")
+	}
+	if v := strings.TrimSpace(query.Get("inactiveDays")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			return q, errors.New("inactiveDays must be between 1 and 365")
+		}
+		q.InactiveDays = n
+	}
+	q.Refresh = query.Get("refresh") == "true"
+	return q, nil
+}
+
+// resolveInterval picks the series granularity from the span of the range
+// when none was asked for.
+func (q *analyticsQuery) resolveInterval(course *models.Course, now time.Time) {
+	if q.Interval != "" {
+		return
+	}
+	from, to := course.CreatedAt, now
+	if q.From != nil {
+		from = *q.From
+	}
+	if q.To != nil {
+		to = *q.To
+	}
+	switch span := to.Sub(from); {
+	case span <= 90*24*time.Hour:
+		q.Interval = "day"
+	case span <= 2*365*24*time.Hour:
+		q.Interval = "week"
+	default:
+		q.Interval = "month"
+	}
+}
+
+func (q analyticsQuery) rangeFilter() bson.M {
+	r := bson.M{}
+	if q.From != nil {
+		r["$gte"] = *q.From
+	}
+	if q.To != nil {
+		r["$lt"] = *q.To
+	}
+	return r
+}
+
+// cohortFilter selects the students the report is about: those who
+// enrolled within the range.
+func (q analyticsQuery) cohortFilter(courseOID primitive.ObjectID) bson.M {
+	filter := bson.M{"courseId": courseOID, "status": bson.M{"$ne": models.EnrollmentStatusPending}}
+	if r := q.rangeFilter(); len(r) > 0 {
+		filter["enrolledAt"] = r
+	}
+	return filter
+}
+
+func (q analyticsQuery) cacheKey(course *models.Course) string {
+	key := course.ID.Hex() + ":" + strconv.FormatInt(course.Version, 10) + ":" + q.Interval + ":" + strconv.Itoa(q.InactiveDays)
+	for _, t := range []*time.Time{q.From, q.To} {
+		key += ":"
+		if t != nil {
+			key += strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+	return key
+}
+
+type analyticsSummary struct {
+	Enrollments    int            `json:"enrollments"`
+	ByStatus       map[string]int `json:"byStatus"`
+	Completions    int            `json:"completions"`
+	CompletionRate float64        `json:"completionRate"`
+	AverageGrade   *float64       `json:"averageGrade,omitempty"`
+}
+
+type analyticsPeriod struct {
+	Period    time.Time `json:"period"`
+	Enrolled  int       `json:"enrolled"`
+	Completed int       `json:"completed"`
+}
+
+// moduleFunnelStep counts, among the students who can see the module, how
+// many started it and how many finished its required items.
+type moduleFunnelStep struct {
+	ModuleID  primitive.ObjectID `json:"moduleId"`
+	Title     string             `json:"title"`
+	Eligible  int                `json:"eligible"`
+	Started   int                `json:"started"`
+	Completed int                `json:"completed"`
+}
+
+type itemAnalytics struct {
+	ItemID          primitive.ObjectID `json:"itemId"`
+	ModuleID        primitive.ObjectID `json:"moduleId"`
+	Title           string             `json:"title"`
+	Type            string             `json:"type"`
+	Optional        bool               `json:"optional,omitempty"`
+	MaxScore        float64            `json:"maxScore"`
+	Learners        int                `json:"learners"`
+	Done            int                `json:"done"`
+	AverageAttempts float64            `json:"averageAttempts"`
+	// AverageScore is the mean of score/maxScore, for graded items.
+	AverageScore *float64 `json:"averageScore,omitempty"`
+	Distribution []int    `json:"scoreDistribution,omitempty"`
+}
+
+type dropOffPoint struct {
+	ItemID   primitive.ObjectID `json:"itemId"`
+	ModuleID primitive.ObjectID `json:"moduleId"`
+	Title    string             `json:"title"`
+	Students int                `json:"students"`
+}
+
+// analyticsDropOff places every inactive, unfinished student at the first
+// required item they have not done.
+type analyticsDropOff struct {
+	InactiveDays int            `json:"inactiveDays"`
+	Inactive     int            `json:"inactive"`
+	NotStarted   int            `json:"notStarted"`
+	Points       []dropOffPoint `json:"points"`
+}
+
+type courseAnalytics struct {
+	CourseID            primitive.ObjectID `json:"courseId"`
+	From                *time.Time         `json:"from,omitempty"`
+	To                  *time.Time         `json:"to,omitempty"`
+	Interval            string             `json:"interval"`
+	GeneratedAt         time.Time          `json:"generatedAt"`
+	Cached              bool               `json:"cached"`
+	Summary             analyticsSummary   `json:"summary"`
+	EnrollmentsOverTime []analyticsPeriod  `json:"enrollmentsOverTime"`
+	Funnel              []moduleFunnelStep `json:"funnel"`
+	Items               []itemAnalytics    `json:"items"`
+	DropOff             analyticsDropOff   `json:"dropOff"`
+	// GradeDistribution buckets the students' current course grade in
+	// tenths (0-10%, ..., 90-100%).
+	GradeDistribution []int `json:"gradeDistribution"`
+}
+
+type analyticsCacheEntry struct {
+	report  courseAnalytics
+	expires time.Time
+}
+
+var (
+	analyticsCacheMu sync.Mutex
+	analyticsCache   = map[string]analyticsCacheEntry{}
+)
+
+func cachedAnalytics(key string, now time.Time) (courseAnalytics, bool) {
+	analyticsCacheMu.Lock()
+	defer analyticsCacheMu.Unlock()
+	entry, ok := analyticsCache[key]
+	if !ok || now.After(entry.expires) {
+		return courseAnalytics{}, false
+	}
+	return entry.report, true
+}
+
+func storeAnalytics(key string, report courseAnalytics, now time.Time) {
+	analyticsCacheMu.Lock()
+	defer analyticsCacheMu.Unlock()
+	if len(analyticsCache) >= analyticsCacheMaxEntries {
+		for k, e := range analyticsCache {
+			if now.After(e.expires) {
+				delete(analyticsCache, k)
+			}
+		}
+		for k := range analyticsCache {
+			if len(analyticsCache) < analyticsCacheMaxEntries {
+				break
+			}
+			delete(analyticsCache, k)
+		}
+	}
+	analyticsCache[key] = analyticsCacheEntry{report: report, expires: now.Add(analyticsCacheTTL)}
+}
+
+// GetCourseAnalytics is the teacher dashboard of a course.
+func GetCourseAnalytics(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	now := time.Now()
+	q.resolveInterval(course, now)
+	key := q.cacheKey(course)
+	if !q.Refresh {
+		if report, ok := cachedAnalytics(key, now); ok {
+			report.Cached = true
+			writeJSON(w, http.StatusOK, report)
+			return
+		}
+	}
+
+	report, err := buildCourseAnalytics(ctx, course, q, now)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build analytics")
+		return
+	}
+	if report.Summary.Enrollments >= analyticsCacheMinEnrollments {
+		storeAnalytics(key, report, now)
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func buildCourseAnalytics(ctx context.Context, course *models.Course, q analyticsQuery, now time.Time) (courseAnalytics, error) {
+	report := courseAnalytics{
+		CourseID:    course.ID,
+		From:        q.From,
+		To:          q.To,
+		Interval:    q.Interval,
+		GeneratedAt: now,
+	}
+
+	series, err := analyticsSeries(ctx, course.ID, q)
+	if err != nil {
+		return report, err
+	}
+	report.EnrollmentsOverTime = series
+
+	learners, err := analyticsLearners(ctx, course.ID, q)
+	if err != nil {
+		return report, err
+	}
+	report.Summary = summarizeLearners(learners)
+	report.Funnel = moduleFunnel(course, learners)
+	report.DropOff = dropOffPoints(course, learners, q.InactiveDays, now)
+	report.GradeDistribution = gradeDistribution(course, learners)
+
+	items, err := itemDifficulty(ctx, course, q)
+	if err != nil {
+		return report, err
+	}
+	report.Items = items
+	return report, nil
+}
+
+// periodExpr truncates a date field to the report interval.
+func periodExpr(field, interval string) bson.M {
+	trunc := bson.M{"date": field, "unit": interval}
+	if interval == "week" {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+// analyticsSeries counts enrollments and completions per period.
+func analyticsSeries(ctx context.Context, courseOID primitive.ObjectID, q analyticsQuery) ([]analyticsPeriod, error) {
+	type bucket struct {
+		Period time.Time `bson:"_id"`
+		Count  int       `bson:"count"`
+	}
+	count := func(collection, field string, filter bson.M) ([]bucket, error) {
+		cursor, err := db.GetCollection(collection).Aggregate(ctx, []bson.M{
+			{"$match": filter},
+			{"$group": bson.M{"_id": periodExpr("$"+field, q.Interval), "count": bson.M{"$sum": 1}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var out []bucket
+		err = cursor.All(ctx, &out)
+		return out, err
+	}
+
+	enrolled, err := count("enrollments", "enrolledAt", q.cohortFilter(courseOID))
+	if err != nil {
+		return nil, err
+	}
+	completionFilter := bson.M{"courseId": courseOID}
+	if r := q.rangeFilter(); len(r) > 0 {
+		completionFilter["completedAt"] = r
+	}
+	completed, err := count("course_completions", "completedAt", completionFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	byPeriod := map[time.Time]*analyticsPeriod{}
+	get := func(t time.Time) *analyticsPeriod {
+		if p, ok := byPeriod[t]; ok {
+			return p
+		}
+		p := &analyticsPeriod{Period: t}
+		byPeriod[t] = p
+		return p
+	}
+	for _, b := range enrolled {
+		get(b.Period).Enrolled = b.Count
+	}
+	for _, b := range completed {
+		get(b.Period).Completed = b.Count
+	}
+
+	series := make([]analyticsPeriod, 0, len(byPeriod))
+	for _, p := range byPeriod {
+		series = append(series, *p)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Period.Before(series[j].Period) })
+	return series, nil
+}
+
+type analyticsLearner struct {
+	models.Enrollment `bson:",inline"`
+	Progress          []models.Progress        `bson:"progress"`
+	Completion        *models.CourseCompletion `bson:"completion"`
+}
+
+// analyticsLearners loads the cohort's enrollments with their progress and
+// completion record.
+func analyticsLearners(ctx context.Context, courseOID primitive.ObjectID, q analyticsQuery) ([]analyticsLearner, error) {
+	sameLearner := bson.M{"$expr": bson.M{"$and": []bson.M{
+		{"$eq": []interface{}{"$courseId", "$$courseId"}},
+		{"$eq": []interface{}{"$userId", "$$userId"}},
+	}}}
+	cursor, err := db.GetCollection("enrollments").Aggregate(ctx, []bson.M{
+		{"$match": q.cohortFilter(courseOID)},
+		{"$lookup": bson.M{
+			"from": "progress",
+			"let":  bson.M{"courseId": "$courseId", "userId": "$userId"},
+			"pipeline": []bson.M{
+				{"$match": sameLearner},
+				{"$project": bson.M{"itemId": 1, "status": 1, "score": 1, "attempts": 1}},
+			},
+			"as": "progress",
+		}},
+		{"$lookup": bson.M{
+			"from":     "course_completions",
+			"let":      bson.M{"courseId": "$courseId", "userId": "$userId"},
+			"pipeline": []bson.M{{"$match": sameLearner}},
+			"as":       "completion",
+		}},
+		{"$set": bson.M{"completion": bson.M{"$first": "$completion"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var learners []analyticsLearner
+	err = cursor.All(ctx, &learners)
+	return learners, err
+}
+
+func summarizeLearners(learners []analyticsLearner) analyticsSummary {
+	s := analyticsSummary{Enrollments: len(learners), ByStatus: map[string]int{}}
+	var gradeSum float64
+	graded := 0
+	for _, l := range learners {
+		s.ByStatus[l.Status]++
+		if l.Completion == nil {
+			continue
+		}
+		s.Completions++
+		if l.Completion.Grade != nil {
+			gradeSum += *l.Completion.Grade
+			graded++
+		}
+	}
+	if s.Enrollments > 0 {
+		s.CompletionRate = float64(s.Completions) / float64(s.Enrollments)
+	}
+	if graded > 0 {
+		avg := gradeSum / float64(graded)
+		s.AverageGrade = &avg
+	}
+	return s
+}
+
+func doneItems(progress []models.Progress) map[primitive.ObjectID]bool {
+	done := map[primitive.ObjectID]bool{}
+	for _, p := range progress {
+		done[p.ItemID] = p.Status == "done"
+	}
+	return done
+}
+
+func moduleFunnel(course *models.Course, learners []analyticsLearner) []moduleFunnelStep {
+	steps := make([]moduleFunnelStep, len(course.Modules))
+	for i, m := range course.Modules {
+		steps[i] = moduleFunnelStep{ModuleID: m.ID, Title: m.Title}
+	}
+
+	for _, l := range learners {
+		touched := doneItems(l.Progress)
+		for i := range course.Modules {
+			m := &course.Modules[i]
+			if !visibleToGroup(m.GroupIDs, l.GroupID) {
+				continue
+			}
+			steps[i].Eligible++
+			started := false
+			required, done := 0, 0
+			for ii := range m.Items {
+				item := &m.Items[ii]
+				if !visibleToGroup(item.GroupIDs, l.GroupID) {
+					continue
+				}
+				isDone, ok := touched[item.ID]
+				started = started || ok
+				if item.Optional {
+					continue
+				}
+				required++
+				if isDone {
+					done++
+				}
+			}
+			if started {
+				steps[i].Started++
+			}
+			if required > 0 && done == required {
+				steps[i].Completed++
+			}
+		}
+	}
+	return steps
+}
+
+func dropOffPoints(course *models.Course, learners []analyticsLearner, inactiveDays int, now time.Time) analyticsDropOff {
+	cutoff := now.AddDate(0, 0, -inactiveDays)
+	out := analyticsDropOff{InactiveDays: inactiveDays, Points: []dropOffPoint{}}
+	counts := map[primitive.ObjectID]int{}
+
+	for _, l := range learners {
+		if l.Completion != nil || l.Status == models.EnrollmentStatusCompleted {
+			continue
+		}
+		lastSeen := l.EnrolledAt
+		if l.LastAccessAt != nil {
+			lastSeen = *l.LastAccessAt
+		}
+		ended := l.Status == models.EnrollmentStatusWithdrawn || l.Status == models.EnrollmentStatusExpired
+		if !ended && !lastSeen.Before(cutoff) {
+			continue
+		}
+		out.Inactive++
+		if len(l.Progress) == 0 {
+			out.NotStarted++
+			continue
+		}
+
+		done := doneItems(l.Progress)
+	find:
+		for mi := range course.Modules {
+			m := &course.Modules[mi]
+			if !visibleToGroup(m.GroupIDs, l.GroupID) {
+				continue
+			}
+			for ii := range m.Items {
+				item := &m.Items[ii]
+				if item.Optional || !visibleToGroup(item.GroupIDs, l.GroupID) || done[item.ID] {
+					continue
+				}
+				counts[item.ID]++
+				break find
+			}
+		}
+	}
+
+	for _, m := range course.Modules {
+		for _, item := range m.Items {
+			if n := counts[item.ID]; n > 0 {
+				out.Points = append(out.Points, dropOffPoint{ItemID: item.ID, ModuleID: m.ID, Title: item.Title, Students: n})
+			}
+		}
+	}
+	sort.SliceStable(out.Points, func(i, j int) bool { return out.Points[i].Students > out.Points[j].Students })
+	return out
+}
+
+func scoreBucket(share float64) int {
+	return min(max(int(share*scoreBuckets), 0), scoreBuckets-1)
+}
+
+// gradeDistribution uses the grade of the completion rules; courses
+// without graded items give an empty distribution.
+func gradeDistribution(course *models.Course, learners []analyticsLearner) []int {
+	buckets := make([]int, scoreBuckets)
+	for _, l := range learners {
+		if grade := evaluateCompletion(course, l.GroupID, l.Progress).Grade; grade != nil {
+			buckets[scoreBucket(*grade)]++
+		}
+	}
+	return buckets
+}
+
+// itemDifficulty aggregates progress per item: learners, done count,
+// average attempts and normalized score, and a score histogram.
+func itemDifficulty(ctx context.Context, course *models.Course, q analyticsQuery) ([]itemAnalytics, error) {
+	branches := []bson.M{}
+	for _, m := range course.Modules {
+		for _, item := range m.Items {
+			if item.MaxScore > 0 {
+				branches = append(branches, bson.M{
+					"case": bson.M{"$eq": []interface{}{"$itemId", item.ID}},
+					"then": item.MaxScore,
+				})
+			}
+		}
+	}
+	var maxScore interface{} = 0
+	if len(branches) > 0 {
+		maxScore = bson.M{"$switch": bson.M{"branches": branches, "default": 0}}
+	}
+	share := bson.M{"$min": []interface{}{
+		bson.M{"$max": []interface{}{bson.M{"$divide": []interface{}{"$score", "$maxScore"}}, 0}},
+		1,
+	}}
+
+	pipeline := []bson.M{{"$match": bson.M{"courseId": course.ID}}}
+	if q.From != nil || q.To != nil {
+		// Restrict to the cohort of students enrolled within the range.
+		pipeline = append(pipeline,
+			bson.M{"$lookup": bson.M{
+				"from": "enrollments",
+				"let":  bson.M{"courseId": "$courseId", "userId": "$userId"},
+				"pipeline": []bson.M{
+					{"$match": bson.M{"$expr": bson.M{"$and": []bson.M{
+						{"$eq": []interface{}{"$courseId", "$$courseId"}},
+						{"$eq": []interface{}{"$userId", "$$userId"}},
+					}}}},
+					{"$match": q.cohortFilter(course.ID)},
+					{"$project": bson.M{"_id": 1}},
+				},
+				"as": "cohort",
+			}},
+			bson.M{"$match": bson.M{"cohort.0": bson.M{"$exists": true}}},
+		)
+	}
+	pipeline = append(pipeline,
+		bson.M{"$set": bson.M{"maxScore": maxScore}},
+		bson.M{"$facet": bson.M{
+			"items": []bson.M{{"$group": bson.M{
+				"_id":      "$itemId",
+				"learners": bson.M{"$sum": 1},
+				"done":     bson.M{"$sum": bson.M{"$cond": []interface{}{bson.M{"$eq": []interface{}{"$status", "done"}}, 1, 0}}},
+				"attempts": bson.M{"$avg": "$attempts"},
+				"score": bson.M{"$avg": bson.M{"$cond": []interface{}{
+					bson.M{"$gt": []interface{}{"$maxScore", 0}}, share, nil,
+				}}},
+			}}},
+			"scores": []bson.M{
+				{"$match": bson.M{"maxScore": bson.M{"$gt": 0}}},
+				{"$group": bson.M{
+					"_id": bson.M{
+						"item": "$itemId",
+						"bucket": bson.M{"$min": []interface{}{
+							bson.M{"$floor": bson.M{"$multiply": []interface{}{share, scoreBuckets}}},
+							scoreBuckets - 1,
+						}},
+					},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+		}},
+	)
+
+	cursor, err := db.GetCollection("progress").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var facets []struct {
+		Items []struct {
+			ItemID   primitive.ObjectID `bson:"_id"`
+			Learners int                `bson:"learners"`
+			Done     int                `bson:"done"`
+			Attempts float64            `bson:"attempts"`
+			Score    *float64           `bson:"score"`
+		} `bson:"items"`
+		Scores []struct {
+			ID struct {
+				ItemID primitive.ObjectID `bson:"item"`
+				Bucket float64            `bson:"bucket"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		} `bson:"scores"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	byItem := map[primitive.ObjectID]*itemAnalytics{}
+	items := []itemAnalytics{}
+	for _, m := range course.Modules {
+		for _, item := range m.Items {
+			entry := itemAnalytics{
+				ItemID:   item.ID,
+				ModuleID: m.ID,
+				Title:    item.Title,
+				Type:     item.Type,
+				Optional: item.Optional,
+				MaxScore: item.MaxScore,
+			}
+			if item.MaxScore > 0 {
+				entry.Distribution = make([]int, scoreBuckets)
+			}
+			items = append(items, entry)
+		}
+	}
+	for i := range items {
+		byItem[items[i].ItemID] = &items[i]
+	}
+	if len(facets) == 0 {
+		return items, nil
+	}
+	for _, row := range facets[0].Items {
+		if entry := byItem[row.ItemID]; entry != nil {
+			entry.Learners = row.Learners
+			entry.Done = row.Done
+			entry.AverageAttempts = row.Attempts
+			entry.AverageScore = row.Score
+		}
+	}
+	for _, row := range facets[0].Scores {
+		if entry := byItem[row.ID.ItemID]; entry != nil && entry.Distribution != nil {
+			entry.Distribution[int(row.ID.Bucket)] += row.Count
+		}
+	}
+	return items, nil
+}
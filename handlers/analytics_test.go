@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestParseAnalyticsQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return t
+	}
+	tests := []struct {
+		name     string
+		query    string
+		from, to time.Time
+		interval string
+		inactive int
+		wantErr  string
+	}{
+		{name: "defaults", inactive: defaultInactiveDays},
+		{name: "inclusive to date", query: "from=2026-01-01&to=2026-01-31", from: day("2026-01-01"), to: day("2026-02-01"), inactive: defaultInactiveDays},
+		{name: "rfc 3339 to", query: "to=2026-01-31T12:00:00Z", to: day("2026-01-31").Add(12 * time.Hour), inactive: defaultInactiveDays},
+		{name: "interval and inactive days", query: "interval=week&inactiveDays=30", interval: "week", inactive: 30},
+		{name: "invalid from", query: "from=yesterday", wantErr: "invalid from"},
+		{name: "invalid to", query: "to=2026-13-01", wantErr: "invalid to"},
+		{name: "empty range", query: "from=2026-02-01&to=2026-01-31", wantErr: "from must be before to"},
+		{name: "unknown interval", query: "interval=year", wantErr: "interval must be day, week or month"},
+		{name: "inactive days out of range", query: "inactiveDays=0", wantErr: "inactiveDays must be between 1 and 365"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseAnalyticsQuery(httptest.NewRequest(http.MethodGet, "/analytics?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct {
+				got  *time.Time
+				want time.Time
+			}{{q.From, tt.from}, {q.To, tt.to}} {
+				if (c.got == nil) != c.want.IsZero() || (c.got != nil && !c.got.Equal(c.want)) {
+					t.Errorf("range bound = %v, want %v", c.got, c.want)
+				}
+			}
+			if q.Interval != tt.interval || q.InactiveDays != tt.inactive {
+				t.Errorf("interval %q, inactiveDays %d; want %q, %d", q.Interval, q.InactiveDays, tt.interval, tt.inactive)
+			}
+		})
+	}
+}
+
+func TestResolveInterval(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	ago := func(days int) *time.Time {
+		t := now.AddDate(0, 0, -days)
+		return &t
+	}
+	tests := []struct {
+		name    string
+		created time.Time
+		q       analyticsQuery
+		want    string
+	}{
+		{"explicit", *ago(1000), analyticsQuery{Interval: "day"}, "day"},
+		{"new course", *ago(30), analyticsQuery{}, "day"},
+		{"course of a year", *ago(365), analyticsQuery{}, "week"},
+		{"old course", *ago(1000), analyticsQuery{}, "month"},
+		{"short range of an old course", *ago(1000), analyticsQuery{From: ago(60)}, "day"},
+		{"range ending in the past", *ago(1000), analyticsQuery{To: ago(200)}, "month"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.resolveInterval(&models.Course{CreatedAt: tt.created}, now)
+			if q.Interval != tt.want {
+				t.Errorf("interval = %q, want %q", q.Interval, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreBucket(t *testing.T) {
+	tests := []struct {
+		share float64
+		want  int
+	}{{-0.5, 0}, {0, 0}, {0.09, 0}, {0.1, 1}, {0.55, 5}, {0.99, 9}, {1, 9}, {1.5, 9}}
+	for _, tt := range tests {
+		if got := scoreBucket(tt.share); got != tt.want {
+			t.Errorf("scoreBucket(%v) = %d, want %d", tt.share, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeLearners(t *testing.T) {
+	grade := func(g float64) *models.CourseCompletion { return &models.CourseCompletion{Grade: &g} }
+	learner := func(status string, c *models.CourseCompletion) analyticsLearner {
+		return analyticsLearner{Enrollment: models.Enrollment{Status: status}, Completion: c}
+	}
+	s := summarizeLearners([]analyticsLearner{
+		learner(models.EnrollmentStatusActive, nil),
+		learner(models.EnrollmentStatusCompleted, grade(0.8)),
+		learner(models.EnrollmentStatusCompleted, grade(0.6)),
+		learner(models.EnrollmentStatusCompleted, &models.CourseCompletion{}),
+	})
+	if s.Enrollments != 4 || s.Completions != 3 || s.CompletionRate != 0.75 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.ByStatus[models.EnrollmentStatusActive] != 1 || s.ByStatus[models.EnrollmentStatusCompleted] != 3 {
+		t.Errorf("byStatus = %v", s.ByStatus)
+	}
+	if s.AverageGrade == nil || *s.AverageGrade != 0.7 {
+		t.Errorf("averageGrade = %v, want 0.7", s.AverageGrade)
+	}
+
+	if empty := summarizeLearners(nil); empty.CompletionRate != 0 || empty.AverageGrade != nil {
+		t.Errorf("empty summary = %+v", empty)
+	}
+}
+
+func TestModuleFunnelAndDropOff(t *testing.T) {
+	intro, quiz, extra, final, groupOnly := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	group := primitive.NewObjectID()
+	course := &models.Course{Modules: []models.CourseModule{
+		{ID: primitive.NewObjectID(), Title: "Start", Items: []models.CourseItem{
+			{ID: intro, Title: "Intro"},
+			{ID: quiz, Title: "Quiz"},
+			{ID: extra, Title: "Extra", Optional: true},
+		}},
+		{ID: primitive.NewObjectID(), Title: "End", Items: []models.CourseItem{{ID: final, Title: "Final"}}},
+		{ID: primitive.NewObjectID(), Title: "Group", GroupIDs: []primitive.ObjectID{group}, Items: []models.CourseItem{{ID: groupOnly}}},
+	}}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	long, recent := now.AddDate(0, 0, -30), now.AddDate(0, 0, -1)
+	progress := func(status string, ids ...primitive.ObjectID) []models.Progress {
+		var out []models.Progress
+		for _, id := range ids {
+			out = append(out, models.Progress{ItemID: id, Status: status})
+		}
+		return out
+	}
+	learner := func(status string, lastSeen time.Time, groupID *primitive.ObjectID, p []models.Progress) analyticsLearner {
+		return analyticsLearner{
+			Enrollment: models.Enrollment{Status: status, EnrolledAt: long, LastAccessAt: &lastSeen, GroupID: groupID},
+			Progress:   p,
+		}
+	}
+	learners := []analyticsLearner{
+		// Finished the first module, active.
+		learner(models.EnrollmentStatusActive, recent, nil, progress("done", intro, quiz)),
+		// Only opened the optional item, then left.
+		learner(models.EnrollmentStatusActive, long, &group, progress("started", extra)),
+		// Withdrew after the intro.
+		learner(models.EnrollmentStatusWithdrawn, recent, nil, progress("done", intro)),
+		// Never started.
+		learner(models.EnrollmentStatusActive, long, nil, nil),
+		// Completed, so never a drop-off.
+		{Enrollment: models.Enrollment{Status: models.EnrollmentStatusCompleted, EnrolledAt: long},
+			Progress: progress("done", intro, quiz, final)},
+	}
+
+	type counts struct{ eligible, started, completed int }
+	var got []counts
+	for _, s := range moduleFunnel(course, learners) {
+		got = append(got, counts{s.Eligible, s.Started, s.Completed})
+	}
+	want := []counts{{5, 4, 2}, {5, 1, 1}, {1, 0, 0}}
+	if !slices.Equal(got, want) {
+		t.Errorf("funnel = %v, want %v", got, want)
+	}
+
+	d := dropOffPoints(course, learners, 14, now)
+	if d.Inactive != 3 || d.NotStarted != 1 {
+		t.Errorf("inactive %d, notStarted %d; want 3, 1", d.Inactive, d.NotStarted)
+	}
+	var points []string
+	for _, p := range d.Points {
+		points = append(points, p.Title)
+		if p.Students != 1 {
+			t.Errorf("%s: students = %d, want 1", p.Title, p.Students)
+		}
+	}
+	if !slices.Equal(points, []string{"Intro", "Quiz"}) {
+		t.Errorf("drop-off points = %v, want [Intro Quiz]", points)
+	}
+}
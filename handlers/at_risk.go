@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// Assessments older than riskRefreshInterval, or than the last change to
+// the course, are redone by the background job.
+const riskRefreshInterval = time.Hour
+
+// Risk factors and their weight in the score; the weights add up to 1.
+const (
+	riskInactive       = "inactive"
+	riskLowScores      = "low_scores"
+	riskFailedAttempts = "failed_attempts"
+	riskBehindSchedule = "behind_schedule"
+
+	riskInactiveWeight       = 0.4
+	riskLowScoresWeight      = 0.25
+	riskFailedAttemptsWeight = 0.2
+	riskBehindScheduleWeight = 0.15
+)
+
+// atRiskSettingsOf returns the thresholds in force for course.
+func atRiskSettingsOf(course *models.Course) models.AtRiskSettings {
+	s := models.AtRiskSettings{}
+	if course.AtRisk != nil {
+		s = *course.AtRisk
+	}
+	if s.InactiveDays == 0 {
+		s.InactiveDays = 7
+	}
+	if s.LowScore == 0 {
+		s.LowScore = 0.5
+	}
+	if s.FailedAttempts == 0 {
+		s.FailedAttempts = 3
+	}
+	if s.MinScore == 0 {
+		s.MinScore = 0.4
+	}
+	return s
+}
+
+// assessRisk scores an enrollment from its last activity, its scores and
+// attempts on the items the student can see, and, when the enrollment has
+// an end date, its required progress against the time elapsed.
+func assessRisk(course *models.Course, s models.AtRiskSettings, e models.Enrollment, progress []models.Progress, now time.Time) models.EnrollmentRisk {
+	risk := models.EnrollmentRisk{Factors: []models.RiskFactor{}, ComputedAt: now}
+	add := func(code string, weight, severity float64, detail string) {
+		if severity <= 0 {
+			return
+		}
+		w := math.Round(weight*min(severity, 1)*100) / 100
+		risk.Factors = append(risk.Factors, models.RiskFactor{Code: code, Weight: w, Detail: detail})
+		risk.Score += w
+	}
+
+	lastActive := e.EnrolledAt
+	if e.LastAccessAt != nil && e.LastAccessAt.After(lastActive) {
+		lastActive = *e.LastAccessAt
+	}
+	byItem := map[primitive.ObjectID]*models.Progress{}
+	for i := range progress {
+		p := &progress[i]
+		byItem[p.ItemID] = p
+		if p.UpdatedAt.After(lastActive) {
+			lastActive = p.UpdatedAt
+		}
+	}
+	if days := int(now.Sub(lastActive).Hours() / 24); days >= s.InactiveDays {
+		// Half the weight at the threshold, all of it at twice the threshold.
+		severity := 0.5 + 0.5*float64(days-s.InactiveDays)/float64(s.InactiveDays)
+		add(riskInactive, riskInactiveWeight, severity, fmt.Sprintf("no activity for %d days", days))
+	}
+
+	graded, low, failed := 0, 0, 0
+	for mi := range course.Modules {
+		module := &course.Modules[mi]
+		for ii := range module.Items {
+			item := &module.Items[ii]
+			p := byItem[item.ID]
+			if p == nil || !itemVisibleToGroup(module, item, e.GroupID) {
+				continue
+			}
+			if item.MaxScore > 0 && p.Status == "done" {
+				graded++
+				if p.Score/item.MaxScore < s.LowScore {
+					low++
+				}
+			}
+			if !itemPassed(item, p) && p.Attempts >= s.FailedAttempts {
+				failed++
+			}
+		}
+	}
+	if low > 0 {
+		add(riskLowScores, riskLowScoresWeight, float64(low)/float64(graded),
+			fmt.Sprintf("%d of %d graded items below %g%%", low, graded, s.LowScore*100))
+	}
+	if failed > 0 {
+		add(riskFailedAttempts, riskFailedAttemptsWeight, float64(failed)/2,
+			fmt.Sprintf("%d items attempted %d or more times without passing", failed, s.FailedAttempts))
+	}
+
+	if e.EndsAt != nil && e.EndsAt.After(e.EnrolledAt) {
+		status := evaluateCompletion(course, e.GroupID, progress)
+		if status.RequiredCount > 0 {
+			done := float64(status.RequiredDone) / float64(status.RequiredCount)
+			elapsed := min(max(float64(now.Sub(e.EnrolledAt))/float64(e.EndsAt.Sub(e.EnrolledAt)), 0), 1)
+			// A gap of a quarter of the course starts to count.
+			if gap := elapsed - done; gap >= 0.25 {
+				add(riskBehindSchedule, riskBehindScheduleWeight, gap*2,
+					fmt.Sprintf("%.0f%% of required items done with %.0f%% of the time elapsed", done*100, elapsed*100))
+			}
+		}
+	}
+
+	risk.Score = math.Round(min(risk.Score, 1)*100) / 100
+	return risk
+}
+
+// assessRisks refreshes the risk of active enrollments whose assessment is
+// missing or stale.
+func assessRisks(ctx context.Context, now time.Time) (int, error) {
+	enrollments := db.GetCollection("enrollments")
+	courseIDs, err := enrollments.Distinct(ctx, "courseId", bson.M{"status": models.EnrollmentStatusActive})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, raw := range courseIDs {
+		courseOID, ok := raw.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var course models.Course
+		if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}).Decode(&course); err != nil {
+			continue
+		}
+		settings := atRiskSettingsOf(&course)
+
+		stale := now.Add(-riskRefreshInterval)
+		if course.UpdatedAt.After(stale) {
+			stale = course.UpdatedAt
+		}
+		filter := bson.M{
+			"courseId": courseOID,
+			"status":   models.EnrollmentStatusActive,
+			"$or": []bson.M{
+				{"risk": bson.M{"$exists": false}},
+				{"risk.computedAt": bson.M{"$lt": stale}},
+			},
+		}
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(jobBatchSize)
+		for {
+			cursor, err := enrollments.Find(ctx, filter, opts)
+			if err != nil {
+				return count, err
+			}
+			var batch []models.Enrollment
+			if err := cursor.All(ctx, &batch); err != nil {
+				return count, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			userIDs := make([]primitive.ObjectID, 0, len(batch))
+			for _, e := range batch {
+				userIDs = append(userIDs, e.UserID)
+			}
+			progress, err := learnerProgress(ctx, courseOID, userIDs)
+			if err != nil {
+				return count, err
+			}
+			writes := make([]mongo.WriteModel, 0, len(batch))
+			for _, e := range batch {
+				risk := assessRisk(&course, settings, e, progress[e.UserID], now)
+				writes = append(writes, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": e.ID, "status": models.EnrollmentStatusActive}).
+					SetUpdate(bson.M{"$set": bson.M{"risk": risk}}))
+			}
+			if _, err := enrollments.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return count, err
+			}
+			count += len(batch)
+
+			if len(batch) < jobBatchSize {
+				break
+			}
+			filter["_id"] = bson.M{"$gt": batch[len(batch)-1].ID}
+		}
+	}
+	return count, nil
+}
+
+// atRiskSort lists the highest risk first.
+var atRiskSort = []sortField{{Path: "risk.score", Desc: true}, {Path: "_id", Desc: true}}
+
+type atRiskEntry struct {
+	EnrollmentID primitive.ObjectID    `json:"enrollmentId"`
+	UserID       primitive.ObjectID    `json:"userId"`
+	Username     string                `json:"username"`
+	GroupID      *primitive.ObjectID   `json:"groupId,omitempty"`
+	EnrolledAt   time.Time             `json:"enrolledAt"`
+	LastAccessAt *time.Time            `json:"lastAccessAt,omitempty"`
+	EndsAt       *time.Time            `json:"endsAt,omitempty"`
+	Risk         models.EnrollmentRisk `json:"risk"`
+}
+
+// GetCourseAtRisk lists the active students whose risk score reaches
+// minScore (by default the course's threshold), highest first. group
+// narrows to one group id (or "none").
+func GetCourseAtRisk(w http.ResponseWriter, r *http.Request) {
+	pg, err := parseListPage(r, "risk_desc", "minScore", "group")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	minScore := atRiskSettingsOf(course).MinScore
+	if v := strings.TrimSpace(query.Get("minScore")); v != "" {
+		minScore, err = strconv.ParseFloat(v, 64)
+		if err != nil || minScore < 0 || minScore > 1 {
+			writeError(w, http.StatusBadRequest, "minScore must be between 0 and 1")
+			return
+		}
+	}
+
+	filter := bson.M{
+		"courseId":   course.ID,
+		"status":     models.EnrollmentStatusActive,
+		"risk.score": bson.M{"$gte": minScore},
+	}
+	switch group := strings.TrimSpace(query.Get("group")); group {
+	case "":
+	case "none":
+		filter["groupId"] = nil
+	default:
+		groupOID, err := primitive.ObjectIDFromHex(group)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid group")
+			return
+		}
+		filter["groupId"] = groupOID
+	}
+
+	collection := db.GetCollection("enrollments")
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count enrollments")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(atRiskSort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(atRiskSort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	enrollments := []models.Enrollment{}
+	if err := cursor.All(ctx, &enrollments); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode enrollments")
+		return
+	}
+
+	fetched := len(enrollments)
+	if fetched > pg.Limit {
+		enrollments = enrollments[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(enrollments)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(enrollments))
+	for _, e := range enrollments {
+		ids = append(ids, e.UserID)
+	}
+	names, err := usernames(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	results := make([]atRiskEntry, 0, len(enrollments))
+	for _, e := range enrollments {
+		results = append(results, atRiskEntry{
+			EnrollmentID: e.ID,
+			UserID:       e.UserID,
+			Username:     names[e.UserID],
+			GroupID:      e.GroupID,
+			EnrolledAt:   e.EnrolledAt,
+			LastAccessAt: e.LastAccessAt,
+			EndsAt:       e.EndsAt,
+			Risk:         *e.Risk,
+		})
+	}
+
+	var first, last []interface{}
+	if len(enrollments) > 0 {
+		first = []interface{}{enrollments[0].Risk.Score, enrollments[0].ID}
+		last = []interface{}{enrollments[len(enrollments)-1].Risk.Score, enrollments[len(enrollments)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// GetAtRiskSettings returns the thresholds in force, defaults filled in.
+func GetAtRiskSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"settings": atRiskSettingsOf(course)})
+}
+
+func validateAtRiskSettings(s models.AtRiskSettings) error {
+	switch {
+	case s.InactiveDays < 0 || s.InactiveDays > 365:
+		return errorf("inactiveDays must be between 0 and 365")
+	case s.LowScore < 0 || s.LowScore > 1:
+		return errorf("lowScore must be between 0 and 1")
+	case s.FailedAttempts < 0 || s.FailedAttempts > 100:
+		return errorf("failedAttempts must be between 0 and 100")
+	case s.MinScore < 0 || s.MinScore > 1:
+		return errorf("minScore must be between 0 and 1")
+	}
+	return nil
+}
+
+// PutAtRiskSettings replaces the thresholds; zero fields go back to the
+// defaults. The job reassesses the course's students on its next run.
+func PutAtRiskSettings(w http.ResponseWriter, r *http.Request) {
+	var input models.AtRiskSettings
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if err := validateAtRiskSettings(input); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"atRisk": input, "updatedAt": time.Now()}}
+	if input == (models.AtRiskSettings{}) {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"atRisk": ""}}
+	}
+	updated := updateCourseVersioned(ctx, w, r, course.ID, primitive.NilObjectID, update)
+	if updated == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"settings": atRiskSettingsOf(updated)})
+}
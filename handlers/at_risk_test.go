@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestAtRiskSettingsOf(t *testing.T) {
+	defaults := models.AtRiskSettings{InactiveDays: 7, LowScore: 0.5, FailedAttempts: 3, MinScore: 0.4}
+	if got := atRiskSettingsOf(&models.Course{}); got != defaults {
+		t.Errorf("no settings = %+v, want %+v", got, defaults)
+	}
+	got := atRiskSettingsOf(&models.Course{AtRisk: &models.AtRiskSettings{InactiveDays: 3, MinScore: 0.2}})
+	want := models.AtRiskSettings{InactiveDays: 3, LowScore: 0.5, FailedAttempts: 3, MinScore: 0.2}
+	if got != want {
+		t.Errorf("partial settings = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateAtRiskSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       models.AtRiskSettings
+		wantErr string
+	}{
+		{"defaults", models.AtRiskSettings{}, ""},
+		{"valid", models.AtRiskSettings{InactiveDays: 365, LowScore: 1, FailedAttempts: 100, MinScore: 0.6}, ""},
+		{"inactive days", models.AtRiskSettings{InactiveDays: 366}, "inactiveDays must be between 0 and 365"},
+		{"low score", models.AtRiskSettings{LowScore: 1.5}, "lowScore must be between 0 and 1"},
+		{"failed attempts", models.AtRiskSettings{FailedAttempts: -1}, "failedAttempts must be between 0 and 100"},
+		{"min score", models.AtRiskSettings{MinScore: -0.1}, "minScore must be between 0 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAtRiskSettings(tt.s)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssessRisk(t *testing.T) {
+	quiz, test, page := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	course := &models.Course{Modules: []models.CourseModule{{Items: []models.CourseItem{
+		{ID: quiz, MaxScore: 10, PassScore: 6},
+		{ID: test, MaxScore: 10, PassScore: 6},
+		{ID: page},
+	}}}}
+	s := atRiskSettingsOf(course)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+	ptr := func(t time.Time) *time.Time { return &t }
+	done := func(id primitive.ObjectID, score float64) models.Progress {
+		return models.Progress{ItemID: id, Status: "done", Score: score, Attempts: 1, UpdatedAt: now}
+	}
+
+	tests := []struct {
+		name      string
+		e         models.Enrollment
+		progress  []models.Progress
+		wantCodes []string
+		wantScore float64
+	}{
+		{
+			name:      "new student",
+			e:         models.Enrollment{EnrolledAt: daysAgo(2)},
+			wantCodes: []string{},
+		},
+		{
+			name:      "inactive at the threshold",
+			e:         models.Enrollment{EnrolledAt: daysAgo(7)},
+			wantCodes: []string{riskInactive},
+			wantScore: 0.2,
+		},
+		{
+			name:      "inactive for twice the threshold",
+			e:         models.Enrollment{EnrolledAt: daysAgo(60), LastAccessAt: ptr(daysAgo(14))},
+			wantCodes: []string{riskInactive},
+			wantScore: 0.4,
+		},
+		{
+			name:      "recent progress counts as activity",
+			e:         models.Enrollment{EnrolledAt: daysAgo(60)},
+			progress:  []models.Progress{done(quiz, 8), done(test, 9)},
+			wantCodes: []string{},
+		},
+		{
+			name:      "half the graded items scored low",
+			e:         models.Enrollment{EnrolledAt: daysAgo(2)},
+			progress:  []models.Progress{done(quiz, 2), done(test, 8)},
+			wantCodes: []string{riskLowScores},
+			wantScore: 0.13,
+		},
+		{
+			name:      "repeated failed attempts",
+			e:         models.Enrollment{EnrolledAt: daysAgo(2)},
+			progress:  []models.Progress{{ItemID: quiz, Status: "started", Attempts: 3, UpdatedAt: now}},
+			wantCodes: []string{riskFailedAttempts},
+			wantScore: 0.1,
+		},
+		{
+			name:      "behind schedule",
+			e:         models.Enrollment{EnrolledAt: daysAgo(10), LastAccessAt: ptr(now), EndsAt: ptr(now.AddDate(0, 0, 10))},
+			wantCodes: []string{riskBehindSchedule},
+			wantScore: 0.15,
+		},
+		{
+			name:      "on schedule",
+			e:         models.Enrollment{EnrolledAt: daysAgo(10), EndsAt: ptr(now.AddDate(0, 0, 10))},
+			progress:  []models.Progress{done(quiz, 8), done(page, 0)},
+			wantCodes: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk := assessRisk(course, s, tt.e, tt.progress, now)
+			codes := []string{}
+			for _, f := range risk.Factors {
+				codes = append(codes, f.Code)
+			}
+			if !slices.Equal(codes, tt.wantCodes) {
+				t.Errorf("factors = %v, want %v", codes, tt.wantCodes)
+			}
+			if risk.Score != tt.wantScore {
+				t.Errorf("score = %v, want %v", risk.Score, tt.wantScore)
+			}
+			if !risk.ComputedAt.Equal(now) {
+				t.Errorf("computedAt = %v, want %v", risk.ComputedAt, now)
+			}
+		})
+	}
+}
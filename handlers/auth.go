@@ -31,6 +31,8 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
 	user.Password = string(hash)
+	// Роли выдаются только вручную в базе, не при регистрации
+	user.Role = ""
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -63,14 +65,18 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Устанавливаем Cookie для авторизации
+	setSessionCookie(w, dbUser.Username)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+}
+
+func setSessionCookie(w http.ResponseWriter, username string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
-		Value:    dbUser.Username,
+		Value:    username,
 		Expires:  time.Now().Add(24 * time.Hour),
 		HttpOnly: true,
 		Path:     "/",
 	})
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
 }
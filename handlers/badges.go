@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/badge"
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const maxStreakDays = 365
+
+// recordActivity stamps lastAccessAt and extends the student's streak: a
+// first update on the day after ActiveDay adds a day, a gap restarts it.
+// It runs before saveProgress on the student's own updates, so grading
+// does not count as activity.
+func recordActivity(ctx context.Context, userID, courseOID primitive.ObjectID) {
+	now := time.Now()
+	today := now.UTC().Format("2006-01-02")
+	yesterday := now.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"streakDays": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{"$activeDay", today}}, "then": "$streakDays"},
+					bson.M{"case": bson.M{"$eq": bson.A{"$activeDay", yesterday}}, "then": bson.M{"$add": bson.A{"$streakDays", 1}}},
+				},
+				"default": 1,
+			}},
+			"activeDay":    today,
+			"lastAccessAt": now,
+		}}},
+		{{Key: "$set", Value: bson.M{"longestStreak": bson.M{"$max": bson.A{"$longestStreak", "$streakDays"}}}}},
+	}
+	_, err := db.GetCollection("enrollments").UpdateOne(ctx, bson.M{
+		"userId":   userID,
+		"courseId": courseOID,
+		"status":   bson.M{"$ne": models.EnrollmentStatusPending},
+	}, update)
+	if err != nil {
+		log.Printf("badges: recording activity of %s: %v", userID.Hex(), err)
+	}
+}
+
+// checkBadges awards the course's badges whose criteria the student meets
+// and has not been awarded yet.
+func checkBadges(ctx context.Context, userID, courseOID primitive.ObjectID) error {
+	cursor, err := db.GetCollection("badge_classes").Find(ctx, bson.M{"courseId": courseOID})
+	if err != nil {
+		return err
+	}
+	var classes []models.BadgeClass
+	if err := cursor.All(ctx, &classes); err != nil {
+		return err
+	}
+	earned, err := db.GetCollection("badge_awards").Distinct(ctx, "badgeId", bson.M{"userId": userID, "courseId": courseOID})
+	if err != nil {
+		return err
+	}
+	classes = slices.DeleteFunc(classes, func(b models.BadgeClass) bool {
+		return slices.Contains(earned, interface{}(b.ID))
+	})
+	if len(classes) == 0 {
+		return nil
+	}
+
+	var enrollment models.Enrollment
+	err = db.GetCollection("enrollments").FindOne(ctx, bson.M{"userId": userID, "courseId": courseOID}).Decode(&enrollment)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var course models.Course
+	err = db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}).Decode(&course)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	progress, err := learnerProgress(ctx, courseOID, []primitive.ObjectID{userID})
+	if err != nil {
+		return err
+	}
+	completed, err := db.GetCollection("course_completions").CountDocuments(ctx, bson.M{"userId": userID, "courseId": courseOID})
+	if err != nil {
+		return err
+	}
+
+	for i := range classes {
+		b := &classes[i]
+		var met bool
+		switch b.Criteria.Type {
+		case models.BadgeCriterionCompletion:
+			met = completed > 0
+		case models.BadgeCriterionPerfectScore:
+			met = hasPerfectScore(&course, b.Criteria.ItemID, progress[userID])
+		case models.BadgeCriterionStreak:
+			met = enrollment.LongestStreak >= b.Criteria.Days
+		}
+		if !met {
+			continue
+		}
+		if err := awardBadge(ctx, b, &course, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasPerfectScore reports whether the student reached the full maxScore
+// in itemID, or in any quiz when itemID is nil.
+func hasPerfectScore(course *models.Course, itemID *primitive.ObjectID, progress []models.Progress) bool {
+	for _, p := range progress {
+		if itemID != nil && p.ItemID != *itemID {
+			continue
+		}
+		_, item := findItem(course, p.ItemID)
+		if item == nil || (itemID == nil && item.Type != models.ItemTypeQuiz) {
+			continue
+		}
+		if item.MaxScore > 0 && p.Score >= item.MaxScore {
+			return true
+		}
+	}
+	return false
+}
+
+func awardBadge(ctx context.Context, b *models.BadgeClass, course *models.Course, userID primitive.ObjectID) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	award := models.BadgeAward{
+		ID:       primitive.NewObjectID(),
+		BadgeID:  b.ID,
+		CourseID: course.ID,
+		UserID:   userID,
+		Salt:     hex.EncodeToString(salt),
+		IssuedAt: time.Now(),
+	}
+	if _, err := db.GetCollection("badge_awards").InsertOne(ctx, award); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+	if err := notify(ctx, userID, models.NotificationBadgeAwarded, &course.ID,
+		"You earned the \""+b.Name+"\" badge in \""+course.Title+"\"."); err != nil {
+		log.Printf("badges: failed to notify %s: %v", userID.Hex(), err)
+	}
+	return nil
+}
+
+type badgeCriteriaInput struct {
+	Type   string `json:"type"`
+	ItemID string `json:"itemId"`
+	Days   int    `json:"days"`
+}
+
+// criteria validates the input against the course.
+func (in badgeCriteriaInput) criteria(course *models.Course) (models.BadgeCriteria, string) {
+	c := models.BadgeCriteria{Type: strings.TrimSpace(in.Type)}
+	switch c.Type {
+	case models.BadgeCriterionCompletion:
+	case models.BadgeCriterionPerfectScore:
+		if s := strings.TrimSpace(in.ItemID); s != "" {
+			oid, err := primitive.ObjectIDFromHex(s)
+			if err != nil {
+				return c, "invalid criteria.itemId"
+			}
+			_, item := findItem(course, oid)
+			if item == nil {
+				return c, "unknown item in criteria.itemId"
+			}
+			if item.MaxScore <= 0 {
+				return c, "criteria.itemId must be a graded item"
+			}
+			c.ItemID = &oid
+		}
+	case models.BadgeCriterionStreak:
+		if in.Days < 2 || in.Days > maxStreakDays {
+			return c, "criteria.days must be between 2 and 365"
+		}
+		c.Days = in.Days
+	default:
+		return c, "criteria.type must be completion, perfect_score or streak"
+	}
+	return c, ""
+}
+
+func validateBadgeText(name, description string) string {
+	if name == "" {
+		return "name is required"
+	}
+	if utf8.RuneCountInString(name) > 80 {
+		return "name is limited to 80 characters"
+	}
+	if utf8.RuneCountInString(description) > 500 {
+		return "description is limited to 500 characters"
+	}
+	return ""
+}
+
+type badgeInput struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Color       string             `json:"color"`
+	Criteria    badgeCriteriaInput `json:"criteria"`
+}
+
+// GetCourseBadges lists the badges a course awards.
+func GetCourseBadges(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := db.GetCollection("badge_classes").Find(ctx, bson.M{"courseId": oid}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch badges")
+		return
+	}
+	badges := []models.BadgeClass{}
+	if err := cursor.All(ctx, &badges); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode badges")
+		return
+	}
+	writeJSON(w, http.StatusOK, badges)
+}
+
+// CreateCourseBadge adds a badge class to the course.
+func CreateCourseBadge(w http.ResponseWriter, r *http.Request) {
+	var input badgeInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Description = strings.TrimSpace(input.Description)
+	if msg := validateBadgeText(input.Name, input.Description); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	input.Color = strings.TrimSpace(input.Color)
+	if input.Color == "" {
+		input.Color = badge.DefaultColor
+	}
+	if _, ok := badge.ParseColor(input.Color); !ok {
+		writeError(w, http.StatusBadRequest, "color must look like #rrggbb")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, userID := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+	criteria, msg := input.Criteria.criteria(course)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	now := time.Now()
+	b := models.BadgeClass{
+		ID:          primitive.NewObjectID(),
+		CourseID:    course.ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Color:       strings.ToLower(input.Color),
+		Criteria:    criteria,
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := db.GetCollection("badge_classes").InsertOne(ctx, b); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create badge")
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+type badgePatchInput struct {
+	Name        *string             `json:"name"`
+	Description *string             `json:"description"`
+	Color       *string             `json:"color"`
+	Criteria    *badgeCriteriaInput `json:"criteria"`
+}
+
+// PatchCourseBadge edits a badge class. Badges already awarded are kept.
+func PatchCourseBadge(w http.ResponseWriter, r *http.Request) {
+	var input badgePatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	badgeOID, err := primitive.ObjectIDFromHex(r.PathValue("badgeId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid badge id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+
+	var b models.BadgeClass
+	collection := db.GetCollection("badge_classes")
+	if err := collection.FindOne(ctx, bson.M{"_id": badgeOID, "courseId": course.ID}).Decode(&b); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "badge not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch badge")
+		return
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	if input.Name != nil {
+		b.Name = strings.TrimSpace(*input.Name)
+		set["name"] = b.Name
+	}
+	if input.Description != nil {
+		b.Description = strings.TrimSpace(*input.Description)
+		set["description"] = b.Description
+	}
+	if msg := validateBadgeText(b.Name, b.Description); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if input.Color != nil {
+		c := strings.ToLower(strings.TrimSpace(*input.Color))
+		if _, ok := badge.ParseColor(c); !ok {
+			writeError(w, http.StatusBadRequest, "color must look like #rrggbb")
+			return
+		}
+		set["color"] = c
+	}
+	if input.Criteria != nil {
+		criteria, msg := input.Criteria.criteria(course)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		set["criteria"] = criteria
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": badgeOID}, bson.M{"$set": set}, opts).Decode(&b); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "badge not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update badge")
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+// DeleteCourseBadge removes a badge class and revokes its awards, so
+// their hosted assertions report them as revoked.
+func DeleteCourseBadge(w http.ResponseWriter, r *http.Request) {
+	badgeOID, err := primitive.ObjectIDFromHex(r.PathValue("badgeId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid badge id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+
+	res, err := db.GetCollection("badge_classes").DeleteOne(ctx, bson.M{"_id": badgeOID, "courseId": course.ID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete badge")
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeError(w, http.StatusNotFound, "badge not found")
+		return
+	}
+	if err := revokeBadgeAwards(ctx, bson.M{"badgeId": badgeOID}, "badge class deleted"); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke awards")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func revokeBadgeAwards(ctx context.Context, filter bson.M, reason string) error {
+	filter["revokedAt"] = bson.M{"$exists": false}
+	_, err := db.GetCollection("badge_awards").UpdateMany(ctx, filter,
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "revocationReason": reason}})
+	return err
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func badgeTestCourse() (course *models.Course, quiz, task, page primitive.ObjectID) {
+	quiz, task, page = primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	course = &models.Course{Modules: []models.CourseModule{{Items: []models.CourseItem{
+		{ID: quiz, Type: models.ItemTypeQuiz, MaxScore: 10},
+		{ID: task, MaxScore: 5},
+		{ID: page},
+	}}}}
+	return course, quiz, task, page
+}
+
+func TestHasPerfectScore(t *testing.T) {
+	course, quiz, task, page := badgeTestCourse()
+	tests := []struct {
+		name     string
+		item     *primitive.ObjectID
+		progress []models.Progress
+		want     bool
+	}{
+		{"any quiz, full score", nil, []models.Progress{{ItemID: quiz, Score: 10}}, true},
+		{"any quiz, partial score", nil, []models.Progress{{ItemID: quiz, Score: 9}}, false},
+		{"any quiz ignores other items", nil, []models.Progress{{ItemID: task, Score: 5}}, false},
+		{"given item", &task, []models.Progress{{ItemID: quiz, Score: 10}, {ItemID: task, Score: 5}}, true},
+		{"given item, other item perfect", &task, []models.Progress{{ItemID: quiz, Score: 10}}, false},
+		{"ungraded item", &page, []models.Progress{{ItemID: page, Score: 0}}, false},
+		{"removed item", nil, []models.Progress{{ItemID: primitive.NewObjectID(), Score: 10}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasPerfectScore(course, tt.item, tt.progress); got != tt.want {
+				t.Errorf("hasPerfectScore = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadgeCriteria(t *testing.T) {
+	course, quiz, _, page := badgeTestCourse()
+	tests := []struct {
+		name    string
+		in      badgeCriteriaInput
+		want    models.BadgeCriteria
+		wantErr string
+	}{
+		{"completion", badgeCriteriaInput{Type: " completion "}, models.BadgeCriteria{Type: models.BadgeCriterionCompletion}, ""},
+		{"perfect score in any quiz", badgeCriteriaInput{Type: "perfect_score"}, models.BadgeCriteria{Type: models.BadgeCriterionPerfectScore}, ""},
+		{"perfect score in an item", badgeCriteriaInput{Type: "perfect_score", ItemID: quiz.Hex()}, models.BadgeCriteria{Type: models.BadgeCriterionPerfectScore, ItemID: &quiz}, ""},
+		{"invalid item id", badgeCriteriaInput{Type: "perfect_score", ItemID: "x"}, models.BadgeCriteria{}, "invalid criteria.itemId"},
+		{"unknown item", badgeCriteriaInput{Type: "perfect_score", ItemID: primitive.NewObjectID().Hex()}, models.BadgeCriteria{}, "unknown item in criteria.itemId"},
+		{"ungraded item", badgeCriteriaInput{Type: "perfect_score", ItemID: page.Hex()}, models.BadgeCriteria{}, "criteria.itemId must be a graded item"},
+		{"streak", badgeCriteriaInput{Type: "streak", Days: 7}, models.BadgeCriteria{Type: models.BadgeCriterionStreak, Days: 7}, ""},
+		{"streak too short", badgeCriteriaInput{Type: "streak", Days: 1}, models.BadgeCriteria{}, "criteria.days must be between 2 and 365"},
+		{"streak too long", badgeCriteriaInput{Type: "streak", Days: maxStreakDays + 1}, models.BadgeCriteria{}, "criteria.days must be between 2 and 365"},
+		{"unknown type", badgeCriteriaInput{Type: "login"}, models.BadgeCriteria{}, "criteria.type must be completion, perfect_score or streak"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, msg := tt.in.criteria(course)
+			if msg != tt.wantErr {
+				t.Fatalf("criteria error = %q, want %q", msg, tt.wantErr)
+			}
+			if msg != "" {
+				return
+			}
+			if got.Type != tt.want.Type || got.Days != tt.want.Days || (got.ItemID == nil) != (tt.want.ItemID == nil) ||
+				(got.ItemID != nil && *got.ItemID != *tt.want.ItemID) {
+				t.Errorf("criteria = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBadgeText(t *testing.T) {
+	tests := []struct {
+		name, badge, description, want string
+	}{
+		{"ok", "Отличник", "За идеальный тест", ""},
+		{"no name", "", "", "name is required"},
+		{"80 letters", strings.Repeat("я", 80), "", ""},
+		{"long name", strings.Repeat("я", 81), "", "name is limited to 80 characters"},
+		{"long description", "Badge", strings.Repeat("я", 501), "description is limited to 500 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateBadgeText(tt.badge, tt.description); got != tt.want {
+				t.Errorf("validateBadgeText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
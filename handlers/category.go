@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+type categoryCreateInput struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug,omitempty"`
+	ParentID string `json:"parentId,omitempty"`
+	Order    int    `json:"order"`
+}
+
+// categoryPatchInput moves a category to the root with "parentId": "".
+type categoryPatchInput struct {
+	Name     *string `json:"name"`
+	Slug     *string `json:"slug"`
+	ParentID *string `json:"parentId"`
+	Order    *int    `json:"order"`
+}
+
+// categoryNode is a category in the GET /categories tree. CourseCount is
+// the category's own courses, TotalCount includes all descendants.
+type categoryNode struct {
+	models.Category
+	CourseCount int64           `json:"courseCount"`
+	TotalCount  int64           `json:"totalCount"`
+	Children    []*categoryNode `json:"children"`
+}
+
+// slugify lowercases and joins runs of letters and digits with dashes.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+func loadCategory(ctx context.Context, w http.ResponseWriter, oid primitive.ObjectID) *models.Category {
+	var category models.Category
+	err := db.GetCollection("categories").FindOne(ctx, bson.M{"_id": oid}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "category not found")
+		return nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch category")
+		return nil
+	}
+	return &category
+}
+
+// resolveCategory checks a course's category against the taxonomy and
+// returns the slug to store.
+func resolveCategory(ctx context.Context, value string) (string, error) {
+	slug := strings.ToLower(strings.TrimSpace(value))
+	if slug == "" {
+		return "", errorf("category is required")
+	}
+	n, err := db.GetCollection("categories").CountDocuments(ctx, bson.M{"slug": slug})
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", errorf("unknown category")
+	}
+	return slug, nil
+}
+
+// checkCategory is resolveCategory for handlers: it writes 400 for an
+// unknown category and 500 on database errors.
+func checkCategory(ctx context.Context, w http.ResponseWriter, value string) (string, bool) {
+	slug, err := resolveCategory(ctx, value)
+	if err != nil {
+		if _, ok := err.(*simpleError); ok {
+			writeError(w, http.StatusBadRequest, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, "failed to check category")
+		}
+		return "", false
+	}
+	return slug, true
+}
+
+// categoryFilterClause matches courses in the category with the given slug
+// or any of its descendants. Values outside the taxonomy still match
+// exactly, so courses with a legacy free-form category stay reachable.
+func categoryFilterClause(ctx context.Context, value string) (bson.M, error) {
+	collection := db.GetCollection("categories")
+
+	var category models.Category
+	err := collection.FindOne(ctx, bson.M{"slug": strings.ToLower(value)}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		return bson.M{"category": value}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"ancestors": category.ID}, options.Find().SetProjection(bson.M{"slug": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var descendants []models.Category
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return nil, err
+	}
+
+	slugs := []string{category.Slug}
+	for _, d := range descendants {
+		slugs = append(slugs, d.Slug)
+	}
+	return bson.M{"category": bson.M{"$in": slugs}}, nil
+}
+
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := db.GetCollection("categories").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch categories")
+		return
+	}
+	categories := []models.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode categories")
+		return
+	}
+
+	counts, err := courseCountsByCategory(ctx, viewerIDFromRequest(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count courses")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildCategoryTree(categories, counts))
+}
+
+// courseCountsByCategory counts the courses the viewer can see per slug.
+func courseCountsByCategory(ctx context.Context, viewerID primitive.ObjectID) (map[string]int64, error) {
+	cursor, err := db.GetCollection("courses").Aggregate(ctx, []bson.M{
+		{"$match": courseVisibilityFilter(viewerID)},
+		{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Category string `bson:"_id"`
+		Count    int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.Category] = row.Count
+	}
+	return counts, nil
+}
+
+// buildCategoryTree nests categories (already in display order) under their
+// parents and sums course counts up the tree.
+func buildCategoryTree(categories []models.Category, counts map[string]int64) []*categoryNode {
+	nodes := make(map[primitive.ObjectID]*categoryNode, len(categories))
+	for _, c := range categories {
+		nodes[c.ID] = &categoryNode{Category: c, CourseCount: counts[c.Slug], Children: []*categoryNode{}}
+	}
+
+	roots := []*categoryNode{}
+	for _, c := range categories {
+		node := nodes[c.ID]
+		if c.ParentID != nil {
+			if parent, ok := nodes[*c.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	var total func(n *categoryNode) int64
+	total = func(n *categoryNode) int64 {
+		n.TotalCount = n.CourseCount
+		for _, child := range n.Children {
+			n.TotalCount += total(child)
+		}
+		return n.TotalCount
+	}
+	for _, root := range roots {
+		total(root)
+	}
+	return roots
+}
+
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	var input categoryCreateInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	slug := slugify(input.Slug)
+	if strings.TrimSpace(input.Slug) == "" {
+		slug = slugify(input.Name)
+	} else if slug != input.Slug {
+		writeError(w, http.StatusBadRequest, "slug must be lowercase letters and digits separated by dashes")
+		return
+	}
+	if slug == "" {
+		writeError(w, http.StatusBadRequest, "name must contain letters or digits")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	category := models.Category{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		Slug:      slug,
+		Ancestors: []primitive.ObjectID{},
+		Order:     input.Order,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if input.ParentID != "" {
+		parentOID, err := primitive.ObjectIDFromHex(input.ParentID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid parentId")
+			return
+		}
+		var parent models.Category
+		if err := db.GetCollection("categories").FindOne(ctx, bson.M{"_id": parentOID}).Decode(&parent); err != nil {
+			writeError(w, http.StatusBadRequest, "parent category not found")
+			return
+		}
+		category.ParentID = &parent.ID
+		category.Ancestors = append(append([]primitive.ObjectID{}, parent.Ancestors...), parent.ID)
+	}
+
+	if _, err := db.GetCollection("categories").InsertOne(ctx, category); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "slug already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create category")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, category)
+}
+
+func PatchCategory(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	var input categoryPatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	category := loadCategory(ctx, w, oid)
+	if category == nil {
+		return
+	}
+
+	setFields := bson.M{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			writeError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		setFields["name"] = name
+	}
+	if input.Slug != nil {
+		if *input.Slug == "" || slugify(*input.Slug) != *input.Slug {
+			writeError(w, http.StatusBadRequest, "slug must be lowercase letters and digits separated by dashes")
+			return
+		}
+		setFields["slug"] = *input.Slug
+	}
+	if input.Order != nil {
+		setFields["order"] = *input.Order
+	}
+
+	var ancestors []primitive.ObjectID
+	if input.ParentID != nil {
+		ancestors = []primitive.ObjectID{}
+		if *input.ParentID == "" {
+			setFields["parentId"] = nil
+		} else {
+			parentOID, err := primitive.ObjectIDFromHex(*input.ParentID)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid parentId")
+				return
+			}
+			var parent models.Category
+			if err := db.GetCollection("categories").FindOne(ctx, bson.M{"_id": parentOID}).Decode(&parent); err != nil {
+				writeError(w, http.StatusBadRequest, "parent category not found")
+				return
+			}
+			if createsCategoryCycle(oid, &parent) {
+				writeError(w, http.StatusBadRequest, "category cannot be moved under itself")
+				return
+			}
+			setFields["parentId"] = parent.ID
+			ancestors = append(append(ancestors, parent.Ancestors...), parent.ID)
+		}
+		setFields["ancestors"] = ancestors
+	}
+
+	if len(setFields) == 0 {
+		writeError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+	setFields["updatedAt"] = time.Now()
+
+	collection := db.GetCollection("categories")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": setFields}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "slug already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update category")
+		return
+	}
+
+	if ancestors != nil {
+		if err := moveCategoryDescendants(ctx, oid, ancestors); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to move subcategories")
+			return
+		}
+	}
+	if slug, ok := setFields["slug"].(string); ok && slug != category.Slug {
+		_, err := db.GetCollection("courses").UpdateMany(ctx,
+			bson.M{"category": category.Slug},
+			bson.M{"$set": bson.M{"category": slug}})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update courses")
+			return
+		}
+	}
+
+	updated := loadCategory(ctx, w, oid)
+	if updated == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// moveCategoryDescendants rewrites the ancestor chains below a category
+// that now sits under newAncestors.
+func moveCategoryDescendants(ctx context.Context, oid primitive.ObjectID, newAncestors []primitive.ObjectID) error {
+	collection := db.GetCollection("categories")
+	cursor, err := collection.Find(ctx, bson.M{"ancestors": oid})
+	if err != nil {
+		return err
+	}
+	var descendants []models.Category
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return err
+	}
+
+	for _, d := range descendants {
+		i := 0
+		for i < len(d.Ancestors) && d.Ancestors[i] != oid {
+			i++
+		}
+		chain := append(append([]primitive.ObjectID{}, newAncestors...), d.Ancestors[i:]...)
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": bson.M{"ancestors": chain}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createsCategoryCycle reports whether moving the category under parent
+// would make it its own ancestor.
+func createsCategoryCycle(oid primitive.ObjectID, parent *models.Category) bool {
+	return parent.ID == oid || containsOID(parent.Ancestors, oid)
+}
+
+func containsOID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteCategory removes an empty leaf; categories with subcategories or
+// courses are refused with 409.
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	category := loadCategory(ctx, w, oid)
+	if category == nil {
+		return
+	}
+
+	children, err := db.GetCollection("categories").CountDocuments(ctx, bson.M{"parentId": oid})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check subcategories")
+		return
+	}
+	if children > 0 {
+		writeError(w, http.StatusConflict, "category has subcategories")
+		return
+	}
+	courses, err := db.GetCollection("courses").CountDocuments(ctx, bson.M{"category": category.Slug})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check courses")
+		return
+	}
+	if courses > 0 {
+		writeError(w, http.StatusConflict, "category has courses")
+		return
+	}
+
+	if _, err := db.GetCollection("categories").DeleteOne(ctx, bson.M{"_id": oid}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Computer Science", "computer-science"},
+		{"  C++ & Go!  ", "c-go"},
+		{"Data--Science 101", "data-science-101"},
+		{"Программирование", "программирование"},
+		{"---", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := slugify(tt.in); got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatesCategoryCycle(t *testing.T) {
+	root, child, grandchild, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name   string
+		moved  primitive.ObjectID
+		parent models.Category
+		want   bool
+	}{
+		{"under itself", child, models.Category{ID: child, Ancestors: []primitive.ObjectID{root}}, true},
+		{"under its child", root, models.Category{ID: child, Ancestors: []primitive.ObjectID{root}}, true},
+		{"under its grandchild", root, models.Category{ID: grandchild, Ancestors: []primitive.ObjectID{root, child}}, true},
+		{"under a sibling tree", child, models.Category{ID: other, Ancestors: []primitive.ObjectID{}}, false},
+		{"under its own parent", grandchild, models.Category{ID: child, Ancestors: []primitive.ObjectID{root}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createsCategoryCycle(tt.moved, &tt.parent); got != tt.want {
+				t.Errorf("createsCategoryCycle = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	root, child, orphan := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	missing := primitive.NewObjectID()
+	categories := []models.Category{
+		{ID: root, Slug: "cs"},
+		{ID: child, Slug: "go", ParentID: &root},
+		{ID: orphan, Slug: "lost", ParentID: &missing},
+	}
+	tree := buildCategoryTree(categories, map[string]int64{"cs": 2, "go": 3, "lost": 1})
+
+	if len(tree) != 2 || tree[0].ID != root || tree[1].ID != orphan {
+		t.Fatalf("roots = %+v", tree)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].ID != child {
+		t.Fatalf("children = %+v", tree[0].Children)
+	}
+	if tree[0].CourseCount != 2 || tree[0].TotalCount != 5 || tree[0].Children[0].TotalCount != 3 {
+		t.Errorf("counts = %d/%d, child %d", tree[0].CourseCount, tree[0].TotalCount, tree[0].Children[0].TotalCount)
+	}
+	if tree[1].TotalCount != 1 {
+		t.Errorf("orphan total = %d", tree[1].TotalCount)
+	}
+}
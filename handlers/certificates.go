@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/certificate"
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// certificateSigLen truncates the code's MAC to keep the QR code small.
+const certificateSigLen = 12
+
+// certificateCode is the public verification code: the certificate id and
+// its MAC, in the usual token format.
+func certificateCode(id primitive.ObjectID) string {
+	sig := signPayload("certificate", id[:])[:certificateSigLen]
+	return base64.RawURLEncoding.EncodeToString(id[:]) + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func decodeCertificateCode(code string) (primitive.ObjectID, bool) {
+	var id primitive.ObjectID
+	payloadPart, sigPart, ok := strings.Cut(code, ".")
+	if !ok {
+		return id, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil || len(payload) != len(id) {
+		return id, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, signPayload("certificate", payload)[:certificateSigLen]) {
+		return id, false
+	}
+	copy(id[:], payload)
+	return id, true
+}
+
+func certificateVerifyURL(r *http.Request, code string) string {
+	return appBaseURL(r) + "/certificates/" + code + "/verify"
+}
+
+// issueCertificate issues the user's certificate for a completed course
+// with a certificate template. It is a no-op when one exists already.
+func issueCertificate(ctx context.Context, course *models.Course, userID primitive.ObjectID) error {
+	if course.Certificate == nil {
+		return nil
+	}
+	var completion models.CourseCompletion
+	err := db.GetCollection("course_completions").FindOne(ctx, bson.M{"userId": userID, "courseId": course.ID}).Decode(&completion)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names, err := usernames(ctx, []primitive.ObjectID{userID})
+	if err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	cert := models.Certificate{
+		ID:           id,
+		Code:         certificateCode(id),
+		UserID:       userID,
+		CourseID:     course.ID,
+		CompletionID: completion.ID,
+		StudentName:  names[userID],
+		CourseTitle:  course.Title,
+		Grade:        completion.Grade,
+		Template:     *course.Certificate,
+		CompletedAt:  completion.CompletedAt,
+		IssuedAt:     time.Now(),
+	}
+	if _, err := db.GetCollection("certificates").InsertOne(ctx, cert); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// issueMissingCertificates issues certificates for the user's completions
+// that predate their course's certificate template.
+func issueMissingCertificates(ctx context.Context, userID primitive.ObjectID) error {
+	courseIDs, err := db.GetCollection("course_completions").Distinct(ctx, "courseId", bson.M{"userId": userID})
+	if err != nil || len(courseIDs) == 0 {
+		return err
+	}
+	issued, err := db.GetCollection("certificates").Distinct(ctx, "courseId", bson.M{"userId": userID})
+	if err != nil {
+		return err
+	}
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{
+		"_id":         bson.M{"$in": courseIDs, "$nin": issued},
+		"certificate": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return err
+	}
+	for i := range courses {
+		if err := issueCertificate(ctx, &courses[i], userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func certificateData(r *http.Request, cert *models.Certificate) certificate.Data {
+	return certificate.Data{
+		Title:       cert.Template.Title,
+		Body:        cert.Template.Body,
+		Signer:      cert.Template.Signer,
+		SignerTitle: cert.Template.SignerTitle,
+		StudentName: cert.StudentName,
+		CourseTitle: cert.CourseTitle,
+		CompletedAt: cert.CompletedAt,
+		Grade:       cert.Grade,
+		Code:        cert.Code,
+		VerifyURL:   certificateVerifyURL(r, cert.Code),
+	}
+}
+
+func writeCertificatePDF(w http.ResponseWriter, r *http.Request, cert *models.Certificate) {
+	pdf, err := certificate.Render(certificateData(r, cert))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to render certificate")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="certificate-`+cert.ID.Hex()+`.pdf"`)
+	w.Write(pdf)
+}
+
+// GetCertificateTemplate returns the course's certificate template.
+func GetCertificateTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+	if course.Certificate == nil {
+		writeError(w, http.StatusNotFound, "certificate template not set")
+		return
+	}
+	writeJSON(w, http.StatusOK, course.Certificate)
+}
+
+// normalizeCertificateTemplate trims the template's fields and checks their
+// lengths.
+func normalizeCertificateTemplate(t *models.CertificateTemplate) error {
+	t.Title = strings.TrimSpace(t.Title)
+	t.Body = strings.TrimSpace(t.Body)
+	t.Signer = strings.TrimSpace(t.Signer)
+	t.SignerTitle = strings.TrimSpace(t.SignerTitle)
+	if utf8.RuneCountInString(t.Title) > 80 || utf8.RuneCountInString(t.Signer) > 80 ||
+		utf8.RuneCountInString(t.SignerTitle) > 80 {
+		return errorf("title, signer and signerTitle are limited to 80 characters")
+	}
+	if utf8.RuneCountInString(t.Body) > 500 {
+		return errorf("body is limited to 500 characters")
+	}
+	return nil
+}
+
+// PutCertificateTemplate sets the certificate template. Certificates
+// already issued keep the template they were issued with.
+func PutCertificateTemplate(w http.ResponseWriter, r *http.Request) {
+	var input models.CertificateTemplate
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if err := normalizeCertificateTemplate(&input); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"certificate": input, "updatedAt": time.Now()}}
+	updated := updateCourseVersioned(ctx, w, r, course.ID, primitive.NilObjectID, update)
+	if updated == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, updated.Certificate)
+}
+
+// DeleteCertificateTemplate stops issuing certificates for the course.
+// Issued certificates stay valid.
+func DeleteCertificateTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"certificate": ""}}
+	if updateCourseVersioned(ctx, w, r, course.ID, primitive.NilObjectID, update) == nil {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type certificateEntry struct {
+	models.Certificate `bson:",inline"`
+	DownloadURL        string `json:"downloadUrl"`
+	VerifyURL          string `json:"verifyUrl"`
+}
+
+// GetMyCertificates lists the caller's certificates, newest first.
+func GetMyCertificates(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := issueMissingCertificates(ctx, userID); err != nil {
+		log.Printf("certificates: failed to issue for %s: %v", userID.Hex(), err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "issuedAt", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := db.GetCollection("certificates").Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch certificates")
+		return
+	}
+	var certs []models.Certificate
+	if err := cursor.All(ctx, &certs); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode certificates")
+		return
+	}
+
+	entries := make([]certificateEntry, 0, len(certs))
+	for _, c := range certs {
+		entries = append(entries, certificateEntry{
+			Certificate: c,
+			DownloadURL: "/me/certificates/" + c.ID.Hex() + "/pdf",
+			VerifyURL:   certificateVerifyURL(r, c.Code),
+		})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// DownloadMyCertificate sends one of the caller's certificates as PDF.
+func DownloadMyCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid certificate id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cert models.Certificate
+	err = db.GetCollection("certificates").FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&cert)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "certificate not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch certificate")
+		return
+	}
+	writeCertificatePDF(w, r, &cert)
+}
+
+// findCertificateByCode checks the code's signature before looking the
+// certificate up. Forged and unknown codes both give nil.
+func findCertificateByCode(ctx context.Context, code string) (*models.Certificate, error) {
+	oid, ok := decodeCertificateCode(code)
+	if !ok {
+		return nil, nil
+	}
+	var cert models.Certificate
+	err := db.GetCollection("certificates").FindOne(ctx, bson.M{"_id": oid, "code": code}).Decode(&cert)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// DownloadCertificateByCode is the public PDF download linked from the
+// verification page; knowing the code is enough.
+func DownloadCertificateByCode(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cert, err := findCertificateByCode(ctx, r.PathValue("code"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch certificate")
+		return
+	}
+	if cert == nil {
+		writeError(w, http.StatusNotFound, "certificate not found")
+		return
+	}
+	writeCertificatePDF(w, r, cert)
+}
+
+// VerifyCertificatePage is the public page the QR code points at.
+func VerifyCertificatePage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	code := r.PathValue("code")
+	cert, err := findCertificateByCode(ctx, code)
+	if err != nil {
+		http.Error(w, "Ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := template.ParseFiles("views/certificate_verify.html")
+	if err != nil {
+		http.Error(w, "Template parse error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{"Valid": cert != nil, "Code": code}
+	if cert != nil {
+		data["StudentName"] = cert.StudentName
+		data["CourseTitle"] = cert.CourseTitle
+		data["CompletedAt"] = cert.CompletedAt.UTC().Format("02.01.2006")
+		data["IssuedAt"] = cert.IssuedAt.UTC().Format("02.01.2006")
+		if cert.Grade != nil {
+			data["Grade"] = certificate.FormatGrade(*cert.Grade)
+		}
+		data["DownloadURL"] = "/certificates/" + code + "/pdf"
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("certificates: template execute: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCertificateCode(t *testing.T) {
+	id := primitive.NewObjectID()
+	code := certificateCode(id)
+	if got, ok := decodeCertificateCode(code); !ok || got != id {
+		t.Fatalf("decode(%q) = %v, %v", code, got, ok)
+	}
+
+	altered := code[:len(code)-1] + "A"
+	if code[len(code)-1] == 'A' {
+		altered = code[:len(code)-1] + "B"
+	}
+	if _, ok := decodeCertificateCode(altered); ok {
+		t.Error("altered code verified")
+	}
+	if _, ok := decodeCertificateCode("garbage"); ok {
+		t.Error("garbage verified")
+	}
+}
+
+// Codes are signed with a key kept on disk, so they must verify with the
+// key a restarted server loads.
+func TestAppSecretPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "secret.key")
+	created, err := loadOrCreateSecret(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadOrCreateSecret(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 32 || !bytes.Equal(created, loaded) {
+		t.Errorf("created %x, loaded %x", created, loaded)
+	}
+}
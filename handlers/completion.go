@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// Names of the completion rules, as reported in completionStatus.Unmet.
+const (
+	ruleRequiredItems = "requiredItems"
+	ruleMinGrade      = "minGrade"
+	rulePassedItems   = "passedItems"
+	ruleMinModules    = "minModules"
+)
+
+// completionRulesOf returns the rules in force for course.
+func completionRulesOf(course *models.Course) models.CompletionRules {
+	rules := course.Completion
+	if rules == nil || (!rules.RequiredItems && rules.MinGrade == 0 && len(rules.PassedItems) == 0 && rules.MinModules == 0) {
+		return models.CompletionRules{RequiredItems: true}
+	}
+	return *rules
+}
+
+// completionStatus is a student's standing against the completion rules.
+// Only items the student's group can see count.
+type completionStatus struct {
+	Completed     bool     `json:"completed"`
+	RequiredDone  int      `json:"requiredDone"`
+	RequiredCount int      `json:"requiredCount"`
+	Grade         *float64 `json:"grade,omitempty"`
+	ModulesDone   int      `json:"modulesDone"`
+	PassedItems   int      `json:"passedItems"`
+	Unmet         []string `json:"unmet"`
+}
+
+func itemPassed(item *models.CourseItem, p *models.Progress) bool {
+	return p != nil && p.Status == "done" && p.Score >= item.PassScore
+}
+
+// evaluateCompletion checks progress (the student's progress documents in
+// the course) against the course's completion rules. The grade is the
+// score reached on required items over their maxScore, each score capped
+// at its item's maxScore.
+func evaluateCompletion(course *models.Course, groupID *primitive.ObjectID, progress []models.Progress) completionStatus {
+	byItem := map[primitive.ObjectID]*models.Progress{}
+	for i := range progress {
+		byItem[progress[i].ItemID] = &progress[i]
+	}
+
+	status := completionStatus{Unmet: []string{}}
+	var score, maxScore float64
+	for mi := range course.Modules {
+		module := &course.Modules[mi]
+		if !visibleToGroup(module.GroupIDs, groupID) {
+			continue
+		}
+		required, done := 0, 0
+		for ii := range module.Items {
+			item := &module.Items[ii]
+			if item.Optional || !visibleToGroup(item.GroupIDs, groupID) {
+				continue
+			}
+			required++
+			p := byItem[item.ID]
+			if p != nil && p.Status == "done" {
+				done++
+			}
+			if item.MaxScore > 0 {
+				maxScore += item.MaxScore
+				if p != nil {
+					score += min(max(p.Score, 0), item.MaxScore)
+				}
+			}
+		}
+		status.RequiredCount += required
+		status.RequiredDone += done
+		if required > 0 && done == required {
+			status.ModulesDone++
+		}
+	}
+	if maxScore > 0 {
+		grade := score / maxScore
+		status.Grade = &grade
+	}
+
+	rules := completionRulesOf(course)
+	passedAll := true
+	for _, id := range rules.PassedItems {
+		module, item := findItem(course, id)
+		// Items that were removed or are hidden from the group are skipped.
+		if item == nil || !itemVisibleToGroup(module, item, groupID) {
+			continue
+		}
+		if itemPassed(item, byItem[id]) {
+			status.PassedItems++
+		} else {
+			passedAll = false
+		}
+	}
+
+	if rules.RequiredItems && (status.RequiredCount == 0 || status.RequiredDone < status.RequiredCount) {
+		status.Unmet = append(status.Unmet, ruleRequiredItems)
+	}
+	if rules.MinGrade > 0 && (status.Grade == nil || *status.Grade < rules.MinGrade) {
+		status.Unmet = append(status.Unmet, ruleMinGrade)
+	}
+	if !passedAll {
+		status.Unmet = append(status.Unmet, rulePassedItems)
+	}
+	if rules.MinModules > 0 && status.ModulesDone < rules.MinModules {
+		status.Unmet = append(status.Unmet, ruleMinModules)
+	}
+	status.Completed = len(status.Unmet) == 0
+	return status
+}
+
+// learnerProgress loads the progress documents of users in a course, keyed
+// by user.
+func learnerProgress(ctx context.Context, courseOID primitive.ObjectID, userIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Progress, error) {
+	byUser := map[primitive.ObjectID][]models.Progress{}
+	if len(userIDs) == 0 {
+		return byUser, nil
+	}
+	cursor, err := db.GetCollection("progress").Find(ctx, bson.M{"courseId": courseOID, "userId": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []models.Progress
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for _, p := range docs {
+		byUser[p.UserID] = append(byUser[p.UserID], p)
+	}
+	return byUser, nil
+}
+
+// completeIfSatisfied records the completion of an active enrollment whose
+// progress meets the course's rules and marks the enrollment completed. It
+// reports whether e was completed now.
+func completeIfSatisfied(ctx context.Context, course *models.Course, e models.Enrollment, progress []models.Progress) (bool, error) {
+	if e.Status != models.EnrollmentStatusActive {
+		return false, nil
+	}
+	status := evaluateCompletion(course, e.GroupID, progress)
+	if !status.Completed {
+		return false, nil
+	}
+
+	insert := bson.M{"enrollmentId": e.ID, "completedAt": time.Now()}
+	if status.Grade != nil {
+		insert["grade"] = *status.Grade
+	}
+	// The first completion is kept when a student completes the course again.
+	_, err := db.GetCollection("course_completions").UpdateOne(ctx,
+		bson.M{"userId": e.UserID, "courseId": course.ID},
+		bson.M{"$setOnInsert": insert},
+		options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+	if err := issueCertificate(ctx, course, e.UserID); err != nil {
+		return false, err
+	}
+
+	_, ok, err := endEnrollment(ctx, e, models.EnrollmentStatusCompleted, bson.M{}, nil)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := notify(ctx, e.UserID, models.NotificationEnrollmentCompleted, &course.ID,
+		"You have completed \""+course.Title+"\"."); err != nil {
+		log.Printf("completion: failed to notify %s: %v", e.UserID.Hex(), err)
+	}
+	return true, nil
+}
+
+// checkCourseCompletion runs after a progress update and completes the
+// user's active enrollment once the rules are met.
+func checkCourseCompletion(ctx context.Context, userID, courseOID primitive.ObjectID) error {
+	var e models.Enrollment
+	err := db.GetCollection("enrollments").FindOne(ctx, bson.M{
+		"userId":   userID,
+		"courseId": courseOID,
+		"status":   models.EnrollmentStatusActive,
+	}).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var course models.Course
+	if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}).Decode(&course); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	progress, err := learnerProgress(ctx, courseOID, []primitive.ObjectID{userID})
+	if err != nil {
+		return err
+	}
+	_, err = completeIfSatisfied(ctx, &course, e, progress[userID])
+	return err
+}
+
+// courseCompletions loads the completion records of users in a course.
+func courseCompletions(ctx context.Context, courseOID primitive.ObjectID, userIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.CourseCompletion, error) {
+	byUser := map[primitive.ObjectID]*models.CourseCompletion{}
+	if len(userIDs) == 0 {
+		return byUser, nil
+	}
+	cursor, err := db.GetCollection("course_completions").Find(ctx, bson.M{"courseId": courseOID, "userId": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []models.CourseCompletion
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for i := range docs {
+		byUser[docs[i].UserID] = &docs[i]
+	}
+	return byUser, nil
+}
+
+// GetCourseCompletion returns the completion rules and, for an enrolled
+// caller, where they stand.
+func GetCourseCompletion(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+
+	resp := map[string]interface{}{"rules": completionRulesOf(course)}
+
+	var enrollment models.Enrollment
+	err = db.GetCollection("enrollments").FindOne(ctx, bson.M{
+		"userId":   userID,
+		"courseId": oid,
+		"status":   bson.M{"$ne": models.EnrollmentStatusPending},
+	}).Decode(&enrollment)
+	if err != nil && err != mongo.ErrNoDocuments {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
+		return
+	}
+	if err == nil {
+		progress, err := learnerProgress(ctx, oid, []primitive.ObjectID{userID})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch progress")
+			return
+		}
+		resp["status"] = evaluateCompletion(course, enrollment.GroupID, progress[userID])
+	}
+
+	completions, err := courseCompletions(ctx, oid, []primitive.ObjectID{userID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch completion")
+		return
+	}
+	if c := completions[userID]; c != nil {
+		resp["completion"] = c
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type completionRulesInput struct {
+	RequiredItems bool     `json:"requiredItems"`
+	MinGrade      float64  `json:"minGrade"`
+	PassedItems   []string `json:"passedItems"`
+	MinModules    int      `json:"minModules"`
+}
+
+// PutCourseCompletion replaces the completion rules. Students who already
+// meet the new rules are completed by the background job.
+func PutCourseCompletion(w http.ResponseWriter, r *http.Request) {
+	var input completionRulesInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if input.MinGrade < 0 || input.MinGrade > 1 {
+		writeError(w, http.StatusBadRequest, "minGrade must be between 0 and 1")
+		return
+	}
+	if input.MinModules < 0 {
+		writeError(w, http.StatusBadRequest, "minModules cannot be negative")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
+		return
+	}
+	if input.MinModules > len(course.Modules) {
+		writeError(w, http.StatusBadRequest, "minModules exceeds the number of modules")
+		return
+	}
+
+	rules := models.CompletionRules{
+		RequiredItems: input.RequiredItems,
+		MinGrade:      input.MinGrade,
+		MinModules:    input.MinModules,
+	}
+	for _, s := range input.PassedItems {
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(s))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid item id in passedItems")
+			return
+		}
+		if _, item := findItem(course, oid); item == nil {
+			writeError(w, http.StatusBadRequest, "unknown item in passedItems: "+oid.Hex())
+			return
+		}
+		if !slices.Contains(rules.PassedItems, oid) {
+			rules.PassedItems = append(rules.PassedItems, oid)
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"completion": rules, "updatedAt": time.Now()}}
+	if !rules.RequiredItems && rules.MinGrade == 0 && len(rules.PassedItems) == 0 && rules.MinModules == 0 {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"completion": ""}}
+	}
+	updated := updateCourseVersioned(ctx, w, r, course.ID, primitive.NilObjectID, update)
+	if updated == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rules": completionRulesOf(updated)})
+}
+
+// completionSort pages completion reports newest first.
+var completionSort = []sortField{{Path: "completedAt", Desc: true}, {Path: "_id", Desc: true}}
+
+type completionEntry struct {
+	models.CourseCompletion `bson:",inline"`
+	Username                string `json:"username"`
+}
+
+// GetCourseCompletions is the staff report of students who completed the
+// course, newest first.
+func GetCourseCompletions(w http.ResponseWriter, r *http.Request) {
+	pg, err := parseListPage(r, "completedAt_desc")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	collection := db.GetCollection("course_completions")
+	filter := bson.M{"courseId": course.ID}
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count completions")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(completionSort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(completionSort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch completions")
+		return
+	}
+	completions := []models.CourseCompletion{}
+	if err := cursor.All(ctx, &completions); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode completions")
+		return
+	}
+
+	fetched := len(completions)
+	if fetched > pg.Limit {
+		completions = completions[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(completions)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(completions))
+	for _, c := range completions {
+		ids = append(ids, c.UserID)
+	}
+	names, err := usernames(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	results := make([]completionEntry, 0, len(completions))
+	for _, c := range completions {
+		results = append(results, completionEntry{CourseCompletion: c, Username: names[c.UserID]})
+	}
+
+	var first, last []interface{}
+	if len(completions) > 0 {
+		first = []interface{}{completions[0].CompletedAt, completions[0].ID}
+		last = []interface{}{completions[len(completions)-1].CompletedAt, completions[len(completions)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
+	writeJSON(w, http.StatusOK, results)
+}
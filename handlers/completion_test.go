@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestCompletionRulesOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *models.CompletionRules
+		want  models.CompletionRules
+	}{
+		{"none", nil, models.CompletionRules{RequiredItems: true}},
+		{"empty", &models.CompletionRules{}, models.CompletionRules{RequiredItems: true}},
+		{"grade only", &models.CompletionRules{MinGrade: 0.5}, models.CompletionRules{MinGrade: 0.5}},
+		{"modules only", &models.CompletionRules{MinModules: 2}, models.CompletionRules{MinModules: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := completionRulesOf(&models.Course{Completion: tt.rules})
+			if got.RequiredItems != tt.want.RequiredItems || got.MinGrade != tt.want.MinGrade || got.MinModules != tt.want.MinModules {
+				t.Errorf("completionRulesOf = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCompletion(t *testing.T) {
+	quiz, task, extra, hidden := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	group := primitive.NewObjectID()
+	course := func(rules *models.CompletionRules) *models.Course {
+		return &models.Course{Completion: rules, Modules: []models.CourseModule{
+			{Items: []models.CourseItem{
+				{ID: quiz, MaxScore: 10, PassScore: 6},
+				{ID: extra, Optional: true},
+			}},
+			{Items: []models.CourseItem{
+				{ID: task, MaxScore: 10},
+				{ID: hidden, GroupIDs: []primitive.ObjectID{group}},
+			}},
+		}}
+	}
+	done := func(id primitive.ObjectID, score float64) models.Progress {
+		return models.Progress{ItemID: id, Status: "done", Score: score}
+	}
+
+	tests := []struct {
+		name        string
+		rules       *models.CompletionRules
+		group       *primitive.ObjectID
+		progress    []models.Progress
+		wantDone    int
+		wantCount   int
+		wantModules int
+		wantGrade   float64
+		wantUnmet   []string
+	}{
+		{
+			name:      "nothing done",
+			wantCount: 2,
+			wantUnmet: []string{ruleRequiredItems},
+		},
+		{
+			name:        "all visible required items done",
+			progress:    []models.Progress{done(quiz, 8), done(task, 4)},
+			wantDone:    2,
+			wantCount:   2,
+			wantModules: 2,
+			wantGrade:   0.6,
+			wantUnmet:   []string{},
+		},
+		{
+			name:        "group item counts for its members",
+			group:       &group,
+			progress:    []models.Progress{done(quiz, 8), done(task, 4)},
+			wantDone:    2,
+			wantCount:   3,
+			wantModules: 1,
+			wantGrade:   0.6,
+			wantUnmet:   []string{ruleRequiredItems},
+		},
+		{
+			name:        "scores are capped at maxScore",
+			rules:       &models.CompletionRules{MinGrade: 0.8},
+			progress:    []models.Progress{done(quiz, 50), done(task, -5)},
+			wantDone:    2,
+			wantCount:   2,
+			wantModules: 2,
+			wantGrade:   0.5,
+			wantUnmet:   []string{ruleMinGrade},
+		},
+		{
+			name:        "passed items and modules",
+			rules:       &models.CompletionRules{PassedItems: []primitive.ObjectID{quiz, hidden}, MinModules: 2},
+			progress:    []models.Progress{done(quiz, 5), {ItemID: task, Status: "started", Score: 10}},
+			wantDone:    1,
+			wantCount:   2,
+			wantModules: 1,
+			wantGrade:   0.75,
+			wantUnmet:   []string{rulePassedItems, ruleMinModules},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluateCompletion(course(tt.rules), tt.group, tt.progress)
+			if got.RequiredDone != tt.wantDone || got.RequiredCount != tt.wantCount || got.ModulesDone != tt.wantModules {
+				t.Errorf("done %d/%d, modules %d; want %d/%d, modules %d",
+					got.RequiredDone, got.RequiredCount, got.ModulesDone, tt.wantDone, tt.wantCount, tt.wantModules)
+			}
+			if got.Grade == nil || *got.Grade != tt.wantGrade {
+				t.Errorf("grade = %v, want %v", got.Grade, tt.wantGrade)
+			}
+			if !slices.Equal(got.Unmet, tt.wantUnmet) {
+				t.Errorf("unmet = %v, want %v", got.Unmet, tt.wantUnmet)
+			}
+			if got.Completed != (len(tt.wantUnmet) == 0) {
+				t.Errorf("completed = %v", got.Completed)
+			}
+		})
+	}
+}
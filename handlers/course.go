@@ -4,13 +4,14 @@ import (
 	"context"
 	"html/template"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"AP_Final/db"
@@ -18,44 +19,87 @@ import (
 )
 
 type courseItemInput struct {
-	ID       string  `json:"id,omitempty"`
-	Type     string  `json:"type"`
-	Title    string  `json:"title"`
-	MaxScore float64 `json:"maxScore"`
-	Order    int     `json:"order"`
+	ID             string     `json:"id,omitempty"`
+	Type           string     `json:"type"`
+	Title          string     `json:"title"`
+	MaxScore       float64    `json:"maxScore"`
+	Order          int        `json:"order"`
+	URL            string     `json:"url,omitempty"`
+	ActivityID     string     `json:"activityId,omitempty"`
+	ToolID         string     `json:"toolId,omitempty"`
+	AvailableFrom  *time.Time `json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time `json:"availableUntil,omitempty"`
+	Optional       bool       `json:"optional,omitempty"`
+	PassScore      float64    `json:"passScore,omitempty"`
 }
 
 type courseModuleInput struct {
-	ID    string            `json:"id,omitempty"`
-	Title string            `json:"title"`
-	Order int               `json:"order"`
-	Items []courseItemInput `json:"items,omitempty"`
+	ID             string            `json:"id,omitempty"`
+	Title          string            `json:"title"`
+	Order          int               `json:"order"`
+	Items          []courseItemInput `json:"items,omitempty"`
+	AvailableFrom  *time.Time        `json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time        `json:"availableUntil,omitempty"`
 }
 
 type courseCreateInput struct {
-	Title       string              `json:"title"`
-	Description string              `json:"description"`
-	Category    string              `json:"category"`
-	TeacherID   string              `json:"teacherId"`
-	Modules     []courseModuleInput `json:"modules,omitempty"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags,omitempty"`
+	TeacherID   string   `json:"teacherId"`
+	Status      string   `json:"status,omitempty"`
+	Capacity    int      `json:"capacity,omitempty"`
+	// EnrollmentKey is write-only; exports carry the method but not the key.
+	EnrollmentMethod string              `json:"enrollmentMethod,omitempty"`
+	EnrollmentKey    string              `json:"enrollmentKey,omitempty"`
+	EnrollmentDays   int                 `json:"enrollmentDays,omitempty"`
+	Modules          []courseModuleInput `json:"modules,omitempty"`
 }
 
 type coursePatchInput struct {
-	Title       *string `json:"title"`
-	Description *string `json:"description"`
-	Category    *string `json:"category"`
-	TeacherID   *string `json:"teacherId"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Category    *string   `json:"category"`
+	Tags        *[]string `json:"tags"`
+	TeacherID   *string   `json:"teacherId"`
+	IsTemplate  *bool     `json:"isTemplate"`
+	Capacity    *int      `json:"capacity"`
+	// An empty enrollmentKey removes the key.
+	EnrollmentMethod *string `json:"enrollmentMethod"`
+	EnrollmentKey    *string `json:"enrollmentKey"`
+	EnrollmentDays   *int    `json:"enrollmentDays"`
 }
 
 type moduleCreateInput struct {
-	Title string            `json:"title"`
-	Order int               `json:"order"`
-	Items []courseItemInput `json:"items,omitempty"`
+	Title          string            `json:"title"`
+	Order          int               `json:"order"`
+	Items          []courseItemInput `json:"items,omitempty"`
+	AvailableFrom  *time.Time        `json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time        `json:"availableUntil,omitempty"`
 }
 
 type modulePatchInput struct {
-	Title *string `json:"title"`
-	Order *int    `json:"order"`
+	Title          *string    `json:"title"`
+	Order          *int       `json:"order"`
+	AvailableFrom  *time.Time `json:"availableFrom"`
+	AvailableUntil *time.Time `json:"availableUntil"`
+	GroupIDs       *[]string  `json:"groupIds"`
+}
+
+type itemPatchInput struct {
+	Type           *string    `json:"type"`
+	Title          *string    `json:"title"`
+	MaxScore       *float64   `json:"maxScore"`
+	Order          *int       `json:"order"`
+	URL            *string    `json:"url"`
+	ActivityID     *string    `json:"activityId"`
+	ToolID         *string    `json:"toolId"`
+	AvailableFrom  *time.Time `json:"availableFrom"`
+	AvailableUntil *time.Time `json:"availableUntil"`
+	GroupIDs       *[]string  `json:"groupIds"`
+	Optional       *bool      `json:"optional"`
+	PassScore      *float64   `json:"passScore"`
 }
 
 func wantsHTML(r *http.Request) bool {
@@ -78,24 +122,56 @@ func GetCourses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page, limit, err := parsePagination(r)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
-	}
+	viewerID := viewerIDFromRequest(r)
+	filter := courseVisibilityFilter(viewerID)
 
-	filter := bson.M{}
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	if status != "" {
+		if !validCourseStatus(status) {
+			writeError(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		if status == models.CourseStatusPublished {
+			andFilter(filter, bson.M{"$or": []bson.M{
+				{"status": status},
+				{"status": bson.M{"$exists": false}},
+			}})
+		} else {
+			filter["status"] = status
+		}
+	}
 
 	search := strings.TrimSpace(r.URL.Query().Get("search"))
 	if search != "" {
-		filter["title"] = bson.M{"$regex": search, "$options": "i"}
+		filter["$text"] = bson.M{"$search": search}
 	}
 
+	// Category and teacher filters are kept apart from the base filter so
+	// each facet can be counted without its own restriction.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	categoryClause := bson.M{}
 	category := strings.TrimSpace(r.URL.Query().Get("category"))
 	if category != "" {
-		filter["category"] = category
+		clause, err := categoryFilterClause(ctx, category)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to resolve category")
+			return
+		}
+		categoryClause = clause
+	}
+
+	tagClause, err := tagFilterClause(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(tagClause) > 0 {
+		andFilter(filter, tagClause)
 	}
 
+	teacherClause := bson.M{}
 	teacherID := strings.TrimSpace(r.URL.Query().Get("teacherId"))
 	if teacherID != "" {
 		oid, err := primitive.ObjectIDFromHex(teacherID)
@@ -103,95 +179,166 @@ func GetCourses(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "invalid teacherId")
 			return
 		}
-		filter["teacherId"] = oid
+		teacherClause["teacherId"] = oid
 	}
 
-	sortSpec, err := parseSort(r.URL.Query().Get("sort"))
+	sortParam := strings.TrimSpace(r.URL.Query().Get("sort"))
+	if sortParam == "" && search != "" {
+		sortParam = "relevance"
+	}
+	if sortParam == "relevance" && search == "" {
+		writeError(w, http.StatusBadRequest, "sort=relevance requires search")
+		return
+	}
+	sortName, sortFields, err := parseSort(sortParam)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	pg, err := parseListPage(r, sortName, "search", "category", "teacherId", "status", "tags", "match")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	collection := db.GetCollection("courses")
 
-	total, err := collection.CountDocuments(ctx, filter)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to count courses")
-		return
+	query := bson.M{}
+	for k, v := range filter {
+		query[k] = v
+	}
+	query["$and"] = append([]bson.M{categoryClause, teacherClause}, andClauses(filter)...)
+
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, query)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count courses")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
 	}
 
-	opts := options.Find().SetSkip(int64((page - 1) * limit)).SetLimit(int64(limit)).SetSort(sortSpec)
-	cursor, err := collection.Find(ctx, filter, opts)
+	opts := options.Find().SetLimit(int64(pg.Limit + 1))
+	if sortFields == nil {
+		opts.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}}).
+			SetSkip(pg.offset())
+	} else {
+		opts.SetSort(pg.sortSpec(sortFields))
+		if keyset := pg.keysetFilter(sortFields); keyset != nil {
+			query["$and"] = append(query["$and"].([]bson.M), keyset)
+		}
+	}
+	if search != "" {
+		opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+	}
+	cursor, err := collection.Find(ctx, query, opts)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch courses")
 		return
 	}
 	defer cursor.Close(ctx)
 
-	courses := []models.Course{}
+	courses := []courseSearchResult{}
 	if err := cursor.All(ctx, &courses); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to decode courses")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"items": courses,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
-}
+	fetched := len(courses)
+	if fetched > pg.Limit {
+		courses = courses[:pg.Limit]
+	}
+	var links pageLinks
+	if sortFields == nil {
+		links = pg.offsetLinks(fetched)
+	} else {
+		if pg.Back() {
+			slices.Reverse(courses)
+		}
+		var first, last []interface{}
+		if len(courses) > 0 {
+			first = courseSortValues(&courses[0].Course, sortFields)
+			last = courseSortValues(&courses[len(courses)-1].Course, sortFields)
+		}
+		links = pg.keysetLinks(fetched, first, last)
+	}
 
-func CreateCourse(w http.ResponseWriter, r *http.Request) {
-	var input courseCreateInput
-	if err := decodeJSON(r, &input); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+	facets, err := loadCourseFacets(ctx, filter, categoryClause, teacherClause)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count facets")
 		return
 	}
 
-	if strings.TrimSpace(input.Title) == "" {
-		writeError(w, http.StatusBadRequest, "title is required")
-		return
+	courseIDs := make([]primitive.ObjectID, 0, len(courses))
+	for i := range courses {
+		courseIDs = append(courseIDs, courses[i].ID)
 	}
-	if strings.TrimSpace(input.Category) == "" {
-		writeError(w, http.StatusBadRequest, "category is required")
+	groups, err := viewerGroupIDs(ctx, viewerID, courseIDs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
 		return
 	}
-	if strings.TrimSpace(input.TeacherID) == "" {
-		writeError(w, http.StatusBadRequest, "teacherId is required")
-		return
+
+	// As in GetCourse, non-staff only see their group's content, and
+	// highlights are built from what they see.
+	terms := searchTerms(search)
+	now := time.Now()
+	for i := range courses {
+		c := &courses[i].Course
+		c.Status = courseStatusOf(c)
+		if !isCourseStaff(c, viewerID) {
+			hideOtherGroupsContent(c, groups[c.ID])
+			lockUnavailableContent(c, now)
+		}
+		if len(terms) > 0 {
+			courses[i].Highlights = courseHighlights(c, terms)
+		}
 	}
 
-	teacherOID, err := primitive.ObjectIDFromHex(input.TeacherID)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid teacherId")
+	resp := map[string]interface{}{
+		"items":  courses,
+		"limit":  pg.Limit,
+		"facets": facets,
+	}
+	if links.Next != "" {
+		resp["nextCursor"] = links.Next
+	}
+	if links.Prev != "" {
+		resp["prevCursor"] = links.Prev
+	}
+	setLinkHeader(w, r, links)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func CreateCourse(w http.ResponseWriter, r *http.Request) {
+	var input courseCreateInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
 		return
 	}
 
-	now := time.Now()
-	course := models.Course{
-		ID:          primitive.NewObjectID(),
-		Title:       strings.TrimSpace(input.Title),
-		Description: strings.TrimSpace(input.Description),
-		Category:    strings.TrimSpace(input.Category),
-		TeacherID:   teacherOID,
-		Modules:     mapModulesInput(input.Modules),
-		CreatedAt:   now,
-		UpdatedAt:   now,
+	course, err := buildCourse(input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	var ok bool
+	if course.Category, ok = checkCategory(ctx, w, course.Category); !ok {
+		return
+	}
+
 	_, err = db.GetCollection("courses").InsertOne(ctx, course)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create course")
 		return
 	}
 
+	w.Header().Set("ETag", courseETag(course.Version))
 	writeJSON(w, http.StatusCreated, course)
 }
 
@@ -220,14 +367,41 @@ func GetCourse(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var course models.Course
-	err = db.GetCollection("courses").FindOne(ctx, bson.M{"_id": oid}).Decode(&course)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			writeError(w, http.StatusNotFound, "course not found")
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+
+	viewerID := viewerIDFromRequest(r)
+	if !canViewCourse(course, viewerID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+	course.Status = courseStatusOf(course)
+
+	// Owners always see the full structure; everyone else only sees their
+	// group's content with time-locked parts flagged, which also varies the
+	// ETag.
+	etag := courseETag(course.Version)
+	if !isCourseStaff(course, viewerID) {
+		groupID, err := viewerGroupID(ctx, viewerID, course.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to fetch course")
+		hideOtherGroupsContent(course, groupID)
+		fingerprint := lockUnavailableContent(course, time.Now())
+		if groupID != nil {
+			fingerprint += "-" + groupID.Hex()
+		}
+		etag = etag[:len(etag)-1] + "-" + fingerprint + `"`
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", "Accept, Cookie")
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -267,9 +441,25 @@ func PatchCourse(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "category cannot be empty")
 			return
 		}
-		setFields["category"] = strings.TrimSpace(*input.Category)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		slug, ok := checkCategory(ctx, w, *input.Category)
+		cancel()
+		if !ok {
+			return
+		}
+		setFields["category"] = slug
+	}
+
+	if input.Tags != nil {
+		tags, err := normalizeTags(*input.Tags)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		setFields["tags"] = tags
 	}
 
+	pullFields := bson.M{}
 	if input.TeacherID != nil {
 		if strings.TrimSpace(*input.TeacherID) == "" {
 			writeError(w, http.StatusBadRequest, "teacherId cannot be empty")
@@ -281,28 +471,92 @@ func PatchCourse(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		setFields["teacherId"] = teacherOID
+		// The new owner is no longer listed with a staff role.
+		pullFields["staff"] = bson.M{"userId": teacherOID}
+	}
+
+	if input.IsTemplate != nil {
+		setFields["isTemplate"] = *input.IsTemplate
+	}
+
+	if input.Capacity != nil {
+		if *input.Capacity < 0 {
+			writeError(w, http.StatusBadRequest, "capacity cannot be negative")
+			return
+		}
+		setFields["capacity"] = *input.Capacity
+	}
+
+	if input.EnrollmentDays != nil {
+		if *input.EnrollmentDays < 0 {
+			writeError(w, http.StatusBadRequest, "enrollmentDays cannot be negative")
+			return
+		}
+		setFields["enrollmentDays"] = *input.EnrollmentDays
+	}
+
+	unsetFields := bson.M{}
+	if input.EnrollmentMethod != nil {
+		if !validEnrollmentMethod(*input.EnrollmentMethod) {
+			writeError(w, http.StatusBadRequest, "invalid enrollmentMethod")
+			return
+		}
+		setFields["enrollmentMethod"] = *input.EnrollmentMethod
+	}
+	if input.EnrollmentKey != nil {
+		if *input.EnrollmentKey == "" {
+			unsetFields["enrollmentKeyHash"] = ""
+		} else {
+			hash, err := hashEnrollmentKey(*input.EnrollmentKey)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to hash enrollment key")
+				return
+			}
+			setFields["enrollmentKeyHash"] = hash
+		}
 	}
 
-	if len(setFields) == 0 {
+	if len(setFields) == 0 && len(unsetFields) == 0 {
 		writeError(w, http.StatusBadRequest, "no fields to update")
 		return
 	}
 
 	setFields["updatedAt"] = time.Now()
+	update := bson.M{"$set": setFields}
+	if len(unsetFields) > 0 {
+		update["$unset"] = unsetFields
+	}
+	if len(pullFields) > 0 {
+		update["$pull"] = pullFields
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := db.GetCollection("courses").UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": setFields})
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update course")
+	course, userID := loadStaffCourse(ctx, w, r, capEditContent)
+	if course == nil {
 		return
 	}
-	if res.MatchedCount == 0 {
-		writeError(w, http.StatusNotFound, "course not found")
+	// Handing the course over, sharing it as a template (which exposes its
+	// content to every teacher) and the enrollment method (which decides who
+	// gets in) are left to the owner.
+	if input.TeacherID != nil || input.IsTemplate != nil || input.EnrollmentMethod != nil || input.EnrollmentKey != nil {
+		if !requireCourseCapability(w, course, userID, capManageCourse) {
+			return
+		}
+	}
+
+	if updateCourseVersioned(ctx, w, r, oid, primitive.NilObjectID, update) == nil {
 		return
 	}
 
+	if input.Capacity != nil {
+		if err := syncSeats(ctx, oid); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update seats")
+			return
+		}
+	}
+
 	writeJSON(w, http.StatusOK, map[string]string{"message": "course updated"})
 }
 
@@ -317,13 +571,23 @@ func DeleteCourse(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := db.GetCollection("courses").DeleteOne(ctx, bson.M{"_id": oid})
+	if course, _ := loadStaffCourse(ctx, w, r, capManageCourse); course == nil {
+		return
+	}
+
+	filter, err := courseMutationFilter(r, oid)
+	if err != nil {
+		writeCourseMutationFilterError(w, err)
+		return
+	}
+
+	res, err := db.GetCollection("courses").DeleteOne(ctx, filter)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to delete course")
 		return
 	}
 	if res.DeletedCount == 0 {
-		writeError(w, http.StatusNotFound, "course not found")
+		writeCourseMutationMiss(ctx, w, oid, primitive.NilObjectID)
 		return
 	}
 
@@ -349,31 +613,36 @@ func AddModule(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "module title is required")
 		return
 	}
+	if err := validateWindow(input.AvailableFrom, input.AvailableUntil); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateItemsInput(input.Items); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	module := models.CourseModule{
-		ID:    primitive.NewObjectID(),
-		Title: strings.TrimSpace(input.Title),
-		Order: input.Order,
-		Items: mapItemsInput(input.Items),
+		ID:             primitive.NewObjectID(),
+		Title:          strings.TrimSpace(input.Title),
+		Order:          input.Order,
+		Items:          mapItemsInput(input.Items),
+		AvailableFrom:  input.AvailableFrom,
+		AvailableUntil: input.AvailableUntil,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := db.GetCollection("courses").UpdateOne(
-		ctx,
-		bson.M{"_id": courseOID},
-		bson.M{
-			"$push": bson.M{"modules": module},
-			"$set":  bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to add module")
+	if course, _ := loadStaffCourse(ctx, w, r, capEditContent); course == nil {
 		return
 	}
-	if res.MatchedCount == 0 {
-		writeError(w, http.StatusNotFound, "course not found")
+
+	update := bson.M{
+		"$push": bson.M{"modules": module},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	if updateCourseVersioned(ctx, w, r, courseOID, primitive.NilObjectID, update) == nil {
 		return
 	}
 
@@ -413,8 +682,18 @@ func PatchModule(w http.ResponseWriter, r *http.Request) {
 	if input.Order != nil {
 		setFields["modules.$[mod].order"] = *input.Order
 	}
+	if err := validateWindow(input.AvailableFrom, input.AvailableUntil); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.AvailableFrom != nil {
+		setFields["modules.$[mod].availableFrom"] = *input.AvailableFrom
+	}
+	if input.AvailableUntil != nil {
+		setFields["modules.$[mod].availableUntil"] = *input.AvailableUntil
+	}
 
-	if len(setFields) == 0 {
+	if len(setFields) == 0 && input.GroupIDs == nil {
 		writeError(w, http.StatusBadRequest, "no fields to update")
 		return
 	}
@@ -424,26 +703,24 @@ func PatchModule(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	opts := options.Update().SetArrayFilters(options.ArrayFilters{
-		Filters: []interface{}{bson.M{"mod._id": moduleOID}},
-	})
-
-	res, err := db.GetCollection("courses").UpdateOne(
-		ctx,
-		bson.M{"_id": courseOID},
-		bson.M{"$set": setFields},
-		opts,
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update module")
+	if course, _ := loadStaffCourse(ctx, w, r, capEditContent); course == nil {
 		return
 	}
-	if res.MatchedCount == 0 {
-		writeError(w, http.StatusNotFound, "course not found")
-		return
+
+	if input.GroupIDs != nil {
+		groupIDs, err := parseCourseGroupIDs(ctx, courseOID, *input.GroupIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		setFields["modules.$[mod].groupIds"] = groupIDs
 	}
-	if res.ModifiedCount == 0 {
-		writeError(w, http.StatusNotFound, "module not found")
+
+	opts := options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"mod._id": moduleOID}},
+	})
+
+	if updateCourseVersioned(ctx, w, r, courseOID, moduleOID, bson.M{"$set": setFields}, opts) == nil {
 		return
 	}
 
@@ -469,24 +746,15 @@ func DeleteModule(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := db.GetCollection("courses").UpdateOne(
-		ctx,
-		bson.M{"_id": courseOID},
-		bson.M{
-			"$pull": bson.M{"modules": bson.M{"_id": moduleOID}},
-			"$set":  bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to delete module")
+	if course, _ := loadStaffCourse(ctx, w, r, capEditContent); course == nil {
 		return
 	}
-	if res.MatchedCount == 0 {
-		writeError(w, http.StatusNotFound, "course not found")
-		return
+
+	update := bson.M{
+		"$pull": bson.M{"modules": bson.M{"_id": moduleOID}},
+		"$set":  bson.M{"updatedAt": time.Now()},
 	}
-	if res.ModifiedCount == 0 {
-		writeError(w, http.StatusNotFound, "module not found")
+	if updateCourseVersioned(ctx, w, r, courseOID, moduleOID, update) == nil {
 		return
 	}
 
@@ -494,47 +762,350 @@ func DeleteModule(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func parsePagination(r *http.Request) (int, int, error) {
-	page := 1
-	limit := 10
+func PatchItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	moduleOID, err := primitive.ObjectIDFromHex(r.PathValue("moduleId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid module id")
+		return
+	}
+
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	var input itemPatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
 
-	if v := r.URL.Query().Get("page"); v != "" {
-		p, err := strconv.Atoi(v)
-		if err != nil || p < 1 {
-			return 0, 0, errorf("invalid page")
+	setFields := bson.M{}
+	if input.Title != nil {
+		if strings.TrimSpace(*input.Title) == "" {
+			writeError(w, http.StatusBadRequest, "item title cannot be empty")
+			return
+		}
+		setFields["modules.$[mod].items.$[it].title"] = strings.TrimSpace(*input.Title)
+	}
+	if input.Type != nil {
+		setFields["modules.$[mod].items.$[it].type"] = strings.TrimSpace(*input.Type)
+	}
+	if input.MaxScore != nil {
+		if *input.MaxScore < 0 {
+			writeError(w, http.StatusBadRequest, "maxScore cannot be negative")
+			return
+		}
+		setFields["modules.$[mod].items.$[it].maxScore"] = *input.MaxScore
+	}
+	if input.Order != nil {
+		setFields["modules.$[mod].items.$[it].order"] = *input.Order
+	}
+	if input.URL != nil {
+		if err := validateItemURL(*input.URL); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		setFields["modules.$[mod].items.$[it].url"] = strings.TrimSpace(*input.URL)
+	}
+	if input.ActivityID != nil {
+		if err := validateActivityID(*input.ActivityID); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		setFields["modules.$[mod].items.$[it].activityId"] = strings.TrimSpace(*input.ActivityID)
+	}
+	var toolOID *primitive.ObjectID
+	if input.ToolID != nil {
+		parsed, err := primitive.ObjectIDFromHex(strings.TrimSpace(*input.ToolID))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid toolId")
+			return
+		}
+		toolOID = &parsed
+		setFields["modules.$[mod].items.$[it].toolId"] = parsed
+	}
+	if err := validateWindow(input.AvailableFrom, input.AvailableUntil); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.AvailableFrom != nil {
+		setFields["modules.$[mod].items.$[it].availableFrom"] = *input.AvailableFrom
+	}
+	if input.AvailableUntil != nil {
+		setFields["modules.$[mod].items.$[it].availableUntil"] = *input.AvailableUntil
+	}
+	if input.Optional != nil {
+		setFields["modules.$[mod].items.$[it].optional"] = *input.Optional
+	}
+	if input.PassScore != nil {
+		if *input.PassScore < 0 {
+			writeError(w, http.StatusBadRequest, "passScore cannot be negative")
+			return
+		}
+		setFields["modules.$[mod].items.$[it].passScore"] = *input.PassScore
+	}
+
+	if len(setFields) == 0 && input.GroupIDs == nil {
+		writeError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+
+	setFields["updatedAt"] = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capEditContent) {
+		return
+	}
+	module, item := findItem(course, itemOID)
+	if module == nil || module.ID != moduleOID {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+	patched := *item
+	if input.Type != nil {
+		patched.Type = strings.TrimSpace(*input.Type)
+	}
+	if toolOID != nil {
+		patched.ToolID = toolOID
+	}
+	if err := validateItemKind(&patched); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.GroupIDs != nil {
+		groupIDs, err := parseCourseGroupIDs(ctx, courseOID, *input.GroupIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		page = p
+		setFields["modules.$[mod].items.$[it].groupIds"] = groupIDs
+	}
+
+	opts := options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"mod._id": moduleOID}, bson.M{"it._id": itemOID}},
+	})
+
+	if updateCourseVersioned(ctx, w, r, courseOID, moduleOID, bson.M{"$set": setFields}, opts) == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "item updated"})
+}
+
+// courseSorts maps the sort parameter to its keyset fields. relevance has
+// none: text scores cannot be range-queried, so it pages by offset.
+var courseSorts = map[string][]sortField{
+	"createdAt_desc": {{Path: "createdAt", Desc: true}, {Path: "_id", Desc: true}},
+	"createdAt_asc":  {{Path: "createdAt"}, {Path: "_id"}},
+	"title_asc":      {{Path: "title"}, {Path: "_id"}},
+	"title_desc":     {{Path: "title", Desc: true}, {Path: "_id", Desc: true}},
+	"relevance":      nil,
+}
+
+func parseSort(sortParam string) (string, []sortField, error) {
+	name := strings.TrimSpace(sortParam)
+	if name == "" {
+		name = "createdAt_desc"
 	}
+	fields, ok := courseSorts[name]
+	if !ok {
+		return "", nil, errorf("invalid sort")
+	}
+	return name, fields, nil
+}
 
-	if v := r.URL.Query().Get("limit"); v != "" {
-		l, err := strconv.Atoi(v)
-		if err != nil || l < 1 {
-			return 0, 0, errorf("invalid limit")
+func courseSortValues(c *models.Course, fields []sortField) []interface{} {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		switch f.Path {
+		case "createdAt":
+			values[i] = c.CreatedAt
+		case "title":
+			values[i] = c.Title
+		case "_id":
+			values[i] = c.ID
 		}
-		if l > 100 {
-			l = 100
+	}
+	return values
+}
+
+// buildCourse validates a create payload and turns it into a new course
+// document. Shared by CreateCourse and course import.
+func buildCourse(input courseCreateInput) (models.Course, error) {
+	if strings.TrimSpace(input.Title) == "" {
+		return models.Course{}, errorf("title is required")
+	}
+	if strings.TrimSpace(input.Category) == "" {
+		return models.Course{}, errorf("category is required")
+	}
+	if strings.TrimSpace(input.TeacherID) == "" {
+		return models.Course{}, errorf("teacherId is required")
+	}
+
+	teacherOID, err := primitive.ObjectIDFromHex(input.TeacherID)
+	if err != nil {
+		return models.Course{}, errorf("invalid teacherId")
+	}
+
+	status := strings.TrimSpace(input.Status)
+	if status == "" {
+		status = models.CourseStatusDraft
+	}
+	if !validCourseStatus(status) {
+		return models.Course{}, errorf("invalid status")
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return models.Course{}, err
+	}
+	if input.Capacity < 0 {
+		return models.Course{}, errorf("capacity cannot be negative")
+	}
+	if input.EnrollmentDays < 0 {
+		return models.Course{}, errorf("enrollmentDays cannot be negative")
+	}
+	if input.EnrollmentMethod != "" && !validEnrollmentMethod(input.EnrollmentMethod) {
+		return models.Course{}, errorf("invalid enrollmentMethod")
+	}
+	keyHash := ""
+	if input.EnrollmentKey != "" {
+		if keyHash, err = hashEnrollmentKey(input.EnrollmentKey); err != nil {
+			return models.Course{}, err
 		}
-		limit = l
 	}
 
-	return page, limit, nil
+	if err := validateModulesInput(input.Modules); err != nil {
+		return models.Course{}, err
+	}
+
+	now := time.Now()
+	course := models.Course{
+		ID:                primitive.NewObjectID(),
+		Title:             strings.TrimSpace(input.Title),
+		Description:       strings.TrimSpace(input.Description),
+		Category:          strings.TrimSpace(input.Category),
+		Tags:              tags,
+		TeacherID:         teacherOID,
+		Capacity:          input.Capacity,
+		EnrollmentMethod:  input.EnrollmentMethod,
+		EnrollmentKeyHash: keyHash,
+		EnrollmentDays:    input.EnrollmentDays,
+		Status:            status,
+		Modules:           mapModulesInput(input.Modules),
+		Version:           1,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if status == models.CourseStatusPublished {
+		course.PublishedAt = &now
+	}
+	return course, nil
 }
 
-func parseSort(sortParam string) (bson.D, error) {
-	switch strings.TrimSpace(sortParam) {
-	case "", "createdAt_desc":
-		return bson.D{{Key: "createdAt", Value: -1}}, nil
-	case "createdAt_asc":
-		return bson.D{{Key: "createdAt", Value: 1}}, nil
-	case "title_asc":
-		return bson.D{{Key: "title", Value: 1}}, nil
-	case "title_desc":
-		return bson.D{{Key: "title", Value: -1}}, nil
+func validCourseStatus(status string) bool {
+	switch status {
+	case models.CourseStatusDraft, models.CourseStatusPublished, models.CourseStatusArchived:
+		return true
 	default:
-		return nil, errorf("invalid sort")
+		return false
 	}
 }
 
+func validateModulesInput(inputs []courseModuleInput) error {
+	for _, m := range inputs {
+		if err := validateWindow(m.AvailableFrom, m.AvailableUntil); err != nil {
+			return err
+		}
+		if err := validateItemsInput(m.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateItemsInput(inputs []courseItemInput) error {
+	for _, i := range inputs {
+		if err := validateWindow(i.AvailableFrom, i.AvailableUntil); err != nil {
+			return err
+		}
+		if err := validateItemURL(i.URL); err != nil {
+			return err
+		}
+		if err := validateActivityID(i.ActivityID); err != nil {
+			return err
+		}
+		if strings.TrimSpace(i.ToolID) != "" {
+			if _, err := primitive.ObjectIDFromHex(strings.TrimSpace(i.ToolID)); err != nil {
+				return errorf("invalid toolId")
+			}
+		} else if strings.TrimSpace(i.Type) == models.ItemTypeLti {
+			return errorf("lti items require a toolId")
+		}
+		if i.PassScore < 0 || (i.MaxScore > 0 && i.PassScore > i.MaxScore) {
+			return errorf("passScore must be between 0 and maxScore")
+		}
+	}
+	return nil
+}
+
+// validateItemKind checks that an item carries what its type needs: lti
+// items a tool, scorm items a package.
+func validateItemKind(item *models.CourseItem) error {
+	switch item.Type {
+	case models.ItemTypeLti:
+		if item.ToolID == nil {
+			return errorf("lti items require a toolId")
+		}
+	case models.ItemTypeScorm:
+		if item.PackageID == nil {
+			return errorf("scorm items require a packageId")
+		}
+	}
+	return nil
+}
+
+func validateItemURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errorf("invalid item url")
+	}
+	return nil
+}
+
+// validateActivityID checks the xAPI activity IRI an item is linked to.
+func validateActivityID(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && !isIRI(raw) {
+		return errorf("activityId must be an IRI")
+	}
+	return nil
+}
+
 func mapModulesInput(inputs []courseModuleInput) []models.CourseModule {
 	modules := []models.CourseModule{}
 	for _, m := range inputs {
@@ -546,10 +1117,12 @@ func mapModulesInput(inputs []courseModuleInput) []models.CourseModule {
 		}
 
 		module := models.CourseModule{
-			ID:    modID,
-			Title: strings.TrimSpace(m.Title),
-			Order: m.Order,
-			Items: mapItemsInput(m.Items),
+			ID:             modID,
+			Title:          strings.TrimSpace(m.Title),
+			Order:          m.Order,
+			Items:          mapItemsInput(m.Items),
+			AvailableFrom:  m.AvailableFrom,
+			AvailableUntil: m.AvailableUntil,
 		}
 		modules = append(modules, module)
 	}
@@ -567,11 +1140,20 @@ func mapItemsInput(inputs []courseItemInput) []models.CourseItem {
 		}
 
 		item := models.CourseItem{
-			ID:       itemID,
-			Type:     strings.TrimSpace(i.Type),
-			Title:    strings.TrimSpace(i.Title),
-			MaxScore: i.MaxScore,
-			Order:    i.Order,
+			ID:             itemID,
+			Type:           strings.TrimSpace(i.Type),
+			Title:          strings.TrimSpace(i.Title),
+			MaxScore:       i.MaxScore,
+			Order:          i.Order,
+			URL:            strings.TrimSpace(i.URL),
+			ActivityID:     strings.TrimSpace(i.ActivityID),
+			AvailableFrom:  i.AvailableFrom,
+			AvailableUntil: i.AvailableUntil,
+			Optional:       i.Optional,
+			PassScore:      i.PassScore,
+		}
+		if toolOID, err := primitive.ObjectIDFromHex(strings.TrimSpace(i.ToolID)); err == nil {
+			item.ToolID = &toolOID
 		}
 		items = append(items, item)
 	}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+type courseCloneInput struct {
+	Title          string `json:"title"`
+	TeacherID      string `json:"teacherId"`
+	DateOffsetDays int    `json:"dateOffsetDays"`
+}
+
+// cloneCourse deep-copies the course structure with fresh ids. Enrollments
+// and progress live in their own collections and are never copied. The copy
+// starts as a draft and remembers where it came from.
+func cloneCourse(src *models.Course, teacherID primitive.ObjectID, title string, offset time.Duration) models.Course {
+	now := time.Now()
+
+	// Item ids are regenerated up front so item prerequisites can follow.
+	itemIDs := map[primitive.ObjectID]primitive.ObjectID{}
+	for _, m := range src.Modules {
+		for _, it := range m.Items {
+			itemIDs[it.ID] = primitive.NewObjectID()
+		}
+	}
+
+	modules := make([]models.CourseModule, 0, len(src.Modules))
+	for _, m := range src.Modules {
+		module := m
+		module.ID = primitive.NewObjectID()
+		// Groups belong to the source course and are not copied.
+		module.GroupIDs = nil
+		module.AvailableFrom = shiftTime(m.AvailableFrom, offset)
+		module.AvailableUntil = shiftTime(m.AvailableUntil, offset)
+
+		module.Items = make([]models.CourseItem, 0, len(m.Items))
+		for _, it := range m.Items {
+			item := it
+			item.ID = itemIDs[it.ID]
+			item.GroupIDs = nil
+			// xAPI statements find their item by activityId, so the copy
+			// must not answer for the source's activities.
+			item.ActivityID = ""
+			item.Prerequisites = nil
+			for _, req := range it.Prerequisites {
+				if id, ok := itemIDs[req]; ok {
+					item.Prerequisites = append(item.Prerequisites, id)
+				}
+			}
+			item.AvailableFrom = shiftTime(it.AvailableFrom, offset)
+			item.AvailableUntil = shiftTime(it.AvailableUntil, offset)
+			module.Items = append(module.Items, item)
+		}
+		modules = append(modules, module)
+	}
+
+	if title == "" {
+		title = src.Title
+	}
+	sourceID := src.ID
+
+	var completion *models.CompletionRules
+	if src.Completion != nil {
+		rules := *src.Completion
+		rules.PassedItems = nil
+		for _, id := range src.Completion.PassedItems {
+			if newID, ok := itemIDs[id]; ok {
+				rules.PassedItems = append(rules.PassedItems, newID)
+			}
+		}
+		completion = &rules
+	}
+
+	return models.Course{
+		ID:               primitive.NewObjectID(),
+		Title:            title,
+		Description:      src.Description,
+		Category:         src.Category,
+		Tags:             src.Tags,
+		Capacity:         src.Capacity,
+		EnrollmentMethod: src.EnrollmentMethod,
+		EnrollmentDays:   src.EnrollmentDays,
+		Completion:       completion,
+		Certificate:      src.Certificate,
+		AtRisk:           src.AtRisk,
+		Prerequisites:    src.Prerequisites,
+		TeacherID:        teacherID,
+		Status:           models.CourseStatusDraft,
+		Modules:          modules,
+		SourceCourseID:   &sourceID,
+		Version:          1,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+}
+
+func shiftTime(t *time.Time, offset time.Duration) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := t.Add(offset)
+	return &shifted
+}
+
+func CloneCourse(w http.ResponseWriter, r *http.Request) {
+	copyCourse(w, r, false)
+}
+
+func InstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	copyCourse(w, r, true)
+}
+
+// copyCourse creates a draft copy owned by the caller. Only admins may
+// hand the copy to someone else with teacherId; for anyone else it is
+// ignored.
+func copyCourse(w http.ResponseWriter, r *http.Request, fromTemplate bool) {
+	user, err := getUserFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	userID := user.ID
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	var input courseCloneInput
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &input); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+
+	teacherOID := userID
+	if strings.TrimSpace(input.TeacherID) != "" && user.Role == models.RoleAdmin {
+		teacherOID, err = primitive.ObjectIDFromHex(input.TeacherID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid teacherId")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	src := loadCourse(ctx, w, oid)
+	if src == nil {
+		return
+	}
+
+	// Templates are a shared library; any other course can only be copied
+	// by staff who may edit it.
+	if fromTemplate {
+		if !src.IsTemplate {
+			writeError(w, http.StatusNotFound, "template not found")
+			return
+		}
+	} else if !requireCourseCapability(w, src, userID, capEditContent) {
+		return
+	}
+
+	offset := time.Duration(input.DateOffsetDays) * 24 * time.Hour
+	course := cloneCourse(src, teacherOID, strings.TrimSpace(input.Title), offset)
+
+	if _, err := db.GetCollection("courses").InsertOne(ctx, course); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to clone course")
+		return
+	}
+
+	w.Header().Set("ETag", courseETag(course.Version))
+	writeJSON(w, http.StatusCreated, course)
+}
+
+// GetTemplates lists the template library by title, cursor-paged like
+// GET /courses.
+func GetTemplates(w http.ResponseWriter, r *http.Request) {
+	pg, err := parseListPage(r, "title_asc", "category")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sortFields := courseSorts["title_asc"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"isTemplate": true}
+	if category := strings.TrimSpace(r.URL.Query().Get("category")); category != "" {
+		clause, err := categoryFilterClause(ctx, category)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to resolve category")
+			return
+		}
+		filter["category"] = clause["category"]
+	}
+
+	collection := db.GetCollection("courses")
+
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count templates")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(sortFields); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(sortFields)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch templates")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	templates := []models.Course{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode templates")
+		return
+	}
+
+	fetched := len(templates)
+	if fetched > pg.Limit {
+		templates = templates[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(templates)
+	}
+	var first, last []interface{}
+	if len(templates) > 0 {
+		first = courseSortValues(&templates[0], sortFields)
+		last = courseSortValues(&templates[len(templates)-1], sortFields)
+	}
+	links := pg.keysetLinks(fetched, first, last)
+	for i := range templates {
+		templates[i].Status = courseStatusOf(&templates[i])
+	}
+
+	resp := map[string]interface{}{
+		"items": templates,
+		"limit": pg.Limit,
+	}
+	if links.Next != "" {
+		resp["nextCursor"] = links.Next
+	}
+	if links.Prev != "" {
+		resp["prevCursor"] = links.Prev
+	}
+	setLinkHeader(w, r, links)
+	writeJSON(w, http.StatusOK, resp)
+}
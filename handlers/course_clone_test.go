@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestCloneCourse(t *testing.T) {
+	start := time.Date(2026, 2, 1, 9, 0, 0, 0, time.UTC)
+	group := primitive.NewObjectID()
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	src := &models.Course{
+		ID:                primitive.NewObjectID(),
+		Title:             "Go 101",
+		TeacherID:         primitive.NewObjectID(),
+		Staff:             []models.CourseStaff{{UserID: primitive.NewObjectID(), Role: models.CourseRoleTA}},
+		Status:            models.CourseStatusPublished,
+		EnrollmentKeyHash: "hash",
+		SeatsTaken:        12,
+		Completion:        &models.CompletionRules{PassedItems: []primitive.ObjectID{second, primitive.NewObjectID()}},
+		Modules: []models.CourseModule{{
+			ID:            primitive.NewObjectID(),
+			GroupIDs:      []primitive.ObjectID{group},
+			AvailableFrom: &start,
+			Items: []models.CourseItem{
+				{ID: first, Title: "Read", ActivityID: "https://example.com/a", GroupIDs: []primitive.ObjectID{group}},
+				{ID: second, Title: "Quiz", Prerequisites: []primitive.ObjectID{first, primitive.NewObjectID()}, AvailableUntil: &start},
+			},
+		}},
+	}
+	teacher := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		title     string
+		offset    time.Duration
+		wantTitle string
+	}{
+		{"same dates", "", 0, "Go 101"},
+		{"shifted copy", "Go 101 (spring)", 7 * 24 * time.Hour, "Go 101 (spring)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cloneCourse(src, teacher, tt.title, tt.offset)
+
+			if c.ID == src.ID || c.Title != tt.wantTitle || c.TeacherID != teacher {
+				t.Errorf("course = %v %q %v", c.ID, c.Title, c.TeacherID)
+			}
+			if c.Status != models.CourseStatusDraft || c.SourceCourseID == nil || *c.SourceCourseID != src.ID {
+				t.Errorf("status = %q, source = %v", c.Status, c.SourceCourseID)
+			}
+			if c.Staff != nil || c.EnrollmentKeyHash != "" || c.SeatsTaken != 0 {
+				t.Errorf("copied staff, key or seats: %+v", c)
+			}
+
+			m := c.Modules[0]
+			if m.ID == src.Modules[0].ID || m.GroupIDs != nil {
+				t.Errorf("module id %v, groups %v", m.ID, m.GroupIDs)
+			}
+			if !m.AvailableFrom.Equal(start.Add(tt.offset)) {
+				t.Errorf("availableFrom = %v", m.AvailableFrom)
+			}
+			read, quiz := m.Items[0], m.Items[1]
+			if read.ID == first || quiz.ID == second {
+				t.Error("item ids were kept")
+			}
+			if read.ActivityID != "" || read.GroupIDs != nil {
+				t.Errorf("read = %+v", read)
+			}
+			if len(quiz.Prerequisites) != 1 || quiz.Prerequisites[0] != read.ID {
+				t.Errorf("prerequisites = %v, want [%v]", quiz.Prerequisites, read.ID)
+			}
+			if !quiz.AvailableUntil.Equal(start.Add(tt.offset)) {
+				t.Errorf("availableUntil = %v", quiz.AvailableUntil)
+			}
+			if got := c.Completion.PassedItems; len(got) != 1 || got[0] != quiz.ID {
+				t.Errorf("passedItems = %v, want [%v]", got, quiz.ID)
+			}
+		})
+	}
+
+	if src.Modules[0].Items[0].ActivityID == "" || src.Modules[0].Items[1].Prerequisites[0] != first {
+		t.Error("cloning changed the source course")
+	}
+}
@@ -0,0 +1,1113 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/imscc"
+	"AP_Final/models"
+	"AP_Final/scorm"
+)
+
+const (
+	courseExportSchema        = "mini-moodle/course"
+	courseExportSchemaVersion = 2
+	courseExportFile          = "course.json"
+	maxImportSize             = 32 << 20
+	// SCORM packages travel in export archives as scorm/<packageId>.zip.
+	scormExportDir = "scorm/"
+)
+
+// courseExportDocument is the self-describing envelope written by export and
+// accepted by import. The course body reuses the create payload so import
+// goes through the same validation as POST /courses. Since version 2 the
+// envelope also carries what POST /courses does not take; its ids refer to
+// the exported groups, modules and items and are remapped along with them.
+type courseExportDocument struct {
+	Schema        string                        `json:"schema"`
+	SchemaVersion int                           `json:"schemaVersion"`
+	ExportedAt    time.Time                     `json:"exportedAt"`
+	CourseID      string                        `json:"courseId"`
+	Course        courseCreateInput             `json:"course"`
+	Groups        []courseExportGroup           `json:"groups,omitempty"`
+	Modules       map[string]courseExportModule `json:"modules,omitempty"`
+	Items         map[string]courseExportItem   `json:"items,omitempty"`
+	// Prerequisites name other courses of the source server; they are not
+	// remapped.
+	Prerequisites []coursePrerequisiteInput `json:"prerequisites,omitempty"`
+	// Completion holds the completion rules; passedItems are exported ids.
+	Completion  *completionRulesInput       `json:"completion,omitempty"`
+	Certificate *models.CertificateTemplate `json:"certificate,omitempty"`
+	AtRisk      *models.AtRiskSettings      `json:"atRisk,omitempty"`
+}
+
+// courseExportGroup is a group without its TAs, who are users of the
+// source database.
+type courseExportGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type courseExportModule struct {
+	GroupIDs []string `json:"groupIds,omitempty"`
+}
+
+type courseExportItem struct {
+	GroupIDs      []string `json:"groupIds,omitempty"`
+	PackageID     string   `json:"packageId,omitempty"`
+	Prerequisites []string `json:"prerequisites,omitempty"`
+}
+
+// packageIDs lists the SCORM packages the exported items play.
+func (doc *courseExportDocument) packageIDs() []string {
+	ids := []string{}
+	for _, item := range doc.Items {
+		if item.PackageID != "" && !slices.Contains(ids, item.PackageID) {
+			ids = append(ids, item.PackageID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+type importConflict struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func courseToInput(course *models.Course) courseCreateInput {
+	modules := make([]courseModuleInput, 0, len(course.Modules))
+	for _, m := range course.Modules {
+		items := make([]courseItemInput, 0, len(m.Items))
+		for _, it := range m.Items {
+			toolID := ""
+			if it.ToolID != nil {
+				toolID = it.ToolID.Hex()
+			}
+			items = append(items, courseItemInput{
+				ID:             it.ID.Hex(),
+				Type:           it.Type,
+				Title:          it.Title,
+				MaxScore:       it.MaxScore,
+				Order:          it.Order,
+				URL:            it.URL,
+				ActivityID:     it.ActivityID,
+				ToolID:         toolID,
+				AvailableFrom:  it.AvailableFrom,
+				AvailableUntil: it.AvailableUntil,
+				Optional:       it.Optional,
+				PassScore:      it.PassScore,
+			})
+		}
+		modules = append(modules, courseModuleInput{
+			ID:             m.ID.Hex(),
+			Title:          m.Title,
+			Order:          m.Order,
+			Items:          items,
+			AvailableFrom:  m.AvailableFrom,
+			AvailableUntil: m.AvailableUntil,
+		})
+	}
+
+	return courseCreateInput{
+		Title:            course.Title,
+		Description:      course.Description,
+		Category:         course.Category,
+		Tags:             course.Tags,
+		TeacherID:        course.TeacherID.Hex(),
+		Status:           courseStatusOf(course),
+		Capacity:         course.Capacity,
+		EnrollmentMethod: course.EnrollmentMethod,
+		EnrollmentDays:   course.EnrollmentDays,
+		Modules:          modules,
+	}
+}
+
+func ExportCourse(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	format := strings.TrimSpace(r.URL.Query().Get("format"))
+	if format != "" && format != "json" && format != "zip" && format != "imscc" {
+		writeError(w, http.StatusBadRequest, "invalid format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capEditContent) {
+		return
+	}
+
+	doc, err := buildCourseExport(ctx, course)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build export")
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "zip":
+		if err := writeCourseExportZip(zip.NewWriter(&buf), doc); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to build export archive")
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="course-`+course.ID.Hex()+`.zip"`)
+	case "imscc":
+		if err := imscc.Export(course, &buf); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to build cartridge")
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ims.imscc+zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="course-`+course.ID.Hex()+`.imscc"`)
+	default:
+		w.Header().Set("Content-Disposition", `attachment; filename="course-`+course.ID.Hex()+`.json"`)
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func buildCourseExport(ctx context.Context, course *models.Course) (*courseExportDocument, error) {
+	doc := &courseExportDocument{
+		Schema:        courseExportSchema,
+		SchemaVersion: courseExportSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		CourseID:      course.ID.Hex(),
+		Course:        courseToInput(course),
+		Modules:       map[string]courseExportModule{},
+		Items:         map[string]courseExportItem{},
+	}
+
+	cursor, err := db.GetCollection("groups").Find(ctx, bson.M{"courseId": course.ID}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		doc.Groups = append(doc.Groups, courseExportGroup{ID: g.ID.Hex(), Name: g.Name})
+	}
+
+	for _, p := range course.Prerequisites {
+		minCompletion := p.MinCompletion
+		doc.Prerequisites = append(doc.Prerequisites, coursePrerequisiteInput{CourseID: p.CourseID.Hex(), MinCompletion: &minCompletion})
+	}
+
+	doc.Certificate = course.Certificate
+	doc.AtRisk = course.AtRisk
+	if c := course.Completion; c != nil {
+		doc.Completion = &completionRulesInput{
+			RequiredItems: c.RequiredItems,
+			MinGrade:      c.MinGrade,
+			PassedItems:   hexIDs(c.PassedItems),
+			MinModules:    c.MinModules,
+		}
+	}
+
+	for _, m := range course.Modules {
+		if len(m.GroupIDs) > 0 {
+			doc.Modules[m.ID.Hex()] = courseExportModule{GroupIDs: hexIDs(m.GroupIDs)}
+		}
+		for _, it := range m.Items {
+			item := courseExportItem{GroupIDs: hexIDs(it.GroupIDs), Prerequisites: hexIDs(it.Prerequisites)}
+			if it.PackageID != nil {
+				item.PackageID = it.PackageID.Hex()
+			}
+			if !reflect.ValueOf(item).IsZero() {
+				doc.Items[it.ID.Hex()] = item
+			}
+		}
+	}
+	return doc, nil
+}
+
+func hexIDs(ids []primitive.ObjectID) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, id.Hex())
+	}
+	return out
+}
+
+func writeCourseExportZip(zw *zip.Writer, doc *courseExportDocument) error {
+	f, err := zw.Create(courseExportFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	for _, id := range doc.packageIDs() {
+		f, err := zw.Create(scormExportDir + id + ".zip")
+		if err != nil {
+			return err
+		}
+		if err := scorm.Pack(filepath.Join(scormStorageDir(), id), f); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// readCourseExport reads the export document, from a zip archive when the
+// request says so; the archive is returned for the files it carries.
+func readCourseExport(r *http.Request) (*courseExportDocument, *zip.Reader, error) {
+	isZip := strings.HasPrefix(r.Header.Get("Content-Type"), "application/zip")
+	limit := int64(maxImportSize)
+	if isZip {
+		limit = maxScormUpload
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, nil, errorf("failed to read body")
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, errorf("import is too large")
+	}
+
+	var archive *zip.Reader
+	if isZip {
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, nil, errorf("invalid zip archive")
+		}
+		archive = zr
+		body = nil
+		for _, f := range zr.File {
+			if f.Name != courseExportFile {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, nil, errorf("invalid zip archive")
+			}
+			body, err = io.ReadAll(io.LimitReader(rc, maxImportSize))
+			rc.Close()
+			if err != nil {
+				return nil, nil, errorf("invalid zip archive")
+			}
+		}
+		if body == nil {
+			return nil, nil, errorf(courseExportFile + " not found in archive")
+		}
+	}
+
+	// The version is checked first, so a document from a newer server is
+	// reported as such rather than as having unknown fields.
+	var envelope struct {
+		Schema        string `json:"schema"`
+		SchemaVersion int    `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, nil, errorf("invalid json body")
+	}
+	if envelope.Schema != courseExportSchema {
+		return nil, nil, errorf("unsupported schema")
+	}
+	if envelope.SchemaVersion < 1 || envelope.SchemaVersion > courseExportSchemaVersion {
+		return nil, nil, errorf("unsupported schemaVersion")
+	}
+
+	var doc courseExportDocument
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, errorf("invalid json body")
+	}
+	return &doc, archive, nil
+}
+
+// importIDs maps the group, module, item and package ids of an export
+// document to the ids they get on import.
+type importIDs struct {
+	groups   map[string]primitive.ObjectID
+	modules  map[string]primitive.ObjectID
+	items    map[string]primitive.ObjectID
+	packages map[string]primitive.ObjectID
+}
+
+// assignImportIDs picks the ids the imported groups, modules and items get:
+// fresh ones when remapping, as in cloneCourse, or the exported ones. The
+// course body is rewritten to use them. A remapped copy also drops the
+// items' xAPI activity ids, which would otherwise still match the source.
+func assignImportIDs(doc *courseExportDocument, remap bool) importIDs {
+	ids := importIDs{
+		groups:  map[string]primitive.ObjectID{},
+		modules: map[string]primitive.ObjectID{},
+		items:   map[string]primitive.ObjectID{},
+	}
+	assign := func(m map[string]primitive.ObjectID, id string) string {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if remap || err != nil {
+			oid = primitive.NewObjectID()
+		}
+		if id != "" {
+			m[id] = oid
+		}
+		return oid.Hex()
+	}
+	for i := range doc.Groups {
+		doc.Groups[i].ID = assign(ids.groups, doc.Groups[i].ID)
+	}
+	for i := range doc.Course.Modules {
+		module := &doc.Course.Modules[i]
+		module.ID = assign(ids.modules, module.ID)
+		for j := range module.Items {
+			module.Items[j].ID = assign(ids.items, module.Items[j].ID)
+			if remap {
+				module.Items[j].ActivityID = ""
+			}
+		}
+	}
+	return ids
+}
+
+func resolveImportIDs(m map[string]primitive.ObjectID, kind string, ids []string) ([]primitive.ObjectID, error) {
+	var out []primitive.ObjectID
+	for _, id := range ids {
+		oid, ok := m[id]
+		if !ok {
+			return nil, errorf("unknown " + kind + " " + id)
+		}
+		out = append(out, oid)
+	}
+	return out, nil
+}
+
+// applyImportSettings copies the envelope's settings onto the built course
+// and returns the groups to create with it.
+func applyImportSettings(doc *courseExportDocument, ids importIDs, course *models.Course) ([]models.Group, error) {
+	now := time.Now()
+	groups := []models.Group{}
+	names := map[string]bool{}
+	for _, g := range doc.Groups {
+		name := strings.TrimSpace(g.Name)
+		if name == "" {
+			return nil, errorf("group name is required")
+		}
+		if names[name] {
+			return nil, errorf("duplicate group name " + name)
+		}
+		names[name] = true
+		oid, _ := primitive.ObjectIDFromHex(g.ID)
+		groups = append(groups, models.Group{ID: oid, CourseID: course.ID, Name: name, CreatedAt: now, UpdatedAt: now})
+	}
+
+	modules := map[string]*models.CourseModule{}
+	items := map[string]*models.CourseItem{}
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		modules[module.ID.Hex()] = module
+		for j := range module.Items {
+			items[module.Items[j].ID.Hex()] = &module.Items[j]
+		}
+	}
+
+	for id, settings := range doc.Modules {
+		oid, ok := ids.modules[id]
+		if !ok {
+			return nil, errorf("unknown module " + id)
+		}
+		module := modules[oid.Hex()]
+		var err error
+		if module.GroupIDs, err = resolveImportIDs(ids.groups, "group", settings.GroupIDs); err != nil {
+			return nil, err
+		}
+	}
+	graph := map[primitive.ObjectID][]primitive.ObjectID{}
+	for id, settings := range doc.Items {
+		oid, ok := ids.items[id]
+		if !ok {
+			return nil, errorf("unknown item " + id)
+		}
+		item := items[oid.Hex()]
+		var err error
+		if item.GroupIDs, err = resolveImportIDs(ids.groups, "group", settings.GroupIDs); err != nil {
+			return nil, err
+		}
+		if settings.PackageID != "" {
+			if item.Type != models.ItemTypeScorm {
+				return nil, errorf("packageId on non-scorm item " + id)
+			}
+			pkgOID, ok := ids.packages[settings.PackageID]
+			if !ok {
+				return nil, errorf("unknown scorm package " + settings.PackageID)
+			}
+			item.PackageID = &pkgOID
+		}
+		if item.Prerequisites, err = resolveImportIDs(ids.items, "item", settings.Prerequisites); err != nil {
+			return nil, err
+		}
+		if len(item.Prerequisites) > 0 {
+			graph[item.ID] = item.Prerequisites
+		}
+	}
+	if itemCycle(graph) {
+		return nil, errorf("item prerequisites would create a cycle")
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for _, p := range doc.Prerequisites {
+		oid, err := primitive.ObjectIDFromHex(p.CourseID)
+		if err != nil {
+			return nil, errorf("invalid prerequisite courseId")
+		}
+		if seen[oid] {
+			return nil, errorf("duplicate prerequisite course")
+		}
+		seen[oid] = true
+		minCompletion := 1.0
+		if p.MinCompletion != nil {
+			minCompletion = *p.MinCompletion
+		}
+		if minCompletion <= 0 || minCompletion > 1 {
+			return nil, errorf("minCompletion must be in (0, 1]")
+		}
+		course.Prerequisites = append(course.Prerequisites, models.CoursePrerequisite{CourseID: oid, MinCompletion: minCompletion})
+	}
+
+	if c := doc.Completion; c != nil {
+		if c.MinGrade < 0 || c.MinGrade > 1 {
+			return nil, errorf("minGrade must be between 0 and 1")
+		}
+		if c.MinModules < 0 || c.MinModules > len(course.Modules) {
+			return nil, errorf("minModules must be between 0 and the number of modules")
+		}
+		rules := models.CompletionRules{RequiredItems: c.RequiredItems, MinGrade: c.MinGrade, MinModules: c.MinModules}
+		passed, err := resolveImportIDs(ids.items, "item", c.PassedItems)
+		if err != nil {
+			return nil, err
+		}
+		for _, oid := range passed {
+			if !slices.Contains(rules.PassedItems, oid) {
+				rules.PassedItems = append(rules.PassedItems, oid)
+			}
+		}
+		if rules.RequiredItems || rules.MinGrade > 0 || len(rules.PassedItems) > 0 || rules.MinModules > 0 {
+			course.Completion = &rules
+		}
+	}
+
+	if doc.Certificate != nil {
+		certificate := *doc.Certificate
+		if err := normalizeCertificateTemplate(&certificate); err != nil {
+			return nil, err
+		}
+		course.Certificate = &certificate
+	}
+
+	if doc.AtRisk != nil && *doc.AtRisk != (models.AtRiskSettings{}) {
+		if err := validateAtRiskSettings(*doc.AtRisk); err != nil {
+			return nil, err
+		}
+		settings := *doc.AtRisk
+		course.AtRisk = &settings
+	}
+	return groups, nil
+}
+
+// keepKnownPrerequisites drops course prerequisites naming courses that do
+// not exist on this server, as an export from another server may, and
+// refuses cycles through the imported course. It writes the error response
+// and returns false on failure.
+func keepKnownPrerequisites(ctx context.Context, w http.ResponseWriter, course *models.Course) bool {
+	if len(course.Prerequisites) == 0 {
+		return true
+	}
+	ids := make([]primitive.ObjectID, 0, len(course.Prerequisites))
+	for _, p := range course.Prerequisites {
+		ids = append(ids, p.CourseID)
+	}
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+		return false
+	}
+	var existing []models.Course
+	if err := cursor.All(ctx, &existing); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+		return false
+	}
+	known := map[primitive.ObjectID]bool{}
+	for _, c := range existing {
+		known[c.ID] = true
+	}
+
+	kept := []models.CoursePrerequisite{}
+	ids = ids[:0]
+	for _, p := range course.Prerequisites {
+		if known[p.CourseID] {
+			kept = append(kept, p)
+			ids = append(ids, p.CourseID)
+		}
+	}
+	course.Prerequisites = kept
+	if len(kept) == 0 {
+		course.Prerequisites = nil
+		return true
+	}
+	cycle, err := courseCycle(ctx, course.ID, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+		return false
+	}
+	if cycle {
+		writeError(w, http.StatusBadRequest, "course prerequisites would create a cycle")
+		return false
+	}
+	return true
+}
+
+// importPackage is a SCORM package played by an imported item: bundled in
+// the archive, or already stored on this server when archive is nil.
+type importPackage struct {
+	id       primitive.ObjectID
+	archive  *zip.Reader
+	manifest *scorm.Manifest
+	size     int64
+}
+
+// planImportPackages resolves the packages the document refers to. Bundled
+// packages are validated like uploads and get fresh ids when remapping;
+// others must already exist here, as after a JSON export from this server,
+// and the importer must be able to edit a course that plays them.
+// It writes the error response and returns false on failure.
+func planImportPackages(ctx context.Context, w http.ResponseWriter, doc *courseExportDocument, archive *zip.Reader, remap bool, userID primitive.ObjectID) (map[string]*importPackage, []importConflict, bool) {
+	bundled := map[string]*zip.File{}
+	if archive != nil {
+		for _, f := range archive.File {
+			if name, ok := strings.CutPrefix(f.Name, scormExportDir); ok && strings.HasSuffix(name, ".zip") {
+				bundled[strings.TrimSuffix(name, ".zip")] = f
+			}
+		}
+	}
+
+	plan := map[string]*importPackage{}
+	conflicts := []importConflict{}
+	for _, id := range doc.packageIDs() {
+		oid, idErr := primitive.ObjectIDFromHex(id)
+		f, ok := bundled[id]
+		if !ok {
+			allowed := false
+			if idErr == nil {
+				var err error
+				if allowed, err = canReusePackage(ctx, oid, userID); err != nil {
+					writeError(w, http.StatusInternalServerError, "failed to check scorm packages")
+					return nil, nil, false
+				}
+			}
+			// Packages the importer cannot edit look missing.
+			if !allowed {
+				writeError(w, http.StatusBadRequest, "scorm package "+id+" not found")
+				return nil, nil, false
+			}
+			plan[id] = &importPackage{id: oid}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scorm package "+id)
+			return nil, nil, false
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxScormUpload))
+		rc.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scorm package "+id)
+			return nil, nil, false
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scorm package "+id)
+			return nil, nil, false
+		}
+		manifest, err := scorm.ParseManifest(zr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scorm package "+id+": "+err.Error())
+			return nil, nil, false
+		}
+
+		pkg := &importPackage{id: primitive.NewObjectID(), archive: zr, manifest: manifest, size: int64(len(data))}
+		if !remap {
+			if idErr != nil {
+				conflicts = append(conflicts, importConflict{Kind: "scormPackage", ID: id, Reason: "invalid id"})
+			} else {
+				pkg.id = oid
+				n, err := db.GetCollection("scorm_packages").CountDocuments(ctx, bson.M{"_id": oid}, options.Count().SetLimit(1))
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "failed to check scorm packages")
+					return nil, nil, false
+				}
+				if n > 0 {
+					conflicts = append(conflicts, importConflict{Kind: "scormPackage", ID: id, Reason: "already exists"})
+				}
+			}
+		}
+		plan[id] = pkg
+	}
+	return plan, conflicts, true
+}
+
+// canReusePackage reports whether userID may point an imported item at an
+// existing package: they must be able to edit the course it was uploaded to
+// or a course that already plays it, such as a clone.
+func canReusePackage(ctx context.Context, pkgOID, userID primitive.ObjectID) (bool, error) {
+	var pkg models.ScormPackage
+	opts := options.FindOne().SetProjection(bson.M{"courseId": 1})
+	err := db.GetCollection("scorm_packages").FindOne(ctx, bson.M{"_id": pkgOID}, opts).Decode(&pkg)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"$or": []bson.M{{"_id": pkg.CourseID}, {"modules.items.packageId": pkgOID}}}
+	cursor, err := db.GetCollection("courses").Find(ctx, filter, options.Find().SetProjection(bson.M{"teacherId": 1, "staff": 1}))
+	if err != nil {
+		return false, err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return false, err
+	}
+	for i := range courses {
+		if hasCourseCapability(&courses[i], userID, capEditContent) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// storeImportPackages unpacks the bundled packages for the imported course.
+// On failure the packages stored so far are removed again.
+func storeImportPackages(ctx context.Context, plan map[string]*importPackage, courseOID, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	stored := []primitive.ObjectID{}
+	for _, p := range plan {
+		if p.archive == nil {
+			continue
+		}
+		dir := filepath.Join(scormStorageDir(), p.id.Hex())
+		err := scorm.Extract(p.archive, dir)
+		if err == nil {
+			_, err = db.GetCollection("scorm_packages").InsertOne(ctx, models.ScormPackage{
+				ID:         p.id,
+				CourseID:   courseOID,
+				Version:    p.manifest.Version,
+				Title:      p.manifest.Title,
+				LaunchPath: p.manifest.LaunchPath,
+				Size:       p.size,
+				UploadedBy: userID,
+				CreatedAt:  time.Now(),
+			})
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			removeImportPackages(ctx, stored)
+			return nil, err
+		}
+		stored = append(stored, p.id)
+	}
+	return stored, nil
+}
+
+func removeImportPackages(ctx context.Context, ids []primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		os.RemoveAll(filepath.Join(scormStorageDir(), id.Hex()))
+	}
+	_, _ = db.GetCollection("scorm_packages").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+// findImportConflicts checks whether preserving the exported ids would clash
+// with the document itself or with courses already in the database.
+func findImportConflicts(ctx context.Context, doc *courseExportDocument) ([]importConflict, error) {
+	conflicts := []importConflict{}
+
+	courseOID, err := primitive.ObjectIDFromHex(doc.CourseID)
+	if err != nil {
+		conflicts = append(conflicts, importConflict{Kind: "course", ID: doc.CourseID, Reason: "invalid id"})
+	} else {
+		n, err := db.GetCollection("courses").CountDocuments(ctx, bson.M{"_id": courseOID}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			conflicts = append(conflicts, importConflict{Kind: "course", ID: doc.CourseID, Reason: "already exists"})
+		}
+	}
+
+	seen := map[string]bool{}
+	moduleIDs := []primitive.ObjectID{}
+	itemIDs := []primitive.ObjectID{}
+	check := func(kind, id string) (primitive.ObjectID, bool) {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			conflicts = append(conflicts, importConflict{Kind: kind, ID: id, Reason: "invalid id"})
+			return oid, false
+		}
+		if seen[id] {
+			conflicts = append(conflicts, importConflict{Kind: kind, ID: id, Reason: "duplicate id in document"})
+			return oid, false
+		}
+		seen[id] = true
+		return oid, true
+	}
+	groupIDs := []primitive.ObjectID{}
+	for _, g := range doc.Groups {
+		if oid, ok := check("group", g.ID); ok {
+			groupIDs = append(groupIDs, oid)
+		}
+	}
+	for _, m := range doc.Course.Modules {
+		if oid, ok := check("module", m.ID); ok {
+			moduleIDs = append(moduleIDs, oid)
+		}
+		for _, it := range m.Items {
+			if oid, ok := check("item", it.ID); ok {
+				itemIDs = append(itemIDs, oid)
+			}
+		}
+	}
+
+	used, err := existingCourseRefs(ctx, moduleIDs, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, oid := range moduleIDs {
+		if used[oid] {
+			conflicts = append(conflicts, importConflict{Kind: "module", ID: oid.Hex(), Reason: "used by another course"})
+		}
+	}
+	for _, oid := range itemIDs {
+		if used[oid] {
+			conflicts = append(conflicts, importConflict{Kind: "item", ID: oid.Hex(), Reason: "used by another course"})
+		}
+	}
+	if len(groupIDs) > 0 {
+		cursor, err := db.GetCollection("groups").Find(ctx, bson.M{"_id": bson.M{"$in": groupIDs}}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return nil, err
+		}
+		var existing []models.Group
+		if err := cursor.All(ctx, &existing); err != nil {
+			return nil, err
+		}
+		for _, g := range existing {
+			conflicts = append(conflicts, importConflict{Kind: "group", ID: g.ID.Hex(), Reason: "already exists"})
+		}
+	}
+
+	return conflicts, nil
+}
+
+func existingCourseRefs(ctx context.Context, moduleIDs, itemIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	used := map[primitive.ObjectID]bool{}
+	if len(moduleIDs) == 0 && len(itemIDs) == 0 {
+		return used, nil
+	}
+
+	filter := bson.M{"$or": []bson.M{
+		{"modules._id": bson.M{"$in": moduleIDs}},
+		{"modules.items._id": bson.M{"$in": itemIDs}},
+	}}
+	opts := options.Find().SetProjection(bson.M{"modules._id": 1, "modules.items._id": 1})
+	cursor, err := db.GetCollection("courses").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return nil, err
+	}
+	for _, c := range courses {
+		for _, m := range c.Modules {
+			used[m.ID] = true
+			for _, it := range m.Items {
+				used[it.ID] = true
+			}
+		}
+	}
+	return used, nil
+}
+
+func ImportCourse(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	userID := user.ID
+
+	query := r.URL.Query()
+	idMode := strings.TrimSpace(query.Get("idMode"))
+	if idMode == "" {
+		idMode = "remap"
+	}
+	if idMode != "remap" && idMode != "preserve" {
+		writeError(w, http.StatusBadRequest, "invalid idMode")
+		return
+	}
+	dryRun := query.Get("dryRun") == "true"
+
+	// Only admins may import a course on someone else's behalf.
+	teacherOID := userID
+	if v := strings.TrimSpace(query.Get("teacherId")); v != "" && user.Role == models.RoleAdmin {
+		teacherOID, err = primitive.ObjectIDFromHex(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid teacherId")
+			return
+		}
+	}
+
+	doc, archive, err := readCourseExport(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Unpacking bundled SCORM packages takes as long as an upload.
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	conflicts := []importConflict{}
+	if idMode == "preserve" {
+		conflicts, err = findImportConflicts(ctx, doc)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check conflicts")
+			return
+		}
+	}
+	plan, packageConflicts, ok := planImportPackages(ctx, w, doc, archive, idMode == "remap", userID)
+	if !ok {
+		return
+	}
+	conflicts = append(conflicts, packageConflicts...)
+	ids := assignImportIDs(doc, idMode == "remap")
+	ids.packages = map[string]primitive.ObjectID{}
+	for id, p := range plan {
+		ids.packages[id] = p.id
+	}
+
+	// Imported courses belong to the importing teacher; ids of users in the
+	// source database are meaningless here.
+	doc.Course.TeacherID = teacherOID.Hex()
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if course.Category, ok = checkCategory(ctx, w, course.Category); !ok {
+		return
+	}
+	if idMode == "preserve" {
+		if oid, err := primitive.ObjectIDFromHex(doc.CourseID); err == nil {
+			course.ID = oid
+		}
+	}
+	groups, err := applyImportSettings(doc, ids, &course)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !keepKnownPrerequisites(ctx, w, &course) {
+		return
+	}
+
+	if len(conflicts) > 0 {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "import conflicts",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"valid":     true,
+			"conflicts": conflicts,
+			"course":    course,
+			"groups":    groups,
+		})
+		return
+	}
+
+	stored, err := storeImportPackages(ctx, plan, course.ID, userID)
+	if err != nil {
+		if err == scorm.ErrUnsafePath || err == scorm.ErrTooLarge {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to store scorm packages")
+		return
+	}
+
+	if _, err := db.GetCollection("courses").InsertOne(ctx, course); err != nil {
+		removeImportPackages(ctx, stored)
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "course already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to import course")
+		return
+	}
+	if len(groups) > 0 {
+		docs := make([]interface{}, 0, len(groups))
+		for _, g := range groups {
+			docs = append(docs, g)
+		}
+		if _, err := db.GetCollection("groups").InsertMany(ctx, docs); err != nil {
+			// Without its groups the course would show restricted content
+			// to nobody, so the import is undone.
+			_, _ = db.GetCollection("courses").DeleteOne(ctx, bson.M{"_id": course.ID})
+			removeImportPackages(ctx, stored)
+			if mongo.IsDuplicateKeyError(err) {
+				writeError(w, http.StatusConflict, "group already exists")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to import groups")
+			return
+		}
+	}
+
+	w.Header().Set("ETag", courseETag(course.Version))
+	writeJSON(w, http.StatusCreated, course)
+}
+
+func cartridgeToInput(c *imscc.Course) courseCreateInput {
+	modules := make([]courseModuleInput, 0, len(c.Modules))
+	for i, m := range c.Modules {
+		items := make([]courseItemInput, 0, len(m.Items))
+		for j, it := range m.Items {
+			items = append(items, courseItemInput{
+				Type:     it.Type,
+				Title:    it.Title,
+				MaxScore: it.MaxScore,
+				Order:    j + 1,
+				URL:      it.URL,
+			})
+		}
+		modules = append(modules, courseModuleInput{Title: m.Title, Order: i + 1, Items: items})
+	}
+	return courseCreateInput{
+		Title:       c.Title,
+		Description: c.Description,
+		Modules:     modules,
+	}
+}
+
+// ImportCartridge creates a draft course from an IMS Common Cartridge
+// package. Resources that have no equivalent here are skipped and listed in
+// the response.
+func ImportCartridge(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun := query.Get("dryRun") == "true"
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if len(body) > maxImportSize {
+		writeError(w, http.StatusBadRequest, "import is too large")
+		return
+	}
+
+	result, err := imscc.Import(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid cartridge: "+err.Error())
+		return
+	}
+
+	input := cartridgeToInput(&result.Course)
+	input.Category = strings.TrimSpace(query.Get("category"))
+	input.TeacherID = userID.Hex()
+	if v := strings.TrimSpace(query.Get("title")); v != "" {
+		input.Title = v
+	}
+
+	course, err := buildCourse(input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var ok bool
+	if course.Category, ok = checkCategory(ctx, w, course.Category); !ok {
+		return
+	}
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"course":      course,
+			"unsupported": result.Unsupported,
+		})
+		return
+	}
+
+	if _, err := db.GetCollection("courses").InsertOne(ctx, course); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to import course")
+		return
+	}
+
+	w.Header().Set("ETag", courseETag(course.Version))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"course":      course,
+		"unsupported": result.Unsupported,
+	})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func importRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/courses/import", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestReadCourseExportVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"newer version with new fields", `{"schema":"mini-moodle/course","schemaVersion":99,"future":true,"course":{}}`, "unsupported schemaVersion"},
+		{"other schema", `{"schema":"other","schemaVersion":1}`, "unsupported schema"},
+		{"unknown field", `{"schema":"mini-moodle/course","schemaVersion":2,"future":true,"course":{}}`, "invalid json body"},
+		{"version 1", `{"schema":"mini-moodle/course","schemaVersion":1,"course":{"title":"T"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readCourseExport(importRequest(tt.body))
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("err = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func exportFixture(t *testing.T) *courseExportDocument {
+	t.Helper()
+	groupID := primitive.NewObjectID().Hex()
+	moduleID := primitive.NewObjectID().Hex()
+	itemID := primitive.NewObjectID().Hex()
+	body := `{
+  "schema": "mini-moodle/course",
+  "schemaVersion": 2,
+  "courseId": "` + primitive.NewObjectID().Hex() + `",
+  "course": {
+    "title": "Export", "category": "go", "teacherId": "` + primitive.NewObjectID().Hex() + `",
+    "modules": [{"id": "` + moduleID + `", "title": "M", "items": [{"id": "` + itemID + `", "type": "page", "title": "P", "activityId": "https://example.com/activities/p"}]}]
+  },
+  "groups": [{"id": "` + groupID + `", "name": "Evening"}],
+  "modules": {"` + moduleID + `": {"groupIds": ["` + groupID + `"]}},
+  "items": {"` + itemID + `": {"groupIds": ["` + groupID + `"]}}
+}`
+	doc, _, err := readCourseExport(importRequest(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestImportSettingsRemap(t *testing.T) {
+	for _, remap := range []bool{true, false} {
+		doc := exportFixture(t)
+		oldGroup := doc.Groups[0].ID
+		oldItem := doc.Course.Modules[0].Items[0].ID
+
+		ids := assignImportIDs(doc, remap)
+		course, err := buildCourse(doc.Course)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, err := applyImportSettings(doc, ids, &course)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(groups) != 1 || groups[0].Name != "Evening" || groups[0].CourseID != course.ID {
+			t.Fatalf("groups = %+v", groups)
+		}
+		if changed := groups[0].ID.Hex() != oldGroup; changed != remap {
+			t.Errorf("remap=%v: group id changed = %v", remap, changed)
+		}
+		if changed := course.Modules[0].Items[0].ID.Hex() != oldItem; changed != remap {
+			t.Errorf("remap=%v: item id changed = %v", remap, changed)
+		}
+		if kept := course.Modules[0].Items[0].ActivityID != ""; kept == remap {
+			t.Errorf("remap=%v: activityId kept = %v", remap, kept)
+		}
+		module := course.Modules[0]
+		if len(module.GroupIDs) != 1 || module.GroupIDs[0] != groups[0].ID {
+			t.Errorf("module groups = %v, want %v", module.GroupIDs, groups[0].ID)
+		}
+		if item := module.Items[0]; len(item.GroupIDs) != 1 || item.GroupIDs[0] != groups[0].ID {
+			t.Errorf("item groups = %v, want %v", item.GroupIDs, groups[0].ID)
+		}
+	}
+}
+
+func TestImportSettingsUnknownReference(t *testing.T) {
+	doc := exportFixture(t)
+	for id := range doc.Items {
+		doc.Items[id] = courseExportItem{GroupIDs: []string{primitive.NewObjectID().Hex()}}
+	}
+	ids := assignImportIDs(doc, true)
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err == nil || !strings.HasPrefix(err.Error(), "unknown group") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestImportSettingsPrerequisites(t *testing.T) {
+	doc := exportFixture(t)
+	first := doc.Course.Modules[0].Items[0]
+	second := first
+	second.ID = primitive.NewObjectID().Hex()
+	doc.Course.Modules[0].Items = append(doc.Course.Modules[0].Items, second)
+	doc.Items[second.ID] = courseExportItem{Prerequisites: []string{first.ID}}
+	required := primitive.NewObjectID()
+	minCompletion := 0.5
+	doc.Prerequisites = []coursePrerequisiteInput{{CourseID: required.Hex(), MinCompletion: &minCompletion}}
+
+	ids := assignImportIDs(doc, true)
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err != nil {
+		t.Fatal(err)
+	}
+	items := course.Modules[0].Items
+	if got := items[1].Prerequisites; len(got) != 1 || got[0] != items[0].ID {
+		t.Errorf("item prerequisites = %v, want %v", got, items[0].ID)
+	}
+	if got := course.Prerequisites; len(got) != 1 || got[0].CourseID != required || got[0].MinCompletion != 0.5 {
+		t.Errorf("course prerequisites = %+v", got)
+	}
+
+	// A cycle between the two items is refused.
+	doc = exportFixture(t)
+	first = doc.Course.Modules[0].Items[0]
+	second.ID = primitive.NewObjectID().Hex()
+	doc.Course.Modules[0].Items = append(doc.Course.Modules[0].Items, second)
+	doc.Items[first.ID] = courseExportItem{Prerequisites: []string{second.ID}}
+	doc.Items[second.ID] = courseExportItem{Prerequisites: []string{first.ID}}
+	ids = assignImportIDs(doc, true)
+	if course, err = buildCourse(doc.Course); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestImportSettingsCompletion(t *testing.T) {
+	doc := exportFixture(t)
+	itemID := doc.Course.Modules[0].Items[0].ID
+	doc.Completion = &completionRulesInput{MinGrade: 0.6, PassedItems: []string{itemID, itemID}, MinModules: 1}
+
+	ids := assignImportIDs(doc, true)
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err != nil {
+		t.Fatal(err)
+	}
+	rules := course.Completion
+	if rules == nil || rules.MinGrade != 0.6 || rules.MinModules != 1 {
+		t.Fatalf("completion = %+v", rules)
+	}
+	if len(rules.PassedItems) != 1 || rules.PassedItems[0] != course.Modules[0].Items[0].ID {
+		t.Errorf("passedItems = %v, want %v", rules.PassedItems, course.Modules[0].Items[0].ID)
+	}
+
+	doc = exportFixture(t)
+	doc.Completion = &completionRulesInput{MinModules: 2}
+	ids = assignImportIDs(doc, true)
+	if course, err = buildCourse(doc.Course); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err == nil || !strings.HasPrefix(err.Error(), "minModules") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestImportSettingsCertificate(t *testing.T) {
+	doc := exportFixture(t)
+	doc.Certificate = &models.CertificateTemplate{Title: "  Diploma ", Body: "{student} finished {course}"}
+	ids := assignImportIDs(doc, true)
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err != nil {
+		t.Fatal(err)
+	}
+	if c := course.Certificate; c == nil || c.Title != "Diploma" || c.Body != doc.Certificate.Body {
+		t.Errorf("certificate = %+v", c)
+	}
+
+	doc = exportFixture(t)
+	doc.Certificate = &models.CertificateTemplate{Body: strings.Repeat("x", 501)}
+	ids = assignImportIDs(doc, true)
+	if course, err = buildCourse(doc.Course); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err == nil || !strings.HasPrefix(err.Error(), "body") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestImportSettingsAtRisk(t *testing.T) {
+	doc := exportFixture(t)
+	doc.AtRisk = &models.AtRiskSettings{InactiveDays: 10, MinScore: 0.4}
+	ids := assignImportIDs(doc, true)
+	course, err := buildCourse(doc.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err != nil {
+		t.Fatal(err)
+	}
+	if course.AtRisk == nil || *course.AtRisk != *doc.AtRisk {
+		t.Errorf("atRisk = %+v", course.AtRisk)
+	}
+
+	doc = exportFixture(t)
+	doc.AtRisk = &models.AtRiskSettings{LowScore: 2}
+	ids = assignImportIDs(doc, true)
+	if course, err = buildCourse(doc.Course); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(doc, ids, &course); err == nil || !strings.HasPrefix(err.Error(), "lowScore") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// The envelope must survive a JSON round trip unchanged, since exports are
+// written with encoding/json and read back strictly.
+func TestCourseExportDocumentRoundTrip(t *testing.T) {
+	doc := exportFixture(t)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := readCourseExport(importRequest(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Groups) != 1 || len(again.Modules) != 1 || len(again.Items) != 1 {
+		t.Errorf("round trip = %+v", again)
+	}
+}
+
+const testScormManifest = `<manifest identifier="m" xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_rootv1p2">
+  <metadata><schema>ADL SCORM</schema><schemaversion>1.2</schemaversion></metadata>
+  <organizations default="o"><organization identifier="o"><title>Lesson</title>
+    <item identifier="i" identifierref="r"><title>Start</title></item>
+  </organization></organizations>
+  <resources><resource identifier="r" type="webcontent" adlcp:scormtype="sco" href="index.html"/></resources>
+</manifest>`
+
+func TestCourseExportZipCarriesScormPackages(t *testing.T) {
+	storage := t.TempDir()
+	t.Setenv("SCORM_STORAGE_DIR", storage)
+	pkgID := primitive.NewObjectID().Hex()
+	files := map[string]string{"imsmanifest.xml": testScormManifest, "index.html": "<p>hi</p>", "js/api.js": "// api"}
+	for name, body := range files {
+		target := filepath.Join(storage, pkgID, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	doc := exportFixture(t)
+	itemID := doc.Course.Modules[0].Items[0].ID
+	doc.Course.Modules[0].Items[0].Type = models.ItemTypeScorm
+	doc.Items[itemID] = courseExportItem{PackageID: pkgID}
+
+	var buf bytes.Buffer
+	if err := writeCourseExportZip(zip.NewWriter(&buf), doc); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/courses/import", bytes.NewReader(buf.Bytes()))
+	r.Header.Set("Content-Type", "application/zip")
+	imported, archive, err := readCourseExport(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	plan, conflicts, ok := planImportPackages(context.Background(), rec, imported, archive, true, primitive.NewObjectID())
+	if !ok {
+		t.Fatalf("plan: %d %s", rec.Code, rec.Body)
+	}
+	p := plan[pkgID]
+	if len(conflicts) != 0 || p == nil || p.archive == nil {
+		t.Fatalf("plan = %+v, conflicts = %+v", plan, conflicts)
+	}
+	if p.id.Hex() == pkgID {
+		t.Error("bundled package kept its id while remapping")
+	}
+	if p.manifest.LaunchPath != "index.html" || p.manifest.Title != "Lesson" {
+		t.Errorf("manifest = %+v", p.manifest)
+	}
+	if len(p.archive.File) != len(files) {
+		t.Errorf("package has %d files, want %d", len(p.archive.File), len(files))
+	}
+
+	ids := assignImportIDs(imported, true)
+	ids.packages = map[string]primitive.ObjectID{pkgID: p.id}
+	course, err := buildCourse(imported.Course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyImportSettings(imported, ids, &course); err != nil {
+		t.Fatal(err)
+	}
+	if got := course.Modules[0].Items[0].PackageID; got == nil || *got != p.id {
+		t.Errorf("item package = %v, want %v", got, p.id)
+	}
+}
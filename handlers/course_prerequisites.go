@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const maxPrerequisiteNodes = 100
+
+type coursePrerequisiteInput struct {
+	CourseID      string   `json:"courseId"`
+	MinCompletion *float64 `json:"minCompletion,omitempty"`
+}
+
+// prerequisitesInput replaces the whole prerequisite configuration of a
+// course: required courses, and per item the items that must be done first.
+type prerequisitesInput struct {
+	Courses []coursePrerequisiteInput `json:"courses"`
+	Items   map[string][]string       `json:"items"`
+}
+
+type unmetCourse struct {
+	CourseID       primitive.ObjectID `json:"courseId"`
+	Title          string             `json:"title,omitempty"`
+	MinCompletion  float64            `json:"minCompletion"`
+	CompletionRate float64            `json:"completionRate"`
+}
+
+type unmetItem struct {
+	ItemID primitive.ObjectID `json:"itemId"`
+	Title  string             `json:"title"`
+}
+
+type prerequisiteNode struct {
+	ID             primitive.ObjectID `json:"id"`
+	Title          string             `json:"title,omitempty"`
+	Status         string             `json:"status,omitempty"`
+	CompletionRate *float64           `json:"completionRate,omitempty"`
+}
+
+type prerequisiteEdge struct {
+	CourseID      primitive.ObjectID `json:"courseId"`
+	Requires      primitive.ObjectID `json:"requires"`
+	MinCompletion float64            `json:"minCompletion"`
+	Met           *bool              `json:"met,omitempty"`
+}
+
+type itemPrerequisites struct {
+	ItemID   primitive.ObjectID   `json:"itemId"`
+	Title    string               `json:"title"`
+	Requires []primitive.ObjectID `json:"requires"`
+	Met      *bool                `json:"met,omitempty"`
+}
+
+// completionRates computes done required items / required items per course
+// for a user, the ratio /me/progress reports as completionRate. Only items
+// visible to the user's group in each course count.
+func completionRates(ctx context.Context, userID primitive.ObjectID, courseIDs []primitive.ObjectID) (map[primitive.ObjectID]float64, error) {
+	rates := map[primitive.ObjectID]float64{}
+	if len(courseIDs) == 0 {
+		return rates, nil
+	}
+
+	groups, err := viewerGroupIDs(ctx, userID, courseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetProjection(bson.M{
+		"modules.groupIds":       1,
+		"modules.items._id":      1,
+		"modules.items.optional": 1,
+		"modules.items.groupIds": 1,
+	})
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"_id": bson.M{"$in": courseIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return nil, err
+	}
+	required := map[primitive.ObjectID][]primitive.ObjectID{}
+	for _, c := range courses {
+		for i := range c.Modules {
+			m := &c.Modules[i]
+			for j := range m.Items {
+				it := &m.Items[j]
+				if !it.Optional && itemVisibleToGroup(m, it, groups[c.ID]) {
+					required[c.ID] = append(required[c.ID], it.ID)
+				}
+			}
+		}
+	}
+
+	cursor, err = db.GetCollection("progress").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"userId": userID, "courseId": bson.M{"$in": courseIDs}, "status": "done"}},
+		{"$group": bson.M{"_id": "$courseId", "items": bson.M{"$addToSet": "$itemId"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		CourseID primitive.ObjectID   `bson:"_id"`
+		Items    []primitive.ObjectID `bson:"items"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	for _, id := range courseIDs {
+		rates[id] = 0
+	}
+	for _, row := range rows {
+		items := required[row.CourseID]
+		if len(items) == 0 {
+			continue
+		}
+		done := 0
+		for _, id := range items {
+			if slices.Contains(row.Items, id) {
+				done++
+			}
+		}
+		rates[row.CourseID] = float64(done) / float64(len(items))
+	}
+	return rates, nil
+}
+
+// unmetCoursePrerequisites lists the prerequisites of course the user has
+// not completed far enough.
+func unmetCoursePrerequisites(ctx context.Context, userID primitive.ObjectID, course *models.Course) ([]unmetCourse, error) {
+	unmet := []unmetCourse{}
+	if len(course.Prerequisites) == 0 {
+		return unmet, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(course.Prerequisites))
+	for _, p := range course.Prerequisites {
+		ids = append(ids, p.CourseID)
+	}
+	rates, err := completionRates(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	titles, err := courseTitles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range course.Prerequisites {
+		if rates[p.CourseID] < p.MinCompletion {
+			unmet = append(unmet, unmetCourse{
+				CourseID:       p.CourseID,
+				Title:          titles[p.CourseID],
+				MinCompletion:  p.MinCompletion,
+				CompletionRate: rates[p.CourseID],
+			})
+		}
+	}
+	return unmet, nil
+}
+
+func courseTitles(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	opts := options.Find().SetProjection(bson.M{"title": 1})
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return nil, err
+	}
+	titles := map[primitive.ObjectID]string{}
+	for _, c := range courses {
+		titles[c.ID] = c.Title
+	}
+	return titles, nil
+}
+
+// unmetItemPrerequisites lists required items the user has not done yet.
+// Required items that no longer exist in the course are ignored.
+func unmetItemPrerequisites(ctx context.Context, userID primitive.ObjectID, course *models.Course, item *models.CourseItem) ([]unmetItem, error) {
+	unmet := []unmetItem{}
+	if len(item.Prerequisites) == 0 {
+		return unmet, nil
+	}
+
+	cursor, err := db.GetCollection("progress").Find(ctx, bson.M{
+		"userId":   userID,
+		"courseId": course.ID,
+		"itemId":   bson.M{"$in": item.Prerequisites},
+		"status":   "done",
+	}, options.Find().SetProjection(bson.M{"itemId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var done []models.Progress
+	if err := cursor.All(ctx, &done); err != nil {
+		return nil, err
+	}
+	doneSet := map[primitive.ObjectID]bool{}
+	for _, p := range done {
+		doneSet[p.ItemID] = true
+	}
+
+	for _, id := range item.Prerequisites {
+		if doneSet[id] {
+			continue
+		}
+		if _, required := findItem(course, id); required != nil {
+			unmet = append(unmet, unmetItem{ItemID: id, Title: required.Title})
+		}
+	}
+	return unmet, nil
+}
+
+// courseCycle reports whether requiring prereqs from courseOID would close a
+// cycle, i.e. courseOID is reachable from one of them.
+func courseCycle(ctx context.Context, courseOID primitive.ObjectID, prereqs []primitive.ObjectID) (bool, error) {
+	visited := map[primitive.ObjectID]bool{}
+	frontier := []primitive.ObjectID{}
+	for _, id := range prereqs {
+		if id == courseOID {
+			return true, nil
+		}
+		if !visited[id] {
+			visited[id] = true
+			frontier = append(frontier, id)
+		}
+	}
+
+	opts := options.Find().SetProjection(bson.M{"prerequisites": 1})
+	for len(frontier) > 0 {
+		cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"_id": bson.M{"$in": frontier}}, opts)
+		if err != nil {
+			return false, err
+		}
+		var courses []models.Course
+		if err := cursor.All(ctx, &courses); err != nil {
+			return false, err
+		}
+
+		frontier = frontier[:0]
+		for _, c := range courses {
+			for _, p := range c.Prerequisites {
+				if p.CourseID == courseOID {
+					return true, nil
+				}
+				if !visited[p.CourseID] {
+					visited[p.CourseID] = true
+					frontier = append(frontier, p.CourseID)
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// itemCycle reports whether the item prerequisite graph has a cycle.
+func itemCycle(graph map[primitive.ObjectID][]primitive.ObjectID) bool {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[primitive.ObjectID]int{}
+	var visit func(id primitive.ObjectID) bool
+	visit = func(id primitive.ObjectID) bool {
+		switch state[id] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[id] = visiting
+		for _, next := range graph[id] {
+			if visit(next) {
+				return true
+			}
+		}
+		state[id] = done
+		return false
+	}
+	for id := range graph {
+		if visit(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// PutPrerequisites replaces a course's prerequisites (course editors).
+func PutPrerequisites(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	var input prerequisitesInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capEditContent) {
+		return
+	}
+
+	prereqs := []models.CoursePrerequisite{}
+	prereqIDs := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, p := range input.Courses {
+		oid, err := primitive.ObjectIDFromHex(p.CourseID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid prerequisite courseId")
+			return
+		}
+		if seen[oid] {
+			writeError(w, http.StatusBadRequest, "duplicate prerequisite course")
+			return
+		}
+		seen[oid] = true
+		minCompletion := 1.0
+		if p.MinCompletion != nil {
+			minCompletion = *p.MinCompletion
+		}
+		if minCompletion <= 0 || minCompletion > 1 {
+			writeError(w, http.StatusBadRequest, "minCompletion must be in (0, 1]")
+			return
+		}
+		prereqs = append(prereqs, models.CoursePrerequisite{CourseID: oid, MinCompletion: minCompletion})
+		prereqIDs = append(prereqIDs, oid)
+	}
+
+	if len(prereqIDs) > 0 {
+		n, err := db.GetCollection("courses").CountDocuments(ctx, bson.M{"_id": bson.M{"$in": prereqIDs}})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+			return
+		}
+		if int(n) != len(prereqIDs) {
+			writeError(w, http.StatusBadRequest, "prerequisite course not found")
+			return
+		}
+		cycle, err := courseCycle(ctx, courseOID, prereqIDs)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+			return
+		}
+		if cycle {
+			writeError(w, http.StatusBadRequest, "course prerequisites would create a cycle")
+			return
+		}
+	}
+
+	graph := map[primitive.ObjectID][]primitive.ObjectID{}
+	for itemHex, required := range input.Items {
+		itemOID, err := primitive.ObjectIDFromHex(itemHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid item id")
+			return
+		}
+		if _, item := findItem(course, itemOID); item == nil {
+			writeError(w, http.StatusBadRequest, "item not found: "+itemHex)
+			return
+		}
+		ids := []primitive.ObjectID{}
+		for _, reqHex := range required {
+			reqOID, err := primitive.ObjectIDFromHex(reqHex)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid item id")
+				return
+			}
+			if _, item := findItem(course, reqOID); item == nil {
+				writeError(w, http.StatusBadRequest, "item not found: "+reqHex)
+				return
+			}
+			ids = append(ids, reqOID)
+		}
+		if len(ids) > 0 {
+			graph[itemOID] = ids
+		}
+	}
+	if itemCycle(graph) {
+		writeError(w, http.StatusBadRequest, "item prerequisites would create a cycle")
+		return
+	}
+
+	// Every item present at load time gets its list set or cleared through
+	// its own array filter; items added concurrently are left alone.
+	set := bson.M{"prerequisites": prereqs, "updatedAt": time.Now()}
+	unset := bson.M{}
+	filters := []interface{}{}
+	n := 0
+	for _, m := range course.Modules {
+		for _, it := range m.Items {
+			ident := "i" + strconv.Itoa(n)
+			n++
+			path := "modules.$[].items.$[" + ident + "].prerequisites"
+			if ids, ok := graph[it.ID]; ok {
+				set[path] = ids
+			} else {
+				unset[path] = ""
+			}
+			filters = append(filters, bson.M{ident + "._id": it.ID})
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	opts := options.FindOneAndUpdate()
+	if len(filters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: filters})
+	}
+
+	updated := updateCourseVersioned(ctx, w, r, courseOID, primitive.NilObjectID, update, opts)
+	if updated == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// GetPrerequisites returns the prerequisite graph of a course: the courses
+// it transitively depends on, and the item-level requirements inside it.
+// For a signed-in caller, edges and items carry whether they are met.
+func GetPrerequisites(w http.ResponseWriter, r *http.Request) {
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	viewerID := viewerIDFromRequest(r)
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, viewerID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+
+	courses := map[primitive.ObjectID]*models.Course{course.ID: course}
+	order := []primitive.ObjectID{course.ID}
+	frontier := []primitive.ObjectID{}
+	for _, p := range course.Prerequisites {
+		frontier = append(frontier, p.CourseID)
+	}
+	opts := options.Find().SetProjection(bson.M{"title": 1, "status": 1, "teacherId": 1, "prerequisites": 1})
+	for len(frontier) > 0 && len(courses) < maxPrerequisiteNodes {
+		cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"_id": bson.M{"$in": frontier}}, opts)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch prerequisites")
+			return
+		}
+		var found []models.Course
+		if err := cursor.All(ctx, &found); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to decode prerequisites")
+			return
+		}
+		frontier = frontier[:0]
+		for i := range found {
+			c := &found[i]
+			if _, ok := courses[c.ID]; ok {
+				continue
+			}
+			courses[c.ID] = c
+			order = append(order, c.ID)
+			for _, p := range c.Prerequisites {
+				if _, ok := courses[p.CourseID]; !ok {
+					frontier = append(frontier, p.CourseID)
+				}
+			}
+		}
+	}
+
+	var rates map[primitive.ObjectID]float64
+	if !viewerID.IsZero() {
+		rates, err = completionRates(ctx, viewerID, order)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to compute completion")
+			return
+		}
+	}
+
+	nodes := []prerequisiteNode{}
+	edges := []prerequisiteEdge{}
+	for _, id := range order {
+		c := courses[id]
+		node := prerequisiteNode{ID: c.ID}
+		// Drafts of other teachers appear only as ids.
+		if canViewCourse(c, viewerID) {
+			node.Title = c.Title
+			node.Status = courseStatusOf(c)
+		}
+		if rates != nil {
+			rate := rates[c.ID]
+			node.CompletionRate = &rate
+		}
+		nodes = append(nodes, node)
+
+		for _, p := range c.Prerequisites {
+			edge := prerequisiteEdge{CourseID: c.ID, Requires: p.CourseID, MinCompletion: p.MinCompletion}
+			if rates != nil {
+				met := rates[p.CourseID] >= p.MinCompletion
+				edge.Met = &met
+			}
+			edges = append(edges, edge)
+		}
+	}
+
+	items := []itemPrerequisites{}
+	for _, m := range course.Modules {
+		for i := range m.Items {
+			it := &m.Items[i]
+			if len(it.Prerequisites) == 0 {
+				continue
+			}
+			entry := itemPrerequisites{ItemID: it.ID, Title: it.Title, Requires: it.Prerequisites}
+			if !viewerID.IsZero() {
+				unmet, err := unmetItemPrerequisites(ctx, viewerID, course, it)
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "failed to check item prerequisites")
+					return
+				}
+				met := len(unmet) == 0
+				entry.Met = &met
+			}
+			items = append(items, entry)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"courseId": course.ID,
+		"nodes":    nodes,
+		"edges":    edges,
+		"items":    items,
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestItemCycle(t *testing.T) {
+	a, b, c, d := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	type graph = map[primitive.ObjectID][]primitive.ObjectID
+	tests := []struct {
+		name  string
+		graph graph
+		want  bool
+	}{
+		{"empty", graph{}, false},
+		{"chain", graph{c: {b}, b: {a}}, false},
+		{"diamond", graph{d: {b, c}, b: {a}, c: {a}}, false},
+		{"self", graph{a: {a}}, true},
+		{"pair", graph{a: {b}, b: {a}}, true},
+		{"long loop", graph{a: {b}, b: {c}, c: {d}, d: {a}}, true},
+		{"loop beside a chain", graph{d: {a}, b: {c}, c: {b}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemCycle(tt.graph); got != tt.want {
+				t.Errorf("itemCycle = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A course naming itself is caught before the prerequisite graph is read.
+func TestCourseCycleSelf(t *testing.T) {
+	course := primitive.NewObjectID()
+	cycle, err := courseCycle(context.Background(), course, []primitive.ObjectID{primitive.NewObjectID(), course})
+	if err != nil || !cycle {
+		t.Errorf("courseCycle = %v, %v; want true", cycle, err)
+	}
+}
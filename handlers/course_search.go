@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	snippetWidth = 160
+	maxFacets    = 50
+)
+
+// courseSearchResult is a course as listed by GetCourses, with the text
+// search score and highlighted snippets when a search term was given.
+type courseSearchResult struct {
+	models.Course `bson:",inline"`
+	Score         float64           `bson:"score,omitempty" json:"score,omitempty"`
+	Highlights    []courseHighlight `bson:"-" json:"highlights,omitempty"`
+}
+
+// courseHighlight is an HTML-escaped snippet with matches wrapped in <mark>.
+type courseHighlight struct {
+	Field   string `json:"field"`
+	ItemID  string `json:"itemId,omitempty"`
+	Snippet string `json:"snippet"`
+}
+
+type categoryFacet struct {
+	Value string `bson:"_id" json:"value"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+type teacherFacet struct {
+	TeacherID primitive.ObjectID `bson:"teacherId" json:"teacherId"`
+	Username  string             `bson:"username,omitempty" json:"username,omitempty"`
+	Count     int64              `bson:"count" json:"count"`
+}
+
+type courseFacets struct {
+	Categories []categoryFacet `bson:"categories" json:"categories"`
+	Teachers   []teacherFacet  `bson:"teachers" json:"teachers"`
+}
+
+// searchTerms splits a $text search string the way MongoDB does: quoted
+// phrases stay together and negated terms are dropped, since they can never
+// appear in a match.
+func searchTerms(search string) []string {
+	var terms []string
+	for i, part := range strings.Split(search, `"`) {
+		if i%2 == 1 {
+			if p := strings.TrimSpace(part); p != "" {
+				terms = append(terms, strings.ToLower(p))
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if strings.HasPrefix(word, "-") {
+				continue
+			}
+			terms = append(terms, strings.ToLower(word))
+		}
+	}
+	return terms
+}
+
+// highlight returns an escaped snippet of text around the first match, with
+// every match inside it marked. width 0 keeps the whole text.
+func highlight(text string, terms []string, width int) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != term {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+	if first == -1 {
+		return "", false
+	}
+
+	start, end := 0, len(runes)
+	if width > 0 && len(runes) > width {
+		start = first - width/3
+		if start < 0 {
+			start = 0
+		}
+		end = start + width
+		if end > len(runes) {
+			end = len(runes)
+			start = end - width
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			b.WriteString("<mark>" + segment + "</mark>")
+		} else {
+			b.WriteString(segment)
+		}
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+func courseHighlights(course *models.Course, terms []string) []courseHighlight {
+	var out []courseHighlight
+	if s, ok := highlight(course.Title, terms, 0); ok {
+		out = append(out, courseHighlight{Field: "title", Snippet: s})
+	}
+	if s, ok := highlight(course.Description, terms, snippetWidth); ok {
+		out = append(out, courseHighlight{Field: "description", Snippet: s})
+	}
+	for _, m := range course.Modules {
+		for _, it := range m.Items {
+			if s, ok := highlight(it.Title, terms, 0); ok {
+				out = append(out, courseHighlight{Field: "item", ItemID: it.ID.Hex(), Snippet: s})
+			}
+		}
+	}
+	return out
+}
+
+// loadCourseFacets counts matching courses per category and per teacher.
+// Each facet ignores its own filter so the other values stay selectable.
+func loadCourseFacets(ctx context.Context, base, categoryClause, teacherClause bson.M) (courseFacets, error) {
+	facets := courseFacets{Categories: []categoryFacet{}, Teachers: []teacherFacet{}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: base}},
+		{{Key: "$facet", Value: bson.M{
+			"categories": bson.A{
+				bson.M{"$match": teacherClause},
+				bson.M{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": maxFacets},
+			},
+			"teachers": bson.A{
+				bson.M{"$match": categoryClause},
+				bson.M{"$group": bson.M{"_id": "$teacherId", "count": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": maxFacets},
+				bson.M{"$lookup": bson.M{
+					"from":         "users",
+					"localField":   "_id",
+					"foreignField": "_id",
+					"as":           "user",
+				}},
+				bson.M{"$project": bson.M{
+					"_id":       0,
+					"teacherId": "$_id",
+					"count":     1,
+					"username":  bson.M{"$arrayElemAt": bson.A{"$user.username", 0}},
+				}},
+			},
+		}}},
+	}
+
+	cursor, err := db.GetCollection("courses").Aggregate(ctx, pipeline)
+	if err != nil {
+		return facets, err
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&facets); err != nil {
+			return facets, err
+		}
+	}
+	return facets, cursor.Err()
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"", nil},
+		{"Go  Concurrency", []string{"go", "concurrency"}},
+		{`"Hello World" go`, []string{"hello world", "go"}},
+		{"go -java", []string{"go"}},
+		{`"" go`, []string{"go"}},
+		{`"unterminated phrase`, []string{"unterminated phrase"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if got := searchTerms(tt.search); !slices.Equal(got, tt.want) {
+				t.Errorf("searchTerms(%q) = %q, want %q", tt.search, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("a", 50) + " target " + strings.Repeat("b", 50)
+	tests := []struct {
+		name   string
+		text   string
+		terms  []string
+		width  int
+		want   string
+		wantOK bool
+	}{
+		{"no match", "Intro to Go", []string{"java"}, 0, "", false},
+		{"case insensitive", "Intro to Go", []string{"go"}, 0, "Intro to <mark>Go</mark>", true},
+		{"every match", "go, Go, GO", []string{"go"}, 0, "<mark>go</mark>, <mark>Go</mark>, <mark>GO</mark>", true},
+		{"adjacent terms merge", "goroutine", []string{"go", "routine"}, 0, "<mark>goroutine</mark>", true},
+		{"escapes html", "<b>Go</b>", []string{"go"}, 0, "&lt;b&gt;<mark>Go</mark>&lt;/b&gt;", true},
+		{"unicode", "Курс по Go", []string{"курс"}, 0, "<mark>Курс</mark> по Go", true},
+		{"snippet", long, []string{"target"}, 20, "…aaaaa <mark>target</mark> bbbbbbb…", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := highlight(tt.text, tt.terms, tt.width)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("highlight = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// Course capabilities. Every ownership check goes through
+// hasCourseCapability instead of comparing TeacherID.
+const (
+	capView         = "view"
+	capEditContent  = "edit_content"
+	capGrade        = "grade"
+	capManageRoster = "manage_roster"
+	// capManageCourse covers deleting the course, handing it over, its
+	// staff list, template sharing and the enrollment method.
+	capManageCourse = "manage_course"
+)
+
+var roleCapabilities = map[string][]string{
+	models.CourseRoleOwner:     {capView, capEditContent, capGrade, capManageRoster, capManageCourse},
+	models.CourseRoleCoTeacher: {capView, capEditContent, capGrade, capManageRoster},
+	models.CourseRoleTA:        {capView, capGrade},
+	models.CourseRoleObserver:  {capView},
+}
+
+// validStaffRole reports whether role can be given through the staff list;
+// ownership only changes with teacherId.
+func validStaffRole(role string) bool {
+	return role != models.CourseRoleOwner && roleCapabilities[role] != nil
+}
+
+// courseRole returns the user's role in the course, or "" for non-staff.
+func courseRole(course *models.Course, userID primitive.ObjectID) string {
+	if userID.IsZero() {
+		return ""
+	}
+	if course.TeacherID == userID {
+		return models.CourseRoleOwner
+	}
+	for _, s := range course.Staff {
+		if s.UserID == userID {
+			return s.Role
+		}
+	}
+	return ""
+}
+
+func hasCourseCapability(course *models.Course, userID primitive.ObjectID, capability string) bool {
+	return slices.Contains(roleCapabilities[courseRole(course, userID)], capability)
+}
+
+func isCourseOwner(course *models.Course, userID primitive.ObjectID) bool {
+	return courseRole(course, userID) == models.CourseRoleOwner
+}
+
+// isCourseStaff reports whether the user sees the course as staff: drafts,
+// locked and group-restricted content included.
+func isCourseStaff(course *models.Course, userID primitive.ObjectID) bool {
+	return hasCourseCapability(course, userID, capView)
+}
+
+// requireCourseCapability writes 403 and returns false unless the user has
+// the capability in course.
+func requireCourseCapability(w http.ResponseWriter, course *models.Course, userID primitive.ObjectID, capability string) bool {
+	if !hasCourseCapability(course, userID, capability) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	return true
+}
+
+// loadStaffCourse loads the course in the {id} path segment for a staff
+// member with the capability. On failure the response has been written.
+func loadStaffCourse(ctx context.Context, w http.ResponseWriter, r *http.Request, capability string) (*models.Course, primitive.ObjectID) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, userID
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return nil, userID
+	}
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return nil, userID
+	}
+	if !requireCourseCapability(w, course, userID, capability) {
+		return nil, userID
+	}
+	return course, userID
+}
+
+// taGroupIDs returns the groups a TA is assigned to. A TA without groups
+// works with the whole course; other roles always do (nil).
+func taGroupIDs(ctx context.Context, course *models.Course, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if courseRole(course, userID) != models.CourseRoleTA {
+		return nil, nil
+	}
+	cursor, err := db.GetCollection("groups").Find(ctx,
+		bson.M{"courseId": course.ID, "taIds": userID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(groups))
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+	return ids, nil
+}
+
+type staffEntry struct {
+	models.CourseStaff `bson:",inline"`
+	Username           string `json:"username"`
+}
+
+// GetCourseStaff lists the owner followed by the rest of the staff.
+func GetCourseStaff(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	staff := append([]models.CourseStaff{{
+		UserID:  course.TeacherID,
+		Role:    models.CourseRoleOwner,
+		AddedAt: course.CreatedAt,
+	}}, course.Staff...)
+	ids := make([]primitive.ObjectID, 0, len(staff))
+	for _, s := range staff {
+		ids = append(ids, s.UserID)
+	}
+	names, err := usernames(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+
+	entries := make([]staffEntry, 0, len(staff))
+	for _, s := range staff {
+		entries = append(entries, staffEntry{CourseStaff: s, Username: names[s.UserID]})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+type staffInput struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// AddCourseStaff gives a user a role in the course (owner only).
+func AddCourseStaff(w http.ResponseWriter, r *http.Request) {
+	var input staffInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Role = strings.TrimSpace(input.Role)
+	if !validStaffRole(input.Role) {
+		writeError(w, http.StatusBadRequest, "role must be co_teacher, ta or observer")
+		return
+	}
+
+	filter := bson.M{}
+	switch {
+	case strings.TrimSpace(input.UserID) != "":
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(input.UserID))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid userId")
+			return
+		}
+		filter["_id"] = oid
+	case strings.TrimSpace(input.Username) != "":
+		filter["username"] = strings.TrimSpace(input.Username)
+	default:
+		writeError(w, http.StatusBadRequest, "userId or username is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, ownerID := loadStaffCourse(ctx, w, r, capManageCourse)
+	if course == nil {
+		return
+	}
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"username": 1})
+	if err := db.GetCollection("users").FindOne(ctx, filter, opts).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch user")
+		return
+	}
+
+	member := models.CourseStaff{
+		UserID:  user.ID,
+		Role:    input.Role,
+		AddedBy: ownerID,
+		AddedAt: time.Now(),
+	}
+	res, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": course.ID, "teacherId": bson.M{"$ne": user.ID}, "staff.userId": bson.M{"$ne": user.ID}},
+		bson.M{
+			"$push": bson.M{"staff": member},
+			"$set":  bson.M{"updatedAt": member.AddedAt},
+			"$inc":  bson.M{"version": 1},
+		})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update course")
+		return
+	}
+	if res.MatchedCount == 0 {
+		writeError(w, http.StatusConflict, "user is already course staff")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, staffEntry{CourseStaff: member, Username: user.Username})
+}
+
+type staffPatchInput struct {
+	Role string `json:"role"`
+}
+
+// PatchCourseStaff changes a staff member's role (owner only).
+func PatchCourseStaff(w http.ResponseWriter, r *http.Request) {
+	var input staffPatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Role = strings.TrimSpace(input.Role)
+	if !validStaffRole(input.Role) {
+		writeError(w, http.StatusBadRequest, "role must be co_teacher, ta or observer")
+		return
+	}
+	userOID, err := primitive.ObjectIDFromHex(r.PathValue("userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageCourse)
+	if course == nil {
+		return
+	}
+
+	res, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": course.ID, "staff.userId": userOID},
+		bson.M{
+			"$set": bson.M{"staff.$.role": input.Role, "updatedAt": time.Now()},
+			"$inc": bson.M{"version": 1},
+		})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update course")
+		return
+	}
+	if res.MatchedCount == 0 {
+		writeError(w, http.StatusNotFound, "staff member not found")
+		return
+	}
+	// Only TAs and co-teachers lead groups.
+	if input.Role == models.CourseRoleObserver {
+		if err := removeGroupTA(ctx, course.ID, userOID); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update groups")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"userId": userOID.Hex(), "role": input.Role})
+}
+
+// RemoveCourseStaff takes a user off the staff list (owner only).
+func RemoveCourseStaff(w http.ResponseWriter, r *http.Request) {
+	userOID, err := primitive.ObjectIDFromHex(r.PathValue("userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageCourse)
+	if course == nil {
+		return
+	}
+
+	res, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": course.ID, "staff.userId": userOID},
+		bson.M{
+			"$pull": bson.M{"staff": bson.M{"userId": userOID}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+			"$inc":  bson.M{"version": 1},
+		})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update course")
+		return
+	}
+	if res.MatchedCount == 0 {
+		writeError(w, http.StatusNotFound, "staff member not found")
+		return
+	}
+	if err := removeGroupTA(ctx, course.ID, userOID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update groups")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func removeGroupTA(ctx context.Context, courseOID, userOID primitive.ObjectID) error {
+	_, err := db.GetCollection("groups").UpdateMany(ctx,
+		bson.M{"courseId": courseOID, "taIds": userOID},
+		bson.M{"$pull": bson.M{"taIds": userOID}, "$set": bson.M{"updatedAt": time.Now()}})
+	return err
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestValidStaffRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{models.CourseRoleCoTeacher, true},
+		{models.CourseRoleTA, true},
+		{models.CourseRoleObserver, true},
+		{models.CourseRoleOwner, false},
+		{"student", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validStaffRole(tt.role); got != tt.want {
+			t.Errorf("validStaffRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestCourseCapabilities(t *testing.T) {
+	owner, co, ta, observer, student := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	course := &models.Course{TeacherID: owner, Staff: []models.CourseStaff{
+		{UserID: co, Role: models.CourseRoleCoTeacher},
+		{UserID: ta, Role: models.CourseRoleTA},
+		{UserID: observer, Role: models.CourseRoleObserver},
+	}}
+	caps := []string{capView, capEditContent, capGrade, capManageRoster, capManageCourse}
+
+	tests := []struct {
+		name string
+		user primitive.ObjectID
+		role string
+		want []bool // in the order of caps
+	}{
+		{"owner", owner, models.CourseRoleOwner, []bool{true, true, true, true, true}},
+		{"co-teacher", co, models.CourseRoleCoTeacher, []bool{true, true, true, true, false}},
+		{"ta", ta, models.CourseRoleTA, []bool{true, false, true, false, false}},
+		{"observer", observer, models.CourseRoleObserver, []bool{true, false, false, false, false}},
+		{"student", student, "", []bool{false, false, false, false, false}},
+		{"anonymous", primitive.NilObjectID, "", []bool{false, false, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := courseRole(course, tt.user); got != tt.role {
+				t.Errorf("courseRole = %q, want %q", got, tt.role)
+			}
+			for i, c := range caps {
+				if got := hasCourseCapability(course, tt.user, c); got != tt.want[i] {
+					t.Errorf("hasCourseCapability(%s) = %v, want %v", c, got, tt.want[i])
+				}
+			}
+			if got := isCourseOwner(course, tt.user); got != (tt.role == models.CourseRoleOwner) {
+				t.Errorf("isCourseOwner = %v", got)
+			}
+			if got := isCourseStaff(course, tt.user); got != (tt.role != "") {
+				t.Errorf("isCourseStaff = %v", got)
+			}
+		})
+	}
+}
+
+func TestCourseRoleZeroTeacher(t *testing.T) {
+	// A course without an owner must not hand ownership to a zero user id.
+	course := &models.Course{}
+	if got := courseRole(course, primitive.NilObjectID); got != "" {
+		t.Errorf("courseRole = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+// courseStatusOf treats courses created before the draft workflow as published.
+func courseStatusOf(course *models.Course) string {
+	if course.Status == "" {
+		return models.CourseStatusPublished
+	}
+	return course.Status
+}
+
+func canViewCourse(course *models.Course, viewerID primitive.ObjectID) bool {
+	return courseStatusOf(course) == models.CourseStatusPublished || isCourseStaff(course, viewerID)
+}
+
+// courseVisibilityFilter limits listings to published courses plus the
+// drafts and archived courses the viewer is staff of.
+func courseVisibilityFilter(viewerID primitive.ObjectID) bson.M {
+	visible := []bson.M{
+		{"status": models.CourseStatusPublished},
+		{"status": bson.M{"$exists": false}},
+	}
+	if !viewerID.IsZero() {
+		visible = append(visible, bson.M{"teacherId": viewerID}, bson.M{"staff.userId": viewerID})
+	}
+	return bson.M{"$or": visible}
+}
+
+func andFilter(filter bson.M, clause bson.M) {
+	clauses, _ := filter["$and"].([]bson.M)
+	filter["$and"] = append(clauses, clause)
+}
+
+// andClauses returns a copy of the filter's $and clauses.
+func andClauses(filter bson.M) []bson.M {
+	clauses, _ := filter["$and"].([]bson.M)
+	return append([]bson.M(nil), clauses...)
+}
+
+func windowOpen(from, until *time.Time, now time.Time) bool {
+	if from != nil && now.Before(*from) {
+		return false
+	}
+	if until != nil && now.After(*until) {
+		return false
+	}
+	return true
+}
+
+func validateWindow(from, until *time.Time) error {
+	if from != nil && until != nil && !until.After(*from) {
+		return errorf("availableUntil must be after availableFrom")
+	}
+	return nil
+}
+
+// itemAvailable reports whether an item and its module are inside their
+// availability windows.
+func itemAvailable(module *models.CourseModule, item *models.CourseItem, now time.Time) bool {
+	return windowOpen(module.AvailableFrom, module.AvailableUntil, now) &&
+		windowOpen(item.AvailableFrom, item.AvailableUntil, now)
+}
+
+func findItem(course *models.Course, itemOID primitive.ObjectID) (*models.CourseModule, *models.CourseItem) {
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		for j := range module.Items {
+			if module.Items[j].ID == itemOID {
+				return module, &module.Items[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lockUnavailableContent marks modules and items outside their availability
+// window as locked and returns a fingerprint of the lock state, so responses
+// that differ only by time of day get different ETags.
+func lockUnavailableContent(course *models.Course, now time.Time) string {
+	h := fnv.New32a()
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		module.Locked = !windowOpen(module.AvailableFrom, module.AvailableUntil, now)
+		if module.Locked {
+			h.Write(module.ID[:])
+		}
+		for j := range module.Items {
+			item := &module.Items[j]
+			item.Locked = module.Locked || !windowOpen(item.AvailableFrom, item.AvailableUntil, now)
+			if item.Locked {
+				h.Write(item.ID[:])
+			}
+		}
+	}
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+func PublishCourse(w http.ResponseWriter, r *http.Request) {
+	setCourseStatus(w, r, models.CourseStatusPublished)
+}
+
+func UnpublishCourse(w http.ResponseWriter, r *http.Request) {
+	setCourseStatus(w, r, models.CourseStatusDraft)
+}
+
+func ArchiveCourse(w http.ResponseWriter, r *http.Request) {
+	setCourseStatus(w, r, models.CourseStatusArchived)
+}
+
+func setCourseStatus(w http.ResponseWriter, r *http.Request, status string) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capEditContent) {
+		return
+	}
+	if courseStatusOf(course) == status {
+		writeError(w, http.StatusConflict, "course is already "+status)
+		return
+	}
+
+	now := time.Now()
+	setFields := bson.M{"status": status, "updatedAt": now}
+	if status == models.CourseStatusPublished {
+		setFields["publishedAt"] = now
+	}
+
+	updated := updateCourseVersioned(ctx, w, r, oid, primitive.NilObjectID, bson.M{"$set": setFields})
+	if updated == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          updated.ID,
+		"status":      updated.Status,
+		"publishedAt": updated.PublishedAt,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestCanViewCourse(t *testing.T) {
+	owner, ta, student := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	course := func(status string) *models.Course {
+		return &models.Course{
+			TeacherID: owner,
+			Status:    status,
+			Staff:     []models.CourseStaff{{UserID: ta, Role: models.CourseRoleTA}},
+		}
+	}
+	tests := []struct {
+		name   string
+		status string
+		viewer primitive.ObjectID
+		want   bool
+	}{
+		{"legacy course counts as published", "", student, true},
+		{"published", models.CourseStatusPublished, student, true},
+		{"draft hidden from students", models.CourseStatusDraft, student, false},
+		{"draft visible to owner", models.CourseStatusDraft, owner, true},
+		{"draft visible to staff", models.CourseStatusDraft, ta, true},
+		{"archived hidden from students", models.CourseStatusArchived, student, false},
+		{"archived visible to owner", models.CourseStatusArchived, owner, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canViewCourse(course(tt.status), tt.viewer); got != tt.want {
+				t.Errorf("canViewCourse = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowOpen(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name        string
+		from, until *time.Time
+		want        bool
+	}{
+		{"no window", nil, nil, true},
+		{"started", &before, nil, true},
+		{"not started", &after, nil, false},
+		{"not ended", nil, &after, true},
+		{"ended", nil, &before, false},
+		{"inside", &before, &after, true},
+		{"opens exactly now", &now, nil, true},
+		{"closes exactly now", nil, &now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowOpen(tt.from, tt.until, now); got != tt.want {
+				t.Errorf("windowOpen = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+	tests := []struct {
+		name        string
+		from, until *time.Time
+		wantErr     bool
+	}{
+		{"open", nil, nil, false},
+		{"only from", &now, nil, false},
+		{"ordered", &now, &later, false},
+		{"empty", &now, &now, true},
+		{"reversed", &later, &now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateWindow(tt.from, tt.until); (err != nil) != tt.wantErr {
+				t.Errorf("validateWindow = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockUnavailableContent(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	course := &models.Course{Modules: []models.CourseModule{
+		{ID: primitive.NewObjectID(), Items: []models.CourseItem{
+			{ID: primitive.NewObjectID()},
+			{ID: primitive.NewObjectID(), AvailableFrom: &future},
+		}},
+		{ID: primitive.NewObjectID(), AvailableUntil: &past, Items: []models.CourseItem{
+			{ID: primitive.NewObjectID()},
+		}},
+	}}
+
+	first := lockUnavailableContent(course, now)
+	got := []bool{
+		course.Modules[0].Locked, course.Modules[0].Items[0].Locked, course.Modules[0].Items[1].Locked,
+		course.Modules[1].Locked, course.Modules[1].Items[0].Locked,
+	}
+	want := []bool{false, false, true, true, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("locked = %v, want %v", got, want)
+		}
+	}
+
+	if lockUnavailableContent(course, now) != first {
+		t.Error("fingerprint changed without a lock change")
+	}
+	if lockUnavailableContent(course, future.Add(time.Minute)) == first {
+		t.Error("fingerprint did not change when an item unlocked")
+	}
+}
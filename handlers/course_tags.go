@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"AP_Final/db"
+)
+
+const (
+	maxCourseTags   = 20
+	maxTagLength    = 32
+	defaultTagLimit = 30
+)
+
+type tagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+// normalizeTag lowercases a tag and turns spaces and underscores into
+// dashes. Letters, digits and the + # . - found in names like "c++",
+// "c#" or "node.js" are kept; anything else is dropped.
+func normalizeTag(tag string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(tag)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#' || r == '.':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case r == '-' || r == '_' || unicode.IsSpace(r):
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// normalizeTags normalizes and de-duplicates tags, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		tag := normalizeTag(t)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, errorf("tags must be at most " + strconv.Itoa(maxTagLength) + " characters")
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxCourseTags {
+		return nil, errorf("at most " + strconv.Itoa(maxCourseTags) + " tags per course")
+	}
+	return out, nil
+}
+
+// tagFilterClause reads tags=a,b&match=all|any. Courses must carry every
+// listed tag by default, or at least one with match=any.
+func tagFilterClause(r *http.Request) (bson.M, error) {
+	q := r.URL.Query()
+	raw := strings.TrimSpace(q.Get("tags"))
+	match := strings.TrimSpace(q.Get("match"))
+	if match != "" && match != "all" && match != "any" {
+		return nil, errorf("match must be all or any")
+	}
+	if raw == "" {
+		return bson.M{}, nil
+	}
+
+	tags, err := normalizeTags(strings.Split(raw, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return bson.M{}, nil
+	}
+	if match == "any" {
+		return bson.M{"tags": bson.M{"$in": tags}}, nil
+	}
+	return bson.M{"tags": bson.M{"$all": tags}}, nil
+}
+
+// GetPopularTags lists the most used tags among courses the caller can
+// see, optionally within a category subtree.
+func GetPopularTags(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTagLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if l > maxListLimit {
+			l = maxListLimit
+		}
+		limit = l
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := courseVisibilityFilter(viewerIDFromRequest(r))
+	if category := strings.TrimSpace(r.URL.Query().Get("category")); category != "" {
+		clause, err := categoryFilterClause(ctx, category)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to resolve category")
+			return
+		}
+		andFilter(filter, clause)
+	}
+
+	cursor, err := db.GetCollection("courses").Aggregate(ctx, []bson.M{
+		{"$match": filter},
+		{"$unwind": "$tags"},
+		{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit},
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count tags")
+		return
+	}
+
+	tags := []tagCount{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode tags")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Go", "go"},
+		{"  Machine Learning ", "machine-learning"},
+		{"web_dev", "web-dev"},
+		{"C++", "c++"},
+		{"C#", "c#"},
+		{"Node.js", "node.js"},
+		{"--rust--", "rust"},
+		{"a - b", "a-b"},
+		{"hello!?", "hello"},
+		{"Базы данных", "базы-данных"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeTag(tt.in); got != tt.want {
+				t.Errorf("normalizeTag(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, maxCourseTags+1)
+	for i := range many {
+		many[i] = "tag" + strings.Repeat("x", i)
+	}
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, []string{}, false},
+		{"dedupes after normalizing", []string{"Go", "go ", "GO", "web dev", "web_dev"}, []string{"go", "web-dev"}, false},
+		{"drops blanks", []string{"", "  ", "!!", "go"}, []string{"go"}, false},
+		{"too long", []string{strings.Repeat("a", maxTagLength+1)}, nil, true},
+		{"too many", many, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeTags error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("normalizeTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagFilterClause(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bson.M
+		wantErr bool
+	}{
+		{"", bson.M{}, false},
+		{"tags=Go,Web Dev", bson.M{"tags": bson.M{"$all": []string{"go", "web-dev"}}}, false},
+		{"tags=go,rust&match=any", bson.M{"tags": bson.M{"$in": []string{"go", "rust"}}}, false},
+		{"tags=,,", bson.M{}, false},
+		{"tags=go&match=some", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/courses?"+strings.ReplaceAll(tt.query, " ", "%20"), nil)
+			got, err := tagFilterClause(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tagFilterClause error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tagFilterClause = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestValidateItemKind(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		name    string
+		item    models.CourseItem
+		wantErr bool
+	}{
+		{"link", models.CourseItem{Type: models.ItemTypeLink}, false},
+		{"untyped", models.CourseItem{}, false},
+		{"lti with tool", models.CourseItem{Type: models.ItemTypeLti, ToolID: &id}, false},
+		{"lti without tool", models.CourseItem{Type: models.ItemTypeLti}, true},
+		{"scorm with package", models.CourseItem{Type: models.ItemTypeScorm, PackageID: &id}, false},
+		{"scorm without package", models.CourseItem{Type: models.ItemTypeScorm}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateItemKind(&tt.item); (err != nil) != tt.wantErr {
+				t.Errorf("validateItemKind = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
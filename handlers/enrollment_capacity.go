@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// Seats are a counter on the course document. Claiming one is a single
+// conditional $inc, so concurrent enrollments can never overbook; freed
+// seats go to the head of the waitlist through promoteWaitlist. A claim
+// stays open in seatClaims until the enrollment write that uses it is done,
+// so recountSeats can tell when the counter is ahead of the enrollments.
+
+// maxPromotionsPerCall bounds one promotion pass; capacity rarely grows by
+// more at once, and the next freed seat continues the queue.
+const maxPromotionsPerCall = 500
+
+// staleSeatClaim is how long an open claim may go unsettled before
+// recountSeats assumes its request died.
+const staleSeatClaim = time.Minute
+
+// claimSeat takes a seat and opens a claim on it; the caller settles the
+// claim with keepSeat or releaseClaim.
+func claimSeat(ctx context.Context, courseOID primitive.ObjectID) (bool, error) {
+	res, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{
+			"_id":   courseOID,
+			"$expr": bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$seatsTaken", 0}}, "$capacity"}},
+		},
+		bson.M{
+			"$inc": bson.M{"seatsTaken": 1, "seatClaims": 1},
+			"$set": bson.M{"seatClaimedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// keepSeat closes a claim whose enrollment was written.
+func keepSeat(ctx context.Context, courseOID primitive.ObjectID) {
+	_, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": courseOID, "seatClaims": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"seatClaims": -1}},
+	)
+	if err != nil {
+		log.Printf("enrollment: failed to settle seat claim in %s: %v", courseOID.Hex(), err)
+	}
+}
+
+// releaseClaim gives back a claimed seat whose enrollment was not written.
+// After recountSeats dropped a stale claim the counter is already right,
+// so nothing changes.
+func releaseClaim(ctx context.Context, courseOID primitive.ObjectID) error {
+	_, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": courseOID, "seatsTaken": bson.M{"$gt": 0}, "seatClaims": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"seatsTaken": -1, "seatClaims": -1}},
+	)
+	return err
+}
+
+func releaseSeat(ctx context.Context, courseOID primitive.ObjectID) error {
+	_, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": courseOID, "seatsTaken": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"seatsTaken": -1}},
+	)
+	return err
+}
+
+func newEnrollment(userID, courseID primitive.ObjectID, method string) models.Enrollment {
+	return models.Enrollment{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		CourseID:   courseID,
+		Status:     models.EnrollmentStatusActive,
+		EnrolledAt: time.Now(),
+		Method:     method,
+	}
+}
+
+// admitEnrollment inserts doc, taking a seat when the course has a capacity
+// or joining the waitlist when it is full. A duplicate enrollment surfaces
+// as the insert's duplicate key error.
+func admitEnrollment(ctx context.Context, doc models.Enrollment, course *models.Course) (models.Enrollment, error) {
+	doc.Status = models.EnrollmentStatusActive
+	if doc.EndsAt == nil {
+		doc.EndsAt = enrollmentEndsAt(course, doc.EnrolledAt)
+	}
+	enrollments := db.GetCollection("enrollments")
+
+	if course.Capacity <= 0 {
+		if _, err := enrollments.InsertOne(ctx, doc); err != nil {
+			return doc, err
+		}
+		logEnrolled(ctx, doc)
+		return doc, nil
+	}
+
+	claimed, err := claimSeat(ctx, course.ID)
+	if err != nil {
+		return doc, err
+	}
+	if claimed {
+		if _, err := enrollments.InsertOne(ctx, doc); err != nil {
+			if releaseErr := releaseClaim(ctx, course.ID); releaseErr != nil {
+				log.Printf("enrollment: failed to release seat in %s: %v", course.ID.Hex(), releaseErr)
+			}
+			return doc, err
+		}
+		keepSeat(ctx, course.ID)
+		logEnrolled(ctx, doc)
+		return doc, nil
+	}
+
+	seq, err := nextWaitlistSeq(ctx, course.ID)
+	if err != nil {
+		return doc, err
+	}
+	doc.Status = models.EnrollmentStatusWaitlisted
+	doc.WaitlistSeq = seq
+	if _, err := enrollments.InsertOne(ctx, doc); err != nil {
+		return doc, err
+	}
+	logEnrolled(ctx, doc)
+	return settleWaitlisted(ctx, doc, course)
+}
+
+// admitPending moves an approved pending enrollment into a seat or onto the
+// waitlist. It reports false when the enrollment is no longer pending.
+func admitPending(ctx context.Context, doc models.Enrollment, course *models.Course, reviewerID primitive.ObjectID) (models.Enrollment, bool, error) {
+	now := time.Now()
+	set := bson.M{"reviewedBy": reviewerID, "reviewedAt": now}
+	if endsAt := enrollmentEndsAt(course, now); endsAt != nil && doc.EndsAt == nil {
+		set["endsAt"] = *endsAt
+	}
+	doc, ok, err := placeEnrollment(ctx, doc, course, models.EnrollmentStatusPending, set, nil)
+	if ok {
+		logEnrolled(ctx, doc)
+	}
+	return doc, ok, err
+}
+
+// placeEnrollment moves an existing enrollment out of fromStatus into a seat,
+// or onto the waitlist when the course is full, applying set and unset in
+// the same update. It reports false when the enrollment is no longer in
+// fromStatus.
+func placeEnrollment(ctx context.Context, doc models.Enrollment, course *models.Course, fromStatus string, set, unset bson.M) (models.Enrollment, bool, error) {
+	set["status"] = models.EnrollmentStatusActive
+
+	seated := false
+	if course.Capacity > 0 {
+		claimed, err := claimSeat(ctx, course.ID)
+		if err != nil {
+			return doc, false, err
+		}
+		if claimed {
+			seated = true
+		} else {
+			seq, err := nextWaitlistSeq(ctx, course.ID)
+			if err != nil {
+				return doc, false, err
+			}
+			set["status"] = models.EnrollmentStatusWaitlisted
+			set["waitlistSeq"] = seq
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	err := db.GetCollection("enrollments").FindOneAndUpdate(ctx,
+		bson.M{"_id": doc.ID, "status": fromStatus},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if seated {
+			if releaseErr := releaseClaim(ctx, course.ID); releaseErr != nil {
+				log.Printf("enrollment: failed to release seat in %s: %v", course.ID.Hex(), releaseErr)
+			}
+		}
+		if err == mongo.ErrNoDocuments {
+			return doc, false, nil
+		}
+		return doc, false, err
+	}
+	if seated {
+		keepSeat(ctx, course.ID)
+	}
+
+	if doc.Status == models.EnrollmentStatusWaitlisted {
+		doc, err = settleWaitlisted(ctx, doc, course)
+	}
+	return doc, true, err
+}
+
+// vacateSeat frees a seat held by an enrollment that was removed or
+// suspended and hands it to the head of the waitlist.
+func vacateSeat(ctx context.Context, courseOID primitive.ObjectID) error {
+	if err := releaseSeat(ctx, courseOID); err != nil {
+		return err
+	}
+	var course models.Course
+	opts := options.FindOne().SetProjection(bson.M{"title": 1})
+	err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}, opts).Decode(&course)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return promoteWaitlist(ctx, &course)
+}
+
+func nextWaitlistSeq(ctx context.Context, courseOID primitive.ObjectID) (int64, error) {
+	var counter models.Course
+	err := db.GetCollection("courses").FindOneAndUpdate(ctx,
+		bson.M{"_id": courseOID},
+		bson.M{"$inc": bson.M{"waitlistSeq": 1}},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"waitlistSeq": 1}),
+	).Decode(&counter)
+	return counter.WaitlistSeq, err
+}
+
+// settleWaitlisted runs a promotion pass for a freshly waitlisted enrollment,
+// since a seat may have been freed between the failed claim and the write,
+// and returns it with its current status and position.
+func settleWaitlisted(ctx context.Context, doc models.Enrollment, course *models.Course) (models.Enrollment, error) {
+	if err := promoteWaitlist(ctx, course); err != nil {
+		return doc, err
+	}
+	if err := db.GetCollection("enrollments").FindOne(ctx, bson.M{"_id": doc.ID}).Decode(&doc); err != nil {
+		return doc, err
+	}
+	return doc, setWaitlistPosition(ctx, &doc)
+}
+
+// promoteWaitlist moves waitlisted students into free seats in FIFO order
+// and notifies them.
+func promoteWaitlist(ctx context.Context, course *models.Course) error {
+	enrollments := db.GetCollection("enrollments")
+	for i := 0; i < maxPromotionsPerCall; i++ {
+		claimed, err := claimSeat(ctx, course.ID)
+		if err != nil || !claimed {
+			return err
+		}
+
+		var promoted models.Enrollment
+		err = enrollments.FindOneAndUpdate(ctx,
+			bson.M{"courseId": course.ID, "status": models.EnrollmentStatusWaitlisted},
+			bson.M{
+				"$set":   bson.M{"status": models.EnrollmentStatusActive, "promotedAt": time.Now()},
+				"$unset": bson.M{"waitlistSeq": ""},
+			},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "waitlistSeq", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&promoted)
+		if err == mongo.ErrNoDocuments {
+			return releaseClaim(ctx, course.ID)
+		}
+		if err != nil {
+			if releaseErr := releaseClaim(ctx, course.ID); releaseErr != nil {
+				log.Printf("enrollment: failed to release seat in %s: %v", course.ID.Hex(), releaseErr)
+			}
+			return err
+		}
+		keepSeat(ctx, course.ID)
+
+		notifyPromotion(ctx, promoted.UserID, course)
+	}
+	return nil
+}
+
+func notifyPromotion(ctx context.Context, userID primitive.ObjectID, course *models.Course) {
+	err := notify(ctx, userID, models.NotificationWaitlistPromoted, &course.ID,
+		"A seat opened up in \""+course.Title+"\" and you have been enrolled from the waitlist.")
+	if err != nil {
+		log.Printf("enrollment: failed to notify %s: %v", userID.Hex(), err)
+	}
+}
+
+// syncSeats recounts active enrollments after the capacity changed, then
+// fills any new seats. Without a capacity everyone waiting is admitted.
+func syncSeats(ctx context.Context, courseOID primitive.ObjectID) error {
+	var course models.Course
+	opts := options.FindOne().SetProjection(bson.M{"title": 1, "capacity": 1})
+	if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}, opts).Decode(&course); err != nil {
+		return err
+	}
+
+	enrollments := db.GetCollection("enrollments")
+	if course.Capacity <= 0 {
+		cursor, err := enrollments.Find(ctx, bson.M{"courseId": courseOID, "status": models.EnrollmentStatusWaitlisted})
+		if err != nil {
+			return err
+		}
+		var waiting []models.Enrollment
+		if err := cursor.All(ctx, &waiting); err != nil {
+			return err
+		}
+		for _, e := range waiting {
+			res, err := enrollments.UpdateOne(ctx,
+				bson.M{"_id": e.ID, "status": models.EnrollmentStatusWaitlisted},
+				bson.M{
+					"$set":   bson.M{"status": models.EnrollmentStatusActive, "promotedAt": time.Now()},
+					"$unset": bson.M{"waitlistSeq": ""},
+				})
+			if err != nil {
+				return err
+			}
+			if res.ModifiedCount == 1 {
+				notifyPromotion(ctx, e.UserID, &course)
+			}
+		}
+		_, err = db.GetCollection("courses").UpdateOne(ctx, bson.M{"_id": courseOID}, bson.M{"$unset": bson.M{"seatsTaken": ""}})
+		return err
+	}
+
+	if err := recountSeats(ctx, courseOID); err != nil {
+		return err
+	}
+	return promoteWaitlist(ctx, &course)
+}
+
+// recountSeats sets seatsTaken to the number of active enrollments. While
+// a seat claim is open the counter is legitimately ahead of the enrollments,
+// so the recount is skipped; the counter is exact then anyway. Claims older
+// than staleSeatClaim belong to requests that died and are dropped. The
+// write only lands if nothing changed since the counter was read.
+func recountSeats(ctx context.Context, courseOID primitive.ObjectID) error {
+	courses := db.GetCollection("courses")
+	for range 5 {
+		var course models.Course
+		opts := options.FindOne().SetProjection(bson.M{"seatsTaken": 1, "seatClaims": 1, "seatClaimedAt": 1})
+		if err := courses.FindOne(ctx, bson.M{"_id": courseOID}, opts).Decode(&course); err != nil {
+			return err
+		}
+		if !seatRecountAllowed(&course, time.Now()) {
+			return nil
+		}
+		active, err := db.GetCollection("enrollments").CountDocuments(ctx, bson.M{"courseId": courseOID, "status": models.EnrollmentStatusActive})
+		if err != nil {
+			return err
+		}
+
+		filter := bson.M{"_id": courseOID, "seatsTaken": course.SeatsTaken, "seatClaims": course.SeatClaims}
+		if course.SeatsTaken == 0 {
+			filter["seatsTaken"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		if course.SeatClaims == 0 {
+			filter["seatClaims"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		res, err := courses.UpdateOne(ctx, filter, bson.M{
+			"$set":   bson.M{"seatsTaken": active},
+			"$unset": bson.M{"seatClaims": "", "seatClaimedAt": ""},
+		})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 1 {
+			return nil
+		}
+	}
+	return errorf("seat count kept changing")
+}
+
+// seatRecountAllowed reports whether the course has no seat claim in
+// flight, or only claims too old to finish.
+func seatRecountAllowed(course *models.Course, now time.Time) bool {
+	if course.SeatClaims <= 0 {
+		return true
+	}
+	return course.SeatClaimedAt == nil || now.Sub(*course.SeatClaimedAt) > staleSeatClaim
+}
+
+// setWaitlistPosition fills in the 1-based place of a waitlisted enrollment.
+func setWaitlistPosition(ctx context.Context, e *models.Enrollment) error {
+	if e.Status != models.EnrollmentStatusWaitlisted {
+		return nil
+	}
+	ahead, err := db.GetCollection("enrollments").CountDocuments(ctx, bson.M{
+		"courseId":    e.CourseID,
+		"status":      models.EnrollmentStatusWaitlisted,
+		"waitlistSeq": bson.M{"$lt": e.WaitlistSeq},
+	})
+	if err != nil {
+		return err
+	}
+	e.WaitlistPosition = ahead + 1
+	return nil
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"AP_Final/models"
+)
+
+func TestSeatRecountAllowed(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-10 * time.Second)
+	stale := now.Add(-2 * staleSeatClaim)
+
+	tests := []struct {
+		name   string
+		course models.Course
+		want   bool
+	}{
+		{"no claims", models.Course{}, true},
+		{"claim in flight", models.Course{SeatClaims: 1, SeatClaimedAt: &recent}, false},
+		{"stale claim", models.Course{SeatClaims: 2, SeatClaimedAt: &stale}, true},
+		{"claim without time", models.Course{SeatClaims: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seatRecountAllowed(&tt.course, now); got != tt.want {
+				t.Errorf("seatRecountAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
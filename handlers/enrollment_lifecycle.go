@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// enrollmentTransitions lists the statuses each status may move to by hand.
+// Waitlisted students only become active through promotion, and moving to
+// active always goes through the capacity check.
+var enrollmentTransitions = map[string][]string{
+	models.EnrollmentStatusPending: {
+		models.EnrollmentStatusActive, models.EnrollmentStatusWithdrawn,
+	},
+	models.EnrollmentStatusWaitlisted: {
+		models.EnrollmentStatusSuspended, models.EnrollmentStatusWithdrawn, models.EnrollmentStatusExpired,
+	},
+	models.EnrollmentStatusActive: {
+		models.EnrollmentStatusSuspended, models.EnrollmentStatusCompleted,
+		models.EnrollmentStatusWithdrawn, models.EnrollmentStatusExpired,
+	},
+	models.EnrollmentStatusSuspended: {
+		models.EnrollmentStatusActive, models.EnrollmentStatusWithdrawn, models.EnrollmentStatusExpired,
+	},
+	models.EnrollmentStatusCompleted: {models.EnrollmentStatusActive},
+	models.EnrollmentStatusWithdrawn: {models.EnrollmentStatusActive},
+	models.EnrollmentStatusExpired:   {models.EnrollmentStatusActive},
+}
+
+func canTransition(from, to string) bool {
+	return slices.Contains(enrollmentTransitions[from], to)
+}
+
+func validEnrollmentStatus(status string) bool {
+	_, ok := enrollmentTransitions[status]
+	return ok
+}
+
+// enrollmentEndsAt is the end date a new enrollment gets from its course.
+func enrollmentEndsAt(course *models.Course, from time.Time) *time.Time {
+	if course.EnrollmentDays <= 0 {
+		return nil
+	}
+	endsAt := from.AddDate(0, 0, course.EnrollmentDays)
+	return &endsAt
+}
+
+// transitionEnrollment moves e to status to, applying set and unset in the
+// same update. Moving to active claims a seat (or joins the waitlist);
+// leaving active frees one. It reports false when e changed status in the
+// meantime.
+func transitionEnrollment(ctx context.Context, e models.Enrollment, course *models.Course, to string, set, unset bson.M) (models.Enrollment, bool, error) {
+	if unset == nil {
+		unset = bson.M{}
+	}
+	if to != models.EnrollmentStatusActive {
+		return endEnrollment(ctx, e, to, set, unset)
+	}
+
+	unset["suspendedAt"], unset["completedAt"], unset["endedAt"] = "", "", ""
+	// An end date in the past would expire the enrollment again at once.
+	if _, ok := set["endsAt"]; !ok && e.EndsAt != nil && !e.EndsAt.After(time.Now()) {
+		unset["endsAt"] = ""
+	}
+	return placeEnrollment(ctx, e, course, e.Status, set, unset)
+}
+
+// endEnrollment moves e to a status without a seat, applying set and unset
+// in the same update.
+func endEnrollment(ctx context.Context, e models.Enrollment, to string, set, unset bson.M) (models.Enrollment, bool, error) {
+	now := time.Now()
+	set["status"] = to
+	switch to {
+	case models.EnrollmentStatusSuspended:
+		set["suspendedAt"] = now
+	case models.EnrollmentStatusCompleted:
+		set["completedAt"] = now
+	default:
+		set["endedAt"] = now
+	}
+	if unset == nil {
+		unset = bson.M{}
+	}
+	unset["waitlistSeq"] = ""
+
+	var doc models.Enrollment
+	err := db.GetCollection("enrollments").FindOneAndUpdate(ctx,
+		bson.M{"_id": e.ID, "status": e.Status},
+		bson.M{"$set": set, "$unset": unset},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return e, false, nil
+	}
+	if err != nil {
+		return e, false, err
+	}
+
+	if e.Status == models.EnrollmentStatusActive {
+		if err := vacateSeat(ctx, e.CourseID); err != nil {
+			return doc, true, err
+		}
+	}
+	return doc, true, nil
+}
+
+// reenroll brings back a withdrawn or expired enrollment when its student
+// enrolls again: into a seat (or onto the waitlist), or back to pending when
+// the course requires approval. doc is the enrollment the request would have
+// created. It reports false when existing changed status in the meantime.
+func reenroll(ctx context.Context, existing, doc models.Enrollment, course *models.Course) (models.Enrollment, bool, error) {
+	set := bson.M{"method": doc.Method}
+	unset := bson.M{"reviewedBy": "", "reviewedAt": ""}
+	if doc.InvitedBy != nil {
+		set["invitedBy"] = *doc.InvitedBy
+	} else {
+		unset["invitedBy"] = ""
+	}
+
+	if doc.Status == models.EnrollmentStatusPending {
+		set["status"] = models.EnrollmentStatusPending
+		unset["endedAt"], unset["endsAt"] = "", ""
+		var updated models.Enrollment
+		err := db.GetCollection("enrollments").FindOneAndUpdate(ctx,
+			bson.M{"_id": existing.ID, "status": existing.Status},
+			bson.M{"$set": set, "$unset": unset},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return existing, false, nil
+		}
+		return updated, err == nil, err
+	}
+
+	if endsAt := enrollmentEndsAt(course, time.Now()); endsAt != nil {
+		set["endsAt"] = *endsAt
+	} else {
+		unset["endsAt"] = ""
+	}
+	updated, ok, err := transitionEnrollment(ctx, existing, course, models.EnrollmentStatusActive, set, unset)
+	if ok && err == nil {
+		logEnrolled(ctx, updated)
+	}
+	return updated, ok, err
+}
+
+func writeTransitionError(w http.ResponseWriter, from, to string) {
+	writeError(w, http.StatusConflict, "cannot change enrollment from "+from+" to "+to)
+}
+
+type enrollmentPatchInput struct {
+	Status *string `json:"status"`
+	// EndsAt is RFC 3339; an empty string removes the end date.
+	EndsAt *string `json:"endsAt"`
+}
+
+// PatchRosterEnrollment lets the teacher change an enrollment's status
+// (following enrollmentTransitions) and its end date.
+func PatchRosterEnrollment(w http.ResponseWriter, r *http.Request) {
+	var input enrollmentPatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if input.Status == nil && input.EndsAt == nil {
+		writeError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+
+	var endsAt *time.Time
+	if input.EndsAt != nil && strings.TrimSpace(*input.EndsAt) != "" {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(*input.EndsAt))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid endsAt")
+			return
+		}
+		endsAt = &t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, teacherID := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+
+	to := enrollment.Status
+	if input.Status != nil {
+		to = strings.TrimSpace(*input.Status)
+		if !validEnrollmentStatus(to) {
+			writeError(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		if to != enrollment.Status && !canTransition(enrollment.Status, to) {
+			writeTransitionError(w, enrollment.Status, to)
+			return
+		}
+	}
+
+	// The end date goes into the same conditional update as the status, so
+	// reactivating an expired enrollment can give it a new one.
+	set, unset := bson.M{}, bson.M{}
+	if input.EndsAt != nil {
+		if endsAt != nil {
+			set["endsAt"] = *endsAt
+		} else {
+			unset["endsAt"] = ""
+		}
+	}
+
+	if to == enrollment.Status && input.EndsAt == nil {
+		writeJSON(w, http.StatusOK, enrollment)
+		return
+	}
+	if to == enrollment.Status {
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		var doc models.Enrollment
+		err := db.GetCollection("enrollments").FindOneAndUpdate(ctx,
+			bson.M{"_id": enrollment.ID, "status": enrollment.Status},
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusConflict, "enrollment changed, try again")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update enrollment")
+			return
+		}
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+
+	if enrollment.Status == models.EnrollmentStatusPending {
+		now := time.Now()
+		set["reviewedBy"] = teacherID
+		set["reviewedAt"] = now
+		if input.EndsAt == nil && enrollment.EndsAt == nil {
+			if endsAt := enrollmentEndsAt(course, now); endsAt != nil {
+				set["endsAt"] = *endsAt
+			}
+		}
+	}
+	doc, ok, err := transitionEnrollment(ctx, *enrollment, course, to, set, unset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update enrollment")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "enrollment changed, try again")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// WithdrawEnrollment lets a student leave a course while keeping the record
+// and their progress; the seat goes to the waitlist.
+func WithdrawEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid enrollment id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var enrollment models.Enrollment
+	err = db.GetCollection("enrollments").FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&enrollment)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "enrollment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
+		return
+	}
+	if !canTransition(enrollment.Status, models.EnrollmentStatusWithdrawn) {
+		writeTransitionError(w, enrollment.Status, models.EnrollmentStatusWithdrawn)
+		return
+	}
+
+	doc, ok, err := endEnrollment(ctx, enrollment, models.EnrollmentStatusWithdrawn, bson.M{}, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to withdraw enrollment")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "enrollment changed, try again")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"AP_Final/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.EnrollmentStatusPending, models.EnrollmentStatusActive, true},
+		{models.EnrollmentStatusPending, models.EnrollmentStatusSuspended, false},
+		// Waitlisted students only get in through promotion.
+		{models.EnrollmentStatusWaitlisted, models.EnrollmentStatusActive, false},
+		{models.EnrollmentStatusWaitlisted, models.EnrollmentStatusWithdrawn, true},
+		{models.EnrollmentStatusActive, models.EnrollmentStatusCompleted, true},
+		{models.EnrollmentStatusActive, models.EnrollmentStatusPending, false},
+		{models.EnrollmentStatusActive, models.EnrollmentStatusActive, false},
+		{models.EnrollmentStatusSuspended, models.EnrollmentStatusActive, true},
+		{models.EnrollmentStatusSuspended, models.EnrollmentStatusCompleted, false},
+		{models.EnrollmentStatusCompleted, models.EnrollmentStatusActive, true},
+		{models.EnrollmentStatusCompleted, models.EnrollmentStatusWithdrawn, false},
+		{models.EnrollmentStatusWithdrawn, models.EnrollmentStatusActive, true},
+		{models.EnrollmentStatusExpired, models.EnrollmentStatusActive, true},
+		{models.EnrollmentStatusExpired, models.EnrollmentStatusSuspended, false},
+		{"unknown", models.EnrollmentStatusActive, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := canTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("canTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Every target of a transition must itself be a known status.
+func TestEnrollmentTransitionTargets(t *testing.T) {
+	for from, targets := range enrollmentTransitions {
+		for _, to := range targets {
+			if !validEnrollmentStatus(to) {
+				t.Errorf("%s -> %s: unknown target", from, to)
+			}
+			if to == from {
+				t.Errorf("%s may move to itself", from)
+			}
+		}
+	}
+	if validEnrollmentStatus("unknown") {
+		t.Error("unknown status is valid")
+	}
+}
+
+func TestEnrollmentEndsAt(t *testing.T) {
+	from := time.Date(2026, 1, 30, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		days int
+		want *time.Time
+	}{
+		{0, nil},
+		{-3, nil},
+		{30, ptrTime(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))},
+	}
+	for _, tt := range tests {
+		got := enrollmentEndsAt(&models.Course{EnrollmentDays: tt.days}, from)
+		if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+			t.Errorf("enrollmentEndsAt(%d days) = %v, want %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
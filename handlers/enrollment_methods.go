@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	defaultInviteDays = 7
+	maxInviteDays     = 90
+)
+
+func validEnrollmentMethod(method string) bool {
+	switch method {
+	case models.EnrollmentMethodOpen, models.EnrollmentMethodKey,
+		models.EnrollmentMethodApproval, models.EnrollmentMethodInvite:
+		return true
+	default:
+		return false
+	}
+}
+
+func enrollmentMethodOf(course *models.Course) string {
+	if course.EnrollmentMethod == "" {
+		return models.EnrollmentMethodOpen
+	}
+	return course.EnrollmentMethod
+}
+
+func hashEnrollmentKey(key string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), 10)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// inviteClaims is the signed body of an invite link. ID names the stored
+// course_invites record, which makes the link single-use and lets staff
+// revoke it; the link only admits Username when the teacher named a student.
+type inviteClaims struct {
+	CourseID  primitive.ObjectID `bson:"c"`
+	InvitedBy primitive.ObjectID `bson:"i"`
+	Username  string             `bson:"u,omitempty"`
+	Expires   int64              `bson:"x"`
+	ID        primitive.ObjectID `bson:"n"`
+}
+
+func encodeInvite(c inviteClaims) (string, error) {
+	payload, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(signPayload("invite", payload)), nil
+}
+
+func decodeInvite(token string) (inviteClaims, error) {
+	var c inviteClaims
+	enc := base64.RawURLEncoding
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, errorf("invalid invite")
+	}
+	payload, err := enc.DecodeString(body)
+	if err != nil {
+		return c, errorf("invalid invite")
+	}
+	mac, err := enc.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signPayload("invite", payload)) {
+		return c, errorf("invalid invite")
+	}
+	if err := bson.Unmarshal(payload, &c); err != nil {
+		return c, errorf("invalid invite")
+	}
+	if time.Now().Unix() > c.Expires {
+		return c, errorf("invite has expired")
+	}
+	return c, nil
+}
+
+// redeemInvite marks an invite used by userID. It fails when the invite
+// was already used, revoked or has expired.
+func redeemInvite(ctx context.Context, claims inviteClaims, userID primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	res, err := db.GetCollection("course_invites").UpdateOne(ctx, bson.M{
+		"_id":       claims.ID,
+		"courseId":  claims.CourseID,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}, bson.M{"$set": bson.M{"usedAt": now, "usedBy": userID}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// releaseInvite gives back an invite whose enrollment was not created.
+func releaseInvite(ctx context.Context, inviteID, userID primitive.ObjectID) {
+	_, err := db.GetCollection("course_invites").UpdateOne(ctx,
+		bson.M{"_id": inviteID, "usedBy": userID},
+		bson.M{"$unset": bson.M{"usedAt": "", "usedBy": ""}},
+	)
+	if err != nil {
+		log.Printf("enrollment: failed to release invite %s: %v", inviteID.Hex(), err)
+	}
+}
+
+// enrollmentForMethod checks the caller against the course's enrollment
+// method and returns the enrollment to create: active (to be admitted) or
+// pending approval. A valid invite link admits under any method; it is
+// spent here, and its id returned so the caller can release it if the
+// enrollment is not created. On failure the response has been written.
+func enrollmentForMethod(ctx context.Context, w http.ResponseWriter, course *models.Course, userID primitive.ObjectID, input enrollmentCreateInput) (models.Enrollment, *primitive.ObjectID, bool) {
+	if strings.TrimSpace(input.Invite) != "" {
+		claims, err := decodeInvite(strings.TrimSpace(input.Invite))
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return models.Enrollment{}, nil, false
+		}
+		if claims.CourseID != course.ID {
+			writeError(w, http.StatusForbidden, "invite is for another course")
+			return models.Enrollment{}, nil, false
+		}
+		if claims.Username != "" {
+			var user models.User
+			opts := options.FindOne().SetProjection(bson.M{"username": 1})
+			if err := db.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to check invite")
+				return models.Enrollment{}, nil, false
+			}
+			if user.Username != claims.Username {
+				writeError(w, http.StatusForbidden, "invite is for another user")
+				return models.Enrollment{}, nil, false
+			}
+		}
+		ok, err := redeemInvite(ctx, claims, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check invite")
+			return models.Enrollment{}, nil, false
+		}
+		if !ok {
+			writeError(w, http.StatusForbidden, "invite has been used or revoked")
+			return models.Enrollment{}, nil, false
+		}
+		doc := newEnrollment(userID, course.ID, models.EnrollmentMethodInvite)
+		doc.InvitedBy = &claims.InvitedBy
+		return doc, &claims.ID, true
+	}
+
+	method := enrollmentMethodOf(course)
+	if hasCourseCapability(course, userID, capManageRoster) {
+		return newEnrollment(userID, course.ID, method), nil, true
+	}
+
+	switch method {
+	case models.EnrollmentMethodKey:
+		key := input.EnrollmentKey
+		if key == "" {
+			writeError(w, http.StatusForbidden, "enrollment key is required")
+			return models.Enrollment{}, nil, false
+		}
+		if course.EnrollmentKeyHash == "" ||
+			bcrypt.CompareHashAndPassword([]byte(course.EnrollmentKeyHash), []byte(key)) != nil {
+			writeError(w, http.StatusForbidden, "invalid enrollment key")
+			return models.Enrollment{}, nil, false
+		}
+	case models.EnrollmentMethodInvite:
+		writeError(w, http.StatusForbidden, "course is invitation only")
+		return models.Enrollment{}, nil, false
+	case models.EnrollmentMethodApproval:
+		doc := newEnrollment(userID, course.ID, method)
+		doc.Status = models.EnrollmentStatusPending
+		return doc, nil, true
+	}
+	return newEnrollment(userID, course.ID, method), nil, true
+}
+
+type inviteCreateInput struct {
+	Username      string `json:"username"`
+	ExpiresInDays int    `json:"expiresInDays"`
+}
+
+// CreateCourseInvite mints a signed, single-use invite link for a course.
+// Staff who manage the roster (the owner and co-teachers) can invite.
+func CreateCourseInvite(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	var input inviteCreateInput
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &input); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = defaultInviteDays
+	}
+	if days < 1 || days > maxInviteDays {
+		writeError(w, http.StatusBadRequest, "expiresInDays must be between 1 and 90")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capManageRoster) {
+		return
+	}
+
+	now := time.Now()
+	invite := models.CourseInvite{
+		ID:        primitive.NewObjectID(),
+		CourseID:  course.ID,
+		InvitedBy: userID,
+		Username:  strings.TrimSpace(input.Username),
+		ExpiresAt: now.Add(time.Duration(days) * 24 * time.Hour),
+		CreatedAt: now,
+	}
+	expiresAt := invite.ExpiresAt
+	token, err := encodeInvite(inviteClaims{
+		CourseID:  course.ID,
+		InvitedBy: userID,
+		Username:  invite.Username,
+		Expires:   expiresAt.Unix(),
+		ID:        invite.ID,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create invite")
+		return
+	}
+	if _, err := db.GetCollection("course_invites").InsertOne(ctx, invite); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create invite")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":        invite.ID,
+		"token":     token,
+		"url":       appBaseURL(r) + "/courses/" + course.ID.Hex() + "?invite=" + url.QueryEscape(token),
+		"expiresAt": expiresAt,
+	})
+}
+
+// GetCourseInvites lists a course's invites that can still be redeemed,
+// newest first.
+func GetCourseInvites(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capManageRoster) {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := db.GetCollection("course_invites").Find(ctx, bson.M{
+		"courseId":  oid,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch invites")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.CourseInvite{}
+	if err := cursor.All(ctx, &results); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode invites")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// RevokeCourseInvite stops an unused invite link from admitting anyone.
+func RevokeCourseInvite(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+	inviteOID, err := primitive.ObjectIDFromHex(r.PathValue("inviteId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid invite id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capManageRoster) {
+		return
+	}
+
+	invites := db.GetCollection("course_invites")
+	res, err := invites.UpdateOne(ctx, bson.M{
+		"_id":       inviteOID,
+		"courseId":  oid,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+	}, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke invite")
+		return
+	}
+	if res.MatchedCount == 0 {
+		var invite models.CourseInvite
+		err := invites.FindOne(ctx, bson.M{"_id": inviteOID, "courseId": oid}).Decode(&invite)
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "invite not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to revoke invite")
+			return
+		}
+		if invite.UsedAt != nil {
+			writeError(w, http.StatusConflict, "invite has already been used")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "invite revoked"})
+}
+
+// GetPendingEnrollments lists the approval queue of a course, oldest first.
+func GetPendingEnrollments(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, oid)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capView) {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "enrolledAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := db.GetCollection("enrollments").Find(ctx,
+		bson.M{"courseId": oid, "status": models.EnrollmentStatusPending}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.Enrollment{}
+	if err := cursor.All(ctx, &results); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode enrollments")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// loadReviewableEnrollment loads an enrollment and its course for staff who
+// manage the roster. On failure the response has been written.
+func loadReviewableEnrollment(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Enrollment, *models.Course, primitive.ObjectID) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, nil, userID
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid enrollment id")
+		return nil, nil, userID
+	}
+
+	var enrollment models.Enrollment
+	if err := db.GetCollection("enrollments").FindOne(ctx, bson.M{"_id": oid}).Decode(&enrollment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "enrollment not found")
+			return nil, nil, userID
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
+		return nil, nil, userID
+	}
+
+	course := loadCourse(ctx, w, enrollment.CourseID)
+	if course == nil {
+		return nil, nil, userID
+	}
+	if !requireCourseCapability(w, course, userID, capManageRoster) {
+		return nil, nil, userID
+	}
+	if enrollment.Status != models.EnrollmentStatusPending {
+		writeError(w, http.StatusConflict, "enrollment is not pending")
+		return nil, nil, userID
+	}
+	return &enrollment, course, userID
+}
+
+// ApproveEnrollment admits a pending student, subject to the capacity.
+func ApproveEnrollment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	enrollment, course, reviewerID := loadReviewableEnrollment(ctx, w, r)
+	if enrollment == nil {
+		return
+	}
+
+	doc, ok, err := admitPending(ctx, *enrollment, course, reviewerID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to approve enrollment")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "enrollment is not pending")
+		return
+	}
+
+	message := "Your request to join \"" + course.Title + "\" was approved."
+	if doc.Status == models.EnrollmentStatusWaitlisted {
+		message = "Your request to join \"" + course.Title + "\" was approved; the course is full and you are on the waitlist."
+	}
+	// The student is already admitted; a lost notification must not turn
+	// that into an error.
+	if err := notify(ctx, doc.UserID, models.NotificationEnrollmentApproved, &course.ID, message); err != nil {
+		log.Printf("enrollment: failed to notify %s: %v", doc.UserID.Hex(), err)
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// RejectEnrollment drops a pending request, so the student may ask again.
+func RejectEnrollment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	enrollment, course, _ := loadReviewableEnrollment(ctx, w, r)
+	if enrollment == nil {
+		return
+	}
+
+	res, err := db.GetCollection("enrollments").DeleteOne(ctx,
+		bson.M{"_id": enrollment.ID, "status": models.EnrollmentStatusPending})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to reject enrollment")
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeError(w, http.StatusConflict, "enrollment is not pending")
+		return
+	}
+
+	err = notify(ctx, enrollment.UserID, models.NotificationEnrollmentRejected, &course.ID,
+		"Your request to join \""+course.Title+"\" was declined.")
+	if err != nil {
+		log.Printf("enrollment: failed to notify %s: %v", enrollment.UserID.Hex(), err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "enrollment rejected"})
+}
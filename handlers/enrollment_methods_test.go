@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestEnrollmentMethodOf(t *testing.T) {
+	tests := []struct {
+		method    string
+		want      string
+		wantValid bool
+	}{
+		{"", models.EnrollmentMethodOpen, false},
+		{models.EnrollmentMethodOpen, models.EnrollmentMethodOpen, true},
+		{models.EnrollmentMethodKey, models.EnrollmentMethodKey, true},
+		{models.EnrollmentMethodApproval, models.EnrollmentMethodApproval, true},
+		{models.EnrollmentMethodInvite, models.EnrollmentMethodInvite, true},
+		// LTI and manual enrollments are recorded methods, not course settings.
+		{models.EnrollmentMethodLTI, models.EnrollmentMethodLTI, false},
+		{models.EnrollmentMethodManual, models.EnrollmentMethodManual, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := enrollmentMethodOf(&models.Course{EnrollmentMethod: tt.method}); got != tt.want {
+				t.Errorf("enrollmentMethodOf = %q, want %q", got, tt.want)
+			}
+			if got := validEnrollmentMethod(tt.method); got != tt.wantValid {
+				t.Errorf("validEnrollmentMethod = %v, want %v", got, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestInviteToken(t *testing.T) {
+	claims := inviteClaims{
+		CourseID:  primitive.NewObjectID(),
+		InvitedBy: primitive.NewObjectID(),
+		Username:  "alice",
+		Expires:   time.Now().Add(time.Hour).Unix(),
+		ID:        primitive.NewObjectID(),
+	}
+	token, err := encodeInvite(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredClaims := claims
+	expiredClaims.Expires = time.Now().Add(-time.Minute).Unix()
+	expired, err := encodeInvite(expiredClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := encodeInvite(inviteClaims{CourseID: primitive.NewObjectID(), Expires: claims.Expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _, _ := strings.Cut(token, ".")
+	_, otherSig, _ := strings.Cut(other, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", token, ""},
+		{"expired", expired, "invite has expired"},
+		{"swapped signature", body + "." + otherSig, "invalid invite"},
+		{"no signature", body, "invalid invite"},
+		{"not base64", "!!!.???", "invalid invite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeInvite(tt.token)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("decodeInvite error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != claims {
+				t.Errorf("decodeInvite = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
@@ -3,19 +3,24 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"AP_Final/db"
 	"AP_Final/models"
 )
 
 type enrollmentCreateInput struct {
-	CourseID string `json:"courseId"`
+	CourseID      string `json:"courseId"`
+	EnrollmentKey string `json:"enrollmentKey,omitempty"`
+	Invite        string `json:"invite,omitempty"`
 }
 
 func CreateEnrollment(w http.ResponseWriter, r *http.Request) {
@@ -55,29 +60,87 @@ func CreateEnrollment(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to check course")
 		return
 	}
+	// Drafts are hidden from non-staff, so they look missing.
+	if !canViewCourse(&course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+	if courseStatusOf(&course) == models.CourseStatusArchived {
+		writeError(w, http.StatusConflict, "course is archived")
+		return
+	}
 
-	now := time.Now()
-	doc := models.Enrollment{
-		ID:         primitive.NewObjectID(),
-		UserID:     userID,
-		CourseID:   courseOID,
-		Status:     "active",
-		EnrolledAt: now,
+	if !hasCourseCapability(&course, userID, capManageRoster) {
+		unmet, err := unmetCoursePrerequisites(ctx, userID, &course)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check prerequisites")
+			return
+		}
+		if len(unmet) > 0 {
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{
+				"error": "prerequisites not met",
+				"unmet": unmet,
+			})
+			return
+		}
 	}
 
-	_, err = db.GetCollection("enrollments").InsertOne(ctx, doc)
-	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
+	doc, inviteID, ok := enrollmentForMethod(ctx, w, &course, userID, input)
+	if !ok {
+		return
+	}
+	// The invite was spent up front; give it back unless the student gets in.
+	enrolled := false
+	if inviteID != nil {
+		defer func() {
+			if !enrolled {
+				releaseInvite(ctx, *inviteID, userID)
+			}
+		}()
+	}
+
+	if doc.Status == models.EnrollmentStatusPending {
+		_, err = db.GetCollection("enrollments").InsertOne(ctx, doc)
+	} else {
+		doc, err = admitEnrollment(ctx, doc, &course)
+	}
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		// Students who withdrew or ran out of time may come back.
+		var existing models.Enrollment
+		filter := bson.M{"userId": userID, "courseId": courseOID}
+		if err := db.GetCollection("enrollments").FindOne(ctx, filter).Decode(&existing); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
+			return
+		}
+		if existing.Status != models.EnrollmentStatusWithdrawn && existing.Status != models.EnrollmentStatusExpired {
 			writeError(w, http.StatusConflict, "enrollment already exists")
 			return
 		}
+		doc, ok, err := reenroll(ctx, existing, doc, &course)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to create enrollment")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusConflict, "enrollment changed, try again")
+			return
+		}
+		enrolled = true
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create enrollment")
 		return
 	}
 
+	enrolled = true
 	writeJSON(w, http.StatusCreated, doc)
 }
 
+// enrollmentSort pages /enrollments/my newest first.
+var enrollmentSort = []sortField{{Path: "enrolledAt", Desc: true}, {Path: "_id", Desc: true}}
+
 func GetMyEnrollments(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromRequest(r)
 	if err != nil {
@@ -85,10 +148,32 @@ func GetMyEnrollments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pg, err := parseListPage(r, "enrolledAt_desc")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := db.GetCollection("enrollments").Find(ctx, bson.M{"userId": userID})
+	collection := db.GetCollection("enrollments")
+	filter := bson.M{"userId": userID}
+
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count enrollments")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(enrollmentSort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(enrollmentSort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
 		return
@@ -101,6 +186,26 @@ func GetMyEnrollments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fetched := len(results)
+	if fetched > pg.Limit {
+		results = results[:pg.Limit]
+	}
+	for i := range results {
+		if err := setWaitlistPosition(ctx, &results[i]); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to compute waitlist position")
+			return
+		}
+	}
+	if pg.Back() {
+		slices.Reverse(results)
+	}
+	var first, last []interface{}
+	if len(results) > 0 {
+		first = []interface{}{results[0].EnrolledAt, results[0].ID}
+		last = []interface{}{results[len(results)-1].EnrolledAt, results[len(results)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
 	writeJSON(w, http.StatusOK, results)
 }
 
@@ -121,14 +226,23 @@ func DeleteEnrollment(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := db.GetCollection("enrollments").DeleteOne(ctx, bson.M{"_id": oid, "userId": userID})
+	var deleted models.Enrollment
+	err = db.GetCollection("enrollments").FindOneAndDelete(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "enrollment not found")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to delete enrollment")
 		return
 	}
-	if res.DeletedCount == 0 {
-		writeError(w, http.StatusNotFound, "enrollment not found")
-		return
+
+	// A freed seat goes to the head of the waitlist.
+	if deleted.Status == models.EnrollmentStatusActive {
+		if err := vacateSeat(ctx, deleted.CourseID); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to release seat")
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"message": "enrollment deleted"})
@@ -167,8 +281,7 @@ func DeleteEnrollmentsByCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if course.TeacherID != userID {
-		writeError(w, http.StatusForbidden, "forbidden")
+	if !requireCourseCapability(w, &course, userID, capManageRoster) {
 		return
 	}
 
@@ -177,6 +290,10 @@ func DeleteEnrollmentsByCourse(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to delete enrollments")
 		return
 	}
+	if _, err := db.GetCollection("courses").UpdateOne(ctx, bson.M{"_id": courseOID}, bson.M{"$unset": bson.M{"seatsTaken": ""}}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to reset seats")
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{"deletedCount": res.DeletedCount})
 }
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+// courseETag builds a strong ETag from the course version counter.
+func courseETag(version int64) string {
+	return `"v` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseCourseETag reads a version from a strong course ETag. If-Match uses
+// the strong comparison, so weak tags never match.
+func parseCourseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 3 || !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(tag[2:len(tag)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+var errIfMatchRequired = errorf("If-Match header is required")
+
+// courseMutationFilter returns the filter for a course mutation, pinning the
+// expected version from If-Match. Mutations without If-Match are refused, so
+// no client overwrites changes it has not seen; "*" opts out explicitly.
+func courseMutationFilter(r *http.Request, courseOID primitive.ObjectID) (bson.M, error) {
+	filter := bson.M{"_id": courseOID}
+
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return nil, errIfMatchRequired
+	}
+	if header == "*" {
+		return filter, nil
+	}
+
+	// Documents created before versioning have no field; treat them as v0.
+	versions := []interface{}{}
+	for _, tag := range strings.Split(header, ",") {
+		v, ok := parseCourseETag(tag)
+		if !ok {
+			continue
+		}
+		versions = append(versions, v)
+		if v == 0 {
+			versions = append(versions, nil)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errorf("invalid If-Match header")
+	}
+
+	filter["version"] = bson.M{"$in": versions}
+	return filter, nil
+}
+
+// writeCourseMutationFilterError answers a courseMutationFilter error:
+// 428 when If-Match is missing, 400 when it is unusable.
+func writeCourseMutationFilterError(w http.ResponseWriter, err error) {
+	if err == errIfMatchRequired {
+		writeError(w, http.StatusPreconditionRequired, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// writeCourseMutationMiss reports why a versioned course update matched
+// nothing: the course or module is gone (404) or the version moved on (412).
+// Pass primitive.NilObjectID as moduleOID for course-level mutations.
+func writeCourseMutationMiss(ctx context.Context, w http.ResponseWriter, courseOID, moduleOID primitive.ObjectID) {
+	var current models.Course
+	opts := options.FindOne().SetProjection(bson.M{"version": 1, "modules._id": 1})
+	err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}, opts).Decode(&current)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "course not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to check course")
+		return
+	}
+
+	if !moduleOID.IsZero() && findModule(&current, moduleOID) == nil {
+		writeError(w, http.StatusNotFound, "module not found")
+		return
+	}
+
+	w.Header().Set("ETag", courseETag(current.Version))
+	writeError(w, http.StatusPreconditionFailed, "course was modified by another request")
+}
+
+// updateCourseVersioned applies update to the course guarded by If-Match,
+// bumps its version and sets the new ETag. When moduleOID is set the update
+// only matches if that module exists. It returns the updated course, or nil
+// after writing an error response.
+func updateCourseVersioned(ctx context.Context, w http.ResponseWriter, r *http.Request, courseOID, moduleOID primitive.ObjectID, update bson.M, opts ...*options.FindOneAndUpdateOptions) *models.Course {
+	filter, err := courseMutationFilter(r, courseOID)
+	if err != nil {
+		writeCourseMutationFilterError(w, err)
+		return nil
+	}
+	if !moduleOID.IsZero() {
+		filter["modules._id"] = moduleOID
+	}
+
+	inc, _ := update["$inc"].(bson.M)
+	if inc == nil {
+		inc = bson.M{}
+	}
+	inc["version"] = 1
+	update["$inc"] = inc
+
+	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
+
+	var course models.Course
+	err = db.GetCollection("courses").FindOneAndUpdate(ctx, filter, update, opts...).Decode(&course)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeCourseMutationMiss(ctx, w, courseOID, moduleOID)
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update course")
+		return nil
+	}
+
+	w.Header().Set("ETag", courseETag(course.Version))
+	return &course
+}
+
+func findModule(course *models.Course, moduleOID primitive.ObjectID) *models.CourseModule {
+	for i := range course.Modules {
+		if course.Modules[i].ID == moduleOID {
+			return &course.Modules[i]
+		}
+	}
+	return nil
+}
+
+// ifNoneMatch reports whether the request's If-None-Match covers etag. It
+// uses the weak comparison, so W/ prefixes are ignored.
+func ifNoneMatch(r *http.Request, etag string) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
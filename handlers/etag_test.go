@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseCourseETag(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   int64
+		wantOK bool
+	}{
+		{`"v3"`, 3, true},
+		{` "v0" `, 0, true},
+		{`W/"v3"`, 0, false},
+		{`"3"`, 0, false},
+		{`"v-1"`, 0, false},
+		{`v3`, 0, false},
+		{`""`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := parseCourseETag(tt.tag)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseCourseETag(%q) = %v, %v; want %v, %v", tt.tag, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCourseMutationFilter(t *testing.T) {
+	oid := primitive.NewObjectID()
+	tests := []struct {
+		name     string
+		ifMatch  string
+		versions []interface{}
+		err      error
+		wantErr  bool
+	}{
+		{"missing", "", nil, errIfMatchRequired, true},
+		{"any", "*", nil, nil, false},
+		{"one", `"v4"`, []interface{}{int64(4)}, nil, false},
+		{"list", `"v1", W/"v2", "v0"`, []interface{}{int64(1), int64(0), nil}, nil, false},
+		{"weak only", `W/"v2"`, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/courses/"+oid.Hex(), nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			filter, err := courseMutationFilter(r, oid)
+			if (err != nil) != tt.wantErr || (tt.err != nil && err != tt.err) {
+				t.Fatalf("courseMutationFilter error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.versions == nil {
+				if _, ok := filter["version"]; ok {
+					t.Errorf("filter pins a version: %v", filter)
+				}
+				return
+			}
+			got := filter["version"].(bson.M)["$in"].([]interface{})
+			if len(got) != len(tt.versions) {
+				t.Fatalf("versions = %v, want %v", got, tt.versions)
+			}
+			for i := range got {
+				if got[i] != tt.versions[i] {
+					t.Errorf("versions = %v, want %v", got, tt.versions)
+				}
+			}
+		})
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"*", true},
+		{`"v3"`, true},
+		{`W/"v3"`, true},
+		{`"v2", W/"v3"`, true},
+		{`"v2"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/courses/x", nil)
+			r.Header.Set("If-None-Match", tt.header)
+			if got := ifNoneMatch(r, courseETag(3)); got != tt.want {
+				t.Errorf("ifNoneMatch(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
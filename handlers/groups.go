@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	assignRoundRobin = "round_robin"
+	assignRandom     = "random"
+)
+
+// Modules and items with groupIds are only shown to students of those
+// groups; without groupIds they are visible to everyone.
+
+// viewerGroupID returns the group of the user's enrollment in the course.
+func viewerGroupID(ctx context.Context, userID, courseOID primitive.ObjectID) (*primitive.ObjectID, error) {
+	if userID.IsZero() {
+		return nil, nil
+	}
+	var e models.Enrollment
+	opts := options.FindOne().SetProjection(bson.M{"groupId": 1})
+	err := db.GetCollection("enrollments").FindOne(ctx, bson.M{"userId": userID, "courseId": courseOID}, opts).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return e.GroupID, err
+}
+
+// viewerGroupIDs is viewerGroupID for several courses at once; courses the
+// user is not enrolled in, or has no group in, are missing from the map.
+func viewerGroupIDs(ctx context.Context, userID primitive.ObjectID, courseIDs []primitive.ObjectID) (map[primitive.ObjectID]*primitive.ObjectID, error) {
+	groups := map[primitive.ObjectID]*primitive.ObjectID{}
+	if userID.IsZero() || len(courseIDs) == 0 {
+		return groups, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"courseId": 1, "groupId": 1})
+	cursor, err := db.GetCollection("enrollments").Find(ctx, bson.M{"userId": userID, "courseId": bson.M{"$in": courseIDs}, "groupId": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var enrollments []models.Enrollment
+	if err := cursor.All(ctx, &enrollments); err != nil {
+		return nil, err
+	}
+	for _, e := range enrollments {
+		groups[e.CourseID] = e.GroupID
+	}
+	return groups, nil
+}
+
+func visibleToGroup(groupIDs []primitive.ObjectID, groupID *primitive.ObjectID) bool {
+	return len(groupIDs) == 0 || (groupID != nil && slices.Contains(groupIDs, *groupID))
+}
+
+func itemVisibleToGroup(module *models.CourseModule, item *models.CourseItem, groupID *primitive.ObjectID) bool {
+	return visibleToGroup(module.GroupIDs, groupID) && visibleToGroup(item.GroupIDs, groupID)
+}
+
+// hideOtherGroupsContent drops the modules and items the group cannot see.
+func hideOtherGroupsContent(course *models.Course, groupID *primitive.ObjectID) {
+	modules := course.Modules[:0]
+	for _, m := range course.Modules {
+		if !visibleToGroup(m.GroupIDs, groupID) {
+			continue
+		}
+		items := m.Items[:0]
+		for _, it := range m.Items {
+			if visibleToGroup(it.GroupIDs, groupID) {
+				items = append(items, it)
+			}
+		}
+		m.Items = items
+		modules = append(modules, m)
+	}
+	course.Modules = modules
+}
+
+// parseCourseGroupIDs checks that every id names a group of the course.
+func parseCourseGroupIDs(ctx context.Context, courseOID primitive.ObjectID, raw []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(raw))
+	for _, s := range raw {
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errorf("invalid group id")
+		}
+		if !slices.Contains(ids, oid) {
+			ids = append(ids, oid)
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	n, err := db.GetCollection("groups").CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}, "courseId": courseOID})
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(len(ids)) {
+		return nil, errorf("unknown group id")
+	}
+	return ids, nil
+}
+
+// parseTAIDs checks that every id names a staff member of the course who
+// may grade.
+func parseTAIDs(course *models.Course, raw []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(raw))
+	for _, s := range raw {
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errorf("invalid taIds")
+		}
+		if !hasCourseCapability(course, oid, capGrade) {
+			return nil, errorf("taIds must be course staff who can grade")
+		}
+		if !slices.Contains(ids, oid) {
+			ids = append(ids, oid)
+		}
+	}
+	return ids, nil
+}
+
+// loadCourseGroup loads the {groupId} group of course.
+func loadCourseGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, course *models.Course) *models.Group {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("groupId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid group id")
+		return nil
+	}
+	var group models.Group
+	err = db.GetCollection("groups").FindOne(ctx, bson.M{"_id": oid, "courseId": course.ID}).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "group not found")
+		return nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch group")
+		return nil
+	}
+	return &group
+}
+
+// courseGroups lists the groups of a course by name with their member
+// counts.
+func courseGroups(ctx context.Context, courseOID primitive.ObjectID) ([]models.Group, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := db.GetCollection("groups").Find(ctx, bson.M{"courseId": courseOID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	groups := []models.Group{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	cursor, err = db.GetCollection("enrollments").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"courseId": courseOID, "groupId": bson.M{"$ne": nil}}},
+		{"$group": bson.M{"_id": "$groupId", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		GroupID primitive.ObjectID `bson:"_id"`
+		Count   int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		for i := range groups {
+			if groups[i].ID == c.GroupID {
+				groups[i].MemberCount = c.Count
+			}
+		}
+	}
+	return groups, nil
+}
+
+func GetCourseGroups(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	groups, err := courseGroups(ctx, course.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch groups")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+type groupInput struct {
+	Name  *string   `json:"name"`
+	TAIDs *[]string `json:"taIds"`
+}
+
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var input groupInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+
+	var taIDs []primitive.ObjectID
+	if input.TAIDs != nil {
+		ids, err := parseTAIDs(course, *input.TAIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		taIDs = ids
+	}
+
+	now := time.Now()
+	group := models.Group{
+		ID:        primitive.NewObjectID(),
+		CourseID:  course.ID,
+		Name:      strings.TrimSpace(*input.Name),
+		TAIDs:     taIDs,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := db.GetCollection("groups").InsertOne(ctx, group); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "group name already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create group")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, group)
+}
+
+func PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var input groupInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	group := loadCourseGroup(ctx, w, r, course)
+	if group == nil {
+		return
+	}
+
+	setFields := bson.M{}
+	if input.Name != nil {
+		if strings.TrimSpace(*input.Name) == "" {
+			writeError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		setFields["name"] = strings.TrimSpace(*input.Name)
+	}
+	if input.TAIDs != nil {
+		ids, err := parseTAIDs(course, *input.TAIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		setFields["taIds"] = ids
+	}
+	if len(setFields) == 0 {
+		writeError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+	setFields["updatedAt"] = time.Now()
+
+	var updated models.Group
+	err := db.GetCollection("groups").FindOneAndUpdate(ctx,
+		bson.M{"_id": group.ID},
+		bson.M{"$set": setFields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "group name already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update group")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteGroup removes a group, its memberships and every reference to it in
+// the course structure.
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	group := loadCourseGroup(ctx, w, r, course)
+	if group == nil {
+		return
+	}
+
+	if _, err := db.GetCollection("groups").DeleteOne(ctx, bson.M{"_id": group.ID}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete group")
+		return
+	}
+	if _, err := db.GetCollection("enrollments").UpdateMany(ctx,
+		bson.M{"courseId": course.ID, "groupId": group.ID},
+		bson.M{"$unset": bson.M{"groupId": ""}}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update enrollments")
+		return
+	}
+
+	// Content restricted to this group alone becomes visible to everyone,
+	// so the structure changes and the version moves on.
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"gm.groupIds": group.ID},
+		bson.M{"im.items.groupIds": group.ID},
+		bson.M{"gi.groupIds": group.ID},
+	}})
+	_, err := db.GetCollection("courses").UpdateOne(ctx,
+		bson.M{"_id": course.ID, "$or": bson.A{
+			bson.M{"modules.groupIds": group.ID},
+			bson.M{"modules.items.groupIds": group.ID},
+		}},
+		bson.M{
+			"$pull": bson.M{
+				"modules.$[gm].groupIds":             group.ID,
+				"modules.$[im].items.$[gi].groupIds": group.ID,
+			},
+			"$set": bson.M{"updatedAt": time.Now()},
+			"$inc": bson.M{"version": 1},
+		}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update course")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type groupMembersInput struct {
+	EnrollmentIDs []string `json:"enrollmentIds"`
+}
+
+// AddGroupMembers moves enrollments of the course into the group. A student
+// belongs to at most one group, so this also takes them out of another.
+func AddGroupMembers(w http.ResponseWriter, r *http.Request) {
+	var input groupMembersInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(input.EnrollmentIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "enrollmentIds is required")
+		return
+	}
+	ids := make([]primitive.ObjectID, 0, len(input.EnrollmentIDs))
+	for _, s := range input.EnrollmentIDs {
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(s))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid enrollment id")
+			return
+		}
+		ids = append(ids, oid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	group := loadCourseGroup(ctx, w, r, course)
+	if group == nil {
+		return
+	}
+
+	res, err := db.GetCollection("enrollments").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "courseId": course.ID},
+		bson.M{"$set": bson.M{"groupId": group.ID}})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update enrollments")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"matchedCount": res.MatchedCount})
+}
+
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	group := loadCourseGroup(ctx, w, r, course)
+	if group == nil {
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("enrollmentId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid enrollment id")
+		return
+	}
+
+	res, err := db.GetCollection("enrollments").UpdateOne(ctx,
+		bson.M{"_id": oid, "courseId": course.ID, "groupId": group.ID},
+		bson.M{"$unset": bson.M{"groupId": ""}})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update enrollment")
+		return
+	}
+	if res.MatchedCount == 0 {
+		writeError(w, http.StatusNotFound, "enrollment is not in this group")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type groupAssignInput struct {
+	Strategy string   `json:"strategy"`
+	GroupIDs []string `json:"groupIds"`
+	Reassign bool     `json:"reassign"`
+}
+
+// AutoAssignGroups spreads active and waitlisted students over the course's
+// groups (or the listed ones). Each student goes to the group with the
+// fewest members, ties broken by name, so groups stay balanced:
+// round_robin deals students in enrollment order, random shuffles them
+// first. Only students without a group are moved unless reassign is set.
+func AutoAssignGroups(w http.ResponseWriter, r *http.Request) {
+	var input groupAssignInput
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &input); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	if input.Strategy == "" {
+		input.Strategy = assignRoundRobin
+	}
+	if input.Strategy != assignRoundRobin && input.Strategy != assignRandom {
+		writeError(w, http.StatusBadRequest, "strategy must be round_robin or random")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+
+	groups, err := courseGroups(ctx, course.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch groups")
+		return
+	}
+	if len(input.GroupIDs) > 0 {
+		ids, err := parseCourseGroupIDs(ctx, course.ID, input.GroupIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		groups = slices.DeleteFunc(groups, func(g models.Group) bool { return !slices.Contains(ids, g.ID) })
+	}
+	if len(groups) == 0 {
+		writeError(w, http.StatusBadRequest, "course has no groups")
+		return
+	}
+
+	filter := bson.M{
+		"courseId": course.ID,
+		"status":   bson.M{"$in": bson.A{models.EnrollmentStatusActive, models.EnrollmentStatusWaitlisted}},
+	}
+	if !input.Reassign {
+		filter["groupId"] = nil
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "enrolledAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1, "groupId": 1})
+	cursor, err := db.GetCollection("enrollments").Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	var students []models.Enrollment
+	if err := cursor.All(ctx, &students); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode enrollments")
+		return
+	}
+
+	// Students being reassigned no longer count towards their old group.
+	for _, s := range students {
+		if s.GroupID == nil {
+			continue
+		}
+		for i := range groups {
+			if groups[i].ID == *s.GroupID {
+				groups[i].MemberCount--
+			}
+		}
+	}
+	if input.Strategy == assignRandom {
+		rand.Shuffle(len(students), func(i, j int) { students[i], students[j] = students[j], students[i] })
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(students))
+	for _, s := range students {
+		target := 0
+		for i := range groups {
+			if groups[i].MemberCount < groups[target].MemberCount {
+				target = i
+			}
+		}
+		groups[target].MemberCount++
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": s.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"groupId": groups[target].ID}}))
+	}
+	if len(writes) > 0 {
+		if _, err := db.GetCollection("enrollments").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to assign groups")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"assigned": len(writes),
+		"groups":   groups,
+	})
+}
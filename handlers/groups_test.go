@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func TestHideOtherGroupsContent(t *testing.T) {
+	evening, morning := primitive.NewObjectID(), primitive.NewObjectID()
+	course := func() *models.Course {
+		return &models.Course{Modules: []models.CourseModule{
+			{Title: "shared", Items: []models.CourseItem{
+				{Title: "all"},
+				{Title: "evening item", GroupIDs: []primitive.ObjectID{evening}},
+			}},
+			{Title: "morning module", GroupIDs: []primitive.ObjectID{morning}, Items: []models.CourseItem{{Title: "morning item"}}},
+		}}
+	}
+	titles := func(c *models.Course) []string {
+		var out []string
+		for _, m := range c.Modules {
+			out = append(out, m.Title)
+			for _, it := range m.Items {
+				out = append(out, it.Title)
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		group *primitive.ObjectID
+		want  []string
+	}{
+		{"no group", nil, []string{"shared", "all"}},
+		{"evening", &evening, []string{"shared", "all", "evening item"}},
+		{"morning", &morning, []string{"shared", "all", "morning module", "morning item"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := course()
+			hideOtherGroupsContent(c, tt.group)
+			if got := titles(c); !slices.Equal(got, tt.want) {
+				t.Errorf("content = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemVisibleToGroup(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name         string
+		module, item []primitive.ObjectID
+		group        *primitive.ObjectID
+		want         bool
+	}{
+		{"unrestricted", nil, nil, nil, true},
+		{"unrestricted for a member", nil, nil, &a, true},
+		{"module for the group", []primitive.ObjectID{a}, nil, &a, true},
+		{"module for another group", []primitive.ObjectID{b}, nil, &a, false},
+		{"restricted without a group", []primitive.ObjectID{a}, nil, nil, false},
+		{"item for another group", nil, []primitive.ObjectID{b}, &a, false},
+		{"item in a shared list", []primitive.ObjectID{a, b}, []primitive.ObjectID{b}, &b, true},
+		{"module allows, item does not", []primitive.ObjectID{a, b}, []primitive.ObjectID{b}, &a, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module := &models.CourseModule{GroupIDs: tt.module}
+			item := &models.CourseItem{GroupIDs: tt.item}
+			if got := itemVisibleToGroup(module, item, tt.group); got != tt.want {
+				t.Errorf("itemVisibleToGroup = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTAIDs(t *testing.T) {
+	owner, ta, observer, student := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	course := &models.Course{TeacherID: owner, Staff: []models.CourseStaff{
+		{UserID: ta, Role: models.CourseRoleTA},
+		{UserID: observer, Role: models.CourseRoleObserver},
+	}}
+	tests := []struct {
+		name    string
+		raw     []string
+		want    []primitive.ObjectID
+		wantErr bool
+	}{
+		{"none", nil, []primitive.ObjectID{}, false},
+		{"owner and ta", []string{owner.Hex(), " " + ta.Hex()}, []primitive.ObjectID{owner, ta}, false},
+		{"duplicates", []string{ta.Hex(), ta.Hex()}, []primitive.ObjectID{ta}, false},
+		{"observer cannot grade", []string{observer.Hex()}, nil, true},
+		{"student", []string{student.Hex()}, nil, true},
+		{"invalid id", []string{"nope"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTAIDs(course, tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTAIDs error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("parseTAIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"AP_Final/db"
 	"AP_Final/models"
@@ -31,9 +32,18 @@ func decodeJSON(r *http.Request, dst interface{}) error {
 }
 
 func getUserIDFromRequest(r *http.Request) (primitive.ObjectID, error) {
+	user, err := getUserFromRequest(r)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return user.ID, nil
+}
+
+func getUserFromRequest(r *http.Request) (*models.User, error) {
 	cookie, err := r.Cookie("session_token")
 	if err != nil || strings.TrimSpace(cookie.Value) == "" {
-		return primitive.NilObjectID, http.ErrNoCookie
+		return nil, http.ErrNoCookie
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -42,8 +52,47 @@ func getUserIDFromRequest(r *http.Request) (primitive.ObjectID, error) {
 	var user models.User
 	err = db.GetCollection("users").FindOne(ctx, bson.M{"username": cookie.Value}).Decode(&user)
 	if err != nil {
-		return primitive.NilObjectID, err
+		return nil, err
 	}
 
-	return user.ID, nil
+	return &user, nil
+}
+
+// requireAdmin writes 401/403 and returns nil unless the caller is an admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) *models.User {
+	user, err := getUserFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil
+	}
+	if user.Role != models.RoleAdmin {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return nil
+	}
+	return user
+}
+
+// viewerIDFromRequest identifies the caller on public routes; anonymous
+// visitors get primitive.NilObjectID.
+func viewerIDFromRequest(r *http.Request) primitive.ObjectID {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		return primitive.NilObjectID
+	}
+	return userID
+}
+
+// loadCourse fetches a course by id, writing 404/500 and returning nil on failure.
+func loadCourse(ctx context.Context, w http.ResponseWriter, oid primitive.ObjectID) *models.Course {
+	var course models.Course
+	err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": oid}).Decode(&course)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "course not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch course")
+		return nil
+	}
+	return &course
 }
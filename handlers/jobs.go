@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	defaultJobInterval = 10 * time.Minute
+	jobBatchSize       = 500
+)
+
+// StartBackgroundJobs runs enrollment maintenance and at-risk assessment
+// now and then every ENROLLMENT_JOB_INTERVAL (a Go duration, default 10m)
+// until ctx is done.
+// Every step is a conditional update, so several instances may run it.
+func StartBackgroundJobs(ctx context.Context) {
+	interval := defaultJobInterval
+	if v := os.Getenv("ENROLLMENT_JOB_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("jobs: invalid ENROLLMENT_JOB_INTERVAL %q, using %s", v, interval)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runEnrollmentJobs(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func runEnrollmentJobs(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Minute)
+	defer cancel()
+
+	expired, err := expireEnrollments(ctx, time.Now())
+	if err != nil {
+		log.Printf("jobs: expiring enrollments: %v", err)
+	}
+	completed, err := completeEnrollments(ctx)
+	if err != nil {
+		log.Printf("jobs: completing enrollments: %v", err)
+	}
+	assessed, err := assessRisks(ctx, time.Now())
+	if err != nil {
+		log.Printf("jobs: assessing at-risk students: %v", err)
+	}
+	if expired > 0 || completed > 0 || assessed > 0 {
+		log.Printf("jobs: %d enrollments expired, %d completed, %d assessed", expired, completed, assessed)
+	}
+}
+
+// expireEnrollments ends every enrollment whose end date has passed.
+func expireEnrollments(ctx context.Context, now time.Time) (int, error) {
+	collection := db.GetCollection("enrollments")
+	filter := bson.M{
+		"status": bson.M{"$in": bson.A{
+			models.EnrollmentStatusActive, models.EnrollmentStatusWaitlisted, models.EnrollmentStatusSuspended,
+		}},
+		"endsAt": bson.M{"$lte": now},
+	}
+
+	titles := map[primitive.ObjectID]string{}
+	count := 0
+	for {
+		cursor, err := collection.Find(ctx, filter, options.Find().SetLimit(jobBatchSize))
+		if err != nil {
+			return count, err
+		}
+		var batch []models.Enrollment
+		if err := cursor.All(ctx, &batch); err != nil {
+			return count, err
+		}
+
+		progressed := false
+		for _, e := range batch {
+			_, ok, err := endEnrollment(ctx, e, models.EnrollmentStatusExpired, bson.M{}, nil)
+			if err != nil {
+				return count, err
+			}
+			if !ok {
+				continue
+			}
+			progressed = true
+			count++
+
+			title, err := courseTitle(ctx, titles, e.CourseID)
+			if err != nil {
+				return count, err
+			}
+			if title == "" {
+				continue
+			}
+			if err := notify(ctx, e.UserID, models.NotificationEnrollmentExpired, &e.CourseID,
+				"Your enrollment in \""+title+"\" has expired."); err != nil {
+				log.Printf("jobs: failed to notify %s: %v", e.UserID.Hex(), err)
+			}
+		}
+		if len(batch) < jobBatchSize || !progressed {
+			return count, nil
+		}
+	}
+}
+
+// completeEnrollments completes active enrollments whose students meet
+// their course's completion rules, for instance after the rules changed.
+func completeEnrollments(ctx context.Context) (int, error) {
+	enrollments := db.GetCollection("enrollments")
+	courseIDs, err := enrollments.Distinct(ctx, "courseId", bson.M{"status": models.EnrollmentStatusActive})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, raw := range courseIDs {
+		courseOID, ok := raw.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var course models.Course
+		if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}).Decode(&course); err != nil {
+			continue
+		}
+
+		filter := bson.M{"courseId": courseOID, "status": models.EnrollmentStatusActive}
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(jobBatchSize)
+		for {
+			cursor, err := enrollments.Find(ctx, filter, opts)
+			if err != nil {
+				return count, err
+			}
+			var batch []models.Enrollment
+			if err := cursor.All(ctx, &batch); err != nil {
+				return count, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			userIDs := make([]primitive.ObjectID, 0, len(batch))
+			for _, e := range batch {
+				userIDs = append(userIDs, e.UserID)
+			}
+			progress, err := learnerProgress(ctx, courseOID, userIDs)
+			if err != nil {
+				return count, err
+			}
+			for _, e := range batch {
+				done, err := completeIfSatisfied(ctx, &course, e, progress[e.UserID])
+				if err != nil {
+					return count, err
+				}
+				if !done {
+					continue
+				}
+				count++
+				if err := checkBadges(ctx, e.UserID, courseOID); err != nil {
+					log.Printf("jobs: checking badges of %s: %v", courseOID.Hex(), err)
+				}
+			}
+
+			if len(batch) < jobBatchSize {
+				break
+			}
+			filter["_id"] = bson.M{"$gt": batch[len(batch)-1].ID}
+		}
+	}
+	return count, nil
+}
+
+// courseTitle looks a title up through cache; deleted courses give "".
+func courseTitle(ctx context.Context, cache map[primitive.ObjectID]string, courseOID primitive.ObjectID) (string, error) {
+	if title, ok := cache[courseOID]; ok {
+		return title, nil
+	}
+	var course models.Course
+	opts := options.FindOne().SetProjection(bson.M{"title": 1})
+	err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}, opts).Decode(&course)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+	cache[courseOID] = course.Title
+	return course.Title, nil
+}
@@ -0,0 +1,838 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rsa"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"AP_Final/db"
+	"AP_Final/lti"
+	"AP_Final/models"
+)
+
+// This file holds the tool side of LTI 1.3: an external platform (LMS)
+// launches courses and items of this system. lti_platform.go holds the
+// reverse direction.
+
+const (
+	ltiLoginTTL    = 10 * time.Minute
+	ltiDeepLinkTTL = 30 * time.Minute
+)
+
+type ltiPlatformInput struct {
+	Name          string   `json:"name"`
+	Issuer        string   `json:"issuer"`
+	ClientID      string   `json:"clientId"`
+	DeploymentIDs []string `json:"deploymentIds,omitempty"`
+	AuthLoginURL  string   `json:"authLoginUrl"`
+	AuthTokenURL  string   `json:"authTokenUrl,omitempty"`
+	JWKSURL       string   `json:"jwksUrl"`
+}
+
+var (
+	ltiKeyOnce sync.Once
+	ltiKey     *rsa.PrivateKey
+	ltiKeyErr  error
+	ltiGrades  *lti.GradeClient
+
+	ltiKeySets = lti.NewKeySetCache(10 * time.Minute)
+)
+
+func ltiKeyFile() string {
+	if path := os.Getenv("LTI_KEY_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join("uploads", "lti", "private.pem")
+}
+
+// ltiSigningKey loads (or on first use creates) the key this system signs
+// LTI messages with, both as tool and as platform. Open Badges are signed
+// with it too.
+func ltiSigningKey() (*rsa.PrivateKey, string, error) {
+	ltiKeyOnce.Do(func() {
+		ltiKey, ltiKeyErr = lti.LoadOrCreateKey(ltiKeyFile())
+		if ltiKeyErr == nil {
+			ltiGrades = lti.NewGradeClient(ltiKey)
+		}
+	})
+	if ltiKeyErr != nil {
+		return nil, "", ltiKeyErr
+	}
+	return ltiKey, lti.KeyID(&ltiKey.PublicKey), nil
+}
+
+// appBaseURL is the externally visible origin, used as the platform issuer
+// and in URLs handed to other systems. APP_BASE_URL overrides detection.
+func appBaseURL(r *http.Request) string {
+	if base := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/"); base != "" {
+		return base
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ltiStateCookie binds a login state to the browser that started it, so a
+// launch posted from elsewhere with a stolen state is refused. The launch is
+// a cross-site POST, which only carries SameSite=None cookies, and those
+// must be Secure.
+func ltiStateCookie(r *http.Request, state string, maxAge int) *http.Cookie {
+	secure := strings.HasPrefix(appBaseURL(r), "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	return &http.Cookie{
+		Name:     "lti_state_" + state,
+		Value:    state,
+		Path:     "/lti/launch",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	}
+}
+
+// renderAutoPost answers with a page that immediately POSTs fields to action,
+// the form_post response mode used throughout LTI.
+func renderAutoPost(w http.ResponseWriter, action string, fields map[string]string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	tmpl, err := template.ParseFiles("views/lti_post.html")
+	if err != nil {
+		http.Error(w, "Template parse error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, map[string]interface{}{"Action": action, "Fields": fields}); err != nil {
+		http.Error(w, "Template execute error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func saveLtiState(ctx context.Context, state models.LtiState) error {
+	_, err := db.GetCollection("lti_states").InsertOne(ctx, state)
+	return err
+}
+
+// consumeLtiState fetches and deletes a state record in one step, so every
+// state, nonce and launch hint can be used only once.
+func consumeLtiState(ctx context.Context, id, kind string) (*models.LtiState, error) {
+	var state models.LtiState
+	err := db.GetCollection("lti_states").FindOneAndDelete(ctx, bson.M{
+		"_id":       id,
+		"kind":      kind,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func LtiJWKS(w http.ResponseWriter, r *http.Request) {
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, lti.JWKS{Keys: []lti.JWK{lti.PublicJWK(&key.PublicKey, kid)}})
+}
+
+func CreateLtiPlatform(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	var input ltiPlatformInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Issuer = strings.TrimSpace(input.Issuer)
+	input.ClientID = strings.TrimSpace(input.ClientID)
+	if input.Name == "" || input.Issuer == "" || input.ClientID == "" {
+		writeError(w, http.StatusBadRequest, "name, issuer and clientId are required")
+		return
+	}
+	if !validHTTPURL(input.AuthLoginURL) || !validHTTPURL(input.JWKSURL) {
+		writeError(w, http.StatusBadRequest, "authLoginUrl and jwksUrl must be http(s) urls")
+		return
+	}
+	if input.AuthTokenURL != "" && !validHTTPURL(input.AuthTokenURL) {
+		writeError(w, http.StatusBadRequest, "authTokenUrl must be an http(s) url")
+		return
+	}
+
+	platform := models.LtiPlatform{
+		ID:            primitive.NewObjectID(),
+		Name:          input.Name,
+		Issuer:        input.Issuer,
+		ClientID:      input.ClientID,
+		DeploymentIDs: input.DeploymentIDs,
+		AuthLoginURL:  input.AuthLoginURL,
+		AuthTokenURL:  input.AuthTokenURL,
+		JWKSURL:       input.JWKSURL,
+		CreatedAt:     time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.GetCollection("lti_platforms").InsertOne(ctx, platform); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "platform already registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create platform")
+		return
+	}
+
+	base := appBaseURL(r)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"platform": platform,
+		// What the platform administrator needs to configure on their side.
+		"tool": map[string]string{
+			"loginUrl":    base + "/lti/login",
+			"redirectUri": base + "/lti/launch",
+			"jwksUrl":     base + "/lti/jwks",
+			"targetLink":  base + "/courses",
+		},
+	})
+}
+
+func GetLtiPlatforms(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.GetCollection("lti_platforms").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch platforms")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	platforms := []models.LtiPlatform{}
+	if err := cursor.All(ctx, &platforms); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode platforms")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, platforms)
+}
+
+func DeleteLtiPlatform(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	platformOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid platform id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := db.GetCollection("lti_platforms").DeleteOne(ctx, bson.M{"_id": platformOID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete platform")
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeError(w, http.StatusNotFound, "platform not found")
+		return
+	}
+	_, _ = db.GetCollection("lti_links").DeleteMany(ctx, bson.M{"platformId": platformOID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LtiLogin handles OIDC third-party login initiation from a platform and
+// redirects the browser to the platform's authorization endpoint.
+func LtiLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	issuer := r.Form.Get("iss")
+	loginHint := r.Form.Get("login_hint")
+	targetLink := r.Form.Get("target_link_uri")
+	if issuer == "" || loginHint == "" || targetLink == "" {
+		writeError(w, http.StatusBadRequest, "iss, login_hint and target_link_uri are required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"issuer": issuer}
+	if clientID := r.Form.Get("client_id"); clientID != "" {
+		filter["clientId"] = clientID
+	}
+	var platform models.LtiPlatform
+	if err := db.GetCollection("lti_platforms").FindOne(ctx, filter).Decode(&platform); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "unknown platform")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch platform")
+		return
+	}
+
+	state := models.LtiState{
+		ID:         randomToken(16),
+		Kind:       models.LtiStateLogin,
+		Nonce:      randomToken(16),
+		PlatformID: platform.ID,
+		ExpiresAt:  time.Now().Add(ltiLoginTTL),
+	}
+	if err := saveLtiState(ctx, state); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	http.SetCookie(w, ltiStateCookie(r, state.ID, int(ltiLoginTTL/time.Second)))
+
+	q := url.Values{
+		"scope":         {"openid"},
+		"response_type": {"id_token"},
+		"response_mode": {"form_post"},
+		"prompt":        {"none"},
+		"client_id":     {platform.ClientID},
+		"redirect_uri":  {appBaseURL(r) + "/lti/launch"},
+		"login_hint":    {loginHint},
+		"state":         {state.ID},
+		"nonce":         {state.Nonce},
+	}
+	if hint := r.Form.Get("lti_message_hint"); hint != "" {
+		q.Set("lti_message_hint", hint)
+	}
+
+	target := platform.AuthLoginURL
+	if strings.Contains(target, "?") {
+		target += "&" + q.Encode()
+	} else {
+		target += "?" + q.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// LtiLaunch receives the id_token posted by the platform, validates it and
+// signs the user in before dispatching on the message type.
+func LtiLaunch(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	if e := r.PostForm.Get("error"); e != "" {
+		writeError(w, http.StatusBadRequest, "platform returned error: "+e+" "+r.PostForm.Get("error_description"))
+		return
+	}
+	idToken := r.PostForm.Get("id_token")
+	if idToken == "" {
+		writeError(w, http.StatusBadRequest, "id_token is required")
+		return
+	}
+
+	stateID := r.PostForm.Get("state")
+	if cookie, err := r.Cookie("lti_state_" + stateID); stateID == "" || err != nil || cookie.Value != stateID {
+		writeError(w, http.StatusBadRequest, "invalid or expired state")
+		return
+	}
+	http.SetCookie(w, ltiStateCookie(r, stateID, -1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	state, err := consumeLtiState(ctx, stateID, models.LtiStateLogin)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired state")
+		return
+	}
+
+	var platform models.LtiPlatform
+	if err := db.GetCollection("lti_platforms").FindOne(ctx, bson.M{"_id": state.PlatformID}).Decode(&platform); err != nil {
+		writeError(w, http.StatusBadRequest, "unknown platform")
+		return
+	}
+
+	claims, err := verifyLaunchToken(ctx, &platform, idToken, state.Nonce)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid id_token: "+err.Error())
+		return
+	}
+
+	user, err := provisionLtiUser(ctx, &platform, claims.String("sub"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to provision user")
+		return
+	}
+	setSessionCookie(w, user.Username)
+
+	switch claims.String(lti.ClaimMessageType) {
+	case lti.MessageResourceLink:
+		ltiResourceLaunch(ctx, w, r, &platform, user, claims)
+	case lti.MessageDeepLinkingRequest:
+		ltiDeepLinkLaunch(ctx, w, r, &platform, user, claims)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported message type")
+	}
+}
+
+func verifyLaunchToken(ctx context.Context, platform *models.LtiPlatform, idToken, nonce string) (lti.Claims, error) {
+	header, _, err := lti.ParseUnverified(idToken)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ltiKeySets.Key(ctx, platform.JWKSURL, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := lti.Verify(idToken, key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.String("iss") != platform.Issuer {
+		return nil, errorf("issuer mismatch")
+	}
+	if !claims.HasAudience(platform.ClientID) {
+		return nil, errorf("audience mismatch")
+	}
+	if len(claims.Strings("aud")) > 1 && claims.String("azp") != platform.ClientID {
+		return nil, errorf("authorized party mismatch")
+	}
+	if claims.String("nonce") != nonce {
+		return nil, errorf("nonce mismatch")
+	}
+	if claims.String("sub") == "" {
+		return nil, errorf("sub is required")
+	}
+	if claims.String(lti.ClaimVersion) != lti.Version {
+		return nil, errorf("unsupported lti version")
+	}
+	if len(platform.DeploymentIDs) > 0 {
+		deployment := claims.String(lti.ClaimDeploymentID)
+		known := false
+		for _, d := range platform.DeploymentIDs {
+			if d == deployment {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errorf("unknown deployment")
+		}
+	}
+	return claims, nil
+}
+
+// provisionLtiUser finds or creates the local account for a platform user.
+// The account has a random password, so it can only be entered via LTI.
+func provisionLtiUser(ctx context.Context, platform *models.LtiPlatform, subject string) (*models.User, error) {
+	username := "lti:" + platform.ID.Hex() + ":" + subject
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(randomToken(24)), 10)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = db.GetCollection("users").FindOneAndUpdate(ctx,
+		bson.M{"username": username},
+		bson.M{"$setOnInsert": bson.M{"username": username, "password": string(hash)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ltiTarget resolves the course (and optionally item) a resource link points
+// at: custom parameters set by deep linking first, then the target link path.
+func ltiTarget(claims lti.Claims) (primitive.ObjectID, primitive.ObjectID, error) {
+	custom := claims.Object(lti.ClaimCustom)
+	courseHex, itemHex := custom.String("course_id"), custom.String("item_id")
+
+	if courseHex == "" {
+		if u, err := url.Parse(claims.String(lti.ClaimTargetLinkURI)); err == nil {
+			parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+			if len(parts) >= 2 && parts[0] == "courses" {
+				courseHex = parts[1]
+			}
+			if len(parts) >= 4 && parts[2] == "items" {
+				itemHex = parts[3]
+			}
+		}
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(courseHex)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, errorf("launch does not reference a course")
+	}
+	itemOID := primitive.NilObjectID
+	if itemHex != "" {
+		if itemOID, err = primitive.ObjectIDFromHex(itemHex); err != nil {
+			return primitive.NilObjectID, primitive.NilObjectID, errorf("invalid item id")
+		}
+	}
+	return courseOID, itemOID, nil
+}
+
+func ltiResourceLaunch(ctx context.Context, w http.ResponseWriter, r *http.Request, platform *models.LtiPlatform, user *models.User, claims lti.Claims) {
+	courseOID, itemOID, err := ltiTarget(claims)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, user.ID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+	if !itemOID.IsZero() {
+		if _, item := findItem(course, itemOID); item == nil {
+			writeError(w, http.StatusNotFound, "item not found")
+			return
+		}
+	}
+
+	roles := claims.Strings(lti.ClaimRoles)
+	if !lti.HasRole(roles, lti.RoleInstructor) && !lti.HasRole(roles, lti.RoleAdministrator) {
+		// Launches honour the course capacity like self-enrollment does.
+		_, err := admitEnrollment(ctx, newEnrollment(user.ID, course.ID, models.EnrollmentMethodLTI), course)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusInternalServerError, "failed to enroll user")
+			return
+		}
+	}
+
+	ags := claims.Object(lti.ClaimAGSEndpoint)
+	lineItem := ags.String("lineitem")
+	canScore := false
+	for _, s := range ags.Strings("scope") {
+		if s == lti.ScopeScore {
+			canScore = true
+		}
+	}
+	if lineItem != "" && canScore && platform.AuthTokenURL != "" {
+		filter := bson.M{"platformId": platform.ID, "userId": user.ID, "courseId": course.ID}
+		set := bson.M{"subject": claims.String("sub"), "lineItem": lineItem, "updatedAt": time.Now()}
+		if itemOID.IsZero() {
+			filter["itemId"] = bson.M{"$exists": false}
+		} else {
+			filter["itemId"] = itemOID
+			set["itemId"] = itemOID
+		}
+		_, err := db.GetCollection("lti_links").UpdateOne(ctx, filter, bson.M{"$set": set}, options.Update().SetUpsert(true))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to save grade link")
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/courses/"+course.ID.Hex(), http.StatusSeeOther)
+}
+
+func ltiDeepLinkLaunch(ctx context.Context, w http.ResponseWriter, r *http.Request, platform *models.LtiPlatform, user *models.User, claims lti.Claims) {
+	roles := claims.Strings(lti.ClaimRoles)
+	if !lti.HasRole(roles, lti.RoleInstructor) && !lti.HasRole(roles, lti.RoleAdministrator) {
+		writeError(w, http.StatusForbidden, "deep linking requires an instructor role")
+		return
+	}
+
+	settings := claims.Object(lti.ClaimDeepLinkSettings)
+	returnURL := settings.String("deep_link_return_url")
+	if !validHTTPURL(returnURL) {
+		writeError(w, http.StatusBadRequest, "deep_link_return_url is required")
+		return
+	}
+	acceptsLinks := false
+	for _, t := range settings.Strings("accept_types") {
+		if t == "ltiResourceLink" {
+			acceptsLinks = true
+		}
+	}
+	if !acceptsLinks {
+		writeError(w, http.StatusBadRequest, "platform does not accept ltiResourceLink items")
+		return
+	}
+
+	state := models.LtiState{
+		ID:           randomToken(16),
+		Kind:         models.LtiStateDeepLink,
+		PlatformID:   platform.ID,
+		UserID:       user.ID,
+		DeploymentID: claims.String(lti.ClaimDeploymentID),
+		ReturnURL:    returnURL,
+		Data:         settings.String("data"),
+		ExpiresAt:    time.Now().Add(ltiDeepLinkTTL),
+	}
+	if err := saveLtiState(ctx, state); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to start deep linking")
+		return
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "title", Value: 1}}).
+		SetLimit(200).
+		SetProjection(bson.M{"title": 1, "category": 1, "modules._id": 1, "modules.title": 1, "modules.items._id": 1, "modules.items.title": 1, "modules.items.type": 1})
+	cursor, err := db.GetCollection("courses").Find(ctx, courseVisibilityFilter(user.ID), opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch courses")
+		return
+	}
+	courses := []models.Course{}
+	if err := cursor.All(ctx, &courses); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode courses")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := template.ParseFiles("views/lti_deeplink.html")
+	if err != nil {
+		http.Error(w, "Template parse error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Title":    "Выбор курса",
+		"Action":   "/lti/deeplink/" + state.ID,
+		"Platform": platform.Name,
+		"Courses":  courses,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Template execute error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// LtiDeepLinkSubmit turns the instructor's selection into a signed
+// LtiDeepLinkingResponse and posts it back to the platform.
+func LtiDeepLinkSubmit(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := consumeLtiState(ctx, r.PathValue("state"), models.LtiStateDeepLink)
+	if err != nil || state.UserID != userID {
+		writeError(w, http.StatusBadRequest, "invalid or expired deep linking session")
+		return
+	}
+
+	var platform models.LtiPlatform
+	if err := db.GetCollection("lti_platforms").FindOne(ctx, bson.M{"_id": state.PlatformID}).Decode(&platform); err != nil {
+		writeError(w, http.StatusBadRequest, "unknown platform")
+		return
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PostForm.Get("course_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !canViewCourse(course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return
+	}
+
+	base := appBaseURL(r)
+	link := map[string]interface{}{
+		"type":   "ltiResourceLink",
+		"title":  course.Title,
+		"url":    base + "/courses/" + course.ID.Hex(),
+		"custom": map[string]string{"course_id": course.ID.Hex()},
+	}
+	if itemHex := r.PostForm.Get("item_id"); itemHex != "" {
+		itemOID, err := primitive.ObjectIDFromHex(itemHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid item id")
+			return
+		}
+		_, item := findItem(course, itemOID)
+		if item == nil {
+			writeError(w, http.StatusNotFound, "item not found")
+			return
+		}
+		link["title"] = item.Title
+		link["custom"] = map[string]string{"course_id": course.ID.Hex(), "item_id": item.ID.Hex()}
+		if item.MaxScore > 0 {
+			link["lineItem"] = map[string]interface{}{
+				"label":        item.Title,
+				"scoreMaximum": item.MaxScore,
+				"resourceId":   item.ID.Hex(),
+			}
+		}
+	}
+
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                 platform.ClientID,
+		"aud":                 platform.Issuer,
+		"iat":                 now.Unix(),
+		"exp":                 now.Add(5 * time.Minute).Unix(),
+		"nonce":               randomToken(16),
+		lti.ClaimMessageType:  lti.MessageDeepLinkingResponse,
+		lti.ClaimVersion:      lti.Version,
+		lti.ClaimDeploymentID: state.DeploymentID,
+		lti.ClaimContentItems: []interface{}{link},
+	}
+	if state.Data != "" {
+		claims[lti.ClaimDeepLinkData] = state.Data
+	}
+	token, err := lti.Sign(claims, key, kid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to sign response")
+		return
+	}
+
+	renderAutoPost(w, state.ReturnURL, map[string]string{"JWT": token})
+}
+
+// passBackLtiScores publishes the learner's progress to every platform that
+// launched them into the course with an AGS line item. It runs detached from
+// the request that saved the progress; failures are only logged.
+func passBackLtiScores(userID, courseOID, itemOID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := db.GetCollection("lti_links").Find(ctx, bson.M{
+		"userId":   userID,
+		"courseId": courseOID,
+		"$or": []bson.M{
+			{"itemId": itemOID},
+			{"itemId": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		return
+	}
+	var links []models.LtiLink
+	if err := cursor.All(ctx, &links); err != nil || len(links) == 0 {
+		return
+	}
+
+	if _, _, err := ltiSigningKey(); err != nil {
+		log.Printf("lti: score passback skipped: %v", err)
+		return
+	}
+
+	var course models.Course
+	if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": courseOID}).Decode(&course); err != nil {
+		return
+	}
+	progressCursor, err := db.GetCollection("progress").Find(ctx, bson.M{"userId": userID, "courseId": courseOID})
+	if err != nil {
+		return
+	}
+	var progress []models.Progress
+	if err := progressCursor.All(ctx, &progress); err != nil {
+		return
+	}
+
+	for _, link := range links {
+		var platform models.LtiPlatform
+		if err := db.GetCollection("lti_platforms").FindOne(ctx, bson.M{"_id": link.PlatformID}).Decode(&platform); err != nil {
+			continue
+		}
+
+		score := ltiScoreFor(&course, progress, link.ItemID)
+		score.UserID = link.Subject
+		score.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+		if err := ltiGrades.PublishScore(ctx, platform.AuthTokenURL, platform.ClientID, link.LineItem, score); err != nil {
+			log.Printf("lti: score passback to %s failed: %v", platform.Issuer, err)
+		}
+	}
+}
+
+// ltiScoreFor builds the score for a single item, or for the whole course
+// when itemID is nil (the sum of item scores over the sum of maxScores).
+func ltiScoreFor(course *models.Course, progress []models.Progress, itemID *primitive.ObjectID) lti.Score {
+	byItem := map[primitive.ObjectID]models.Progress{}
+	for _, p := range progress {
+		byItem[p.ItemID] = p
+	}
+
+	var given, maximum float64
+	total, done := 0, 0
+	for _, m := range course.Modules {
+		for _, it := range m.Items {
+			if itemID != nil && it.ID != *itemID {
+				continue
+			}
+			total++
+			maximum += it.MaxScore
+			if p, ok := byItem[it.ID]; ok {
+				given += p.Score
+				if p.Status == "done" {
+					done++
+				}
+			}
+		}
+	}
+
+	score := lti.Score{
+		ScoreGiven:       &given,
+		ScoreMaximum:     maximum,
+		ActivityProgress: lti.ActivityInProgress,
+		GradingProgress:  lti.GradingPending,
+	}
+	if total > 0 && done == total {
+		score.ActivityProgress = lti.ActivityCompleted
+		score.GradingProgress = lti.GradingFullyGraded
+	}
+	if maximum == 0 {
+		score.ScoreGiven = nil
+	}
+	return score
+}
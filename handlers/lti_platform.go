@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/lti"
+	"AP_Final/models"
+)
+
+// This file holds the platform side of LTI 1.3: external tools embedded into
+// courses as "lti" items are launched from here and report scores back
+// through Assignment and Grade Services.
+
+const (
+	ltiLaunchTTL = 5 * time.Minute
+	ltiTokenTTL  = time.Hour
+)
+
+type ltiToolInput struct {
+	Name         string   `json:"name"`
+	LoginURL     string   `json:"loginUrl"`
+	LaunchURL    string   `json:"launchUrl"`
+	RedirectURIs []string `json:"redirectUris"`
+	JWKSURL      string   `json:"jwksUrl"`
+}
+
+func CreateLtiTool(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	var input ltiToolInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if !validHTTPURL(input.LoginURL) || !validHTTPURL(input.LaunchURL) || !validHTTPURL(input.JWKSURL) {
+		writeError(w, http.StatusBadRequest, "loginUrl, launchUrl and jwksUrl must be http(s) urls")
+		return
+	}
+	if len(input.RedirectURIs) == 0 {
+		input.RedirectURIs = []string{input.LaunchURL}
+	}
+	for _, u := range input.RedirectURIs {
+		if !validHTTPURL(u) {
+			writeError(w, http.StatusBadRequest, "redirectUris must be http(s) urls")
+			return
+		}
+	}
+
+	tool := models.LtiTool{
+		ID:           primitive.NewObjectID(),
+		Name:         input.Name,
+		ClientID:     randomToken(12),
+		LoginURL:     input.LoginURL,
+		LaunchURL:    input.LaunchURL,
+		RedirectURIs: input.RedirectURIs,
+		JWKSURL:      input.JWKSURL,
+		CreatedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.GetCollection("lti_tools").InsertOne(ctx, tool); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create tool")
+		return
+	}
+
+	base := appBaseURL(r)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"tool": tool,
+		// What the tool needs to register this system as a platform.
+		"platform": map[string]string{
+			"issuer":       base,
+			"clientId":     tool.ClientID,
+			"deploymentId": tool.ID.Hex(),
+			"authLoginUrl": base + "/lti/authorize",
+			"authTokenUrl": base + "/lti/token",
+			"jwksUrl":      base + "/lti/jwks",
+		},
+	})
+}
+
+func GetLtiTools(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.GetCollection("lti_tools").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch tools")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tools := []models.LtiTool{}
+	if err := cursor.All(ctx, &tools); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode tools")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tools)
+}
+
+func DeleteLtiTool(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	toolOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tool id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := db.GetCollection("lti_tools").DeleteOne(ctx, bson.M{"_id": toolOID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete tool")
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeError(w, http.StatusNotFound, "tool not found")
+		return
+	}
+	_, _ = db.GetCollection("lti_tokens").DeleteMany(ctx, bson.M{"toolId": toolOID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadLtiTool(ctx context.Context, w http.ResponseWriter, filter bson.M) *models.LtiTool {
+	var tool models.LtiTool
+	if err := db.GetCollection("lti_tools").FindOne(ctx, filter).Decode(&tool); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "tool not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch tool")
+		return nil
+	}
+	return &tool
+}
+
+// LaunchLtiItem starts an OIDC launch of an "lti" item: the browser goes to
+// the tool's login URL, which sends it back to LtiAuthorize.
+func LaunchLtiItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("courseId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, item := loadLearnerItem(ctx, w, userID, courseOID, itemOID)
+	if item == nil {
+		return
+	}
+	if item.Type != models.ItemTypeLti || item.ToolID == nil {
+		writeError(w, http.StatusBadRequest, "item is not an lti tool")
+		return
+	}
+	tool := loadLtiTool(ctx, w, bson.M{"_id": *item.ToolID})
+	if tool == nil {
+		return
+	}
+
+	state := models.LtiState{
+		ID:        randomToken(16),
+		Kind:      models.LtiStateLaunch,
+		ToolID:    tool.ID,
+		UserID:    userID,
+		CourseID:  course.ID,
+		ItemID:    item.ID,
+		ExpiresAt: time.Now().Add(ltiLaunchTTL),
+	}
+	if err := saveLtiState(ctx, state); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to start launch")
+		return
+	}
+	logItemView(ctx, course, userID, item.ID)
+
+	q := url.Values{
+		"iss":               {appBaseURL(r)},
+		"login_hint":        {userID.Hex()},
+		"target_link_uri":   {ltiTargetLink(tool, item)},
+		"lti_message_hint":  {state.ID},
+		"client_id":         {tool.ClientID},
+		"lti_deployment_id": {tool.ID.Hex()},
+	}
+	target := tool.LoginURL
+	if strings.Contains(target, "?") {
+		target += "&" + q.Encode()
+	} else {
+		target += "?" + q.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func ltiTargetLink(tool *models.LtiTool, item *models.CourseItem) string {
+	if item.URL != "" {
+		return item.URL
+	}
+	return tool.LaunchURL
+}
+
+func ltiLineItemURL(base string, courseOID, itemOID primitive.ObjectID) string {
+	return base + "/lti/ags/courses/" + courseOID.Hex() + "/items/" + itemOID.Hex() + "/lineitem"
+}
+
+// LtiAuthorize is the platform's OIDC authorization endpoint. It answers the
+// tool's authentication request with a signed id_token for the signed-in user.
+func LtiAuthorize(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	form := r.Form
+
+	if !strings.Contains(" "+form.Get("scope")+" ", " openid ") || form.Get("response_type") != "id_token" {
+		writeError(w, http.StatusBadRequest, "scope must include openid and response_type must be id_token")
+		return
+	}
+	if form.Get("nonce") == "" {
+		writeError(w, http.StatusBadRequest, "nonce is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := consumeLtiState(ctx, form.Get("lti_message_hint"), models.LtiStateLaunch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired launch")
+		return
+	}
+	if state.UserID != userID || form.Get("login_hint") != userID.Hex() {
+		writeError(w, http.StatusForbidden, "launch belongs to another user")
+		return
+	}
+
+	tool := loadLtiTool(ctx, w, bson.M{"_id": state.ToolID})
+	if tool == nil {
+		return
+	}
+	if form.Get("client_id") != tool.ClientID {
+		writeError(w, http.StatusBadRequest, "client_id mismatch")
+		return
+	}
+	redirectURI := form.Get("redirect_uri")
+	allowed := false
+	for _, u := range tool.RedirectURIs {
+		if u == redirectURI {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		writeError(w, http.StatusBadRequest, "redirect_uri is not registered for this tool")
+		return
+	}
+
+	course := loadCourse(ctx, w, state.CourseID)
+	if course == nil {
+		return
+	}
+	_, item := findItem(course, state.ItemID)
+	if item == nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+
+	var user models.User
+	if err := db.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch user")
+		return
+	}
+
+	role := lti.RoleLearner
+	if hasCourseCapability(course, userID, capGrade) {
+		role = lti.RoleInstructor
+	}
+
+	base := appBaseURL(r)
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                  base,
+		"aud":                  tool.ClientID,
+		"azp":                  tool.ClientID,
+		"sub":                  userID.Hex(),
+		"iat":                  now.Unix(),
+		"exp":                  now.Add(5 * time.Minute).Unix(),
+		"nonce":                form.Get("nonce"),
+		"name":                 user.Username,
+		lti.ClaimMessageType:   lti.MessageResourceLink,
+		lti.ClaimVersion:       lti.Version,
+		lti.ClaimDeploymentID:  tool.ID.Hex(),
+		lti.ClaimTargetLinkURI: ltiTargetLink(tool, item),
+		lti.ClaimResourceLink:  map[string]string{"id": item.ID.Hex(), "title": item.Title},
+		lti.ClaimContext:       map[string]interface{}{"id": course.ID.Hex(), "title": course.Title},
+		lti.ClaimRoles:         []string{role},
+	}
+	if item.MaxScore > 0 {
+		claims[lti.ClaimAGSEndpoint] = map[string]interface{}{
+			"scope":    []string{lti.ScopeScore, lti.ScopeLineItemReadOnly},
+			"lineitem": ltiLineItemURL(base, course.ID, item.ID),
+		}
+	}
+
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	idToken, err := lti.Sign(claims, key, kid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to sign id_token")
+		return
+	}
+
+	fields := map[string]string{"id_token": idToken}
+	if s := form.Get("state"); s != "" {
+		fields["state"] = s
+	}
+	renderAutoPost(w, redirectURI, fields)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LtiToken issues AGS access tokens to tools for the client_credentials grant
+// with a JWT client assertion signed by the tool's key.
+func LtiToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	if r.PostForm.Get("client_assertion_type") != lti.ClientAssertionType {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	assertion := r.PostForm.Get("client_assertion")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	header, unverified, err := lti.ParseUnverified(assertion)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client")
+		return
+	}
+	var tool models.LtiTool
+	if err := db.GetCollection("lti_tools").FindOne(ctx, bson.M{"clientId": unverified.String("iss")}).Decode(&tool); err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	key, err := ltiKeySets.Key(ctx, tool.JWKSURL, header.Kid)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	claims, err := lti.Verify(assertion, key, time.Now())
+	if err != nil || claims.String("sub") != tool.ClientID || !claims.HasAudience(appBaseURL(r)+"/lti/token") {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	jti := claims.String("jti")
+	exp, _ := claims.Time("exp")
+	if jti == "" {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	// Remember the assertion id until it expires to reject replays.
+	replay := models.LtiState{
+		ID:        "jti:" + tool.ID.Hex() + ":" + jti,
+		Kind:      models.LtiStateAssertion,
+		ToolID:    tool.ID,
+		ExpiresAt: exp.Add(lti.Leeway),
+	}
+	if err := saveLtiState(ctx, replay); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	scopes := []string{}
+	for _, s := range strings.Fields(r.PostForm.Get("scope")) {
+		if s == lti.ScopeScore || s == lti.ScopeLineItemReadOnly {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_scope")
+		return
+	}
+
+	token := randomToken(32)
+	doc := models.LtiToken{
+		ID:        hashToken(token),
+		ToolID:    tool.ID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ltiTokenTTL),
+	}
+	if _, err := db.GetCollection("lti_tokens").InsertOne(ctx, doc); err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(ltiTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// loadLtiGradeTarget authenticates an AGS request and resolves the course
+// item whose line item is addressed. The token's tool must own the item.
+func loadLtiGradeTarget(ctx context.Context, w http.ResponseWriter, r *http.Request, scopes ...string) (*models.Course, *models.CourseItem) {
+	raw := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if raw == "" {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, nil
+	}
+	var token models.LtiToken
+	err := db.GetCollection("lti_tokens").FindOne(ctx, bson.M{
+		"_id":       hashToken(raw),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, nil
+	}
+	granted := false
+	for _, have := range token.Scopes {
+		for _, want := range scopes {
+			if have == want {
+				granted = true
+			}
+		}
+	}
+	if !granted {
+		writeError(w, http.StatusForbidden, "insufficient scope")
+		return nil, nil
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("courseId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return nil, nil
+	}
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return nil, nil
+	}
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return nil, nil
+	}
+	_, item := findItem(course, itemOID)
+	if item == nil || item.ToolID == nil || *item.ToolID != token.ToolID {
+		writeError(w, http.StatusNotFound, "line item not found")
+		return nil, nil
+	}
+	return course, item
+}
+
+func GetLtiLineItem(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, item := loadLtiGradeTarget(ctx, w, r, lti.ScopeLineItemReadOnly, lti.ScopeScore)
+	if item == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", lti.LineItemMediaType)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":             ltiLineItemURL(appBaseURL(r), course.ID, item.ID),
+		"label":          item.Title,
+		"scoreMaximum":   item.MaxScore,
+		"resourceLinkId": item.ID.Hex(),
+	})
+}
+
+// PostLtiScore accepts an AGS score from an embedded tool and records it as
+// the learner's progress on the item, scaled to the item's maxScore.
+func PostLtiScore(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, item := loadLtiGradeTarget(ctx, w, r, lti.ScopeScore)
+	if item == nil {
+		return
+	}
+
+	var score lti.Score
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&score); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid score body")
+		return
+	}
+	userOID, err := primitive.ObjectIDFromHex(score.UserID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid userId")
+		return
+	}
+	if score.ScoreGiven != nil && (score.ScoreMaximum <= 0 || *score.ScoreGiven < 0) {
+		writeError(w, http.StatusBadRequest, "scoreGiven requires a positive scoreMaximum")
+		return
+	}
+
+	// Tools may grade late, after the enrollment has been completed.
+	enrolled, err := db.GetCollection("enrollments").CountDocuments(ctx, bson.M{
+		"userId":   userOID,
+		"courseId": course.ID,
+		"status":   bson.M{"$in": bson.A{models.EnrollmentStatusActive, models.EnrollmentStatusCompleted}},
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check enrollment")
+		return
+	}
+	if enrolled == 0 && !isCourseStaff(course, userOID) {
+		writeError(w, http.StatusNotFound, "user is not enrolled in this course")
+		return
+	}
+
+	status := "in_progress"
+	if score.ActivityProgress == lti.ActivityCompleted || score.ActivityProgress == lti.ActivitySubmitted {
+		status = "done"
+	}
+	value := 0.0
+	if score.ScoreGiven != nil {
+		value = *score.ScoreGiven / score.ScoreMaximum * item.MaxScore
+	}
+
+	recordActivity(ctx, userOID, course.ID)
+	if err := saveProgress(ctx, userOID, course.ID, item.ID, status, value, status == "done", models.ActivitySourceLti); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update progress")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"AP_Final/lti"
+	"AP_Final/lti/ltitest"
+	"AP_Final/models"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("LTI_KEY_FILE", filepath.Join(dir, "lti.pem"))
+	os.Setenv("APP_SECRET_FILE", filepath.Join(dir, "secret.key"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// ltiServers starts the reference launcher and a tool server exposing this
+// package's JWKS, the only tool endpoint the launcher calls back.
+func ltiServers(t *testing.T) (*ltitest.Launcher, models.LtiPlatform) {
+	t.Helper()
+	tool := http.NewServeMux()
+	tool.HandleFunc("GET /lti/jwks", LtiJWKS)
+	toolSrv := httptest.NewServer(tool)
+	t.Cleanup(toolSrv.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ltitest.New("", toolSrv.URL, key)
+	l.CourseID = "course-1"
+	platformSrv := httptest.NewServer(l.Handler())
+	t.Cleanup(platformSrv.Close)
+	l.Base = platformSrv.URL
+
+	platform := models.LtiPlatform{
+		Issuer:        l.Base,
+		ClientID:      ltitest.ClientID,
+		DeploymentIDs: []string{ltitest.DeploymentID},
+		AuthLoginURL:  l.Base + "/auth",
+		AuthTokenURL:  l.Base + "/token",
+		JWKSURL:       l.Base + "/jwks",
+	}
+	return l, platform
+}
+
+var autoPostField = regexp.MustCompile(`name="(\w+)" value="([^"]*)"`)
+
+// oidcLaunch runs the launcher's side of an OIDC launch: login initiation
+// towards the tool, then the authentication request the tool's LtiLogin
+// would redirect to. It returns the id_token posted back.
+func oidcLaunch(t *testing.T, l *ltitest.Launcher, nonce, state string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(l.Base + "/launch?message=resource&role=Learner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	login, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.Path != "/lti/login" {
+		t.Fatalf("login initiation went to %s", login)
+	}
+	q := login.Query()
+	if q.Get("iss") != l.Base || q.Get("client_id") != ltitest.ClientID || q.Get("lti_deployment_id") != ltitest.DeploymentID || q.Get("login_hint") != l.User {
+		t.Fatalf("login initiation params = %v", q)
+	}
+
+	resp, err = client.PostForm(l.Base+"/auth", url.Values{
+		"scope":            {"openid"},
+		"response_type":    {"id_token"},
+		"response_mode":    {"form_post"},
+		"client_id":        {q.Get("client_id")},
+		"redirect_uri":     {l.Tool + "/lti/launch"},
+		"login_hint":       {q.Get("login_hint")},
+		"lti_message_hint": {q.Get("lti_message_hint")},
+		"state":            {state},
+		"nonce":            {nonce},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for _, m := range autoPostField.FindAllStringSubmatch(body.String(), -1) {
+		fields[m[1]] = m[2]
+	}
+	if fields["state"] != state || fields["id_token"] == "" {
+		t.Fatalf("authentication response = %s", body.String())
+	}
+	return fields["id_token"]
+}
+
+func TestLtiLaunchFlow(t *testing.T) {
+	l, platform := ltiServers(t)
+	ctx := context.Background()
+
+	idToken := oidcLaunch(t, l, "nonce-1", "state-1")
+	claims, err := verifyLaunchToken(ctx, &platform, idToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("verify launch: %v", err)
+	}
+	if claims.String(lti.ClaimMessageType) != lti.MessageResourceLink || claims.Object(lti.ClaimCustom).String("course_id") != "course-1" {
+		t.Errorf("claims = %v", claims)
+	}
+	if !lti.HasRole(claims.Strings(lti.ClaimRoles), lti.RoleLearner) {
+		t.Errorf("roles = %v", claims.Strings(lti.ClaimRoles))
+	}
+
+	mismatch := func(name string, mutate func(p *models.LtiPlatform), nonce string) {
+		t.Run(name, func(t *testing.T) {
+			p := platform
+			if mutate != nil {
+				mutate(&p)
+			}
+			if _, err := verifyLaunchToken(ctx, &p, idToken, nonce); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("err = %v, want %s", err, name)
+			}
+		})
+	}
+	mismatch("issuer mismatch", func(p *models.LtiPlatform) { p.Issuer = "https://other.example" }, "nonce-1")
+	mismatch("audience mismatch", func(p *models.LtiPlatform) { p.ClientID = "other-client" }, "nonce-1")
+	mismatch("nonce mismatch", nil, "nonce-2")
+	mismatch("unknown deployment", func(p *models.LtiPlatform) { p.DeploymentIDs = []string{"2"} }, "nonce-1")
+
+	t.Run("authorized party mismatch", func(t *testing.T) {
+		now := time.Now()
+		claims := map[string]interface{}{
+			"iss":                 l.Base,
+			"aud":                 []string{"other-client", ltitest.ClientID},
+			"azp":                 "other-client",
+			"sub":                 l.User,
+			"exp":                 now.Add(time.Minute).Unix(),
+			"nonce":               "nonce-1",
+			lti.ClaimVersion:      lti.Version,
+			lti.ClaimDeploymentID: ltitest.DeploymentID,
+		}
+		token, err := lti.Sign(claims, l.Key, l.KeyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifyLaunchToken(ctx, &platform, token, "nonce-1"); err == nil || err.Error() != "authorized party mismatch" {
+			t.Errorf("err = %v", err)
+		}
+		claims["azp"] = ltitest.ClientID
+		token, _ = lti.Sign(claims, l.Key, l.KeyID)
+		if _, err := verifyLaunchToken(ctx, &platform, token, "nonce-1"); err != nil {
+			t.Errorf("azp of this client: %v", err)
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, claims, _ := lti.ParseUnverified(idToken)
+		forged, _ := lti.Sign(claims, other, l.KeyID)
+		if _, err := verifyLaunchToken(ctx, &platform, forged, "nonce-1"); err != lti.ErrSignature {
+			t.Errorf("err = %v, want %v", err, lti.ErrSignature)
+		}
+	})
+}
+
+func TestLtiScorePassback(t *testing.T) {
+	l, platform := ltiServers(t)
+	if _, _, err := ltiSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	given := 8.5
+	score := lti.Score{
+		UserID:           l.User,
+		ScoreGiven:       &given,
+		ScoreMaximum:     10,
+		ActivityProgress: lti.ActivityCompleted,
+		GradingProgress:  lti.GradingFullyGraded,
+		Timestamp:        time.Now().Format(time.RFC3339),
+	}
+	if err := ltiGrades.PublishScore(context.Background(), platform.AuthTokenURL, platform.ClientID, l.Base+"/lineitem", score); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	got := l.Scores()
+	if len(got) != 1 || got[0].UserID != l.User || got[0].ScoreGiven == nil || *got[0].ScoreGiven != given || got[0].ScoreMaximum != 10 {
+		t.Errorf("scores = %+v", got)
+	}
+
+	// The launcher only accepts assertions signed with the tool's key.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lti.NewGradeClient(other).PublishScore(context.Background(), platform.AuthTokenURL, platform.ClientID, l.Base+"/lineitem", score); err == nil {
+		t.Error("score from an unknown key was accepted")
+	}
+	if len(l.Scores()) != 1 {
+		t.Errorf("scores = %+v", l.Scores())
+	}
+}
+
+func TestLtiJWKS(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LtiJWKS(rec, httptest.NewRequest(http.MethodGet, "/lti/jwks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var set lti.JWKS
+	if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := set.Key(kid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(&key.PublicKey) {
+		t.Error("published key does not match the signing key")
+	}
+}
+
+func TestLtiLoginRequiresParams(t *testing.T) {
+	for _, form := range []url.Values{
+		{},
+		{"iss": {"https://platform.example"}, "login_hint": {"u1"}},
+		{"iss": {"https://platform.example"}, "target_link_uri": {"https://tool.example/"}},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/lti/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		LtiLogin(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("form %v: status = %d", form, rec.Code)
+		}
+	}
+}
+
+// A launch must come from the browser that started the login.
+func TestLtiLaunchRequiresStateCookie(t *testing.T) {
+	form := url.Values{"id_token": {"token"}, "state": {"state-1"}}
+	for _, cookie := range []*http.Cookie{nil, {Name: "lti_state_state-1", Value: "other"}, {Name: "lti_state_other", Value: "state-1"}} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/lti/launch", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		LtiLaunch(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("cookie %v: status = %d", cookie, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+var notificationSort = []sortField{{Path: "createdAt", Desc: true}, {Path: "_id", Desc: true}}
+
+func notify(ctx context.Context, userID primitive.ObjectID, kind string, courseID *primitive.ObjectID, message string) error {
+	_, err := db.GetCollection("notifications").InsertOne(ctx, models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Type:      kind,
+		CourseID:  courseID,
+		Message:   message,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+func GetMyNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	pg, err := parseListPage(r, "createdAt_desc", "unread")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := db.GetCollection("notifications")
+	filter := bson.M{"userId": userID}
+	if r.URL.Query().Get("unread") == "true" {
+		filter["read"] = false
+	}
+
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count notifications")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(notificationSort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(notificationSort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch notifications")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.Notification{}
+	if err := cursor.All(ctx, &results); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode notifications")
+		return
+	}
+
+	fetched := len(results)
+	if fetched > pg.Limit {
+		results = results[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(results)
+	}
+	var first, last []interface{}
+	if len(results) > 0 {
+		first = []interface{}{results[0].CreatedAt, results[0].ID}
+		last = []interface{}{results[len(results)-1].CreatedAt, results[len(results)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := db.GetCollection("notifications").UpdateOne(ctx,
+		bson.M{"_id": oid, "userId": userID},
+		bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update notification")
+		return
+	}
+	if res.MatchedCount == 0 {
+		writeError(w, http.StatusNotFound, "notification not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
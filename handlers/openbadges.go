@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/badge"
+	"AP_Final/db"
+	"AP_Final/lti"
+	"AP_Final/models"
+)
+
+// Open Badges documents are published as JSON-LD under /badges. Version
+// 2.0 assertions are hosted and, when baked, signed; 3.0 credentials are
+// VC-JWTs. Both are signed with the server key shared with LTI.
+const (
+	ob2Context      = "https://w3id.org/openbadges/v2"
+	ob3Context      = "https://purl.imsglobal.org/spec/ob/v3p0/context.json"
+	vcContext       = "https://www.w3.org/2018/credentials/v1"
+	badgeIssuerName = "Mini Moodle"
+)
+
+func badgeIssuerURL(r *http.Request) string {
+	return appBaseURL(r) + "/badges/issuer"
+}
+
+func badgeClassURL(r *http.Request, id primitive.ObjectID) string {
+	return appBaseURL(r) + "/badges/classes/" + id.Hex()
+}
+
+func badgeAssertionURL(r *http.Request, id primitive.ObjectID) string {
+	return appBaseURL(r) + "/badges/assertions/" + id.Hex()
+}
+
+// badgeRecipient is the salted hash of the user's URI; assertions never
+// carry the username.
+func badgeRecipient(r *http.Request, award *models.BadgeAward) (identity, kind string) {
+	sum := sha256.Sum256([]byte(appBaseURL(r) + "/users/" + award.UserID.Hex() + award.Salt))
+	return "sha256$" + hex.EncodeToString(sum[:]), "url"
+}
+
+func badgeCriteriaNarrative(b *models.BadgeClass, course *models.Course) string {
+	switch b.Criteria.Type {
+	case models.BadgeCriterionCompletion:
+		return "Complete the course \"" + course.Title + "\"."
+	case models.BadgeCriterionPerfectScore:
+		if b.Criteria.ItemID != nil {
+			if _, item := findItem(course, *b.Criteria.ItemID); item != nil {
+				return "Reach the full score in \"" + item.Title + "\" of the course \"" + course.Title + "\"."
+			}
+		}
+		return "Reach the full score in a quiz of the course \"" + course.Title + "\"."
+	case models.BadgeCriterionStreak:
+		return "Make progress in the course \"" + course.Title + "\" " + strconv.Itoa(b.Criteria.Days) + " days in a row."
+	}
+	return ""
+}
+
+func loadBadgeClass(ctx context.Context, oid primitive.ObjectID) (*models.BadgeClass, *models.Course, error) {
+	var b models.BadgeClass
+	if err := db.GetCollection("badge_classes").FindOne(ctx, bson.M{"_id": oid}).Decode(&b); err != nil {
+		return nil, nil, err
+	}
+	var course models.Course
+	opts := options.FindOne().SetProjection(bson.M{"title": 1, "modules": 1})
+	if err := db.GetCollection("courses").FindOne(ctx, bson.M{"_id": b.CourseID}, opts).Decode(&course); err != nil {
+		return nil, nil, err
+	}
+	return &b, &course, nil
+}
+
+// badgeAssertion builds the Open Badges 2.0 assertion; verification is
+// HostedBadge for the hosted copy and SignedBadge inside baked images.
+func badgeAssertion(r *http.Request, award *models.BadgeAward, signed bool) map[string]interface{} {
+	identity, kind := badgeRecipient(r, award)
+	verification := map[string]interface{}{"type": "HostedBadge"}
+	if signed {
+		verification = map[string]interface{}{"type": "SignedBadge", "creator": badgeIssuerURL(r) + "/key"}
+	}
+	return map[string]interface{}{
+		"@context": ob2Context,
+		"type":     "Assertion",
+		"id":       badgeAssertionURL(r, award.ID),
+		"recipient": map[string]interface{}{
+			"type":     kind,
+			"hashed":   true,
+			"salt":     award.Salt,
+			"identity": identity,
+		},
+		"badge":        badgeClassURL(r, award.BadgeID),
+		"verification": verification,
+		"issuedOn":     award.IssuedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func signBadgeAssertion(r *http.Request, award *models.BadgeAward) (string, error) {
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		return "", err
+	}
+	return lti.Sign(badgeAssertion(r, award, true), key, kid)
+}
+
+// GetBadgeIssuer is the Open Badges issuer profile.
+func GetBadgeIssuer(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@context":  ob2Context,
+		"type":      "Issuer",
+		"id":        badgeIssuerURL(r),
+		"name":      badgeIssuerName,
+		"url":       appBaseURL(r),
+		"publicKey": badgeIssuerURL(r) + "/key",
+	})
+}
+
+// GetBadgeIssuerKey publishes the public key signed assertions verify with.
+func GetBadgeIssuerKey(w http.ResponseWriter, r *http.Request) {
+	key, _, err := ltiSigningKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@context":     ob2Context,
+		"type":         "CryptographicKey",
+		"id":           badgeIssuerURL(r) + "/key",
+		"owner":        badgeIssuerURL(r),
+		"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+}
+
+// GetBadgeClassDocument is the public Open Badges BadgeClass.
+func GetBadgeClassDocument(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid badge id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b, course, err := loadBadgeClass(ctx, oid)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "badge not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch badge")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@context":    ob2Context,
+		"type":        "BadgeClass",
+		"id":          badgeClassURL(r, b.ID),
+		"name":        b.Name,
+		"description": b.Description,
+		"image":       badgeClassURL(r, b.ID) + "/image",
+		"criteria":    map[string]string{"narrative": badgeCriteriaNarrative(b, course)},
+		"issuer":      badgeIssuerURL(r),
+	})
+}
+
+// GetBadgeClassImage serves the unbaked SVG image of a badge class.
+func GetBadgeClassImage(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid badge id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var b models.BadgeClass
+	if err := db.GetCollection("badge_classes").FindOne(ctx, bson.M{"_id": oid}).Decode(&b); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "badge not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch badge")
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(badge.SVG(b.Name, b.Color))
+}
+
+func loadBadgeAward(ctx context.Context, w http.ResponseWriter, filter bson.M) *models.BadgeAward {
+	var award models.BadgeAward
+	if err := db.GetCollection("badge_awards").FindOne(ctx, filter).Decode(&award); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "assertion not found")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch assertion")
+		return nil
+	}
+	return &award
+}
+
+// writeRevokedAssertion answers 410 with the revocation, as Open Badges
+// verifiers expect from a hosted assertion.
+func writeRevokedAssertion(w http.ResponseWriter, r *http.Request, award *models.BadgeAward) {
+	writeJSON(w, http.StatusGone, map[string]interface{}{
+		"@context":         ob2Context,
+		"id":               badgeAssertionURL(r, award.ID),
+		"revoked":          true,
+		"revocationReason": award.RevocationReason,
+	})
+}
+
+// GetBadgeAssertion is the public hosted Open Badges 2.0 assertion.
+func GetBadgeAssertion(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid assertion id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	award := loadBadgeAward(ctx, w, bson.M{"_id": oid})
+	if award == nil {
+		return
+	}
+	if award.RevokedAt != nil {
+		writeRevokedAssertion(w, r, award)
+		return
+	}
+	writeJSON(w, http.StatusOK, badgeAssertion(r, award, false))
+}
+
+// GetBadgeCredential returns the award as an Open Badges 3.0
+// OpenBadgeCredential, encoded as a VC-JWT.
+func GetBadgeCredential(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid assertion id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	award := loadBadgeAward(ctx, w, bson.M{"_id": oid})
+	if award == nil {
+		return
+	}
+	if award.RevokedAt != nil {
+		writeRevokedAssertion(w, r, award)
+		return
+	}
+	b, course, err := loadBadgeClass(ctx, award.BadgeID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch badge")
+		return
+	}
+
+	identity, kind := badgeRecipient(r, award)
+	issuer := map[string]interface{}{
+		"id":   badgeIssuerURL(r),
+		"type": "Profile",
+		"name": badgeIssuerName,
+		"url":  appBaseURL(r),
+	}
+	credential := map[string]interface{}{
+		"@context":     []string{vcContext, ob3Context},
+		"id":           badgeAssertionURL(r, award.ID),
+		"type":         []string{"VerifiableCredential", "OpenBadgeCredential"},
+		"issuer":       issuer,
+		"issuanceDate": award.IssuedAt.UTC().Format(time.RFC3339),
+		"name":         b.Name,
+		"credentialSubject": map[string]interface{}{
+			"type": "AchievementSubject",
+			"identifier": []map[string]interface{}{{
+				"type":         "IdentityObject",
+				"hashed":       true,
+				"identityHash": identity,
+				"identityType": kind,
+				"salt":         award.Salt,
+			}},
+			"achievement": map[string]interface{}{
+				"id":          badgeClassURL(r, b.ID),
+				"type":        "Achievement",
+				"name":        b.Name,
+				"description": b.Description,
+				"criteria":    map[string]string{"narrative": badgeCriteriaNarrative(b, course)},
+				"image":       map[string]string{"id": badgeClassURL(r, b.ID) + "/image", "type": "Image"},
+			},
+		},
+	}
+
+	key, kid, err := ltiSigningKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "signing key unavailable")
+		return
+	}
+	token, err := lti.Sign(map[string]interface{}{
+		"iss": badgeIssuerURL(r),
+		"jti": badgeAssertionURL(r, award.ID),
+		"nbf": award.IssuedAt.Unix(),
+		"iat": award.IssuedAt.Unix(),
+		"vc":  credential,
+	}, key, kid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to sign credential")
+		return
+	}
+	w.Header().Set("Content-Type", "application/vc+jwt")
+	w.Write([]byte(token))
+}
+
+type myBadgeEntry struct {
+	models.BadgeAward `bson:",inline"`
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	CourseTitle       string `json:"courseTitle"`
+	AssertionURL      string `json:"assertionUrl"`
+	CredentialURL     string `json:"credentialUrl"`
+	ImageURL          string `json:"imageUrl"`
+	BakedPNGURL       string `json:"bakedPngUrl"`
+	BakedSVGURL       string `json:"bakedSvgUrl"`
+}
+
+// GetMyBadges lists the caller's badges, newest first, revoked included.
+func GetMyBadges(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "issuedAt", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := db.GetCollection("badge_awards").Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch badges")
+		return
+	}
+	var awards []models.BadgeAward
+	if err := cursor.All(ctx, &awards); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode badges")
+		return
+	}
+
+	badgeIDs := make([]primitive.ObjectID, 0, len(awards))
+	for _, a := range awards {
+		badgeIDs = append(badgeIDs, a.BadgeID)
+	}
+	classes := map[primitive.ObjectID]models.BadgeClass{}
+	if len(badgeIDs) > 0 {
+		cursor, err := db.GetCollection("badge_classes").Find(ctx, bson.M{"_id": bson.M{"$in": badgeIDs}})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch badges")
+			return
+		}
+		var docs []models.BadgeClass
+		if err := cursor.All(ctx, &docs); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to decode badges")
+			return
+		}
+		for _, b := range docs {
+			classes[b.ID] = b
+		}
+	}
+
+	titles := map[primitive.ObjectID]string{}
+	entries := make([]myBadgeEntry, 0, len(awards))
+	for _, a := range awards {
+		title, err := courseTitle(ctx, titles, a.CourseID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch course")
+			return
+		}
+		b := classes[a.BadgeID]
+		entry := myBadgeEntry{
+			BadgeAward:   a,
+			Name:         b.Name,
+			Description:  b.Description,
+			CourseTitle:  title,
+			AssertionURL: badgeAssertionURL(r, a.ID),
+		}
+		if a.RevokedAt == nil {
+			entry.CredentialURL = badgeAssertionURL(r, a.ID) + "/credential"
+			entry.ImageURL = badgeClassURL(r, a.BadgeID) + "/image"
+			entry.BakedPNGURL = "/me/badges/" + a.ID.Hex() + "/png"
+			entry.BakedSVGURL = "/me/badges/" + a.ID.Hex() + "/svg"
+		}
+		entries = append(entries, entry)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// DownloadMyBadge sends the badge image with the signed assertion baked
+// in, as PNG or SVG ({format}).
+func DownloadMyBadge(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid badge id")
+		return
+	}
+	format := r.PathValue("format")
+	if format != "png" && format != "svg" {
+		writeError(w, http.StatusNotFound, "unknown image format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	award := loadBadgeAward(ctx, w, bson.M{"_id": oid, "userId": userID})
+	if award == nil {
+		return
+	}
+	if award.RevokedAt != nil {
+		writeError(w, http.StatusGone, "badge has been revoked")
+		return
+	}
+	var b models.BadgeClass
+	if err := db.GetCollection("badge_classes").FindOne(ctx, bson.M{"_id": award.BadgeID}).Decode(&b); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch badge")
+		return
+	}
+
+	jws, err := signBadgeAssertion(r, award)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to sign assertion")
+		return
+	}
+
+	var baked []byte
+	if format == "svg" {
+		baked, err = badge.BakeSVG(badge.SVG(b.Name, b.Color), jws)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		var img []byte
+		if img, err = badge.PNG(b.Color); err == nil {
+			baked, err = badge.BakePNG(img, jws)
+		}
+		w.Header().Set("Content-Type", "image/png")
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to bake badge")
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="badge-`+award.ID.Hex()+`.`+format+`"`)
+	w.Write(baked)
+}
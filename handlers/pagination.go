@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultListLimit = 10
+	maxListLimit     = 100
+)
+
+var (
+	appSecretOnce sync.Once
+	appSecretKey  []byte
+	appSecretErr  error
+)
+
+func appSecretFile() string {
+	if path := os.Getenv("APP_SECRET_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join("uploads", "secret.key")
+}
+
+// appSecret is the server-side key for signing opaque tokens: list
+// cursors, invite links and certificate codes. Without APP_SECRET the key
+// is kept in APP_SECRET_FILE, created on first use, so issued certificates
+// keep verifying after a restart.
+func appSecret() []byte {
+	if err := LoadAppSecret(); err != nil {
+		panic(err)
+	}
+	return appSecretKey
+}
+
+// LoadAppSecret loads or creates the signing key. main calls it at startup
+// so an unusable key file stops the server instead of failing requests.
+func LoadAppSecret() error {
+	appSecretOnce.Do(func() {
+		if s := os.Getenv("APP_SECRET"); s != "" {
+			appSecretKey = []byte(s)
+			return
+		}
+		appSecretKey, appSecretErr = loadOrCreateSecret(appSecretFile())
+		if appSecretErr != nil {
+			appSecretErr = fmt.Errorf("APP_SECRET is not set and %s is unusable: %w", appSecretFile(), appSecretErr)
+			return
+		}
+		log.Printf("APP_SECRET is not set; signing with the key in %s", appSecretFile())
+	})
+	return appSecretErr
+}
+
+// loadOrCreateSecret reads a hex-encoded key, generating and saving a new
+// 32-byte key if the file does not exist yet.
+func loadOrCreateSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 16 {
+			return nil, errors.New("no valid key in " + path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sortField is one key of a keyset sort. Path is the field in the query,
+// the last key of every sort must be unique (usually _id).
+type sortField struct {
+	Path string
+	Desc bool
+}
+
+// listCursor is the signed continuation token of a listing. Values holds
+// the sort keys of the boundary document; Offset is used instead for sorts
+// that cannot be expressed as a range (text relevance).
+type listCursor struct {
+	Sort   string        `bson:"s"`
+	Query  string        `bson:"q"`
+	Values []interface{} `bson:"v,omitempty"`
+	Offset int64         `bson:"o,omitempty"`
+	Back   bool          `bson:"b,omitempty"`
+}
+
+// signPayload MACs payload under appSecret. The purpose prefix keeps a
+// token minted for one use from being accepted as another.
+func signPayload(purpose string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, appSecret())
+	mac.Write([]byte(purpose + ":"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func signCursor(payload []byte) []byte {
+	return signPayload("cursor", payload)
+}
+
+func encodeListCursor(c listCursor) string {
+	payload, err := bson.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(signCursor(payload))
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var c listCursor
+	enc := base64.RawURLEncoding
+	body, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return c, errorf("invalid cursor")
+	}
+	payload, err := enc.DecodeString(body)
+	if err != nil {
+		return c, errorf("invalid cursor")
+	}
+	mac, err := enc.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signCursor(payload)) {
+		return c, errorf("invalid cursor")
+	}
+	if err := bson.Unmarshal(payload, &c); err != nil {
+		return c, errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// listPage is the parsed pagination request of a cursor-paged listing.
+type listPage struct {
+	Limit        int
+	IncludeTotal bool
+	Cursor       *listCursor
+	sort         string
+	query        string
+}
+
+// parseListPage reads limit, includeTotal and cursor. The cursor must have
+// been issued for the same sort and the same filter parameters.
+func parseListPage(r *http.Request, sort string, filterParams ...string) (listPage, error) {
+	q := r.URL.Query()
+	p := listPage{Limit: defaultListLimit, sort: sort, query: queryFingerprint(r, filterParams...)}
+
+	if q.Has("page") {
+		return p, errorf("page is not supported, use cursor")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return p, errorf("invalid limit")
+		}
+		if l > maxListLimit {
+			l = maxListLimit
+		}
+		p.Limit = l
+	}
+
+	if v := q.Get("includeTotal"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, errorf("invalid includeTotal")
+		}
+		p.IncludeTotal = b
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeListCursor(v)
+		if err != nil {
+			return p, err
+		}
+		if c.Sort != p.sort || c.Query != p.query {
+			return p, errorf("cursor does not match query")
+		}
+		p.Cursor = &c
+	}
+	return p, nil
+}
+
+func queryFingerprint(r *http.Request, params ...string) string {
+	h := sha256.New()
+	q := r.URL.Query()
+	for _, name := range params {
+		h.Write([]byte(name + "=" + strings.TrimSpace(q.Get(name)) + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Back reports whether the page is fetched backwards from a prev cursor.
+func (p listPage) Back() bool {
+	return p.Cursor != nil && p.Cursor.Back
+}
+
+// sortSpec is the sort to query with; a backwards page runs the sort in
+// reverse and the caller flips the results.
+func (p listPage) sortSpec(fields []sortField) bson.D {
+	spec := bson.D{}
+	for _, f := range fields {
+		dir := 1
+		if f.Desc != p.Back() {
+			dir = -1
+		}
+		spec = append(spec, bson.E{Key: f.Path, Value: dir})
+	}
+	return spec
+}
+
+// keysetFilter restricts the query to documents after (or, going back,
+// before) the cursor position. Nil without a keyset cursor.
+func (p listPage) keysetFilter(fields []sortField) bson.M {
+	if p.Cursor == nil || len(p.Cursor.Values) != len(fields) {
+		return nil
+	}
+	values := p.Cursor.Values
+	or := []bson.M{}
+	for i, f := range fields {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[fields[j].Path] = values[j]
+		}
+		op := "$gt"
+		if f.Desc != p.Back() {
+			op = "$lt"
+		}
+		clause[f.Path] = bson.M{op: values[i]}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+// offset is the number of documents to skip for offset cursors.
+func (p listPage) offset() int64 {
+	if p.Cursor == nil {
+		return 0
+	}
+	if p.Cursor.Back {
+		if off := p.Cursor.Offset - int64(p.Limit); off > 0 {
+			return off
+		}
+		return 0
+	}
+	return p.Cursor.Offset
+}
+
+// pageLinks holds the cursors around a fetched page.
+type pageLinks struct {
+	Next string
+	Prev string
+}
+
+// keysetLinks builds next/prev cursors for a keyset page. n is the number of
+// documents fetched with a limit of Limit+1, before trimming; first and last
+// are the sort values of the first and last documents kept, in display order.
+func (p listPage) keysetLinks(n int, first, last []interface{}) pageLinks {
+	var links pageLinks
+	if n == 0 {
+		return links
+	}
+	more := n > p.Limit
+	hasNext, hasPrev := more, p.Cursor != nil
+	if p.Back() {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		links.Next = encodeListCursor(listCursor{Sort: p.sort, Query: p.query, Values: last})
+	}
+	if hasPrev {
+		links.Prev = encodeListCursor(listCursor{Sort: p.sort, Query: p.query, Values: first, Back: true})
+	}
+	return links
+}
+
+// offsetLinks builds next/prev cursors for an offset page.
+func (p listPage) offsetLinks(n int) pageLinks {
+	var links pageLinks
+	start := p.offset()
+	if n > p.Limit {
+		links.Next = encodeListCursor(listCursor{Sort: p.sort, Query: p.query, Offset: start + int64(p.Limit)})
+	}
+	if start > 0 {
+		links.Prev = encodeListCursor(listCursor{Sort: p.sort, Query: p.query, Offset: start, Back: true})
+	}
+	return links
+}
+
+// setLinkHeader writes RFC 8288 first/next/prev links for the listing.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, links pageLinks) {
+	build := func(cursor, rel string) string {
+		q := r.URL.Query()
+		q.Del("cursor")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		u := appBaseURL(r) + r.URL.Path
+		if enc := q.Encode(); enc != "" {
+			u += "?" + enc
+		}
+		return "<" + u + `>; rel="` + rel + `"`
+	}
+
+	parts := []string{build("", "first")}
+	if links.Next != "" {
+		parts = append(parts, build(links.Next, "next"))
+	}
+	if links.Prev != "" {
+		parts = append(parts, build(links.Prev, "prev"))
+	}
+	w.Header().Set("Link", strings.Join(parts, ", "))
+}
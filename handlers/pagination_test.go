@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseListPage(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"limit=500", ""},
+		{"limit=0", "invalid limit"},
+		{"includeTotal=maybe", "invalid includeTotal"},
+		{"page=2", "page is not supported, use cursor"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/templates?"+tt.query, nil)
+		pg, err := parseListPage(r, "title_asc", "category")
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%q: err = %q, want %q", tt.query, got, tt.want)
+		}
+		if err == nil && (pg.Limit < 1 || pg.Limit > maxListLimit) {
+			t.Errorf("%q: limit = %d", tt.query, pg.Limit)
+		}
+	}
+}
@@ -2,15 +2,20 @@ package handlers
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"AP_Final/db"
+	"AP_Final/models"
 )
 
 type progressInput struct {
@@ -52,7 +57,7 @@ func UpdateProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if status != "not_started" && status != "in_progress" && status != "done" {
+	if !validProgressStatus(status) {
 		writeError(w, http.StatusBadRequest, "invalid status")
 		return
 	}
@@ -60,34 +65,221 @@ func UpdateProgress(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if _, item := loadLearnerItem(ctx, w, userID, courseOID, itemOID); item == nil {
+		return
+	}
+
+	recordActivity(ctx, userID, courseOID)
+	if err := saveProgress(ctx, userID, courseOID, itemOID, status, input.Score, true, models.ActivitySourceManual); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update progress")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "progress updated"})
+}
+
+func validProgressStatus(status string) bool {
+	return status == "not_started" || status == "in_progress" || status == "done"
+}
+
+// GradeProgress records a student's status and score on an item for them.
+// TAs assigned to groups may only grade the students of those groups.
+func GradeProgress(w http.ResponseWriter, r *http.Request) {
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	var input progressInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	status := strings.TrimSpace(input.Status)
+	if !validProgressStatus(status) {
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	course, graderID := loadStaffCourse(ctx, w, r, capGrade)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+	_, item := findItem(course, itemOID)
+	if item == nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+	if input.Score < 0 || (item.MaxScore > 0 && input.Score > item.MaxScore) {
+		writeError(w, http.StatusBadRequest, "score is out of range")
+		return
+	}
+
+	groupIDs, err := taGroupIDs(ctx, course, graderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch groups")
+		return
+	}
+	if len(groupIDs) > 0 && (enrollment.GroupID == nil || !slices.Contains(groupIDs, *enrollment.GroupID)) {
+		writeError(w, http.StatusForbidden, "student is not in your groups")
+		return
+	}
+
+	if err := saveProgress(ctx, enrollment.UserID, course.ID, itemOID, status, input.Score, false, models.ActivitySourceStaff); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update progress")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "progress updated"})
+}
+
+// loadLearnerItem resolves an item the user is allowed to work on: the
+// course must be visible to them, their enrollment active (or completed),
+// the item inside its availability window and its prerequisite items done.
+// Course staff bypass all but visibility. It writes the
+// error response and returns nils on failure.
+func loadLearnerItem(ctx context.Context, w http.ResponseWriter, userID, courseOID, itemOID primitive.ObjectID) (*models.Course, *models.CourseItem) {
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return nil, nil
+	}
+	if !canViewCourse(course, userID) {
+		writeError(w, http.StatusNotFound, "course not found")
+		return nil, nil
+	}
+	module, item := findItem(course, itemOID)
+	if item == nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return nil, nil
+	}
+	denial, err := learnerItemDenial(ctx, userID, course, module, item)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil
+	}
+	if denial != nil {
+		denial.write(w)
+		return nil, nil
+	}
+	return course, item
+}
+
+// itemDenial is why a learner may not open an item of a visible course.
+type itemDenial struct {
+	status  int
+	message string
+	unmet   []unmetItem
+}
+
+func (d *itemDenial) write(w http.ResponseWriter) {
+	if d.unmet != nil {
+		writeJSON(w, d.status, map[string]interface{}{
+			"error": d.message,
+			"unmet": d.unmet,
+		})
+		return
+	}
+	writeError(w, d.status, d.message)
+}
+
+// learnerItemDenial applies the item checks of loadLearnerItem without
+// writing a response; it returns nil when the user may open the item.
+func learnerItemDenial(ctx context.Context, userID primitive.ObjectID, course *models.Course, module *models.CourseModule, item *models.CourseItem) (*itemDenial, error) {
+	if isCourseStaff(course, userID) {
+		return nil, nil
+	}
+	var enrollment models.Enrollment
+	opts := options.FindOne().SetProjection(bson.M{"status": 1, "groupId": 1})
+	err := db.GetCollection("enrollments").FindOne(ctx, bson.M{"userId": userID, "courseId": course.ID}, opts).Decode(&enrollment)
+	if err == mongo.ErrNoDocuments {
+		return &itemDenial{status: http.StatusForbidden, message: "not enrolled in this course"}, nil
+	}
+	if err != nil {
+		return nil, errorf("failed to fetch enrollment")
+	}
+	// Completed students keep access to review the material.
+	if enrollment.Status != models.EnrollmentStatusActive && enrollment.Status != models.EnrollmentStatusCompleted {
+		return &itemDenial{status: http.StatusForbidden, message: "enrollment is " + enrollment.Status}, nil
+	}
+	if !itemVisibleToGroup(module, item, enrollment.GroupID) {
+		return &itemDenial{status: http.StatusNotFound, message: "item not found"}, nil
+	}
+	if !itemAvailable(module, item, time.Now()) {
+		return &itemDenial{status: http.StatusForbidden, message: "item is not available"}, nil
+	}
+	unmet, err := unmetItemPrerequisites(ctx, userID, course, item)
+	if err != nil {
+		return nil, errorf("failed to check item prerequisites")
+	}
+	if len(unmet) > 0 {
+		return &itemDenial{status: http.StatusForbidden, message: "item prerequisites not met", unmet: unmet}, nil
+	}
+	return nil, nil
+}
+
+// saveProgress upserts the user's progress on an item and records the change
+// in the activity stream. countAttempt is false for intermediate saves that
+// should not count as a new attempt; source is an ActivitySource.
+func saveProgress(ctx context.Context, userID, courseOID, itemOID primitive.ObjectID, status string, score float64, countAttempt bool, source string) error {
 	update := bson.M{
 		"$set": bson.M{
 			"userId":    userID,
 			"courseId":  courseOID,
 			"itemId":    itemOID,
 			"status":    status,
-			"score":     input.Score,
+			"score":     score,
 			"updatedAt": time.Now(),
 		},
-		"$inc": bson.M{"attempts": 1},
+	}
+	if countAttempt {
+		update["$inc"] = bson.M{"attempts": 1}
+	} else {
+		update["$setOnInsert"] = bson.M{"attempts": 0}
 	}
 
-	opts := options.Update().SetUpsert(true)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
 
-	_, err = db.GetCollection("progress").UpdateOne(
+	var before models.Progress
+	err := db.GetCollection("progress").FindOneAndUpdate(
 		ctx,
 		bson.M{"userId": userID, "courseId": courseOID, "itemId": itemOID},
 		update,
 		opts,
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update progress")
-		return
+	).Decode(&before)
+	switch err {
+	case nil:
+		logProgressActivity(ctx, userID, courseOID, itemOID, &before, status, score, countAttempt, source)
+	case mongo.ErrNoDocuments:
+		logProgressActivity(ctx, userID, courseOID, itemOID, nil, status, score, countAttempt, source)
+	default:
+		return err
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"message": "progress updated"})
+	// The progress itself is saved; a failed completion check is picked up
+	// again by the background job, missed badges by the next update.
+	if err := checkCourseCompletion(ctx, userID, courseOID); err != nil {
+		log.Printf("progress: checking completion of %s: %v", courseOID.Hex(), err)
+	}
+	if err := checkBadges(ctx, userID, courseOID); err != nil {
+		log.Printf("progress: checking badges of %s: %v", courseOID.Hex(), err)
+	}
+
+	go passBackLtiScores(userID, courseOID, itemOID)
+	return nil
 }
 
+// progressSort keeps the /me/progress order: most complete first, then by
+// course title, with the enrollment id as tie-breaker.
+var progressSort = []sortField{{Path: "completionRate", Desc: true}, {Path: "course.title"}, {Path: "_id"}}
+
 func GetMyProgress(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserIDFromRequest(r)
 	if err != nil {
@@ -95,12 +287,29 @@ func GetMyProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pg, err := parseListPage(r, "completionRate_desc")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	pipeline := mongoProgressPipeline(userID)
+	collection := db.GetCollection("enrollments")
+
+	if pg.IncludeTotal {
+		total, err := countProgressCourses(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count progress")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	pipeline := mongoProgressPipeline(userID, pg)
 
-	cursor, err := db.GetCollection("enrollments").Aggregate(ctx, pipeline)
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to aggregate progress")
 		return
@@ -113,12 +322,73 @@ func GetMyProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fetched := len(results)
+	if fetched > pg.Limit {
+		results = results[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(results)
+	}
+	var first, last []interface{}
+	if len(results) > 0 {
+		first = progressSortValues(results[0])
+		last = progressSortValues(results[len(results)-1])
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
 	writeJSON(w, http.StatusOK, results)
 }
 
-func mongoProgressPipeline(userID primitive.ObjectID) []bson.M {
-	return []bson.M{
-		{"$match": bson.M{"userId": userID}},
+func progressSortValues(doc bson.M) []interface{} {
+	return []interface{}{doc["completionRate"], doc["courseTitle"], doc["enrollmentId"]}
+}
+
+// countProgressCourses counts enrollments whose course still exists, which
+// is what the progress pipeline returns.
+func countProgressCourses(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	cursor, err := db.GetCollection("enrollments").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"userId": userID, "status": bson.M{"$ne": models.EnrollmentStatusPending}}},
+		{"$lookup": bson.M{
+			"from": "courses",
+			"let":  bson.M{"courseId": "$courseId"},
+			"pipeline": []bson.M{
+				{"$match": bson.M{"$expr": bson.M{"$eq": []interface{}{"$_id", "$$courseId"}}}},
+				{"$project": bson.M{"_id": 1}},
+			},
+			"as": "course",
+		}},
+		{"$match": bson.M{"course": bson.M{"$ne": []interface{}{}}}},
+		{"$count": "total"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var out struct {
+		Total int64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&out); err != nil {
+			return 0, err
+		}
+	}
+	return out.Total, cursor.Err()
+}
+
+// groupVisibleExpr is visibleToGroup as an aggregation expression over the
+// enrollment's groupId.
+func groupVisibleExpr(groupIDs string) bson.M {
+	ids := bson.M{"$ifNull": []interface{}{groupIDs, []interface{}{}}}
+	return bson.M{"$or": []interface{}{
+		bson.M{"$eq": []interface{}{bson.M{"$size": ids}, 0}},
+		bson.M{"$in": []interface{}{bson.M{"$ifNull": []interface{}{"$groupId", nil}}, ids}},
+	}}
+}
+
+func mongoProgressPipeline(userID primitive.ObjectID, pg listPage) []bson.M {
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID, "status": bson.M{"$ne": models.EnrollmentStatusPending}}},
 		{"$lookup": bson.M{
 			"from":         "courses",
 			"localField":   "courseId",
@@ -137,18 +407,53 @@ func mongoProgressPipeline(userID primitive.ObjectID) []bson.M {
 			},
 			"as": "progress",
 		}},
+		{"$lookup": bson.M{
+			"from": "course_completions",
+			"let":  bson.M{"courseId": "$courseId", "userId": "$userId"},
+			"pipeline": []bson.M{
+				{"$match": bson.M{"$expr": bson.M{"$and": []bson.M{
+					{"$eq": []interface{}{"$courseId", "$$courseId"}},
+					{"$eq": []interface{}{"$userId", "$$userId"}},
+				}}}},
+				{"$project": bson.M{"completedAt": 1}},
+			},
+			"as": "completion",
+		}},
 		{"$addFields": bson.M{
-			"itemsCount": bson.M{"$sum": bson.M{"$map": bson.M{
-				"input": "$course.modules",
-				"as":    "m",
-				"in":    bson.M{"$size": bson.M{"$ifNull": []interface{}{"$$m.items", []interface{}{}}}},
-			}}},
+			// Only required items the student's group can see count.
+			"requiredItems": bson.M{"$reduce": bson.M{
+				"input":        bson.M{"$ifNull": []interface{}{"$course.modules", []interface{}{}}},
+				"initialValue": []interface{}{},
+				"in": bson.M{"$concatArrays": []interface{}{"$$value", bson.M{"$cond": []interface{}{
+					groupVisibleExpr("$$this.groupIds"),
+					bson.M{"$map": bson.M{
+						"input": bson.M{"$filter": bson.M{
+							"input": bson.M{"$ifNull": []interface{}{"$$this.items", []interface{}{}}},
+							"as":    "it",
+							"cond": bson.M{"$and": []interface{}{
+								groupVisibleExpr("$$it.groupIds"),
+								bson.M{"$ne": []interface{}{"$$it.optional", true}},
+							}},
+						}},
+						"as": "it",
+						"in": "$$it._id",
+					}},
+					[]interface{}{},
+				}}}},
+			}},
+			"avgScore": bson.M{"$ifNull": []interface{}{bson.M{"$avg": "$progress.score"}, 0}},
+		}},
+		{"$addFields": bson.M{
+			"itemsCount": bson.M{"$size": "$requiredItems"},
 			"doneCount": bson.M{"$size": bson.M{"$filter": bson.M{
 				"input": "$progress",
 				"as":    "p",
-				"cond":  bson.M{"$eq": []interface{}{"$$p.status", "done"}},
+				"cond": bson.M{"$and": []interface{}{
+					bson.M{"$eq": []interface{}{"$$p.status", "done"}},
+					bson.M{"$in": []interface{}{"$$p.itemId", "$requiredItems"}},
+				}},
 			}}},
-			"avgScore": bson.M{"$ifNull": []interface{}{bson.M{"$avg": "$progress.score"}, 0}},
+			"completed": bson.M{"$gt": []interface{}{bson.M{"$size": "$completion"}, 0}},
 		}},
 		{"$addFields": bson.M{
 			"completionRate": bson.M{"$cond": []interface{}{
@@ -157,8 +462,31 @@ func mongoProgressPipeline(userID primitive.ObjectID) []bson.M {
 				0,
 			}},
 		}},
-		{"$project": bson.M{
+	}
+	if keyset := pg.keysetFilter(progressSort); keyset != nil {
+		pipeline = append(pipeline, bson.M{"$match": keyset})
+	}
+	// The expiry job runs periodically; an end date that has already passed
+	// shows as expired in the meantime.
+	pipeline = append(pipeline, bson.M{"$addFields": bson.M{
+		"status": bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{
+				bson.M{"$in": bson.A{"$status", bson.A{
+					models.EnrollmentStatusActive, models.EnrollmentStatusWaitlisted, models.EnrollmentStatusSuspended,
+				}}},
+				bson.M{"$gt": bson.A{"$endsAt", nil}},
+				bson.M{"$lte": bson.A{"$endsAt", "$$NOW"}},
+			}},
+			models.EnrollmentStatusExpired,
+			"$status",
+		}},
+	}})
+	return append(pipeline,
+		bson.M{"$sort": pg.sortSpec(progressSort)},
+		bson.M{"$limit": pg.Limit + 1},
+		bson.M{"$project": bson.M{
 			"_id":              0,
+			"enrollmentId":     "$_id",
 			"courseId":         "$course._id",
 			"courseTitle":      "$course.title",
 			"itemsCount":       1,
@@ -167,7 +495,9 @@ func mongoProgressPipeline(userID primitive.ObjectID) []bson.M {
 			"avgScore":         1,
 			"enrollmentStatus": "$status",
 			"enrolledAt":       "$enrolledAt",
+			"endsAt":           "$endsAt",
+			"completedAt":      "$completedAt",
+			"completed":        1,
 		}},
-		{"$sort": bson.M{"completionRate": -1, "courseTitle": 1}},
-	}
+	)
 }
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	maxRosterSearchUsers = 1000
+	maxImportRows        = 5000
+)
+
+// rosterEntry is an enrollment as the teacher sees it on the roster.
+type rosterEntry struct {
+	models.Enrollment `bson:",inline"`
+	Username          string                   `json:"username"`
+	Completion        *models.CourseCompletion `json:"completion,omitempty"`
+}
+
+// loadRosterEnrollment loads the {enrollmentId} enrollment of course.
+func loadRosterEnrollment(ctx context.Context, w http.ResponseWriter, r *http.Request, course *models.Course) *models.Enrollment {
+	oid, err := primitive.ObjectIDFromHex(r.PathValue("enrollmentId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid enrollment id")
+		return nil
+	}
+
+	var enrollment models.Enrollment
+	err = db.GetCollection("enrollments").FindOne(ctx, bson.M{"_id": oid, "courseId": course.ID}).Decode(&enrollment)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "enrollment not found")
+		return nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollment")
+		return nil
+	}
+	return &enrollment
+}
+
+// usernames maps user ids to usernames.
+func usernames(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	names := map[primitive.ObjectID]string{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"username": 1})
+	cursor, err := db.GetCollection("users").Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+// GetCourseRoster lists a course's enrollments for its staff, newest
+// first. q searches usernames; status narrows to one enrollment status and
+// group to one group id (or "none").
+func GetCourseRoster(w http.ResponseWriter, r *http.Request) {
+	pg, err := parseListPage(r, "enrolledAt_desc", "q", "status", "group")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	status := strings.TrimSpace(query.Get("status"))
+	if status != "" && !validEnrollmentStatus(status) {
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capView)
+	if course == nil {
+		return
+	}
+
+	filter := bson.M{"courseId": course.ID}
+	if status != "" {
+		filter["status"] = status
+	}
+	switch group := strings.TrimSpace(query.Get("group")); group {
+	case "":
+	case "none":
+		filter["groupId"] = nil
+	default:
+		groupOID, err := primitive.ObjectIDFromHex(group)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid group")
+			return
+		}
+		filter["groupId"] = groupOID
+	}
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(maxRosterSearchUsers)
+		cursor, err := db.GetCollection("users").Find(ctx,
+			bson.M{"username": primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}}, opts)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to search users")
+			return
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to search users")
+			return
+		}
+		ids := make([]primitive.ObjectID, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		filter["userId"] = bson.M{"$in": ids}
+	}
+
+	collection := db.GetCollection("enrollments")
+	if pg.IncludeTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to count enrollments")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if keyset := pg.keysetFilter(enrollmentSort); keyset != nil {
+		andFilter(filter, keyset)
+	}
+	opts := options.Find().SetSort(pg.sortSpec(enrollmentSort)).SetLimit(int64(pg.Limit + 1))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	enrollments := []models.Enrollment{}
+	if err := cursor.All(ctx, &enrollments); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode enrollments")
+		return
+	}
+
+	fetched := len(enrollments)
+	if fetched > pg.Limit {
+		enrollments = enrollments[:pg.Limit]
+	}
+	if pg.Back() {
+		slices.Reverse(enrollments)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(enrollments))
+	for _, e := range enrollments {
+		ids = append(ids, e.UserID)
+	}
+	names, err := usernames(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	completions, err := courseCompletions(ctx, course.ID, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch completions")
+		return
+	}
+
+	results := make([]rosterEntry, 0, len(enrollments))
+	for _, e := range enrollments {
+		if err := setWaitlistPosition(ctx, &e); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to compute waitlist position")
+			return
+		}
+		results = append(results, rosterEntry{Enrollment: e, Username: names[e.UserID], Completion: completions[e.UserID]})
+	}
+
+	var first, last []interface{}
+	if len(enrollments) > 0 {
+		first = []interface{}{enrollments[0].EnrolledAt, enrollments[0].ID}
+		last = []interface{}{enrollments[len(enrollments)-1].EnrolledAt, enrollments[len(enrollments)-1].ID}
+	}
+	setLinkHeader(w, r, pg.keysetLinks(fetched, first, last))
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+type rosterAddInput struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// AddRosterStudent enrolls a student on the teacher's behalf. Enrollment
+// method and prerequisites are skipped; the capacity still applies.
+func AddRosterStudent(w http.ResponseWriter, r *http.Request) {
+	var input rosterAddInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	filter := bson.M{}
+	switch {
+	case strings.TrimSpace(input.UserID) != "":
+		oid, err := primitive.ObjectIDFromHex(strings.TrimSpace(input.UserID))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid userId")
+			return
+		}
+		filter["_id"] = oid
+	case strings.TrimSpace(input.Username) != "":
+		filter["username"] = strings.TrimSpace(input.Username)
+	default:
+		writeError(w, http.StatusBadRequest, "userId or username is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, teacherID := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"username": 1})
+	if err := db.GetCollection("users").FindOne(ctx, filter, opts).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch user")
+		return
+	}
+
+	doc := newEnrollment(user.ID, course.ID, models.EnrollmentMethodManual)
+	doc.AddedBy = &teacherID
+	doc, err := admitEnrollment(ctx, doc, course)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			writeError(w, http.StatusConflict, "enrollment already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create enrollment")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rosterEntry{Enrollment: doc, Username: user.Username})
+}
+
+// RemoveRosterStudent deletes one student's enrollment, freeing the seat.
+func RemoveRosterStudent(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+
+	var deleted models.Enrollment
+	err := db.GetCollection("enrollments").FindOneAndDelete(ctx, bson.M{"_id": enrollment.ID}).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		writeError(w, http.StatusNotFound, "enrollment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete enrollment")
+		return
+	}
+
+	if deleted.Status == models.EnrollmentStatusActive {
+		if err := vacateSeat(ctx, course.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to release seat")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "enrollment deleted"})
+}
+
+// SuspendRosterStudent blocks a student without deleting their progress.
+// A suspended student gives up their seat or waitlist place.
+func SuspendRosterStudent(w http.ResponseWriter, r *http.Request) {
+	setRosterStatus(w, r, models.EnrollmentStatusSuspended)
+}
+
+// ReactivateRosterStudent readmits a suspended, withdrawn, expired or
+// completed student. They need a free seat again and join the back of the
+// waitlist when the course is full.
+func ReactivateRosterStudent(w http.ResponseWriter, r *http.Request) {
+	setRosterStatus(w, r, models.EnrollmentStatusActive)
+}
+
+func setRosterStatus(w http.ResponseWriter, r *http.Request, to string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	course, _ := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+	enrollment := loadRosterEnrollment(ctx, w, r, course)
+	if enrollment == nil {
+		return
+	}
+	// Approving a request has its own endpoint.
+	if enrollment.Status == models.EnrollmentStatusPending || !canTransition(enrollment.Status, to) {
+		writeTransitionError(w, enrollment.Status, to)
+		return
+	}
+
+	doc, ok, err := transitionEnrollment(ctx, *enrollment, course, to, bson.M{}, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update enrollment")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "enrollment changed, try again")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// Import row outcomes. Dry runs report would_enroll instead of enrolled or
+// waitlisted.
+const (
+	importEnrolled        = "enrolled"
+	importWaitlisted      = "waitlisted"
+	importWouldEnroll     = "would_enroll"
+	importAlreadyEnrolled = "already_enrolled"
+	importError           = "error"
+)
+
+type importRowResult struct {
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// readImportUsernames reads usernames from a CSV body, either raw or in the
+// multipart field "file". A header row naming a "username" column selects
+// that column; otherwise the first column is used. Rows are file line numbers.
+func readImportUsernames(r *http.Request) ([]importRowResult, error) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			return nil, errorf("invalid multipart body")
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errorf("file is required")
+		}
+		defer file.Close()
+		body = file
+	}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows := []importRowResult{}
+	column := 0
+	for header := true; ; header = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, errorf("invalid csv on line " + strconv.Itoa(parseErr.Line))
+			}
+			return nil, errorf("invalid csv")
+		}
+		if header {
+			if i := slices.IndexFunc(record, func(f string) bool {
+				return strings.EqualFold(strings.TrimSpace(f), "username")
+			}); i >= 0 {
+				column = i
+				continue
+			}
+		}
+		if len(rows) >= maxImportRows {
+			return nil, errorf("at most " + strconv.Itoa(maxImportRows) + " rows per import")
+		}
+		username := ""
+		if column < len(record) {
+			username = strings.TrimSpace(record[column])
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, importRowResult{Row: line, Username: username})
+	}
+	return rows, nil
+}
+
+// ImportRoster enrolls the usernames listed in a CSV. With dryRun=true
+// nothing is written and each row reports what would happen.
+func ImportRoster(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid dryRun")
+			return
+		}
+		dryRun = b
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	course, teacherID := loadStaffCourse(ctx, w, r, capManageRoster)
+	if course == nil {
+		return
+	}
+
+	rows, err := readImportUsernames(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		writeError(w, http.StatusBadRequest, "csv has no rows")
+		return
+	}
+
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Username != "" {
+			names = append(names, row.Username)
+		}
+	}
+	userIDs := map[string]primitive.ObjectID{}
+	opts := options.Find().SetProjection(bson.M{"username": 1})
+	cursor, err := db.GetCollection("users").Find(ctx, bson.M{"username": bson.M{"$in": names}}, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	ids := make([]primitive.ObjectID, 0, len(users))
+	for _, u := range users {
+		userIDs[u.Username] = u.ID
+		ids = append(ids, u.ID)
+	}
+
+	enrolled := map[primitive.ObjectID]bool{}
+	cursor, err = db.GetCollection("enrollments").Find(ctx,
+		bson.M{"courseId": course.ID, "userId": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"userId": 1}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	var existing []models.Enrollment
+	if err := cursor.All(ctx, &existing); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch enrollments")
+		return
+	}
+	for _, e := range existing {
+		enrolled[e.UserID] = true
+	}
+
+	summary := map[string]int{}
+	seen := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+		userID, found := userIDs[row.Username]
+		switch {
+		case row.Username == "":
+			row.Status, row.Error = importError, "username is empty"
+		case seen[row.Username] != 0:
+			row.Status, row.Error = importError, "duplicate of row "+strconv.Itoa(seen[row.Username])
+		case !found:
+			row.Status, row.Error = importError, "user not found"
+		case enrolled[userID]:
+			row.Status = importAlreadyEnrolled
+		case dryRun:
+			row.Status = importWouldEnroll
+		default:
+			doc := newEnrollment(userID, course.ID, models.EnrollmentMethodManual)
+			doc.AddedBy = &teacherID
+			doc, err := admitEnrollment(ctx, doc, course)
+			switch {
+			case mongo.IsDuplicateKeyError(err):
+				row.Status = importAlreadyEnrolled
+			case err != nil:
+				row.Status, row.Error = importError, "failed to create enrollment"
+			case doc.Status == models.EnrollmentStatusWaitlisted:
+				row.Status = importWaitlisted
+			default:
+				row.Status = importEnrolled
+			}
+		}
+		if row.Username != "" && seen[row.Username] == 0 {
+			seen[row.Username] = row.Row
+		}
+		summary[row.Status]++
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dryRun":  dryRun,
+		"summary": summary,
+		"rows":    rows,
+	})
+}
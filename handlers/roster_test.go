@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadImportUsernames(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []importRowResult
+		wantErr string
+	}{
+		{
+			name: "username column",
+			csv:  "email,Username\na@example.com, alice\n\nb@example.com,bob\n",
+			want: []importRowResult{{Row: 2, Username: "alice"}, {Row: 4, Username: "bob"}},
+		},
+		{
+			name: "first column without header",
+			csv:  "alice,Alice A.\nbob\n",
+			want: []importRowResult{{Row: 1, Username: "alice"}, {Row: 2, Username: "bob"}},
+		},
+		{
+			name: "short row",
+			csv:  "name,username\nAlice\n",
+			want: []importRowResult{{Row: 2, Username: ""}},
+		},
+		{
+			name: "empty",
+			csv:  "",
+			want: []importRowResult{},
+		},
+		{
+			name:    "broken quotes",
+			csv:     "username\n\"alice\n",
+			wantErr: "invalid csv on line 2",
+		},
+		{
+			name:    "too many rows",
+			csv:     strings.Repeat("user\n", maxImportRows+1),
+			wantErr: "rows per import",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/courses/x/enrollments/import", strings.NewReader(tt.csv))
+			r.Header.Set("Content-Type", "text/csv")
+			got, err := readImportUsernames(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readImportUsernames error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readImportUsernames = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadImportUsernamesMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "roster.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("username\nalice\n"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/courses/x/enrollments/import", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	got, err := readImportUsernames(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []importRowResult{{Row: 2, Username: "alice"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readImportUsernames = %+v, want %+v", got, want)
+	}
+
+	r = httptest.NewRequest("POST", "/courses/x/enrollments/import", strings.NewReader(""))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	if _, err := readImportUsernames(r); err == nil {
+		t.Error("expected an error without a file")
+	}
+}
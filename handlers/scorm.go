@@ -0,0 +1,621 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"AP_Final/db"
+	"AP_Final/models"
+	"AP_Final/scorm"
+)
+
+const (
+	maxScormUpload = 200 << 20
+	maxCMIElements = 512
+	// scormContentTTL is how long a player's content link keeps working.
+	scormContentTTL = 4 * time.Hour
+)
+
+// scormContentCSP runs package files in an opaque origin: their scripts
+// cannot read the site's cookies, storage or pages. They reach the runtime
+// API through scormBridgeScript, which talks to the player by postMessage.
+const scormContentCSP = "sandbox allow-scripts"
+
+const scormBridgeScript = `<script src="/static/scorm-sco.js"></script>`
+
+type scormRuntimeInput struct {
+	CMI    map[string]string `json:"cmi"`
+	Finish bool              `json:"finish"`
+}
+
+// Content types browsers are picky about; everything else falls back to the
+// system MIME table.
+var scormContentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".json":  "application/json",
+	".xml":   "application/xml",
+	".xsd":   "application/xml",
+	".svg":   "image/svg+xml",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".mp3":   "audio/mpeg",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".swf":   "application/x-shockwave-flash",
+}
+
+func scormStorageDir() string {
+	if dir := os.Getenv("SCORM_STORAGE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("uploads", "scorm")
+}
+
+func scormContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ct, ok := scormContentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// UploadScormPackage accepts a multipart upload (field "package") and adds a
+// scorm item backed by it to the module.
+func UploadScormPackage(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return
+	}
+	moduleOID, err := primitive.ObjectIDFromHex(r.PathValue("moduleId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid module id")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxScormUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart body")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("package")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "package file is required")
+		return
+	}
+	defer file.Close()
+
+	maxScore := 100.0
+	if v := strings.TrimSpace(r.FormValue("maxScore")); v != "" {
+		maxScore, err = strconv.ParseFloat(v, 64)
+		if err != nil || maxScore < 0 {
+			writeError(w, http.StatusBadRequest, "invalid maxScore")
+			return
+		}
+	}
+	order, _ := strconv.Atoi(r.FormValue("order"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	course := loadCourse(ctx, w, courseOID)
+	if course == nil {
+		return
+	}
+	if !requireCourseCapability(w, course, userID, capEditContent) {
+		return
+	}
+	if findModule(course, moduleOID) == nil {
+		writeError(w, http.StatusNotFound, "module not found")
+		return
+	}
+
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "package is not a zip archive")
+		return
+	}
+	manifest, err := scorm.ParseManifest(zr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scorm package: "+err.Error())
+		return
+	}
+
+	pkg := models.ScormPackage{
+		ID:         primitive.NewObjectID(),
+		CourseID:   courseOID,
+		Version:    manifest.Version,
+		Title:      manifest.Title,
+		LaunchPath: manifest.LaunchPath,
+		Size:       header.Size,
+		UploadedBy: userID,
+		CreatedAt:  time.Now(),
+	}
+
+	dir := filepath.Join(scormStorageDir(), pkg.ID.Hex())
+	if err := scorm.Extract(zr, dir); err != nil {
+		os.RemoveAll(dir)
+		if err == scorm.ErrUnsafePath || err == scorm.ErrTooLarge {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to store package")
+		return
+	}
+
+	if _, err := db.GetCollection("scorm_packages").InsertOne(ctx, pkg); err != nil {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusInternalServerError, "failed to save package")
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = pkg.Title
+	}
+	if title == "" {
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+	item := models.CourseItem{
+		ID:        primitive.NewObjectID(),
+		Type:      models.ItemTypeScorm,
+		Title:     title,
+		MaxScore:  maxScore,
+		Order:     order,
+		PackageID: &pkg.ID,
+	}
+
+	opts := options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"mod._id": moduleOID}},
+	})
+	update := bson.M{
+		"$push": bson.M{"modules.$[mod].items": item},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	if updateCourseVersioned(ctx, w, r, courseOID, moduleOID, update, opts) == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"item":    item,
+		"package": pkg,
+	})
+}
+
+// scormContentClaims is the signed body of a content link. Sandboxed SCOs
+// run in an opaque origin and send no cookies, so the link itself names the
+// user; every relative asset URL carries it along.
+type scormContentClaims struct {
+	UserID    primitive.ObjectID `bson:"u"`
+	PackageID primitive.ObjectID `bson:"p"`
+	Expires   int64              `bson:"x"`
+}
+
+func encodeScormContentToken(c scormContentClaims) (string, error) {
+	payload, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(signPayload("scorm-content", payload)), nil
+}
+
+func decodeScormContentToken(token string, pkgOID primitive.ObjectID, now time.Time) (primitive.ObjectID, error) {
+	var c scormContentClaims
+	enc := base64.RawURLEncoding
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return primitive.NilObjectID, errorf("invalid content link")
+	}
+	payload, err := enc.DecodeString(body)
+	if err != nil {
+		return primitive.NilObjectID, errorf("invalid content link")
+	}
+	mac, err := enc.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signPayload("scorm-content", payload)) {
+		return primitive.NilObjectID, errorf("invalid content link")
+	}
+	if err := bson.Unmarshal(payload, &c); err != nil || c.PackageID != pkgOID {
+		return primitive.NilObjectID, errorf("invalid content link")
+	}
+	if now.Unix() > c.Expires {
+		return primitive.NilObjectID, errorf("content link has expired")
+	}
+	return c.UserID, nil
+}
+
+// injectScormBridge loads the runtime API bridge into an HTML page before
+// any of the page's own scripts run.
+func injectScormBridge(page []byte) []byte {
+	lower := bytes.ToLower(page)
+	at := 0
+	for _, tag := range []string{"<head", "<html"} {
+		if i := bytes.Index(lower, []byte(tag)); i >= 0 {
+			if end := bytes.IndexByte(page[i:], '>'); end >= 0 {
+				at = i + end + 1
+				break
+			}
+		}
+	}
+	out := make([]byte, 0, len(page)+len(scormBridgeScript))
+	out = append(out, page[:at]...)
+	out = append(out, scormBridgeScript...)
+	return append(out, page[at:]...)
+}
+
+// ServeScormContent serves files of an unpacked package. SCOs load their
+// assets with relative URLs, so everything lives under one prefix, which
+// includes the player's signed content link. Only users who may open an
+// item playing the package get its files.
+func ServeScormContent(w http.ResponseWriter, r *http.Request) {
+	pkgOID, err := primitive.ObjectIDFromHex(r.PathValue("packageId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid package id")
+		return
+	}
+	userID, err := decodeScormContentToken(r.PathValue("token"), pkgOID, time.Now())
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	name := path.Clean("/" + r.PathValue("path"))
+	if name == "/" {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ok, err := canOpenScormPackage(ctx, userID, pkgOID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check package access")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	root := filepath.Join(scormStorageDir(), pkgOID.Hex())
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	contentType := scormContentType(name)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", scormContentCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if strings.HasPrefix(contentType, "text/html") {
+		page, err := io.ReadAll(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to read file")
+			return
+		}
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(injectScormBridge(page)))
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// canOpenScormPackage reports whether the user may open some item that
+// plays the package, under the same rules as the player. Cloned courses
+// share packages, so every course referencing it is considered.
+func canOpenScormPackage(ctx context.Context, userID, pkgOID primitive.ObjectID) (bool, error) {
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"modules.items.packageId": pkgOID})
+	if err != nil {
+		return false, err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return false, err
+	}
+	for i := range courses {
+		course := &courses[i]
+		if !canViewCourse(course, userID) {
+			continue
+		}
+		for j := range course.Modules {
+			module := &course.Modules[j]
+			for k := range module.Items {
+				item := &module.Items[k]
+				if item.Type != models.ItemTypeScorm || item.PackageID == nil || *item.PackageID != pkgOID {
+					continue
+				}
+				denial, err := learnerItemDenial(ctx, userID, course, module, item)
+				if err != nil {
+					return false, err
+				}
+				if denial == nil {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func loadScormItem(ctx context.Context, w http.ResponseWriter, r *http.Request) (primitive.ObjectID, *models.Course, *models.CourseItem, *models.ScormPackage) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return userID, nil, nil, nil
+	}
+
+	courseOID, err := primitive.ObjectIDFromHex(r.PathValue("courseId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid course id")
+		return userID, nil, nil, nil
+	}
+	itemOID, err := primitive.ObjectIDFromHex(r.PathValue("itemId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid item id")
+		return userID, nil, nil, nil
+	}
+
+	course, item := loadLearnerItem(ctx, w, userID, courseOID, itemOID)
+	if item == nil {
+		return userID, nil, nil, nil
+	}
+	if item.Type != models.ItemTypeScorm || item.PackageID == nil {
+		writeError(w, http.StatusBadRequest, "item is not a scorm package")
+		return userID, nil, nil, nil
+	}
+
+	var pkg models.ScormPackage
+	if err := db.GetCollection("scorm_packages").FindOne(ctx, bson.M{"_id": *item.PackageID}).Decode(&pkg); err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, "package not found")
+			return userID, nil, nil, nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch package")
+		return userID, nil, nil, nil
+	}
+
+	return userID, course, item, &pkg
+}
+
+func ScormPlayer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, course, item, pkg := loadScormItem(ctx, w, r)
+	if pkg == nil {
+		return
+	}
+	logItemView(ctx, course, userID, item.ID)
+
+	token, err := encodeScormContentToken(scormContentClaims{
+		UserID:    userID,
+		PackageID: pkg.ID,
+		Expires:   time.Now().Add(scormContentTTL).Unix(),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to open package")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl, err := template.ParseFiles("views/scorm.html")
+	if err != nil {
+		http.Error(w, "Template parse error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     item.Title,
+		"CourseID":  course.ID.Hex(),
+		"ItemID":    item.ID.Hex(),
+		"Version":   pkg.Version,
+		"LaunchURL": "/scorm/" + pkg.ID.Hex() + "/content/" + token + "/" + pkg.LaunchPath,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Template execute error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func GetScormRuntime(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, course, item, pkg := loadScormItem(ctx, w, r)
+	if pkg == nil {
+		return
+	}
+
+	var runtime models.ScormRuntime
+	err := db.GetCollection("scorm_runtime").FindOne(ctx, bson.M{
+		"userId":   userID,
+		"courseId": course.ID,
+		"itemId":   item.ID,
+	}).Decode(&runtime)
+	if err != nil && err != mongo.ErrNoDocuments {
+		writeError(w, http.StatusInternalServerError, "failed to fetch runtime data")
+		return
+	}
+
+	var user models.User
+	_ = db.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+
+	cmi := scormInitialCMI(pkg.Version, userID.Hex(), user.Username, runtime.Sessions > 0)
+	for _, v := range runtime.CMI {
+		if _, readOnly := cmi[v.Element]; !readOnly {
+			cmi[v.Element] = v.Value
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": pkg.Version,
+		"cmi":     cmi,
+	})
+}
+
+// scormInitialCMI returns the read-only elements the LMS supplies to a SCO.
+func scormInitialCMI(version, learnerID, learnerName string, resumed bool) map[string]string {
+	entry := "ab-initio"
+	if resumed {
+		entry = "resume"
+	}
+	if version == scorm.Version2004 {
+		return map[string]string{
+			"cmi._version":     "1.0",
+			"cmi.learner_id":   learnerID,
+			"cmi.learner_name": learnerName,
+			"cmi.credit":       "credit",
+			"cmi.mode":         "normal",
+			"cmi.entry":        entry,
+		}
+	}
+	return map[string]string{
+		"cmi.core._children":    "student_id,student_name,lesson_location,credit,lesson_status,entry,score,total_time,lesson_mode,exit,session_time",
+		"cmi.core.student_id":   learnerID,
+		"cmi.core.student_name": learnerName,
+		"cmi.core.credit":       "credit",
+		"cmi.core.lesson_mode":  "normal",
+		"cmi.core.entry":        entry,
+	}
+}
+
+// PutScormRuntime persists CMI data sent by the runtime API and mirrors
+// lesson status and score into the progress collection.
+func PutScormRuntime(w http.ResponseWriter, r *http.Request) {
+	var input scormRuntimeInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, course, item, pkg := loadScormItem(ctx, w, r)
+	if pkg == nil {
+		return
+	}
+
+	if len(input.CMI) > maxCMIElements {
+		writeError(w, http.StatusBadRequest, "too many cmi elements")
+		return
+	}
+	readOnly := scormInitialCMI(pkg.Version, "", "", false)
+
+	filter := bson.M{"userId": userID, "courseId": course.ID, "itemId": item.ID}
+	var runtime models.ScormRuntime
+	err := db.GetCollection("scorm_runtime").FindOne(ctx, filter).Decode(&runtime)
+	if err != nil && err != mongo.ErrNoDocuments {
+		writeError(w, http.StatusInternalServerError, "failed to fetch runtime data")
+		return
+	}
+
+	merged := map[string]string{}
+	for _, v := range runtime.CMI {
+		merged[v.Element] = v.Value
+	}
+	for element, value := range input.CMI {
+		if !strings.HasPrefix(element, "cmi.") {
+			writeError(w, http.StatusBadRequest, "invalid cmi element: "+element)
+			return
+		}
+		if _, ok := readOnly[element]; ok {
+			continue
+		}
+		if len(value) > scorm.MaxValueLength(pkg.Version, element) {
+			writeError(w, http.StatusBadRequest, "cmi value too long: "+element)
+			return
+		}
+		merged[element] = value
+	}
+	if len(merged) > maxCMIElements {
+		writeError(w, http.StatusBadRequest, "too many cmi elements")
+		return
+	}
+
+	values := make([]models.ScormValue, 0, len(merged))
+	for element, value := range merged {
+		values = append(values, models.ScormValue{Element: element, Value: value})
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"packageId": pkg.ID,
+			"cmi":       values,
+			"updatedAt": time.Now(),
+		},
+	}
+	if input.Finish {
+		update["$inc"] = bson.M{"sessions": 1}
+	}
+	_, err = db.GetCollection("scorm_runtime").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to save runtime data")
+		return
+	}
+
+	outcome := scorm.ReadOutcome(pkg.Version, merged)
+	status := "in_progress"
+	if outcome.Completed {
+		status = "done"
+	}
+	score := 0.0
+	switch {
+	case outcome.Score != nil:
+		score = *outcome.Score
+	case outcome.Scaled != nil:
+		score = *outcome.Scaled * item.MaxScore
+	}
+
+	recordActivity(ctx, userID, course.ID)
+	if err := saveProgress(ctx, userID, course.ID, item.ID, status, score, input.Finish, models.ActivitySourceScorm); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update progress")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": status,
+		"score":  score,
+	})
+}
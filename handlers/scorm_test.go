@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInjectScormBridge(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"head", "<html><HEAD lang=\"en\"><script>x()</script></HEAD></html>",
+			"<html><HEAD lang=\"en\">" + scormBridgeScript + "<script>x()</script></HEAD></html>"},
+		{"html only", "<html><body>hi</body></html>", "<html>" + scormBridgeScript + "<body>hi</body></html>"},
+		{"fragment", "<p>hi</p>", scormBridgeScript + "<p>hi</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectScormBridge([]byte(tt.page))); got != tt.want {
+				t.Errorf("injectScormBridge = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScormContentToken(t *testing.T) {
+	user, pkg := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	token, err := encodeScormContentToken(scormContentClaims{UserID: user, PackageID: pkg, Expires: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := encodeScormContentToken(scormContentClaims{UserID: user, PackageID: pkg, Expires: now.Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		pkg     primitive.ObjectID
+		wantErr bool
+	}{
+		{"valid", token, pkg, false},
+		{"other package", token, primitive.NewObjectID(), true},
+		{"expired", expired, pkg, true},
+		{"tampered", token[:len(token)-2] + "xx", pkg, true},
+		{"garbage", "garbage", pkg, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeScormContentToken(tt.token, tt.pkg, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeScormContentToken error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != user {
+				t.Errorf("decodeScormContentToken = %v, want %v", got, user)
+			}
+		})
+	}
+}
@@ -0,0 +1,694 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"AP_Final/db"
+	"AP_Final/models"
+)
+
+const (
+	maxXapiBody       = 1 << 20
+	maxXapiBatch      = 200
+	defaultXapiLimit  = 100
+	maxXapiQueryLimit = 500
+
+	xapiAuthorityHome = "urn:mini-moodle:xapi-provider"
+)
+
+type xapiProviderInput struct {
+	Name             string   `json:"name"`
+	ActivityPrefixes []string `json:"activityPrefixes,omitempty"`
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CreateXapiProvider registers an activity provider. The secret is only
+// returned here; the server keeps a bcrypt hash.
+func CreateXapiProvider(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	var input xapiProviderInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	prefixes := []string{}
+	for _, p := range input.ActivityPrefixes {
+		p = strings.TrimSpace(p)
+		if !isIRI(p) {
+			writeError(w, http.StatusBadRequest, "activityPrefixes must be IRIs")
+			return
+		}
+		prefixes = append(prefixes, p)
+	}
+
+	secret := randomToken(24)
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), 10)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create provider")
+		return
+	}
+
+	provider := models.XapiProvider{
+		ID:               primitive.NewObjectID(),
+		Name:             input.Name,
+		Key:              randomToken(12),
+		SecretHash:       string(hash),
+		ActivityPrefixes: prefixes,
+		CreatedAt:        time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.GetCollection("xapi_providers").InsertOne(ctx, provider); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create provider")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"provider": provider,
+		"secret":   secret,
+	})
+}
+
+func GetXapiProviders(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.GetCollection("xapi_providers").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch providers")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	providers := []models.XapiProvider{}
+	if err := cursor.All(ctx, &providers); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode providers")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, providers)
+}
+
+func DeleteXapiProvider(w http.ResponseWriter, r *http.Request) {
+	if requireAdmin(w, r) == nil {
+		return
+	}
+
+	providerOID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid provider id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := db.GetCollection("xapi_providers").DeleteOne(ctx, bson.M{"_id": providerOID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete provider")
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateXapi checks the protocol version header and the provider's
+// Basic credentials. It writes the error response and returns nil on failure.
+func authenticateXapi(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.XapiProvider {
+	w.Header().Set("X-Experience-API-Version", xapiVersion)
+
+	version := r.Header.Get("X-Experience-API-Version")
+	if version != "1.0" && !strings.HasPrefix(version, "1.0.") {
+		writeError(w, http.StatusBadRequest, "X-Experience-API-Version header must be 1.0.x")
+		return nil
+	}
+
+	key, secret, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="xapi"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil
+	}
+
+	var provider models.XapiProvider
+	err := db.GetCollection("xapi_providers").FindOne(ctx, bson.M{"key": key}).Decode(&provider)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(provider.SecretHash), []byte(secret)) != nil {
+		if err != nil && err != mongo.ErrNoDocuments {
+			writeError(w, http.StatusInternalServerError, "failed to check credentials")
+			return nil
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="xapi"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil
+	}
+	return &provider
+}
+
+func providerAllows(provider *models.XapiProvider, activityID string) bool {
+	if len(provider.ActivityPrefixes) == 0 {
+		return true
+	}
+	for _, p := range provider.ActivityPrefixes {
+		if strings.HasPrefix(activityID, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func XapiAbout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Experience-API-Version", xapiVersion)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": []string{xapiVersion},
+	})
+}
+
+// PutXapiStatement stores a single statement under the id given in the
+// statementId query parameter.
+func PutXapiStatement(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider := authenticateXapi(ctx, w, r)
+	if provider == nil {
+		return
+	}
+
+	id := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("statementId")))
+	if !uuidPattern.MatchString(id) {
+		writeError(w, http.StatusBadRequest, "statementId must be a UUID")
+		return
+	}
+
+	var st xapiStatement
+	r.Body = http.MaxBytesReader(w, r.Body, maxXapiBody)
+	if err := decodeJSON(r, &st); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid statement: "+err.Error())
+		return
+	}
+	if st.ID != "" && strings.ToLower(st.ID) != id {
+		writeError(w, http.StatusBadRequest, "statement id does not match statementId")
+		return
+	}
+	st.ID = id
+
+	if _, status, err := storeStatements(ctx, provider, []xapiStatement{st}); err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostXapiStatements stores a single statement or an array of statements and
+// returns their ids.
+func PostXapiStatements(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	provider := authenticateXapi(ctx, w, r)
+	if provider == nil {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxXapiBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+
+	var statements []xapiStatement
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = dec.Decode(&statements)
+	} else {
+		var st xapiStatement
+		err = dec.Decode(&st)
+		statements = []xapiStatement{st}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid statement: "+err.Error())
+		return
+	}
+	if len(statements) == 0 {
+		writeError(w, http.StatusBadRequest, "no statements")
+		return
+	}
+	if len(statements) > maxXapiBatch {
+		writeError(w, http.StatusBadRequest, "too many statements in one request")
+		return
+	}
+
+	ids, status, err := storeStatements(ctx, provider, statements)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// storeStatements validates and persists a batch atomically from the
+// client's point of view: nothing is written unless every statement passes.
+// Re-sending an already stored statement with identical content is a no-op.
+func storeStatements(ctx context.Context, provider *models.XapiProvider, statements []xapiStatement) ([]string, int, error) {
+	// Mongo keeps millisecond precision; match it so "stored" round-trips.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	authority := &xapiAgent{
+		ObjectType: "Agent",
+		Name:       provider.Name,
+		Account:    &xapiAccount{HomePage: xapiAuthorityHome, Name: provider.Key},
+	}
+
+	ids := make([]string, 0, len(statements))
+	seen := map[string]bool{}
+	var docs []interface{}
+	var fresh []*xapiStatement
+	var voids []string
+
+	for i := range statements {
+		st := &statements[i]
+		submittedTimestamp := st.Timestamp
+
+		if err := prepareStatement(st, authority, now); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if seen[st.ID] {
+			return nil, http.StatusBadRequest, errorf("duplicate statement id in request: " + st.ID)
+		}
+		seen[st.ID] = true
+		ids = append(ids, st.ID)
+
+		activityID := ""
+		if st.Object.ObjectType == "" || st.Object.ObjectType == "Activity" {
+			activityID = st.Object.ID
+			if !providerAllows(provider, activityID) {
+				return nil, http.StatusForbidden, errorf("provider may not report on activity " + activityID)
+			}
+		}
+
+		var existing models.XapiStatement
+		err := db.GetCollection("xapi_statements").FindOne(ctx, bson.M{"_id": st.ID}).Decode(&existing)
+		if err == nil {
+			if !sameStatement(existing.Raw, st, submittedTimestamp) {
+				return nil, http.StatusConflict, errorf("statement " + st.ID + " already exists with different content")
+			}
+			continue
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, http.StatusInternalServerError, errorf("failed to check statement")
+		}
+
+		if st.Verb.ID == xapiVerbVoided {
+			target := strings.ToLower(st.Object.ID)
+			var targetDoc models.XapiStatement
+			err := db.GetCollection("xapi_statements").FindOne(ctx, bson.M{"_id": target}).Decode(&targetDoc)
+			if err == nil && targetDoc.VerbID == xapiVerbVoided {
+				return nil, http.StatusBadRequest, errorf("voiding statements cannot be voided")
+			}
+			voids = append(voids, target)
+		}
+
+		raw, err := json.Marshal(st)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errorf("failed to encode statement")
+		}
+		timestamp, _ := time.Parse(time.RFC3339Nano, st.Timestamp)
+
+		docs = append(docs, models.XapiStatement{
+			ID:           st.ID,
+			ProviderID:   provider.ID,
+			ActorKey:     agentKey(st.Actor),
+			VerbID:       st.Verb.ID,
+			ActivityID:   activityID,
+			Registration: statementRegistration(st),
+			Timestamp:    timestamp,
+			Stored:       now,
+			Raw:          string(raw),
+		})
+		fresh = append(fresh, st)
+	}
+
+	if len(docs) > 0 {
+		if _, err := db.GetCollection("xapi_statements").InsertMany(ctx, docs); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, http.StatusConflict, errorf("statement already exists")
+			}
+			return nil, http.StatusInternalServerError, errorf("failed to store statements")
+		}
+	}
+	if len(voids) > 0 {
+		_, err := db.GetCollection("xapi_statements").UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": voids}, "verbId": bson.M{"$ne": xapiVerbVoided}},
+			bson.M{"$set": bson.M{"voided": true}},
+		)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errorf("failed to void statements")
+		}
+	}
+
+	// Progress mapping is best effort: the statement itself is already stored
+	// and a learner that cannot be matched is not the provider's error.
+	for _, st := range fresh {
+		_ = applyXapiProgress(ctx, st)
+	}
+
+	return ids, http.StatusOK, nil
+}
+
+func sameStatement(storedRaw string, st *xapiStatement, submittedTimestamp string) bool {
+	var prev xapiStatement
+	if err := json.Unmarshal([]byte(storedRaw), &prev); err != nil {
+		return false
+	}
+	next := *st
+	if submittedTimestamp == "" {
+		next.Timestamp = prev.Timestamp
+	}
+	prev.Stored, next.Stored = "", ""
+	prev.Authority, next.Authority = nil, nil
+
+	a, _ := json.Marshal(prev)
+	b, _ := json.Marshal(next)
+	return bytes.Equal(a, b)
+}
+
+// xapiUsername maps a statement actor to a local username: either an account
+// whose name is the username or an mbox of the form mailto:<username>.
+func xapiUsername(actor *xapiAgent) string {
+	if actor.Account != nil {
+		return actor.Account.Name
+	}
+	return strings.TrimPrefix(actor.Mbox, "mailto:")
+}
+
+// applyXapiProgress marks the linked course items as done when a learner
+// completes or passes an activity. Activity ids are only unique within a
+// course, so every course linking the activity is updated where the learner
+// may open the item.
+func applyXapiProgress(ctx context.Context, st *xapiStatement) error {
+	if st.Verb.ID != xapiVerbCompleted && st.Verb.ID != xapiVerbPassed {
+		return nil
+	}
+	if st.Object.ObjectType != "" && st.Object.ObjectType != "Activity" {
+		return nil
+	}
+	username := xapiUsername(st.Actor)
+	if username == "" {
+		return nil
+	}
+
+	var user models.User
+	if err := db.GetCollection("users").FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		return err
+	}
+
+	cursor, err := db.GetCollection("courses").Find(ctx, bson.M{"modules.items.activityId": st.Object.ID})
+	if err != nil {
+		return err
+	}
+	var courses []models.Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return err
+	}
+
+	for i := range courses {
+		course := &courses[i]
+		if !canViewCourse(course, user.ID) {
+			continue
+		}
+
+		for mi := range course.Modules {
+			module := &course.Modules[mi]
+			for ii := range module.Items {
+				item := &module.Items[ii]
+				if item.ActivityID != st.Object.ID {
+					continue
+				}
+				denial, err := learnerItemDenial(ctx, user.ID, course, module, item)
+				if err != nil {
+					return err
+				}
+				if denial != nil {
+					continue
+				}
+				recordActivity(ctx, user.ID, course.ID)
+				if err := saveProgress(ctx, user.ID, course.ID, item.ID, "done", statementScore(st, item.MaxScore), true, models.ActivitySourceXapi); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// statementScore is the statement's raw score, or its scaled score applied
+// to maxScore, clamped to [0, maxScore].
+func statementScore(st *xapiStatement, maxScore float64) float64 {
+	if st.Result == nil || st.Result.Score == nil {
+		return 0
+	}
+	var score float64
+	s := st.Result.Score
+	switch {
+	case s.Raw != nil:
+		score = *s.Raw
+	case s.Scaled != nil:
+		score = *s.Scaled * maxScore
+	}
+	return max(0, min(score, maxScore))
+}
+
+// GetXapiStatements implements the statement resource's GET: a single
+// (voided) statement by id, or a filtered page with a "more" link.
+func GetXapiStatements(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider := authenticateXapi(ctx, w, r)
+	if provider == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	w.Header().Set("X-Experience-API-Consistent-Through", time.Now().UTC().Format(time.RFC3339Nano))
+
+	statementID := query.Get("statementId")
+	voidedID := query.Get("voidedStatementId")
+	if statementID != "" || voidedID != "" {
+		if statementID != "" && voidedID != "" {
+			writeError(w, http.StatusBadRequest, "statementId and voidedStatementId are mutually exclusive")
+			return
+		}
+		for key := range query {
+			if key != "statementId" && key != "voidedStatementId" && key != "format" && key != "attachments" {
+				writeError(w, http.StatusBadRequest, key+" cannot be combined with a statement id")
+				return
+			}
+		}
+		id, voided := statementID, false
+		if voidedID != "" {
+			id, voided = voidedID, true
+		}
+
+		var doc models.XapiStatement
+		err := db.GetCollection("xapi_statements").FindOne(ctx, bson.M{"_id": strings.ToLower(id), "voided": voided}).Decode(&doc)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				writeError(w, http.StatusNotFound, "statement not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to fetch statement")
+			return
+		}
+		w.Header().Set("Last-Modified", doc.Stored.UTC().Format(http.TimeFormat))
+		writeRawJSON(w, []byte(doc.Raw))
+		return
+	}
+
+	if query.Get("related_agents") == "true" || query.Get("related_activities") == "true" {
+		writeError(w, http.StatusBadRequest, "related_agents and related_activities are not supported")
+		return
+	}
+
+	filter := bson.M{"voided": false}
+	if v := query.Get("agent"); v != "" {
+		var agent xapiAgent
+		if err := json.Unmarshal([]byte(v), &agent); err != nil || validateAgent(&agent, "agent") != nil {
+			writeError(w, http.StatusBadRequest, "invalid agent")
+			return
+		}
+		filter["actorKey"] = agentKey(&agent)
+	}
+	if v := query.Get("verb"); v != "" {
+		filter["verbId"] = v
+	}
+	if v := query.Get("activity"); v != "" {
+		filter["activityId"] = v
+	}
+	if v := query.Get("registration"); v != "" {
+		filter["registration"] = strings.ToLower(v)
+	}
+
+	stored := bson.M{}
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		stored["$gt"] = t
+	}
+	if v := query.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid until")
+			return
+		}
+		stored["$lte"] = t
+	}
+	if len(stored) > 0 {
+		filter["stored"] = stored
+	}
+
+	limit := defaultXapiLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if n > 0 && n < maxXapiQueryLimit {
+			limit = n
+		} else {
+			limit = maxXapiQueryLimit
+		}
+	}
+
+	ascending := query.Get("ascending") == "true"
+	dir := -1
+	cmp := "$lt"
+	if ascending {
+		dir = 1
+		cmp = "$gt"
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		at, id, ok := decodeXapiCursor(v)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		andFilter(filter, bson.M{"$or": []bson.M{
+			{"stored": bson.M{cmp: at}},
+			{"stored": at, "_id": bson.M{cmp: id}},
+		}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "stored", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := db.GetCollection("xapi_statements").Find(ctx, filter, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch statements")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.XapiStatement
+	if err := cursor.All(ctx, &docs); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to decode statements")
+		return
+	}
+
+	more := ""
+	if len(docs) > limit {
+		docs = docs[:limit]
+		last := docs[len(docs)-1]
+		next := url.Values{}
+		for key, values := range query {
+			next[key] = values
+		}
+		next.Set("cursor", encodeXapiCursor(last.Stored, last.ID))
+		more = "/xapi/statements?" + next.Encode()
+	}
+
+	statements := make([]json.RawMessage, 0, len(docs))
+	for _, d := range docs {
+		statements = append(statements, json.RawMessage(d.Raw))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"statements": statements,
+		"more":       more,
+	})
+}
+
+func writeRawJSON(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func encodeXapiCursor(stored time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(stored.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeXapiCursor(v string) (time.Time, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	at, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, "", false
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, id, true
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	xapiVersion = "1.0.3"
+
+	xapiVerbCompleted = "http://adlnet.gov/expapi/verbs/completed"
+	xapiVerbPassed    = "http://adlnet.gov/expapi/verbs/passed"
+	xapiVerbVoided    = "http://adlnet.gov/expapi/verbs/voided"
+)
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[1-5][0-9a-fA-F]{3}-[89abAB][0-9a-fA-F]{3}-[0-9a-fA-F]{12}$`)
+	sha1Pattern     = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+	durationPattern = regexp.MustCompile(`^P(\d+(\.\d+)?Y)?(\d+(\.\d+)?M)?(\d+(\.\d+)?W)?(\d+(\.\d+)?D)?(T(\d+(\.\d+)?H)?(\d+(\.\d+)?M)?(\d+(\.\d+)?S)?)?$`)
+)
+
+type xapiStatement struct {
+	ID          string          `json:"id,omitempty"`
+	Actor       *xapiAgent      `json:"actor"`
+	Verb        *xapiVerb       `json:"verb"`
+	Object      *xapiObject     `json:"object"`
+	Result      *xapiResult     `json:"result,omitempty"`
+	Context     json.RawMessage `json:"context,omitempty"`
+	Timestamp   string          `json:"timestamp,omitempty"`
+	Stored      string          `json:"stored,omitempty"`
+	Authority   *xapiAgent      `json:"authority,omitempty"`
+	Version     string          `json:"version,omitempty"`
+	Attachments json.RawMessage `json:"attachments,omitempty"`
+}
+
+type xapiAgent struct {
+	ObjectType  string       `json:"objectType,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Mbox        string       `json:"mbox,omitempty"`
+	MboxSha1sum string       `json:"mbox_sha1sum,omitempty"`
+	OpenID      string       `json:"openid,omitempty"`
+	Account     *xapiAccount `json:"account,omitempty"`
+	Member      []xapiAgent  `json:"member,omitempty"`
+}
+
+type xapiAccount struct {
+	HomePage string `json:"homePage"`
+	Name     string `json:"name"`
+}
+
+type xapiVerb struct {
+	ID      string            `json:"id"`
+	Display map[string]string `json:"display,omitempty"`
+}
+
+// xapiObject covers Activity, Agent/Group and StatementRef objects.
+type xapiObject struct {
+	ObjectType  string          `json:"objectType,omitempty"`
+	ID          string          `json:"id,omitempty"`
+	Definition  json.RawMessage `json:"definition,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Mbox        string          `json:"mbox,omitempty"`
+	MboxSha1sum string          `json:"mbox_sha1sum,omitempty"`
+	OpenID      string          `json:"openid,omitempty"`
+	Account     *xapiAccount    `json:"account,omitempty"`
+	Member      []xapiAgent     `json:"member,omitempty"`
+}
+
+type xapiResult struct {
+	Score      *xapiScore      `json:"score,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Completion *bool           `json:"completion,omitempty"`
+	Response   string          `json:"response,omitempty"`
+	Duration   string          `json:"duration,omitempty"`
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+}
+
+type xapiScore struct {
+	Scaled *float64 `json:"scaled,omitempty"`
+	Raw    *float64 `json:"raw,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func isIRI(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && u.Scheme != ""
+}
+
+// agentKey returns a canonical form of the agent's inverse functional
+// identifier, used to index and filter statements by actor.
+func agentKey(a *xapiAgent) string {
+	switch {
+	case a.Mbox != "":
+		return "mbox:" + strings.ToLower(a.Mbox)
+	case a.MboxSha1sum != "":
+		return "mbox_sha1sum:" + strings.ToLower(a.MboxSha1sum)
+	case a.OpenID != "":
+		return "openid:" + a.OpenID
+	case a.Account != nil:
+		return "account:" + a.Account.HomePage + "|" + a.Account.Name
+	default:
+		return ""
+	}
+}
+
+func validateAgent(a *xapiAgent, field string) error {
+	if a.ObjectType != "" && a.ObjectType != "Agent" && a.ObjectType != "Group" {
+		return fmt.Errorf("%s.objectType is invalid", field)
+	}
+
+	ifis := 0
+	if a.Mbox != "" {
+		if !strings.HasPrefix(a.Mbox, "mailto:") {
+			return fmt.Errorf("%s.mbox must be a mailto IRI", field)
+		}
+		ifis++
+	}
+	if a.MboxSha1sum != "" {
+		if !sha1Pattern.MatchString(a.MboxSha1sum) {
+			return fmt.Errorf("%s.mbox_sha1sum is invalid", field)
+		}
+		ifis++
+	}
+	if a.OpenID != "" {
+		if !isIRI(a.OpenID) {
+			return fmt.Errorf("%s.openid is invalid", field)
+		}
+		ifis++
+	}
+	if a.Account != nil {
+		if !isIRI(a.Account.HomePage) || a.Account.Name == "" {
+			return fmt.Errorf("%s.account requires homePage and name", field)
+		}
+		ifis++
+	}
+
+	if a.ObjectType == "Group" {
+		if ifis > 1 {
+			return fmt.Errorf("%s must have at most one identifier", field)
+		}
+		if ifis == 0 && len(a.Member) == 0 {
+			return fmt.Errorf("anonymous group %s requires members", field)
+		}
+		for i := range a.Member {
+			if a.Member[i].ObjectType == "Group" {
+				return fmt.Errorf("%s.member cannot contain groups", field)
+			}
+			if err := validateAgent(&a.Member[i], field+".member"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if ifis != 1 {
+		return fmt.Errorf("%s must have exactly one identifier", field)
+	}
+	if len(a.Member) > 0 {
+		return fmt.Errorf("%s.member is only allowed on groups", field)
+	}
+	return nil
+}
+
+func (o *xapiObject) asAgent() *xapiAgent {
+	return &xapiAgent{
+		ObjectType:  o.ObjectType,
+		Name:        o.Name,
+		Mbox:        o.Mbox,
+		MboxSha1sum: o.MboxSha1sum,
+		OpenID:      o.OpenID,
+		Account:     o.Account,
+		Member:      o.Member,
+	}
+}
+
+func validateObject(o *xapiObject) error {
+	switch o.ObjectType {
+	case "", "Activity":
+		if !isIRI(o.ID) {
+			return errorf("object.id must be an IRI")
+		}
+		if len(o.Definition) > 0 && !json.Valid(o.Definition) {
+			return errorf("object.definition is invalid")
+		}
+		return nil
+	case "Agent", "Group":
+		return validateAgent(o.asAgent(), "object")
+	case "StatementRef":
+		if !uuidPattern.MatchString(o.ID) {
+			return errorf("object.id must be a UUID")
+		}
+		return nil
+	case "SubStatement":
+		return errorf("SubStatement objects are not supported")
+	default:
+		return errorf("object.objectType is invalid")
+	}
+}
+
+func validateResult(res *xapiResult) error {
+	if s := res.Score; s != nil {
+		if s.Scaled != nil && (*s.Scaled < -1 || *s.Scaled > 1) {
+			return errorf("result.score.scaled must be between -1 and 1")
+		}
+		if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+			return errorf("result.score.min must not exceed max")
+		}
+		if s.Raw != nil {
+			if (s.Min != nil && *s.Raw < *s.Min) || (s.Max != nil && *s.Raw > *s.Max) {
+				return errorf("result.score.raw must be between min and max")
+			}
+		}
+	}
+	if res.Duration != "" && (res.Duration == "P" || !durationPattern.MatchString(res.Duration)) {
+		return errorf("result.duration must be an ISO 8601 duration")
+	}
+	return nil
+}
+
+// prepareStatement validates an incoming statement and fills in the fields
+// the LRS is responsible for (id, timestamp, stored, authority, version).
+func prepareStatement(st *xapiStatement, authority *xapiAgent, now time.Time) error {
+	if st.ID == "" {
+		st.ID = newUUID()
+	} else if !uuidPattern.MatchString(st.ID) {
+		return errorf("id must be a UUID")
+	}
+	st.ID = strings.ToLower(st.ID)
+
+	if st.Actor == nil {
+		return errorf("actor is required")
+	}
+	if err := validateAgent(st.Actor, "actor"); err != nil {
+		return err
+	}
+
+	if st.Verb == nil || !isIRI(st.Verb.ID) {
+		return errorf("verb.id must be an IRI")
+	}
+
+	if st.Object == nil {
+		return errorf("object is required")
+	}
+	if err := validateObject(st.Object); err != nil {
+		return err
+	}
+	if st.Verb.ID == xapiVerbVoided && st.Object.ObjectType != "StatementRef" {
+		return errorf("voiding statements must target a StatementRef")
+	}
+
+	if st.Result != nil {
+		if err := validateResult(st.Result); err != nil {
+			return err
+		}
+	}
+
+	if len(st.Context) > 0 {
+		var ctx struct {
+			Registration string `json:"registration"`
+		}
+		if err := json.Unmarshal(st.Context, &ctx); err != nil {
+			return errorf("context is invalid")
+		}
+		if ctx.Registration != "" && !uuidPattern.MatchString(ctx.Registration) {
+			return errorf("context.registration must be a UUID")
+		}
+	}
+
+	if st.Timestamp == "" {
+		st.Timestamp = now.Format(time.RFC3339Nano)
+	} else if _, err := time.Parse(time.RFC3339Nano, st.Timestamp); err != nil {
+		return errorf("timestamp must be an ISO 8601 date")
+	}
+
+	if st.Version == "" {
+		st.Version = xapiVersion
+	} else if !strings.HasPrefix(st.Version, "1.0.") && st.Version != "1.0" {
+		return errorf("unsupported statement version")
+	}
+
+	// The LRS owns these; whatever the client sent is replaced.
+	st.Stored = now.Format(time.RFC3339Nano)
+	st.Authority = authority
+	return nil
+}
+
+func statementRegistration(st *xapiStatement) string {
+	if len(st.Context) == 0 {
+		return ""
+	}
+	var ctx struct {
+		Registration string `json:"registration"`
+	}
+	_ = json.Unmarshal(st.Context, &ctx)
+	return strings.ToLower(ctx.Registration)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import "testing"
+
+func TestStatementScore(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name  string
+		score *xapiScore
+		want  float64
+	}{
+		{"no score", nil, 0},
+		{"raw", &xapiScore{Raw: f(7)}, 7},
+		{"raw wins over scaled", &xapiScore{Raw: f(3), Scaled: f(1)}, 3},
+		{"scaled", &xapiScore{Scaled: f(0.5)}, 5},
+		{"raw above max", &xapiScore{Raw: f(1000)}, 10},
+		{"negative raw", &xapiScore{Raw: f(-4)}, 0},
+		{"scaled above one", &xapiScore{Scaled: f(1.5)}, 10},
+		{"negative scaled", &xapiScore{Scaled: f(-1)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &xapiStatement{}
+			if tt.score != nil {
+				st.Result = &xapiResult{Score: tt.score}
+			}
+			if got := statementScore(st, 10); got != tt.want {
+				t.Errorf("statementScore = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package imscc
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"html"
+	"io"
+	"sort"
+
+	"AP_Final/models"
+)
+
+// Export writes the course as a Common Cartridge 1.3 zip. Modules become
+// organization folders; links, assignments and quizzes map to web link,
+// assignment and QTI resources, and any other item becomes a web page.
+func Export(course *models.Course, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	m := manifest{
+		XMLNS:      nsManifest,
+		Identifier: "M_" + course.ID.Hex(),
+		Metadata: manifestMetadata{
+			Schema:        "IMS Common Cartridge",
+			SchemaVersion: "1.3.0",
+			LOM: lom{
+				XMLNS: nsLOM,
+				General: lomGeneral{
+					Title:       lomString{Value: course.Title},
+					Description: lomString{Value: course.Description},
+				},
+			},
+		},
+	}
+
+	modules := append([]models.CourseModule(nil), course.Modules...)
+	sort.SliceStable(modules, func(i, j int) bool { return modules[i].Order < modules[j].Order })
+
+	root := item{Identifier: "root"}
+	for _, mod := range modules {
+		folder := item{Identifier: "F_" + mod.ID.Hex(), Title: mod.Title}
+
+		items := append([]models.CourseItem(nil), mod.Items...)
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Order < items[j].Order })
+
+		for _, it := range items {
+			res, err := writeResource(zw, &it)
+			if err != nil {
+				return err
+			}
+			m.Resources = append(m.Resources, res)
+			folder.Items = append(folder.Items, item{
+				Identifier:    "I_" + it.ID.Hex(),
+				IdentifierRef: res.Identifier,
+				Title:         it.Title,
+			})
+		}
+		root.Items = append(root.Items, folder)
+	}
+	m.Organizations = []organization{{
+		Identifier: "O_1",
+		Structure:  "rooted-hierarchy",
+		Items:      []item{root},
+	}}
+
+	if err := writeXML(zw, manifestFile, m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeResource(zw *zip.Writer, it *models.CourseItem) (resource, error) {
+	id := "R_" + it.ID.Hex()
+	dir := id + "/"
+
+	switch {
+	case it.Type == models.ItemTypeLink && it.URL != "":
+		href := dir + "weblink.xml"
+		doc := webLink{XMLNS: nsWebLink, Title: it.Title, URL: webLinkURL{Href: it.URL, Target: "_blank"}}
+		return resource{Identifier: id, Type: ResourceWebLink, Files: []file{{Href: href}}}, writeXML(zw, href, doc)
+
+	case it.Type == models.ItemTypeAssignment:
+		href := dir + "assignment.xml"
+		doc := assignment{
+			XMLNS:      nsAssignment,
+			Identifier: id,
+			Title:      it.Title,
+			Text:       text{TextType: "text/plain", Value: it.Title},
+			Gradable:   gradable{PointsPossible: it.MaxScore, Value: it.MaxScore > 0},
+		}
+		return resource{Identifier: id, Type: ResourceAssignment, Href: href, Files: []file{{Href: href}}}, writeXML(zw, href, doc)
+
+	case it.Type == models.ItemTypeQuiz:
+		href := dir + "assessment.xml"
+		doc := questestinterop{
+			XMLNS: nsQTI,
+			Assessment: qtiAssessment{
+				Ident: id,
+				Title: it.Title,
+				Metadata: []qtiField{
+					{Label: "cc_profile", Entry: "cc.exam.v0p1"},
+					{Label: "qmd_assessmenttype", Entry: "Examination"},
+				},
+				Outcomes: []qtiDecVar{{VarName: "SCORE", MaxValue: it.MaxScore}},
+				Section:  qtiSection{Ident: "S_" + it.ID.Hex()},
+			},
+		}
+		return resource{Identifier: id, Type: ResourceAssessment, Files: []file{{Href: href}}}, writeXML(zw, href, doc)
+
+	default:
+		href := dir + "page.html"
+		f, err := zw.Create(href)
+		if err != nil {
+			return resource{}, err
+		}
+		title := html.EscapeString(it.Title)
+		page := "<!doctype html>\n<html><head><meta charset=\"utf-8\"><title>" + title +
+			"</title></head><body><h1>" + title + "</h1></body></html>\n"
+		if _, err := io.WriteString(f, page); err != nil {
+			return resource{}, err
+		}
+		return resource{Identifier: id, Type: ResourceWebContent, Href: href, Files: []file{{Href: href}}}, nil
+	}
+}
+
+func writeXML(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
@@ -0,0 +1,203 @@
+package imscc
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"AP_Final/models"
+)
+
+const maxEntrySize = 8 << 20
+
+var ErrNoManifest = errors.New("imsmanifest.xml not found")
+
+// Course is the cartridge content translated into this system's vocabulary.
+type Course struct {
+	Title       string
+	Description string
+	Modules     []Module
+}
+
+type Module struct {
+	Title string
+	Items []Item
+}
+
+type Item struct {
+	Type     string
+	Title    string
+	URL      string
+	MaxScore float64
+}
+
+// Unsupported describes a resource that was skipped during import.
+type Unsupported struct {
+	Identifier string `json:"identifier"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+}
+
+type Result struct {
+	Course      Course
+	Unsupported []Unsupported
+}
+
+// Import reads a .imscc package. Top-level organization folders become
+// modules; resources placed directly under the root, or nested deeper than
+// one folder, are collected into the nearest module.
+func Import(r io.ReaderAt, size int64) (*Result, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[path.Clean(f.Name)] = f
+	}
+
+	mf, ok := files[manifestFile]
+	if !ok {
+		return nil, ErrNoManifest
+	}
+	var m manifest
+	if err := readXML(mf, &m); err != nil {
+		return nil, err
+	}
+
+	resources := map[string]*resource{}
+	for i := range m.Resources {
+		resources[m.Resources[i].Identifier] = &m.Resources[i]
+	}
+
+	res := &Result{
+		Course: Course{
+			Title:       strings.TrimSpace(m.Metadata.LOM.General.Title.Value),
+			Description: strings.TrimSpace(m.Metadata.LOM.General.Description.Value),
+		},
+		Unsupported: []Unsupported{},
+	}
+
+	var top []item
+	if len(m.Organizations) > 0 {
+		top = m.Organizations[0].Items
+		// rooted-hierarchy wraps everything in a single untitled root item.
+		if len(top) == 1 && top[0].IdentifierRef == "" && top[0].Title == "" {
+			top = top[0].Items
+		}
+	}
+
+	loose := Module{Title: "General"}
+	for _, it := range top {
+		if it.IdentifierRef != "" {
+			loose.Items = append(loose.Items, convertItems(files, resources, it, res)...)
+			continue
+		}
+		mod := Module{Title: strings.TrimSpace(it.Title)}
+		if mod.Title == "" {
+			mod.Title = "Module"
+		}
+		for _, child := range it.Items {
+			mod.Items = append(mod.Items, convertItems(files, resources, child, res)...)
+		}
+		res.Course.Modules = append(res.Course.Modules, mod)
+	}
+	if len(loose.Items) > 0 {
+		res.Course.Modules = append([]Module{loose}, res.Course.Modules...)
+	}
+
+	if res.Course.Title == "" {
+		res.Course.Title = "Imported course"
+	}
+	return res, nil
+}
+
+func convertItems(files map[string]*zip.File, resources map[string]*resource, it item, res *Result) []Item {
+	if it.IdentifierRef == "" {
+		var out []Item
+		for _, child := range it.Items {
+			out = append(out, convertItems(files, resources, child, res)...)
+		}
+		return out
+	}
+
+	title := strings.TrimSpace(it.Title)
+	r, ok := resources[it.IdentifierRef]
+	if !ok {
+		res.Unsupported = append(res.Unsupported, Unsupported{Identifier: it.IdentifierRef, Type: "missing", Title: title})
+		return nil
+	}
+
+	out := Item{Title: title}
+	main := files[path.Clean(r.mainFile())]
+
+	switch {
+	case strings.HasPrefix(r.Type, "imswl_xmlv1p"):
+		var doc webLink
+		if main == nil || readXML(main, &doc) != nil || !validLinkURL(doc.URL.Href) {
+			res.Unsupported = append(res.Unsupported, Unsupported{Identifier: r.Identifier, Type: r.Type, Title: title})
+			return nil
+		}
+		out.Type = models.ItemTypeLink
+		out.URL = doc.URL.Href
+		if out.Title == "" {
+			out.Title = doc.Title
+		}
+
+	case r.Type == ResourceAssignment:
+		var doc assignment
+		if main != nil && readXML(main, &doc) == nil {
+			out.MaxScore = doc.Gradable.PointsPossible
+			if out.Title == "" {
+				out.Title = doc.Title
+			}
+		}
+		out.Type = models.ItemTypeAssignment
+
+	case strings.HasPrefix(r.Type, "imsqti_xmlv1p2/") && strings.HasSuffix(r.Type, "/assessment"):
+		var doc questestinterop
+		if main != nil && readXML(main, &doc) == nil {
+			for _, v := range doc.Assessment.Outcomes {
+				if v.MaxValue > out.MaxScore {
+					out.MaxScore = v.MaxValue
+				}
+			}
+			if out.Title == "" {
+				out.Title = doc.Assessment.Title
+			}
+		}
+		out.Type = models.ItemTypeQuiz
+
+	case r.Type == ResourceWebContent:
+		out.Type = models.ItemTypePage
+
+	default:
+		res.Unsupported = append(res.Unsupported, Unsupported{Identifier: r.Identifier, Type: r.Type, Title: title})
+		return nil
+	}
+
+	if out.Title == "" {
+		out.Title = r.Identifier
+	}
+	return []Item{out}
+}
+
+// validLinkURL accepts the URLs link items may hold: absolute http(s).
+func validLinkURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func readXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, maxEntrySize)).Decode(v)
+}
@@ -0,0 +1,218 @@
+package imscc
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"AP_Final/models"
+)
+
+func importFile(t *testing.T, name string) *Result {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Import(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("import %s: %v", name, err)
+	}
+	return res
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportSample(t *testing.T) {
+	res := importFile(t, "testdata/sample.imscc")
+
+	if res.Course.Title != "Intro to Go" {
+		t.Errorf("title = %q", res.Course.Title)
+	}
+	if res.Course.Description != "Sample cartridge exported from another LMS." {
+		t.Errorf("description = %q", res.Course.Description)
+	}
+
+	want := []Module{
+		{Title: "General", Items: []Item{
+			{Type: models.ItemTypePage, Title: "Syllabus"},
+		}},
+		{Title: "Week 1: Basics", Items: []Item{
+			{Type: models.ItemTypeLink, Title: "A Tour of Go", URL: "https://go.dev/tour/"},
+			{Type: models.ItemTypeAssignment, Title: "Homework 1", MaxScore: 20},
+			{Type: models.ItemTypeQuiz, Title: "Quiz 1", MaxScore: 10},
+		}},
+		// The nested "Reading" folder is flattened into its module.
+		{Title: "Week 2: Concurrency", Items: []Item{
+			{Type: models.ItemTypeLink, Title: "Go Concurrency Patterns", URL: "https://go.dev/blog/pipelines"},
+		}},
+	}
+	if !reflect.DeepEqual(res.Course.Modules, want) {
+		t.Errorf("modules =\n%+v\nwant\n%+v", res.Course.Modules, want)
+	}
+
+	wantSkipped := []Unsupported{
+		{Identifier: "r_forum", Type: "imsdt_xmlv1p3", Title: "Discussion: goroutines"},
+		{Identifier: "r_tool", Type: "imsbasiclti_xmlv1p3", Title: "External playground"},
+	}
+	if !reflect.DeepEqual(res.Unsupported, wantSkipped) {
+		t.Errorf("unsupported = %+v, want %+v", res.Unsupported, wantSkipped)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	course := &models.Course{
+		ID:          primitive.NewObjectID(),
+		Title:       "Round trip",
+		Description: "Exported & imported",
+		Modules: []models.CourseModule{
+			{ID: primitive.NewObjectID(), Title: "Second", Order: 2, Items: []models.CourseItem{
+				{ID: primitive.NewObjectID(), Type: models.ItemTypeQuiz, Title: "Final quiz", MaxScore: 15},
+			}},
+			{ID: primitive.NewObjectID(), Title: "First", Order: 1, Items: []models.CourseItem{
+				{ID: primitive.NewObjectID(), Type: models.ItemTypeAssignment, Title: "Essay", MaxScore: 50, Order: 2},
+				{ID: primitive.NewObjectID(), Type: models.ItemTypeLink, Title: "Docs", URL: "https://example.com/docs?a=1&b=2", Order: 1},
+				{ID: primitive.NewObjectID(), Type: models.ItemTypePage, Title: "Intro <notes>", Order: 3},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(course, &buf); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Import(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Course.Title != course.Title || res.Course.Description != course.Description {
+		t.Errorf("course = %q / %q", res.Course.Title, res.Course.Description)
+	}
+	want := []Module{
+		{Title: "First", Items: []Item{
+			{Type: models.ItemTypeLink, Title: "Docs", URL: "https://example.com/docs?a=1&b=2"},
+			{Type: models.ItemTypeAssignment, Title: "Essay", MaxScore: 50},
+			{Type: models.ItemTypePage, Title: "Intro <notes>"},
+		}},
+		{Title: "Second", Items: []Item{
+			{Type: models.ItemTypeQuiz, Title: "Final quiz", MaxScore: 15},
+		}},
+	}
+	if !reflect.DeepEqual(res.Course.Modules, want) {
+		t.Errorf("modules =\n%+v\nwant\n%+v", res.Course.Modules, want)
+	}
+	if len(res.Unsupported) != 0 {
+		t.Errorf("unsupported = %+v", res.Unsupported)
+	}
+}
+
+func TestImportMalformed(t *testing.T) {
+	t.Run("not a zip", func(t *testing.T) {
+		data := []byte("plain text")
+		if _, err := Import(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("no manifest", func(t *testing.T) {
+		data := zipOf(t, map[string]string{"page.html": "<html></html>"})
+		if _, err := Import(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNoManifest) {
+			t.Errorf("err = %v, want ErrNoManifest", err)
+		}
+	})
+
+	t.Run("broken manifest xml", func(t *testing.T) {
+		data := zipOf(t, map[string]string{manifestFile: `<manifest identifier="x"><organizations><organization>`})
+		if _, err := Import(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("invalid web link url", func(t *testing.T) {
+		link := func(href string) string {
+			return `<webLink xmlns="http://www.imsglobal.org/xsd/imsccv1p3/imswl_v1p3"><title>L</title><url href="` + href + `"/></webLink>`
+		}
+		data := zipOf(t, map[string]string{
+			manifestFile: `<manifest identifier="x">
+  <organizations><organization identifier="o"><item identifier="root">
+    <item identifier="m"><title>Week</title>
+      <item identifier="i1" identifierref="r_ok"><title>Good</title></item>
+      <item identifier="i2" identifierref="r_js"><title>Script</title></item>
+      <item identifier="i3" identifierref="r_rel"><title>Relative</title></item>
+    </item>
+  </item></organization></organizations>
+  <resources>
+    <resource identifier="r_ok" type="imswl_xmlv1p3"><file href="ok.xml"/></resource>
+    <resource identifier="r_js" type="imswl_xmlv1p3"><file href="js.xml"/></resource>
+    <resource identifier="r_rel" type="imswl_xmlv1p3"><file href="rel.xml"/></resource>
+  </resources>
+</manifest>`,
+			"ok.xml":  link("https://example.com/"),
+			"js.xml":  link("javascript:alert(1)"),
+			"rel.xml": link("/docs/page.html"),
+		})
+		res, err := Import(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Module{{Title: "Week", Items: []Item{{Type: models.ItemTypeLink, Title: "Good", URL: "https://example.com/"}}}}
+		if !reflect.DeepEqual(res.Course.Modules, want) {
+			t.Errorf("modules = %+v, want %+v", res.Course.Modules, want)
+		}
+		wantSkipped := []Unsupported{
+			{Identifier: "r_js", Type: "imswl_xmlv1p3", Title: "Script"},
+			{Identifier: "r_rel", Type: "imswl_xmlv1p3", Title: "Relative"},
+		}
+		if !reflect.DeepEqual(res.Unsupported, wantSkipped) {
+			t.Errorf("unsupported = %+v, want %+v", res.Unsupported, wantSkipped)
+		}
+	})
+
+	t.Run("dangling resource reference", func(t *testing.T) {
+		data := zipOf(t, map[string]string{manifestFile: `<manifest identifier="x">
+  <organizations><organization identifier="o"><item identifier="root">
+    <item identifier="m"><title>Week</title>
+      <item identifier="i" identifierref="missing"><title>Lost</title></item>
+    </item>
+  </item></organization></organizations>
+  <resources/>
+</manifest>`})
+		res, err := Import(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Course.Title != "Imported course" {
+			t.Errorf("title = %q", res.Course.Title)
+		}
+		if len(res.Course.Modules) != 1 || len(res.Course.Modules[0].Items) != 0 {
+			t.Errorf("modules = %+v", res.Course.Modules)
+		}
+		want := []Unsupported{{Identifier: "missing", Type: "missing", Title: "Lost"}}
+		if !reflect.DeepEqual(res.Unsupported, want) {
+			t.Errorf("unsupported = %+v, want %+v", res.Unsupported, want)
+		}
+	})
+}
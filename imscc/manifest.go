@@ -0,0 +1,144 @@
+// Package imscc reads and writes IMS Common Cartridge 1.3 packages.
+package imscc
+
+import "encoding/xml"
+
+const (
+	manifestFile = "imsmanifest.xml"
+
+	nsManifest   = "http://www.imsglobal.org/xsd/imsccv1p3/imscp_v1p1"
+	nsLOM        = "http://ltsc.ieee.org/xsd/imsccv1p3/LOM/manifest"
+	nsWebLink    = "http://www.imsglobal.org/xsd/imsccv1p3/imswl_v1p3"
+	nsAssignment = "http://www.imsglobal.org/xsd/imscc_extensions/assignment"
+	nsQTI        = "http://www.imsglobal.org/xsd/ims_qtiasiv1p2"
+
+	ResourceWebLink    = "imswl_xmlv1p3"
+	ResourceAssignment = "assignment_xmlv1p0"
+	ResourceAssessment = "imsqti_xmlv1p2/imscc_xmlv1p3/assessment"
+	ResourceWebContent = "webcontent"
+)
+
+// The same structs are used for reading and writing. Elements are matched by
+// local name on read, so cartridges using prefixed namespaces still parse.
+
+type manifest struct {
+	XMLName       xml.Name         `xml:"manifest"`
+	XMLNS         string           `xml:"xmlns,attr,omitempty"`
+	Identifier    string           `xml:"identifier,attr"`
+	Metadata      manifestMetadata `xml:"metadata"`
+	Organizations []organization   `xml:"organizations>organization"`
+	Resources     []resource       `xml:"resources>resource"`
+}
+
+type manifestMetadata struct {
+	Schema        string `xml:"schema"`
+	SchemaVersion string `xml:"schemaversion"`
+	LOM           lom    `xml:"lom"`
+}
+
+type lom struct {
+	XMLNS   string     `xml:"xmlns,attr,omitempty"`
+	General lomGeneral `xml:"general"`
+}
+
+type lomGeneral struct {
+	Title       lomString `xml:"title"`
+	Description lomString `xml:"description"`
+}
+
+type lomString struct {
+	Value string `xml:"string"`
+}
+
+type organization struct {
+	Identifier string `xml:"identifier,attr"`
+	Structure  string `xml:"structure,attr"`
+	Items      []item `xml:"item"`
+}
+
+type item struct {
+	Identifier    string `xml:"identifier,attr"`
+	IdentifierRef string `xml:"identifierref,attr,omitempty"`
+	Title         string `xml:"title,omitempty"`
+	Items         []item `xml:"item"`
+}
+
+type resource struct {
+	Identifier string `xml:"identifier,attr"`
+	Type       string `xml:"type,attr"`
+	Href       string `xml:"href,attr,omitempty"`
+	Files      []file `xml:"file"`
+}
+
+type file struct {
+	Href string `xml:"href,attr"`
+}
+
+func (r *resource) mainFile() string {
+	if r.Href != "" {
+		return r.Href
+	}
+	if len(r.Files) > 0 {
+		return r.Files[0].Href
+	}
+	return ""
+}
+
+type webLink struct {
+	XMLName xml.Name   `xml:"webLink"`
+	XMLNS   string     `xml:"xmlns,attr,omitempty"`
+	Title   string     `xml:"title"`
+	URL     webLinkURL `xml:"url"`
+}
+
+type webLinkURL struct {
+	Href   string `xml:"href,attr"`
+	Target string `xml:"target,attr,omitempty"`
+}
+
+type assignment struct {
+	XMLName    xml.Name `xml:"assignment"`
+	XMLNS      string   `xml:"xmlns,attr,omitempty"`
+	Identifier string   `xml:"identifier,attr"`
+	Title      string   `xml:"title"`
+	Text       text     `xml:"text"`
+	Gradable   gradable `xml:"gradable"`
+}
+
+type text struct {
+	TextType string `xml:"texttype,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type gradable struct {
+	PointsPossible float64 `xml:"points_possible,attr,omitempty"`
+	Value          bool    `xml:",chardata"`
+}
+
+type questestinterop struct {
+	XMLName    xml.Name      `xml:"questestinterop"`
+	XMLNS      string        `xml:"xmlns,attr,omitempty"`
+	Assessment qtiAssessment `xml:"assessment"`
+}
+
+type qtiAssessment struct {
+	Ident    string      `xml:"ident,attr"`
+	Title    string      `xml:"title,attr"`
+	Metadata []qtiField  `xml:"qtimetadata>qtimetadatafield"`
+	Outcomes []qtiDecVar `xml:"outcomes_processing>outcomes>decvar"`
+	Section  qtiSection  `xml:"section"`
+}
+
+type qtiField struct {
+	Label string `xml:"fieldlabel"`
+	Entry string `xml:"fieldentry"`
+}
+
+type qtiDecVar struct {
+	VarName  string  `xml:"varname,attr,omitempty"`
+	MaxValue float64 `xml:"maxvalue,attr,omitempty"`
+}
+
+type qtiSection struct {
+	Ident string `xml:"ident,attr"`
+}
@@ -0,0 +1,182 @@
+package lti
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Score is an AGS score publish payload.
+type Score struct {
+	UserID           string   `json:"userId"`
+	ScoreGiven       *float64 `json:"scoreGiven,omitempty"`
+	ScoreMaximum     float64  `json:"scoreMaximum,omitempty"`
+	Comment          string   `json:"comment,omitempty"`
+	ActivityProgress string   `json:"activityProgress"`
+	GradingProgress  string   `json:"gradingProgress"`
+	Timestamp        string   `json:"timestamp"`
+}
+
+const (
+	ActivityInitialized = "Initialized"
+	ActivityStarted     = "Started"
+	ActivityInProgress  = "InProgress"
+	ActivitySubmitted   = "Submitted"
+	ActivityCompleted   = "Completed"
+
+	GradingFullyGraded = "FullyGraded"
+	GradingPending     = "Pending"
+	GradingNotReady    = "NotReady"
+)
+
+// ScoresURL appends /scores to the line item path, keeping any query string.
+func ScoresURL(lineItem string) (string, error) {
+	u, err := url.Parse(lineItem)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/scores"
+	return u.String(), nil
+}
+
+// ClientAssertion builds the signed JWT a tool presents to a platform's
+// token endpoint (client_credentials grant, RFC 7523).
+func ClientAssertion(key *rsa.PrivateKey, kid, clientID, tokenURL string, now time.Time) (string, error) {
+	jti := make([]byte, 16)
+	_, _ = rand.Read(jti)
+	return Sign(map[string]interface{}{
+		"iss": clientID,
+		"sub": clientID,
+		"aud": tokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": hex.EncodeToString(jti),
+	}, key, kid)
+}
+
+// GradeClient obtains platform access tokens and publishes scores. Tokens
+// are cached per token URL, client and scope until shortly before expiry.
+type GradeClient struct {
+	Key    *rsa.PrivateKey
+	KeyID  string
+	Client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]accessToken
+}
+
+type accessToken struct {
+	value   string
+	expires time.Time
+}
+
+func NewGradeClient(key *rsa.PrivateKey) *GradeClient {
+	return &GradeClient{
+		Key:    key,
+		KeyID:  KeyID(&key.PublicKey),
+		Client: &http.Client{Timeout: 15 * time.Second},
+		tokens: map[string]accessToken{},
+	}
+}
+
+func (c *GradeClient) AccessToken(ctx context.Context, tokenURL, clientID, scope string) (string, error) {
+	cacheKey := tokenURL + " " + clientID + " " + scope
+
+	c.mu.Lock()
+	tok, ok := c.tokens[cacheKey]
+	c.mu.Unlock()
+	if ok && time.Now().Before(tok.expires) {
+		return tok.value, nil
+	}
+
+	assertion, err := ClientAssertion(c.Key, c.KeyID, clientID, tokenURL, time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {ClientAssertionType},
+		"client_assertion":      {assertion},
+		"scope":                 {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("token response without access_token")
+	}
+	if body.ExpiresIn <= 0 {
+		body.ExpiresIn = 3600
+	}
+
+	c.mu.Lock()
+	c.tokens[cacheKey] = accessToken{
+		value:   body.AccessToken,
+		expires: time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute),
+	}
+	c.mu.Unlock()
+	return body.AccessToken, nil
+}
+
+func (c *GradeClient) PublishScore(ctx context.Context, tokenURL, clientID, lineItem string, score Score) error {
+	target, err := ScoresURL(lineItem)
+	if err != nil {
+		return err
+	}
+	token, err := c.AccessToken(ctx, tokenURL, clientID, ScopeScore)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ScoreMediaType)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("publishing score: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package lti
+
+import "strings"
+
+const (
+	Version = "1.3.0"
+
+	ClaimMessageType      = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	ClaimVersion          = "https://purl.imsglobal.org/spec/lti/claim/version"
+	ClaimDeploymentID     = "https://purl.imsglobal.org/spec/lti/claim/deployment_id"
+	ClaimTargetLinkURI    = "https://purl.imsglobal.org/spec/lti/claim/target_link_uri"
+	ClaimResourceLink     = "https://purl.imsglobal.org/spec/lti/claim/resource_link"
+	ClaimRoles            = "https://purl.imsglobal.org/spec/lti/claim/roles"
+	ClaimContext          = "https://purl.imsglobal.org/spec/lti/claim/context"
+	ClaimCustom           = "https://purl.imsglobal.org/spec/lti/claim/custom"
+	ClaimDeepLinkSettings = "https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"
+	ClaimContentItems     = "https://purl.imsglobal.org/spec/lti-dl/claim/content_items"
+	ClaimDeepLinkData     = "https://purl.imsglobal.org/spec/lti-dl/claim/data"
+	ClaimAGSEndpoint      = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+
+	MessageResourceLink        = "LtiResourceLinkRequest"
+	MessageDeepLinkingRequest  = "LtiDeepLinkingRequest"
+	MessageDeepLinkingResponse = "LtiDeepLinkingResponse"
+
+	ScopeScore            = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+	ScopeLineItemReadOnly = "https://purl.imsglobal.org/spec/lti-ags/scope/lineitem.readonly"
+
+	RoleInstructor    = "http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor"
+	RoleLearner       = "http://purl.imsglobal.org/vocab/lis/v2/membership#Learner"
+	RoleAdministrator = "http://purl.imsglobal.org/vocab/lis/v2/institution/person#Administrator"
+
+	ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	ScoreMediaType    = "application/vnd.ims.lis.v1.score+json"
+	LineItemMediaType = "application/vnd.ims.lis.v2.lineitem+json"
+)
+
+// HasRole matches a role by its full URI or by its short name, e.g.
+// "Instructor", which some platforms still send.
+func HasRole(roles []string, role string) bool {
+	short := role
+	if i := strings.LastIndexAny(role, "#/"); i >= 0 {
+		short = role[i+1:]
+	}
+	for _, r := range roles {
+		if r == role || r == short {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package lti
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found in key set")
+
+// JWK is the RSA subset of RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func PublicJWK(pub *rsa.PublicKey, kid string) JWK {
+	return JWK{
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// Key returns the RSA key with the given id. A set with a single key also
+// matches tokens that carry no kid.
+func (s JWKS) Key(kid string) (*rsa.PublicKey, error) {
+	for _, k := range s.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		if k.Kid == kid || (kid == "" && len(s.Keys) == 1) {
+			return k.publicKey()
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (k JWK) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid jwk exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// KeyID derives a stable key id from the public modulus.
+func KeyID(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(pub.N.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// LoadOrCreateKey reads a PEM-encoded PKCS#8 RSA key, generating and saving
+// a new 2048-bit key if the file does not exist yet.
+func LoadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM block in " + path)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("key in " + path + " is not RSA")
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeySetCache fetches remote JWK sets and keeps them for TTL. An unknown kid
+// forces one refetch so key rotation on the other side is picked up.
+type KeySetCache struct {
+	TTL    time.Duration
+	Client *http.Client
+
+	mu   sync.Mutex
+	sets map[string]cachedKeySet
+}
+
+type cachedKeySet struct {
+	set       JWKS
+	fetchedAt time.Time
+}
+
+func NewKeySetCache(ttl time.Duration) *KeySetCache {
+	return &KeySetCache{
+		TTL:    ttl,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		sets:   map[string]cachedKeySet{},
+	}
+}
+
+func (c *KeySetCache) Key(ctx context.Context, url, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	cached, ok := c.sets[url]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < c.TTL {
+		if key, err := cached.set.Key(kid); err == nil {
+			return key, nil
+		}
+	}
+
+	set, err := c.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.sets[url] = cachedKeySet{set: set, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return set.Key(kid)
+}
+
+func (c *KeySetCache) fetch(ctx context.Context, url string) (JWKS, error) {
+	var set JWKS
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return set, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return set, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return set, fmt.Errorf("fetching key set: %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return set, fmt.Errorf("decoding key set: %w", err)
+	}
+	return set, nil
+}
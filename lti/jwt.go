@@ -0,0 +1,174 @@
+// Package lti implements the protocol pieces of LTI 1.3 used by both the tool
+// and the platform side: RS256 JSON Web Tokens, JWK sets, the claim
+// vocabulary and an Assignment and Grade Services client.
+package lti
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Leeway tolerates clock skew between platform and tool.
+const Leeway = time.Minute
+
+var (
+	ErrMalformed      = errors.New("malformed token")
+	ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+	ErrSignature      = errors.New("invalid token signature")
+	ErrExpired        = errors.New("token expired")
+	ErrNotYetValid    = errors.New("token not yet valid")
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Claims is a decoded JWT payload.
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func (c Claims) Object(name string) Claims {
+	m, _ := c[name].(map[string]interface{})
+	return Claims(m)
+}
+
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// HasAudience reports whether aud is, or contains, the given value.
+func (c Claims) HasAudience(aud string) bool {
+	for _, a := range c.Strings("aud") {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign encodes claims as a compact RS256 JWT.
+func Sign(claims interface{}, key *rsa.PrivateKey, kid string) (string, error) {
+	header, err := json.Marshal(Header{Alg: "RS256", Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(sig), nil
+}
+
+// ParseUnverified decodes a token without checking its signature, so the
+// caller can pick the verification key from the issuer and key id.
+func ParseUnverified(token string) (Header, Claims, error) {
+	var header Header
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, nil, ErrMalformed
+	}
+
+	raw, err := decodeSegment(parts[0])
+	if err != nil || json.Unmarshal(raw, &header) != nil {
+		return header, nil, ErrMalformed
+	}
+
+	raw, err = decodeSegment(parts[1])
+	if err != nil {
+		return header, nil, ErrMalformed
+	}
+	claims := Claims{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return header, nil, ErrMalformed
+	}
+	return header, claims, nil
+}
+
+// Verify checks the RS256 signature and the exp/nbf/iat claims.
+func Verify(token string, key *rsa.PublicKey, now time.Time) (Claims, error) {
+	header, claims, err := ParseUnverified(token)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, ErrUnsupportedAlg
+	}
+
+	i := strings.LastIndexByte(token, '.')
+	sig, err := decodeSegment(token[i+1:])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	digest := sha256.Sum256([]byte(token[:i]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+		return nil, ErrSignature
+	}
+
+	exp, ok := claims.Time("exp")
+	if !ok || now.After(exp.Add(Leeway)) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(Leeway).Before(nbf) {
+		return nil, ErrNotYetValid
+	}
+	if iat, ok := claims.Time("iat"); ok && now.Add(Leeway).Before(iat) {
+		return nil, ErrNotYetValid
+	}
+	return claims, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
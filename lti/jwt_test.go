@@ -0,0 +1,76 @@
+package lti
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	key := testKey(t)
+	other := testKey(t)
+	now := time.Now()
+
+	sign := func(claims map[string]interface{}, key *rsa.PrivateKey) string {
+		t.Helper()
+		token, err := Sign(claims, key, KeyID(&key.PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := map[string]interface{}{"iss": "platform", "sub": "u1", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+
+	claims, err := Verify(sign(valid, key), &key.PublicKey, now)
+	if err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	if claims.String("iss") != "platform" || claims.String("sub") != "u1" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// Forged tokens reuse the parts of a validly signed one.
+	parts := strings.Split(sign(valid, key), ".")
+	tampered := encodeSegment([]byte(`{"iss":"platform","sub":"admin","exp":` + strconv.FormatInt(now.Add(time.Minute).Unix(), 10) + `}`))
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"bad signature", sign(valid, other), ErrSignature},
+		{"tampered payload", parts[0] + "." + tampered + "." + parts[2], ErrSignature},
+		{"expired", sign(map[string]interface{}{"exp": now.Add(-2 * Leeway).Unix()}, key), ErrExpired},
+		{"no exp", sign(map[string]interface{}{"iss": "platform"}, key), ErrExpired},
+		{"not yet valid", sign(map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(2 * Leeway).Unix()}, key), ErrNotYetValid},
+		{"issued in the future", sign(map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "iat": now.Add(2 * Leeway).Unix()}, key), ErrNotYetValid},
+		{"alg none", encodeSegment([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", ErrUnsupportedAlg},
+		{"alg HS256", encodeSegment([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + parts[1] + "." + parts[2], ErrUnsupportedAlg},
+		{"malformed", "not-a-jwt", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.token, &key.PublicKey, now); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Clock skew within Leeway is tolerated.
+	skewed := sign(map[string]interface{}{"exp": now.Add(-Leeway / 2).Unix()}, key)
+	if _, err := Verify(skewed, &key.PublicKey, now); err != nil {
+		t.Errorf("token within leeway: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+// Package ltitest provides a minimal LTI 1.3 reference platform. It launches
+// courses via OIDC login initiation, runs deep linking and accepts AGS
+// scores, so the tool side can be exercised without a real LMS, both by
+// cmd/ltilauncher and by tests.
+package ltitest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"AP_Final/lti"
+)
+
+const (
+	ClientID     = "reference-client"
+	DeploymentID = "1"
+)
+
+var page = template.Must(template.New("page").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>LTI reference launcher</title></head>
+<body>
+<h1>LTI reference launcher</h1>
+<p>Tool: {{.Tool}}</p>
+<ul>
+<li><a href="/launch?message=resource&role=Learner">Launch course as learner</a></li>
+<li><a href="/launch?message=resource&role=Instructor">Launch course as instructor</a></li>
+<li><a href="/launch?message=deeplink&role=Instructor">Deep linking (select content)</a></li>
+</ul>
+</body></html>`))
+
+var autoPost = template.Must(template.New("post").Parse(`<!doctype html>
+<html><body><form id="f" method="post" action="{{.Action}}">
+{{range $k, $v := .Fields}}<input type="hidden" name="{{$k}}" value="{{$v}}">{{end}}
+</form><script>document.getElementById("f").submit()</script></body></html>`))
+
+// Launcher is the reference platform. Base may be set after construction,
+// e.g. once an httptest server knows its URL; it is read per request.
+type Launcher struct {
+	Base     string
+	Tool     string
+	CourseID string
+	ItemID   string
+	User     string
+
+	Key   *rsa.PrivateKey
+	KeyID string
+
+	// Logf, if set, receives a line for every token, score and deep linking
+	// response the launcher handles.
+	Logf func(format string, args ...interface{})
+
+	keys   *lti.KeySetCache
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	scores []lti.Score
+}
+
+func New(base, tool string, key *rsa.PrivateKey) *Launcher {
+	return &Launcher{
+		Base:   base,
+		Tool:   strings.TrimRight(tool, "/"),
+		User:   "learner-1",
+		Key:    key,
+		KeyID:  lti.KeyID(&key.PublicKey),
+		keys:   lti.NewKeySetCache(time.Minute),
+		tokens: map[string]time.Time{},
+	}
+}
+
+// Registration is the body to register the launcher with the tool's
+// POST /lti/platforms.
+func (l *Launcher) Registration() map[string]interface{} {
+	return map[string]interface{}{
+		"name":          "Reference launcher",
+		"issuer":        l.Base,
+		"clientId":      ClientID,
+		"deploymentIds": []string{DeploymentID},
+		"authLoginUrl":  l.Base + "/auth",
+		"authTokenUrl":  l.Base + "/token",
+		"jwksUrl":       l.Base + "/jwks",
+	}
+}
+
+func (l *Launcher) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", l.index)
+	mux.HandleFunc("GET /jwks", l.jwks)
+	mux.HandleFunc("GET /launch", l.launch)
+	mux.HandleFunc("GET /auth", l.auth)
+	mux.HandleFunc("POST /auth", l.auth)
+	mux.HandleFunc("POST /token", l.token)
+	mux.HandleFunc("POST /lineitem/scores", l.score)
+	mux.HandleFunc("POST /deeplink/return", l.deepLinkReturn)
+	return mux
+}
+
+// Scores returns the scores published to the launcher's line item so far.
+func (l *Launcher) Scores() []lti.Score {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]lti.Score(nil), l.scores...)
+}
+
+func (l *Launcher) logf(format string, args ...interface{}) {
+	if l.Logf != nil {
+		l.Logf(format, args...)
+	}
+}
+
+func (l *Launcher) index(w http.ResponseWriter, r *http.Request) {
+	_ = page.Execute(w, map[string]string{"Tool": l.Tool})
+}
+
+func (l *Launcher) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lti.JWKS{Keys: []lti.JWK{lti.PublicJWK(&l.Key.PublicKey, l.KeyID)}})
+}
+
+// launch performs OIDC third-party login initiation against the tool. The
+// message hint carries the message type and role through the round trip.
+func (l *Launcher) launch(w http.ResponseWriter, r *http.Request) {
+	target := l.Tool + "/courses/" + l.CourseID
+	if l.ItemID != "" {
+		target += "/items/" + l.ItemID
+	}
+	q := url.Values{
+		"iss":               {l.Base},
+		"login_hint":        {l.User},
+		"target_link_uri":   {target},
+		"lti_message_hint":  {r.URL.Query().Get("message") + ":" + r.URL.Query().Get("role")},
+		"client_id":         {ClientID},
+		"lti_deployment_id": {DeploymentID},
+	}
+	http.Redirect(w, r, l.Tool+"/lti/login?"+q.Encode(), http.StatusFound)
+}
+
+// auth is the platform authorization endpoint: it answers the tool's
+// authentication request with a signed id_token.
+func (l *Launcher) auth(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	if r.Form.Get("client_id") != ClientID || r.Form.Get("login_hint") != l.User {
+		http.Error(w, "unexpected client_id or login_hint", http.StatusBadRequest)
+		return
+	}
+	message, role, _ := strings.Cut(r.Form.Get("lti_message_hint"), ":")
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                  l.Base,
+		"aud":                  ClientID,
+		"sub":                  l.User,
+		"iat":                  now.Unix(),
+		"exp":                  now.Add(5 * time.Minute).Unix(),
+		"nonce":                r.Form.Get("nonce"),
+		lti.ClaimVersion:       lti.Version,
+		lti.ClaimDeploymentID:  DeploymentID,
+		lti.ClaimTargetLinkURI: l.Tool + "/courses/" + l.CourseID,
+		lti.ClaimRoles:         []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#" + role},
+	}
+	if message == "deeplink" {
+		claims[lti.ClaimMessageType] = lti.MessageDeepLinkingRequest
+		claims[lti.ClaimDeepLinkSettings] = map[string]interface{}{
+			"deep_link_return_url": l.Base + "/deeplink/return",
+			"accept_types":         []string{"ltiResourceLink"},
+			"data":                 "reference-data",
+		}
+	} else {
+		claims[lti.ClaimMessageType] = lti.MessageResourceLink
+		claims[lti.ClaimResourceLink] = map[string]string{"id": "resource-1"}
+		custom := map[string]string{"course_id": l.CourseID}
+		if l.ItemID != "" {
+			custom["item_id"] = l.ItemID
+		}
+		claims[lti.ClaimCustom] = custom
+		claims[lti.ClaimAGSEndpoint] = map[string]interface{}{
+			"scope":    []string{lti.ScopeScore},
+			"lineitem": l.Base + "/lineitem",
+		}
+	}
+
+	token, err := lti.Sign(claims, l.Key, l.KeyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = autoPost.Execute(w, map[string]interface{}{
+		"Action": r.Form.Get("redirect_uri"),
+		"Fields": map[string]string{"id_token": token, "state": r.Form.Get("state")},
+	})
+}
+
+func (l *Launcher) verifyFromTool(r *http.Request, token string) (lti.Claims, error) {
+	header, _, err := lti.ParseUnverified(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := l.keys.Key(r.Context(), l.Tool+"/lti/jwks", header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	return lti.Verify(token, key, time.Now())
+}
+
+func (l *Launcher) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	claims, err := l.verifyFromTool(r, r.PostForm.Get("client_assertion"))
+	if err != nil || claims.String("iss") != ClientID || !claims.HasAudience(l.Base+"/token") {
+		l.logf("token: rejected client assertion: %v", err)
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	l.mu.Lock()
+	l.tokens[token] = time.Now().Add(time.Hour)
+	l.mu.Unlock()
+
+	l.logf("token: issued for scope %q", r.PostForm.Get("scope"))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        r.PostForm.Get("scope"),
+	})
+}
+
+func (l *Launcher) score(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	l.mu.Lock()
+	expires, ok := l.tokens[token]
+	l.mu.Unlock()
+	if !ok || time.Now().After(expires) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var score lti.Score
+	if err := json.NewDecoder(r.Body).Decode(&score); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l.mu.Lock()
+	l.scores = append(l.scores, score)
+	l.mu.Unlock()
+
+	given := "-"
+	if score.ScoreGiven != nil {
+		given = fmt.Sprint(*score.ScoreGiven)
+	}
+	l.logf("score: user=%s given=%s max=%v activity=%s grading=%s", score.UserID, given, score.ScoreMaximum, score.ActivityProgress, score.GradingProgress)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (l *Launcher) deepLinkReturn(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	claims, err := l.verifyFromTool(r, r.PostForm.Get("JWT"))
+	if err != nil {
+		http.Error(w, "invalid deep linking response: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !claims.HasAudience(l.Base) || claims.String(lti.ClaimMessageType) != lti.MessageDeepLinkingResponse {
+		http.Error(w, "unexpected deep linking response", http.StatusBadRequest)
+		return
+	}
+
+	items, _ := json.MarshalIndent(claims[lti.ClaimContentItems], "", "  ")
+	l.logf("deep linking: data=%q items=%s", claims.String(lti.ClaimDeepLinkData), items)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Selected content:\n%s\n", items)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/joho/godotenv"
 
 	"AP_Final/db"
+	"AP_Final/handlers"
 	"AP_Final/routes"
 )
 
@@ -21,6 +22,11 @@ func main() {
 		mongoURI = "mongodb://localhost:27017" // дефолт, если .env пуст
 	}
 
+	// Ключ подписи курсоров, приглашений и кодов сертификатов
+	if err := handlers.LoadAppSecret(); err != nil {
+		log.Fatal(err)
+	}
+
 	db.Connect(mongoURI)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -28,6 +34,9 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Фоновые задачи: истечение и завершение записей на курсы
+	handlers.StartBackgroundJobs(context.Background())
+
 	// Инициализируем маршруты
 	routes.RegisterRoutes()
 
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ActivityEnrolled   = "enrolled"
+	ActivityItemViewed = "item_viewed"
+	ActivityProgress   = "progress"
+	ActivitySubmitted  = "submitted"
+	ActivityGraded     = "graded"
+)
+
+// Where a progress change came from.
+const (
+	ActivitySourceManual = "manual"
+	ActivitySourceScorm  = "scorm"
+	ActivitySourceXapi   = "xapi"
+	ActivitySourceLti    = "lti"
+	ActivitySourceStaff  = "staff"
+)
+
+// Activity is one event of a student's learning history. Progress events
+// keep the status before and after the change, since the progress document
+// itself is overwritten in place.
+type Activity struct {
+	ID         primitive.ObjectID  `bson:"_id" json:"id"`
+	UserID     primitive.ObjectID  `bson:"userId" json:"userId"`
+	CourseID   primitive.ObjectID  `bson:"courseId" json:"courseId"`
+	ItemID     *primitive.ObjectID `bson:"itemId,omitempty" json:"itemId,omitempty"`
+	Type       string              `bson:"type" json:"type"`
+	Source     string              `bson:"source,omitempty" json:"source,omitempty"`
+	FromStatus string              `bson:"fromStatus,omitempty" json:"fromStatus,omitempty"`
+	Status     string              `bson:"status,omitempty" json:"status,omitempty"`
+	Score      *float64            `bson:"score,omitempty" json:"score,omitempty"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Badge award criteria.
+const (
+	BadgeCriterionCompletion   = "completion"
+	BadgeCriterionPerfectScore = "perfect_score"
+	BadgeCriterionStreak       = "streak"
+)
+
+type BadgeCriteria struct {
+	Type string `bson:"type" json:"type"`
+	// ItemID limits perfect_score to one item; without it any quiz counts.
+	ItemID *primitive.ObjectID `bson:"itemId,omitempty" json:"itemId,omitempty"`
+	// Days is the streak length: days in a row with progress in the course.
+	Days int `bson:"days,omitempty" json:"days,omitempty"`
+}
+
+// BadgeClass is an achievement a course awards (an Open Badges BadgeClass).
+type BadgeClass struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	CourseID    primitive.ObjectID `bson:"courseId" json:"courseId"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	// Color is the "#rrggbb" colour of the generated badge image.
+	Color     string             `bson:"color" json:"color"`
+	Criteria  BadgeCriteria      `bson:"criteria" json:"criteria"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// BadgeAward is a badge earned by a student (an Open Badges Assertion).
+// Salt hashes the recipient identity in the published assertion.
+type BadgeAward struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	BadgeID   primitive.ObjectID `bson:"badgeId" json:"badgeId"`
+	CourseID  primitive.ObjectID `bson:"courseId" json:"courseId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Salt      string             `bson:"salt" json:"-"`
+	IssuedAt  time.Time          `bson:"issuedAt" json:"issuedAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	// RevocationReason is published with revoked assertions.
+	RevocationReason string `bson:"revocationReason,omitempty" json:"revocationReason,omitempty"`
+}
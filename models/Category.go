@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Category is a node of the course taxonomy. Courses reference it by Slug.
+// Ancestors lists the ids from the root down to the parent, so a subtree is
+// a single {ancestors: id} query.
+type Category struct {
+	ID        primitive.ObjectID   `bson:"_id" json:"id"`
+	Name      string               `bson:"name" json:"name"`
+	Slug      string               `bson:"slug" json:"slug"`
+	ParentID  *primitive.ObjectID  `bson:"parentId,omitempty" json:"parentId,omitempty"`
+	Ancestors []primitive.ObjectID `bson:"ancestors" json:"ancestors"`
+	Order     int                  `bson:"order" json:"order"`
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time            `bson:"updatedAt" json:"updatedAt"`
+}
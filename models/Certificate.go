@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CertificateTemplate is the per-course certificate design. Body may use
+// the {student}, {course}, {date} and {grade} placeholders.
+type CertificateTemplate struct {
+	Title       string `bson:"title,omitempty" json:"title,omitempty"`
+	Body        string `bson:"body,omitempty" json:"body,omitempty"`
+	Signer      string `bson:"signer,omitempty" json:"signer,omitempty"`
+	SignerTitle string `bson:"signerTitle,omitempty" json:"signerTitle,omitempty"`
+}
+
+// Certificate is issued once per course completion. Names and the
+// template are copied at issue time, so later edits leave it unchanged.
+type Certificate struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Code         string              `bson:"code" json:"code"`
+	UserID       primitive.ObjectID  `bson:"userId" json:"userId"`
+	CourseID     primitive.ObjectID  `bson:"courseId" json:"courseId"`
+	CompletionID primitive.ObjectID  `bson:"completionId" json:"completionId"`
+	StudentName  string              `bson:"studentName" json:"studentName"`
+	CourseTitle  string              `bson:"courseTitle" json:"courseTitle"`
+	Grade        *float64            `bson:"grade,omitempty" json:"grade,omitempty"`
+	Template     CertificateTemplate `bson:"template" json:"template"`
+	CompletedAt  time.Time           `bson:"completedAt" json:"completedAt"`
+	IssuedAt     time.Time           `bson:"issuedAt" json:"issuedAt"`
+}
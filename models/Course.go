@@ -6,19 +6,109 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	CourseStatusDraft     = "draft"
+	CourseStatusPublished = "published"
+	CourseStatusArchived  = "archived"
+)
+
+const (
+	EnrollmentMethodOpen     = "open"
+	EnrollmentMethodKey      = "key"
+	EnrollmentMethodApproval = "approval"
+	EnrollmentMethodInvite   = "invite"
+	EnrollmentMethodLTI      = "lti"
+	EnrollmentMethodManual   = "manual"
+)
+
+// Course staff roles. The owner is the course's TeacherID; everyone else
+// is listed in Course.Staff.
+const (
+	CourseRoleOwner     = "owner"
+	CourseRoleCoTeacher = "co_teacher"
+	CourseRoleTA        = "ta"
+	CourseRoleObserver  = "observer"
+)
+
+const (
+	ItemTypeLink       = "link"
+	ItemTypePage       = "page"
+	ItemTypeAssignment = "assignment"
+	ItemTypeQuiz       = "quiz"
+	ItemTypeScorm      = "scorm"
+	ItemTypeLti        = "lti"
+)
+
 type CourseItem struct {
-	ID       primitive.ObjectID `bson:"_id" json:"id"`
-	Type     string             `bson:"type" json:"type"`
-	Title    string             `bson:"title" json:"title"`
-	MaxScore float64            `bson:"maxScore" json:"maxScore"`
-	Order    int                `bson:"order" json:"order"`
+	ID             primitive.ObjectID   `bson:"_id" json:"id"`
+	Type           string               `bson:"type" json:"type"`
+	Title          string               `bson:"title" json:"title"`
+	MaxScore       float64              `bson:"maxScore" json:"maxScore"`
+	Order          int                  `bson:"order" json:"order"`
+	URL            string               `bson:"url,omitempty" json:"url,omitempty"`
+	PackageID      *primitive.ObjectID  `bson:"packageId,omitempty" json:"packageId,omitempty"`
+	ActivityID     string               `bson:"activityId,omitempty" json:"activityId,omitempty"`
+	ToolID         *primitive.ObjectID  `bson:"toolId,omitempty" json:"toolId,omitempty"`
+	Prerequisites  []primitive.ObjectID `bson:"prerequisites,omitempty" json:"prerequisites,omitempty"`
+	GroupIDs       []primitive.ObjectID `bson:"groupIds,omitempty" json:"groupIds,omitempty"`
+	AvailableFrom  *time.Time           `bson:"availableFrom,omitempty" json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time           `bson:"availableUntil,omitempty" json:"availableUntil,omitempty"`
+	Locked         bool                 `bson:"-" json:"locked,omitempty"`
+	// Optional items do not count towards completion. PassScore is the
+	// score a done item needs to count as passed (0 = done is enough).
+	Optional  bool    `bson:"optional,omitempty" json:"optional,omitempty"`
+	PassScore float64 `bson:"passScore,omitempty" json:"passScore,omitempty"`
 }
 
 type CourseModule struct {
-	ID    primitive.ObjectID `bson:"_id" json:"id"`
-	Title string             `bson:"title" json:"title"`
-	Order int                `bson:"order" json:"order"`
-	Items []CourseItem       `bson:"items,omitempty" json:"items,omitempty"`
+	ID             primitive.ObjectID   `bson:"_id" json:"id"`
+	Title          string               `bson:"title" json:"title"`
+	Order          int                  `bson:"order" json:"order"`
+	Items          []CourseItem         `bson:"items,omitempty" json:"items,omitempty"`
+	GroupIDs       []primitive.ObjectID `bson:"groupIds,omitempty" json:"groupIds,omitempty"`
+	AvailableFrom  *time.Time           `bson:"availableFrom,omitempty" json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time           `bson:"availableUntil,omitempty" json:"availableUntil,omitempty"`
+	Locked         bool                 `bson:"-" json:"locked,omitempty"`
+}
+
+// CoursePrerequisite requires a completion rate (done required items /
+// required items, as in /me/progress) of at least MinCompletion in another
+// course.
+type CoursePrerequisite struct {
+	CourseID      primitive.ObjectID `bson:"courseId" json:"courseId"`
+	MinCompletion float64            `bson:"minCompletion" json:"minCompletion"`
+}
+
+// CompletionRules decide when a student has completed the course. Every
+// rule that is set must hold; a course without rules is completed once all
+// its required (non-optional) items are done.
+type CompletionRules struct {
+	RequiredItems bool `bson:"requiredItems,omitempty" json:"requiredItems,omitempty"`
+	// MinGrade is the share of the required items' maxScore to reach, in (0, 1].
+	MinGrade    float64              `bson:"minGrade,omitempty" json:"minGrade,omitempty"`
+	PassedItems []primitive.ObjectID `bson:"passedItems,omitempty" json:"passedItems,omitempty"`
+	// MinModules is the number of modules whose required items are all done.
+	MinModules int `bson:"minModules,omitempty" json:"minModules,omitempty"`
+}
+
+// AtRiskSettings are the thresholds of the at-risk report; zero fields
+// take the defaults.
+type AtRiskSettings struct {
+	// InactiveDays without activity make a student inactive.
+	InactiveDays int `bson:"inactiveDays,omitempty" json:"inactiveDays,omitempty"`
+	// LowScore is the share of maxScore below which a done item scored low.
+	LowScore float64 `bson:"lowScore,omitempty" json:"lowScore,omitempty"`
+	// FailedAttempts on an item not yet passed count as a struggle.
+	FailedAttempts int `bson:"failedAttempts,omitempty" json:"failedAttempts,omitempty"`
+	// MinScore is the risk score from which a student is listed.
+	MinScore float64 `bson:"minScore,omitempty" json:"minScore,omitempty"`
+}
+
+type CourseStaff struct {
+	UserID  primitive.ObjectID `bson:"userId" json:"userId"`
+	Role    string             `bson:"role" json:"role"`
+	AddedBy primitive.ObjectID `bson:"addedBy" json:"addedBy"`
+	AddedAt time.Time          `bson:"addedAt" json:"addedAt"`
 }
 
 type Course struct {
@@ -26,8 +116,40 @@ type Course struct {
 	Title       string             `bson:"title" json:"title"`
 	Description string             `bson:"description,omitempty" json:"description,omitempty"`
 	Category    string             `bson:"category" json:"category"`
+	Tags        []string           `bson:"tags,omitempty" json:"tags,omitempty"`
 	TeacherID   primitive.ObjectID `bson:"teacherId" json:"teacherId"`
+	Staff       []CourseStaff      `bson:"staff,omitempty" json:"staff,omitempty"`
+	Status      string             `bson:"status,omitempty" json:"status"`
+	PublishedAt *time.Time         `bson:"publishedAt,omitempty" json:"publishedAt,omitempty"`
 	Modules     []CourseModule     `bson:"modules,omitempty" json:"modules,omitempty"`
-	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	IsTemplate  bool               `bson:"isTemplate,omitempty" json:"isTemplate,omitempty"`
+	// Capacity limits active enrollments (0 = unlimited). SeatsTaken and
+	// WaitlistSeq are counters maintained atomically by enrollment.
+	Capacity    int   `bson:"capacity,omitempty" json:"capacity,omitempty"`
+	SeatsTaken  int   `bson:"seatsTaken,omitempty" json:"seatsTaken,omitempty"`
+	WaitlistSeq int64 `bson:"waitlistSeq,omitempty" json:"-"`
+	// SeatClaims counts seats claimed whose enrollment write has not
+	// finished yet; SeatClaimedAt is the latest claim.
+	SeatClaims    int        `bson:"seatClaims,omitempty" json:"-"`
+	SeatClaimedAt *time.Time `bson:"seatClaimedAt,omitempty" json:"-"`
+	// EnrollmentMethod decides how students join (empty = open). The key
+	// is only ever stored as a bcrypt hash.
+	EnrollmentMethod  string `bson:"enrollmentMethod,omitempty" json:"enrollmentMethod,omitempty"`
+	EnrollmentKeyHash string `bson:"enrollmentKeyHash,omitempty" json:"-"`
+	// EnrollmentDays gives new enrollments an end date (0 = no end).
+	EnrollmentDays int `bson:"enrollmentDays,omitempty" json:"enrollmentDays,omitempty"`
+	// Completion holds the completion rules (nil = all required items done).
+	Completion *CompletionRules `bson:"completion,omitempty" json:"completion,omitempty"`
+	// Certificate is the certificate template; without one no certificates
+	// are issued.
+	Certificate *CertificateTemplate `bson:"certificate,omitempty" json:"certificate,omitempty"`
+	// AtRisk holds the thresholds of the at-risk report (nil = defaults).
+	AtRisk *AtRiskSettings `bson:"atRisk,omitempty" json:"atRisk,omitempty"`
+	// Prerequisites are courses that must be completed before enrolling.
+	Prerequisites []CoursePrerequisite `bson:"prerequisites,omitempty" json:"prerequisites,omitempty"`
+	// SourceCourseID points at the course or template this one was cloned from.
+	SourceCourseID *primitive.ObjectID `bson:"sourceCourseId,omitempty" json:"sourceCourseId,omitempty"`
+	Version        int64               `bson:"version" json:"version"`
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
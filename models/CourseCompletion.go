@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CourseCompletion records that a student met the course's completion
+// rules. It is written once and outlives the enrollment.
+type CourseCompletion struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"userId" json:"userId"`
+	CourseID     primitive.ObjectID `bson:"courseId" json:"courseId"`
+	EnrollmentID primitive.ObjectID `bson:"enrollmentId" json:"enrollmentId"`
+	// Grade is the share of the required items' maxScore reached, when the
+	// course has graded items.
+	Grade       *float64  `bson:"grade,omitempty" json:"grade,omitempty"`
+	CompletedAt time.Time `bson:"completedAt" json:"completedAt"`
+}
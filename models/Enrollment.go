@@ -6,6 +6,16 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	EnrollmentStatusActive     = "active"
+	EnrollmentStatusWaitlisted = "waitlisted"
+	EnrollmentStatusPending    = "pending"
+	EnrollmentStatusSuspended  = "suspended"
+	EnrollmentStatusCompleted  = "completed"
+	EnrollmentStatusWithdrawn  = "withdrawn"
+	EnrollmentStatusExpired    = "expired"
+)
+
 type Enrollment struct {
 	ID           primitive.ObjectID `bson:"_id" json:"id"`
 	UserID       primitive.ObjectID `bson:"userId" json:"userId"`
@@ -13,4 +23,62 @@ type Enrollment struct {
 	Status       string             `bson:"status" json:"status"`
 	EnrolledAt   time.Time          `bson:"enrolledAt" json:"enrolledAt"`
 	LastAccessAt *time.Time         `bson:"lastAccessAt,omitempty" json:"lastAccessAt,omitempty"`
+	// WaitlistSeq orders the waitlist; WaitlistPosition is the 1-based place
+	// in it, computed when the enrollment is returned.
+	WaitlistSeq      int64      `bson:"waitlistSeq,omitempty" json:"-"`
+	WaitlistPosition int64      `bson:"-" json:"waitlistPosition,omitempty"`
+	PromotedAt       *time.Time `bson:"promotedAt,omitempty" json:"promotedAt,omitempty"`
+	// Method is how the student got in (an EnrollmentMethod, or "lti").
+	Method     string              `bson:"method,omitempty" json:"method,omitempty"`
+	InvitedBy  *primitive.ObjectID `bson:"invitedBy,omitempty" json:"invitedBy,omitempty"`
+	AddedBy    *primitive.ObjectID `bson:"addedBy,omitempty" json:"addedBy,omitempty"`
+	ReviewedBy *primitive.ObjectID `bson:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time          `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	// SuspendedAt is set while a teacher has suspended the student.
+	SuspendedAt *time.Time `bson:"suspendedAt,omitempty" json:"suspendedAt,omitempty"`
+	// EndsAt is when access runs out; the background job then expires the
+	// enrollment. EndedAt records a withdrawal or expiry.
+	EndsAt      *time.Time `bson:"endsAt,omitempty" json:"endsAt,omitempty"`
+	CompletedAt *time.Time `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	EndedAt     *time.Time `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+	// GroupID is the course group (section) the student belongs to.
+	GroupID *primitive.ObjectID `bson:"groupId,omitempty" json:"groupId,omitempty"`
+	// StreakDays counts the UTC days in a row with progress, ending on
+	// ActiveDay ("2006-01-02"); LongestStreak is the best run so far.
+	ActiveDay     string `bson:"activeDay,omitempty" json:"activeDay,omitempty"`
+	StreakDays    int    `bson:"streakDays,omitempty" json:"streakDays,omitempty"`
+	LongestStreak int    `bson:"longestStreak,omitempty" json:"longestStreak,omitempty"`
+	// Risk is the latest at-risk assessment, written by the background job.
+	// Only the staff report shows it.
+	Risk *EnrollmentRisk `bson:"risk,omitempty" json:"-"`
+}
+
+// RiskFactor explains part of a risk score. Weight is what the factor adds
+// to the score.
+type RiskFactor struct {
+	Code   string  `bson:"code" json:"code"`
+	Weight float64 `bson:"weight" json:"weight"`
+	Detail string  `bson:"detail" json:"detail"`
+}
+
+// EnrollmentRisk is a student's risk of not finishing the course, from 0
+// to 1, with the factors behind it.
+type EnrollmentRisk struct {
+	Score      float64      `bson:"score" json:"score"`
+	Factors    []RiskFactor `bson:"factors" json:"factors"`
+	ComputedAt time.Time    `bson:"computedAt" json:"computedAt"`
+}
+
+// CourseInvite is an issued invite link. A link admits one student: it is
+// spent by UsedBy at UsedAt, or revoked by staff before that.
+type CourseInvite struct {
+	ID        primitive.ObjectID  `bson:"_id" json:"id"`
+	CourseID  primitive.ObjectID  `bson:"courseId" json:"courseId"`
+	InvitedBy primitive.ObjectID  `bson:"invitedBy" json:"invitedBy"`
+	Username  string              `bson:"username,omitempty" json:"username,omitempty"`
+	ExpiresAt time.Time           `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+	UsedBy    *primitive.ObjectID `bson:"usedBy,omitempty" json:"usedBy,omitempty"`
+	UsedAt    *time.Time          `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	RevokedAt *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
 }
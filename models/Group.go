@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group is a section of a course. Students join through their enrollment's
+// GroupID; TAIDs are the teaching assistants looking after the group.
+type Group struct {
+	ID          primitive.ObjectID   `bson:"_id" json:"id"`
+	CourseID    primitive.ObjectID   `bson:"courseId" json:"courseId"`
+	Name        string               `bson:"name" json:"name"`
+	TAIDs       []primitive.ObjectID `bson:"taIds,omitempty" json:"taIds,omitempty"`
+	MemberCount int64                `bson:"-" json:"memberCount"`
+	CreatedAt   time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time            `bson:"updatedAt" json:"updatedAt"`
+}
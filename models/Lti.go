@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	LtiStateLogin     = "login"
+	LtiStateLaunch    = "launch"
+	LtiStateDeepLink  = "deeplink"
+	LtiStateAssertion = "assertion"
+)
+
+// LtiPlatform is an external LMS that launches this system as a tool.
+type LtiPlatform struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	Issuer        string             `bson:"issuer" json:"issuer"`
+	ClientID      string             `bson:"clientId" json:"clientId"`
+	DeploymentIDs []string           `bson:"deploymentIds,omitempty" json:"deploymentIds,omitempty"`
+	AuthLoginURL  string             `bson:"authLoginUrl" json:"authLoginUrl"`
+	AuthTokenURL  string             `bson:"authTokenUrl,omitempty" json:"authTokenUrl,omitempty"`
+	JWKSURL       string             `bson:"jwksUrl" json:"jwksUrl"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// LtiTool is an external tool embedded into courses as "lti" items.
+type LtiTool struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	ClientID     string             `bson:"clientId" json:"clientId"`
+	LoginURL     string             `bson:"loginUrl" json:"loginUrl"`
+	LaunchURL    string             `bson:"launchUrl" json:"launchUrl"`
+	RedirectURIs []string           `bson:"redirectUris" json:"redirectUris"`
+	JWKSURL      string             `bson:"jwksUrl" json:"jwksUrl"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// LtiState is a short-lived, single-use record tying the steps of an OIDC
+// launch together: the tool-side login (state/nonce), the platform-side
+// launch hint, or a pending deep linking selection.
+type LtiState struct {
+	ID         string             `bson:"_id"`
+	Kind       string             `bson:"kind"`
+	Nonce      string             `bson:"nonce,omitempty"`
+	PlatformID primitive.ObjectID `bson:"platformId,omitempty"`
+	ToolID     primitive.ObjectID `bson:"toolId,omitempty"`
+	UserID     primitive.ObjectID `bson:"userId,omitempty"`
+	CourseID   primitive.ObjectID `bson:"courseId,omitempty"`
+	ItemID     primitive.ObjectID `bson:"itemId,omitempty"`
+	// Deep linking request details, echoed back in the response.
+	DeploymentID string    `bson:"deploymentId,omitempty"`
+	ReturnURL    string    `bson:"returnUrl,omitempty"`
+	Data         string    `bson:"data,omitempty"`
+	ExpiresAt    time.Time `bson:"expiresAt"`
+}
+
+// LtiLink remembers the AGS line item a platform handed out on launch, so
+// progress can be passed back as a score.
+type LtiLink struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	PlatformID primitive.ObjectID  `bson:"platformId" json:"platformId"`
+	UserID     primitive.ObjectID  `bson:"userId" json:"userId"`
+	Subject    string              `bson:"subject" json:"subject"`
+	CourseID   primitive.ObjectID  `bson:"courseId" json:"courseId"`
+	ItemID     *primitive.ObjectID `bson:"itemId,omitempty" json:"itemId,omitempty"`
+	LineItem   string              `bson:"lineItem" json:"lineItem"`
+	UpdatedAt  time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// LtiToken is an AGS access token issued to an embedded tool.
+type LtiToken struct {
+	ID        string             `bson:"_id"`
+	ToolID    primitive.ObjectID `bson:"toolId"`
+	Scopes    []string           `bson:"scopes"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
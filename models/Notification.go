@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	NotificationWaitlistPromoted    = "waitlist_promoted"
+	NotificationEnrollmentApproved  = "enrollment_approved"
+	NotificationEnrollmentRejected  = "enrollment_rejected"
+	NotificationEnrollmentExpired   = "enrollment_expired"
+	NotificationEnrollmentCompleted = "enrollment_completed"
+	NotificationBadgeAwarded        = "badge_awarded"
+)
+
+// Notification is an in-app message to a user.
+type Notification struct {
+	ID        primitive.ObjectID  `bson:"_id" json:"id"`
+	UserID    primitive.ObjectID  `bson:"userId" json:"userId"`
+	Type      string              `bson:"type" json:"type"`
+	CourseID  *primitive.ObjectID `bson:"courseId,omitempty" json:"courseId,omitempty"`
+	Message   string              `bson:"message" json:"message"`
+	Read      bool                `bson:"read" json:"read"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
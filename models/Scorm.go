@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScormPackage struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	CourseID   primitive.ObjectID `bson:"courseId" json:"courseId"`
+	Version    string             `bson:"version" json:"version"`
+	Title      string             `bson:"title" json:"title"`
+	LaunchPath string             `bson:"launchPath" json:"launchPath"`
+	Size       int64              `bson:"size" json:"size"`
+	UploadedBy primitive.ObjectID `bson:"uploadedBy" json:"uploadedBy"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// ScormValue is one CMI data model element. Elements are stored as a list
+// because their names contain dots, which MongoDB treats as path separators.
+type ScormValue struct {
+	Element string `bson:"element" json:"element"`
+	Value   string `bson:"value" json:"value"`
+}
+
+type ScormRuntime struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	CourseID  primitive.ObjectID `bson:"courseId" json:"courseId"`
+	ItemID    primitive.ObjectID `bson:"itemId" json:"itemId"`
+	PackageID primitive.ObjectID `bson:"packageId" json:"packageId"`
+	CMI       []ScormValue       `bson:"cmi" json:"cmi"`
+	Sessions  int                `bson:"sessions" json:"sessions"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -2,8 +2,11 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+const RoleAdmin = "admin"
+
 type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Username string             `bson:"username" json:"username"`
 	Password string             `bson:"password,omitempty"`
+	Role     string             `bson:"role,omitempty" json:"role,omitempty"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// XapiProvider is an activity provider allowed to write to the LRS with
+// HTTP Basic credentials.
+type XapiProvider struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Key        string             `bson:"key" json:"key"`
+	SecretHash string             `bson:"secretHash" json:"-"`
+	// ActivityPrefixes restricts which activity IRIs the provider may report
+	// on; empty means any.
+	ActivityPrefixes []string  `bson:"activityPrefixes,omitempty" json:"activityPrefixes,omitempty"`
+	CreatedAt        time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// XapiStatement stores the statement as received (plus LRS-assigned fields)
+// together with the fields the query API filters on.
+type XapiStatement struct {
+	ID           string             `bson:"_id" json:"id"`
+	ProviderID   primitive.ObjectID `bson:"providerId" json:"providerId"`
+	ActorKey     string             `bson:"actorKey" json:"actorKey"`
+	VerbID       string             `bson:"verbId" json:"verbId"`
+	ActivityID   string             `bson:"activityId,omitempty" json:"activityId,omitempty"`
+	Registration string             `bson:"registration,omitempty" json:"registration,omitempty"`
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+	Stored       time.Time          `bson:"stored" json:"stored"`
+	Voided       bool               `bson:"voided" json:"voided"`
+	Raw          string             `bson:"raw" json:"-"`
+}
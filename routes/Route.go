@@ -16,25 +16,153 @@ func RegisterRoutes() {
 	http.HandleFunc("GET /courses", handlers.GetCourses)
 	http.HandleFunc("GET /courses/{id}", handlers.GetCourse)
 
+	http.HandleFunc("GET /tags", handlers.GetPopularTags)
+
+	// Category taxonomy (tree is public, changes are admin-only)
+	http.HandleFunc("GET /categories", handlers.GetCategories)
+	http.HandleFunc("POST /categories", handlers.AuthMiddleware(handlers.CreateCategory))
+	http.HandleFunc("PATCH /categories/{id}", handlers.AuthMiddleware(handlers.PatchCategory))
+	http.HandleFunc("DELETE /categories/{id}", handlers.AuthMiddleware(handlers.DeleteCategory))
+
 	// Protected course mutations
 	http.HandleFunc("POST /courses", handlers.AuthMiddleware(handlers.CreateCourse))
 	http.HandleFunc("PATCH /courses/{id}", handlers.AuthMiddleware(handlers.PatchCourse))
 	http.HandleFunc("DELETE /courses/{id}", handlers.AuthMiddleware(handlers.DeleteCourse))
+	http.HandleFunc("POST /courses/{id}/publish", handlers.AuthMiddleware(handlers.PublishCourse))
+	http.HandleFunc("POST /courses/{id}/unpublish", handlers.AuthMiddleware(handlers.UnpublishCourse))
+	http.HandleFunc("POST /courses/{id}/archive", handlers.AuthMiddleware(handlers.ArchiveCourse))
+	http.HandleFunc("POST /courses/{id}/clone", handlers.AuthMiddleware(handlers.CloneCourse))
+	http.HandleFunc("GET /courses/{id}/prerequisites", handlers.GetPrerequisites)
+	http.HandleFunc("PUT /courses/{id}/prerequisites", handlers.AuthMiddleware(handlers.PutPrerequisites))
+	http.HandleFunc("GET /courses/{id}/completion", handlers.AuthMiddleware(handlers.GetCourseCompletion))
+	http.HandleFunc("PUT /courses/{id}/completion", handlers.AuthMiddleware(handlers.PutCourseCompletion))
+	http.HandleFunc("GET /courses/{id}/completions", handlers.AuthMiddleware(handlers.GetCourseCompletions))
+	http.HandleFunc("GET /courses/{id}/certificate-template", handlers.AuthMiddleware(handlers.GetCertificateTemplate))
+	http.HandleFunc("PUT /courses/{id}/certificate-template", handlers.AuthMiddleware(handlers.PutCertificateTemplate))
+	http.HandleFunc("DELETE /courses/{id}/certificate-template", handlers.AuthMiddleware(handlers.DeleteCertificateTemplate))
+	http.HandleFunc("GET /courses/{id}/badges", handlers.AuthMiddleware(handlers.GetCourseBadges))
+	http.HandleFunc("POST /courses/{id}/badges", handlers.AuthMiddleware(handlers.CreateCourseBadge))
+	http.HandleFunc("PATCH /courses/{id}/badges/{badgeId}", handlers.AuthMiddleware(handlers.PatchCourseBadge))
+	http.HandleFunc("DELETE /courses/{id}/badges/{badgeId}", handlers.AuthMiddleware(handlers.DeleteCourseBadge))
+	http.HandleFunc("GET /courses/{id}/analytics", handlers.AuthMiddleware(handlers.GetCourseAnalytics))
+	http.HandleFunc("GET /courses/{id}/at-risk", handlers.AuthMiddleware(handlers.GetCourseAtRisk))
+	http.HandleFunc("GET /courses/{id}/at-risk/settings", handlers.AuthMiddleware(handlers.GetAtRiskSettings))
+	http.HandleFunc("PUT /courses/{id}/at-risk/settings", handlers.AuthMiddleware(handlers.PutAtRiskSettings))
+	http.HandleFunc("GET /courses/{id}/export", handlers.AuthMiddleware(handlers.ExportCourse))
+	http.HandleFunc("POST /courses/import", handlers.AuthMiddleware(handlers.ImportCourse))
+	http.HandleFunc("POST /courses/import/imscc", handlers.AuthMiddleware(handlers.ImportCartridge))
+
+	// Templates
+	http.HandleFunc("GET /templates", handlers.AuthMiddleware(handlers.GetTemplates))
+	http.HandleFunc("POST /templates/{id}/instantiate", handlers.AuthMiddleware(handlers.InstantiateTemplate))
 
 	// Modules
 	http.HandleFunc("POST /courses/{id}/modules", handlers.AuthMiddleware(handlers.AddModule))
 	http.HandleFunc("PATCH /courses/{id}/modules/{moduleId}", handlers.AuthMiddleware(handlers.PatchModule))
 	http.HandleFunc("DELETE /courses/{id}/modules/{moduleId}", handlers.AuthMiddleware(handlers.DeleteModule))
 
+	// Items
+	http.HandleFunc("PATCH /courses/{id}/modules/{moduleId}/items/{itemId}", handlers.AuthMiddleware(handlers.PatchItem))
+
+	// SCORM
+	http.HandleFunc("POST /courses/{id}/modules/{moduleId}/scorm", handlers.AuthMiddleware(handlers.UploadScormPackage))
+	http.HandleFunc("GET /courses/{courseId}/items/{itemId}/scorm", handlers.AuthMiddleware(handlers.ScormPlayer))
+	http.HandleFunc("GET /courses/{courseId}/items/{itemId}/scorm/runtime", handlers.AuthMiddleware(handlers.GetScormRuntime))
+	http.HandleFunc("PUT /courses/{courseId}/items/{itemId}/scorm/runtime", handlers.AuthMiddleware(handlers.PutScormRuntime))
+	http.HandleFunc("GET /scorm/{packageId}/content/{token}/{path...}", handlers.ServeScormContent)
+
+	// LTI 1.3 (tool side)
+	http.HandleFunc("GET /lti/jwks", handlers.LtiJWKS)
+	http.HandleFunc("GET /lti/login", handlers.LtiLogin)
+	http.HandleFunc("POST /lti/login", handlers.LtiLogin)
+	http.HandleFunc("POST /lti/launch", handlers.LtiLaunch)
+	http.HandleFunc("POST /lti/deeplink/{state}", handlers.AuthMiddleware(handlers.LtiDeepLinkSubmit))
+	http.HandleFunc("POST /lti/platforms", handlers.AuthMiddleware(handlers.CreateLtiPlatform))
+	http.HandleFunc("GET /lti/platforms", handlers.AuthMiddleware(handlers.GetLtiPlatforms))
+	http.HandleFunc("DELETE /lti/platforms/{id}", handlers.AuthMiddleware(handlers.DeleteLtiPlatform))
+
+	// LTI 1.3 (platform side)
+	http.HandleFunc("POST /lti/tools", handlers.AuthMiddleware(handlers.CreateLtiTool))
+	http.HandleFunc("GET /lti/tools", handlers.AuthMiddleware(handlers.GetLtiTools))
+	http.HandleFunc("DELETE /lti/tools/{id}", handlers.AuthMiddleware(handlers.DeleteLtiTool))
+	http.HandleFunc("GET /courses/{courseId}/items/{itemId}/lti", handlers.AuthMiddleware(handlers.LaunchLtiItem))
+	http.HandleFunc("GET /lti/authorize", handlers.AuthMiddleware(handlers.LtiAuthorize))
+	http.HandleFunc("POST /lti/authorize", handlers.AuthMiddleware(handlers.LtiAuthorize))
+	http.HandleFunc("POST /lti/token", handlers.LtiToken)
+	http.HandleFunc("GET /lti/ags/courses/{courseId}/items/{itemId}/lineitem", handlers.GetLtiLineItem)
+	http.HandleFunc("POST /lti/ags/courses/{courseId}/items/{itemId}/lineitem/scores", handlers.PostLtiScore)
+
+	// xAPI
+	http.HandleFunc("GET /xapi/about", handlers.XapiAbout)
+	http.HandleFunc("PUT /xapi/statements", handlers.PutXapiStatement)
+	http.HandleFunc("POST /xapi/statements", handlers.PostXapiStatements)
+	http.HandleFunc("GET /xapi/statements", handlers.GetXapiStatements)
+	http.HandleFunc("POST /xapi/providers", handlers.AuthMiddleware(handlers.CreateXapiProvider))
+	http.HandleFunc("GET /xapi/providers", handlers.AuthMiddleware(handlers.GetXapiProviders))
+	http.HandleFunc("DELETE /xapi/providers/{id}", handlers.AuthMiddleware(handlers.DeleteXapiProvider))
+
 	// Progress
 	http.HandleFunc("PUT /courses/{courseId}/items/{itemId}/progress", handlers.AuthMiddleware(handlers.UpdateProgress))
+	http.HandleFunc("POST /courses/{courseId}/items/{itemId}/view", handlers.AuthMiddleware(handlers.ViewItem))
 	http.HandleFunc("GET /me/progress", handlers.AuthMiddleware(handlers.GetMyProgress))
+	http.HandleFunc("GET /me/activity", handlers.AuthMiddleware(handlers.GetMyActivity))
+	http.HandleFunc("GET /me/courses/{courseId}/time-on-task", handlers.AuthMiddleware(handlers.GetMyTimeOnTask))
+	http.HandleFunc("GET /me/notifications", handlers.AuthMiddleware(handlers.GetMyNotifications))
+	http.HandleFunc("POST /me/notifications/{id}/read", handlers.AuthMiddleware(handlers.MarkNotificationRead))
+
+	// Certificates
+	http.HandleFunc("GET /me/certificates", handlers.AuthMiddleware(handlers.GetMyCertificates))
+	http.HandleFunc("GET /me/certificates/{id}/pdf", handlers.AuthMiddleware(handlers.DownloadMyCertificate))
+	http.HandleFunc("GET /certificates/{code}/verify", handlers.VerifyCertificatePage)
+	http.HandleFunc("GET /certificates/{code}/pdf", handlers.DownloadCertificateByCode)
+
+	// Open Badges
+	http.HandleFunc("GET /me/badges", handlers.AuthMiddleware(handlers.GetMyBadges))
+	http.HandleFunc("GET /me/badges/{id}/{format}", handlers.AuthMiddleware(handlers.DownloadMyBadge))
+	http.HandleFunc("GET /badges/issuer", handlers.GetBadgeIssuer)
+	http.HandleFunc("GET /badges/issuer/key", handlers.GetBadgeIssuerKey)
+	http.HandleFunc("GET /badges/classes/{id}", handlers.GetBadgeClassDocument)
+	http.HandleFunc("GET /badges/classes/{id}/image", handlers.GetBadgeClassImage)
+	http.HandleFunc("GET /badges/assertions/{id}", handlers.GetBadgeAssertion)
+	http.HandleFunc("GET /badges/assertions/{id}/credential", handlers.GetBadgeCredential)
 
 	// Enrollments
 	http.HandleFunc("POST /enrollments", handlers.AuthMiddleware(handlers.CreateEnrollment))
 	http.HandleFunc("GET /enrollments/my", handlers.AuthMiddleware(handlers.GetMyEnrollments))
 	http.HandleFunc("DELETE /enrollments", handlers.AuthMiddleware(handlers.DeleteEnrollmentsByCourse))
 	http.HandleFunc("DELETE /enrollments/{id}", handlers.AuthMiddleware(handlers.DeleteEnrollment))
+	http.HandleFunc("POST /enrollments/{id}/withdraw", handlers.AuthMiddleware(handlers.WithdrawEnrollment))
+	http.HandleFunc("POST /enrollments/{id}/approve", handlers.AuthMiddleware(handlers.ApproveEnrollment))
+	http.HandleFunc("POST /enrollments/{id}/reject", handlers.AuthMiddleware(handlers.RejectEnrollment))
+	http.HandleFunc("GET /courses/{id}/enrollments", handlers.AuthMiddleware(handlers.GetCourseRoster))
+	http.HandleFunc("POST /courses/{id}/enrollments", handlers.AuthMiddleware(handlers.AddRosterStudent))
+	http.HandleFunc("POST /courses/{id}/enrollments/import", handlers.AuthMiddleware(handlers.ImportRoster))
+	http.HandleFunc("PATCH /courses/{id}/enrollments/{enrollmentId}", handlers.AuthMiddleware(handlers.PatchRosterEnrollment))
+	http.HandleFunc("DELETE /courses/{id}/enrollments/{enrollmentId}", handlers.AuthMiddleware(handlers.RemoveRosterStudent))
+	http.HandleFunc("POST /courses/{id}/enrollments/{enrollmentId}/suspend", handlers.AuthMiddleware(handlers.SuspendRosterStudent))
+	http.HandleFunc("POST /courses/{id}/enrollments/{enrollmentId}/reactivate", handlers.AuthMiddleware(handlers.ReactivateRosterStudent))
+	http.HandleFunc("PUT /courses/{id}/enrollments/{enrollmentId}/items/{itemId}/progress", handlers.AuthMiddleware(handlers.GradeProgress))
+	http.HandleFunc("GET /courses/{id}/enrollments/{enrollmentId}/activity", handlers.AuthMiddleware(handlers.GetStudentActivity))
+	http.HandleFunc("GET /courses/{id}/enrollments/{enrollmentId}/time-on-task", handlers.AuthMiddleware(handlers.GetStudentTimeOnTask))
+	http.HandleFunc("GET /courses/{id}/enrollments/pending", handlers.AuthMiddleware(handlers.GetPendingEnrollments))
+	http.HandleFunc("POST /courses/{id}/invites", handlers.AuthMiddleware(handlers.CreateCourseInvite))
+	http.HandleFunc("GET /courses/{id}/invites", handlers.AuthMiddleware(handlers.GetCourseInvites))
+	http.HandleFunc("DELETE /courses/{id}/invites/{inviteId}", handlers.AuthMiddleware(handlers.RevokeCourseInvite))
+
+	// Course staff
+	http.HandleFunc("GET /courses/{id}/staff", handlers.AuthMiddleware(handlers.GetCourseStaff))
+	http.HandleFunc("POST /courses/{id}/staff", handlers.AuthMiddleware(handlers.AddCourseStaff))
+	http.HandleFunc("PATCH /courses/{id}/staff/{userId}", handlers.AuthMiddleware(handlers.PatchCourseStaff))
+	http.HandleFunc("DELETE /courses/{id}/staff/{userId}", handlers.AuthMiddleware(handlers.RemoveCourseStaff))
+
+	// Groups (sections) within a course
+	http.HandleFunc("GET /courses/{id}/groups", handlers.AuthMiddleware(handlers.GetCourseGroups))
+	http.HandleFunc("POST /courses/{id}/groups", handlers.AuthMiddleware(handlers.CreateGroup))
+	http.HandleFunc("POST /courses/{id}/groups/assign", handlers.AuthMiddleware(handlers.AutoAssignGroups))
+	http.HandleFunc("PATCH /courses/{id}/groups/{groupId}", handlers.AuthMiddleware(handlers.PatchGroup))
+	http.HandleFunc("DELETE /courses/{id}/groups/{groupId}", handlers.AuthMiddleware(handlers.DeleteGroup))
+	http.HandleFunc("POST /courses/{id}/groups/{groupId}/members", handlers.AuthMiddleware(handlers.AddGroupMembers))
+	http.HandleFunc("DELETE /courses/{id}/groups/{groupId}/members/{enrollmentId}", handlers.AuthMiddleware(handlers.RemoveGroupMember))
 
 	// Static
 	fs := http.FileServer(http.Dir("./static"))
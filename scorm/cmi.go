@@ -0,0 +1,66 @@
+package scorm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Outcome is the learner state extracted from CMI data.
+type Outcome struct {
+	Attempted bool
+	Completed bool
+	Score     *float64
+	// Scaled is the 2004 cmi.score.scaled value in [-1, 1], if reported.
+	Scaled *float64
+}
+
+// ReadOutcome interprets lesson/completion status and score elements for the
+// given SCORM version.
+func ReadOutcome(version string, cmi map[string]string) Outcome {
+	var out Outcome
+
+	if version == Version2004 {
+		completion := strings.ToLower(cmi["cmi.completion_status"])
+		success := strings.ToLower(cmi["cmi.success_status"])
+		out.Completed = completion == "completed" || success == "passed"
+		out.Attempted = out.Completed || completion == "incomplete" || success == "failed"
+		out.Score = parseNumber(cmi["cmi.score.raw"])
+		out.Scaled = parseNumber(cmi["cmi.score.scaled"])
+		return out
+	}
+
+	status := strings.ToLower(cmi["cmi.core.lesson_status"])
+	switch status {
+	case "passed", "completed":
+		out.Completed = true
+		out.Attempted = true
+	case "failed", "incomplete", "browsed":
+		out.Attempted = true
+	}
+	out.Score = parseNumber(cmi["cmi.core.score.raw"])
+	return out
+}
+
+func parseNumber(v string) *float64 {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// MaxValueLength returns the longest value accepted for a CMI element;
+// suspend_data is the only element allowed to carry large payloads.
+func MaxValueLength(version, element string) int {
+	if strings.HasSuffix(element, "suspend_data") {
+		if version == Version2004 {
+			return 64000
+		}
+		return 4096
+	}
+	return 4000
+}
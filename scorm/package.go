@@ -0,0 +1,259 @@
+// Package scorm parses and unpacks SCORM 1.2 and 2004 content packages.
+package scorm
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	Version12   = "1.2"
+	Version2004 = "2004"
+
+	manifestFile = "imsmanifest.xml"
+)
+
+var (
+	ErrNoManifest = errors.New("imsmanifest.xml not found")
+	ErrNoLaunch   = errors.New("no launchable SCO found in manifest")
+	ErrUnsafePath = errors.New("package contains an unsafe path")
+	ErrTooLarge   = errors.New("package is too large when extracted")
+)
+
+// MaxExtractedSize caps the total uncompressed size of a package.
+var MaxExtractedSize int64 = 512 << 20
+
+// Manifest holds the parts of imsmanifest.xml the player needs.
+type Manifest struct {
+	Version    string
+	Title      string
+	LaunchPath string
+}
+
+type manifest struct {
+	Metadata struct {
+		Schema        string `xml:"schema"`
+		SchemaVersion string `xml:"schemaversion"`
+	} `xml:"metadata"`
+	Organizations struct {
+		Default string         `xml:"default,attr"`
+		List    []organization `xml:"organization"`
+	} `xml:"organizations"`
+	Resources []resource `xml:"resources>resource"`
+}
+
+type organization struct {
+	Identifier string `xml:"identifier,attr"`
+	Title      string `xml:"title"`
+	Items      []item `xml:"item"`
+}
+
+type item struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+	Parameters    string `xml:"parameters,attr"`
+	Title         string `xml:"title"`
+	Items         []item `xml:"item"`
+}
+
+type resource struct {
+	Identifier string     `xml:"identifier,attr"`
+	Type       string     `xml:"type,attr"`
+	Href       string     `xml:"href,attr"`
+	XMLBase    string     `xml:"base,attr"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+}
+
+func (r *resource) isSCO() bool {
+	for _, a := range r.Attrs {
+		if strings.EqualFold(a.Name.Local, "scormtype") {
+			return strings.EqualFold(a.Value, "sco")
+		}
+	}
+	return false
+}
+
+// ParseManifest reads imsmanifest.xml from the package root and resolves the
+// launch file of the first SCO in the default organization.
+func ParseManifest(zr *zip.Reader) (*Manifest, error) {
+	var mf *zip.File
+	for _, f := range zr.File {
+		if path.Clean(f.Name) == manifestFile {
+			mf = f
+			break
+		}
+	}
+	if mf == nil {
+		return nil, ErrNoManifest
+	}
+
+	rc, err := mf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var m manifest
+	if err := xml.NewDecoder(io.LimitReader(rc, 4<<20)).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	out := &Manifest{Version: detectVersion(m.Metadata.SchemaVersion)}
+
+	orgs := m.Organizations.List
+	if len(orgs) == 0 {
+		return nil, ErrNoLaunch
+	}
+	org := orgs[0]
+	for _, o := range orgs {
+		if o.Identifier == m.Organizations.Default {
+			org = o
+			break
+		}
+	}
+	out.Title = strings.TrimSpace(org.Title)
+
+	resources := map[string]*resource{}
+	for i := range m.Resources {
+		resources[m.Resources[i].Identifier] = &m.Resources[i]
+	}
+
+	launch, ok := firstLaunch(org.Items, resources)
+	if !ok {
+		return nil, ErrNoLaunch
+	}
+	out.LaunchPath = launch
+	return out, nil
+}
+
+func detectVersion(schemaVersion string) string {
+	v := strings.ToLower(strings.TrimSpace(schemaVersion))
+	if v == "1.2" || strings.HasPrefix(v, "1.2") {
+		return Version12
+	}
+	if strings.Contains(v, "2004") || strings.HasPrefix(v, "cam 1.3") {
+		return Version2004
+	}
+	return Version12
+}
+
+func firstLaunch(items []item, resources map[string]*resource) (string, bool) {
+	for _, it := range items {
+		if r, ok := resources[it.IdentifierRef]; ok && r.Href != "" && (r.isSCO() || len(it.Items) == 0) {
+			href := path.Join(r.XMLBase, r.Href)
+			if it.Parameters != "" {
+				sep := "?"
+				if strings.Contains(href, "?") || strings.HasPrefix(it.Parameters, "?") || strings.HasPrefix(it.Parameters, "#") {
+					sep = ""
+				}
+				href += sep + it.Parameters
+			}
+			return href, true
+		}
+		if launch, ok := firstLaunch(it.Items, resources); ok {
+			return launch, true
+		}
+	}
+	return "", false
+}
+
+// Extract unpacks the package into dir, refusing entries that would escape it.
+func Extract(zr *zip.Reader, dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range zr.File {
+		total += int64(f.UncompressedSize64)
+		if total > MaxExtractedSize {
+			return ErrTooLarge
+		}
+	}
+
+	for _, f := range zr.File {
+		name := path.Clean(strings.ReplaceAll(f.Name, "\\", "/"))
+		if name == "." {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return ErrUnsafePath
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return ErrUnsafePath
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := extractFile(f, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pack zips an unpacked package back up, the reverse of Extract.
+func Pack(dir string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		dst, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	// UncompressedSize64 comes from the archive header; never trust it blindly.
+	if _, err := io.Copy(out, io.LimitReader(rc, int64(f.UncompressedSize64))); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
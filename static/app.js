@@ -37,8 +37,8 @@ async function loadCourses() {
                 <div class="card__title">${escapeHtml(c.title ?? "Без названия")}</div>
                 <div class="card__meta">ID: ${c.id}</div>
                 <div style="margin-top: 12px; display: flex; gap: 8px;">
-                    <button class="btn" onclick="editCourse('${c.id}', '${escapeHtml(c.title)}')">Изменить</button>
-                    <button class="btn" style="color: #ff5b5b; border-color: rgba(255,91,91,0.3)" onclick="deleteCourse('${c.id}')">Удалить</button>
+                    <button class="btn" onclick="editCourse('${c.id}', '${escapeHtml(c.title)}', ${c.version ?? 0})">Изменить</button>
+                    <button class="btn" style="color: #ff5b5b; border-color: rgba(255,91,91,0.3)" onclick="deleteCourse('${c.id}', ${c.version ?? 0})">Удалить</button>
                 </div>
             `;
             grid.appendChild(card);
@@ -48,13 +48,25 @@ async function loadCourses() {
     }
 }
 
-async function deleteCourse(id) {
+// courseETag is the tag of the course version the list showed; mutations
+// send it as If-Match so they never overwrite changes made since.
+function courseETag(version) {
+    return `"v${version}"`;
+}
+
+async function deleteCourse(id, version) {
     if (!confirm("Вы уверены, что хотите удалить этот курс?")) return;
 
     try {
-        const res = await fetch(`${API_BASE}/courses/${id}`, { method: "DELETE" });
+        const res = await fetch(`${API_BASE}/courses/${id}`, {
+            method: "DELETE",
+            headers: { "If-Match": courseETag(version) }
+        });
         if (res.ok) {
             loadCourses();
+        } else if (res.status === 412) {
+            alert("Курс был изменён, список обновлён.");
+            loadCourses();
         } else {
             const errText = await res.text();
             alert("Ошибка удаления: " + errText);
@@ -64,19 +76,22 @@ async function deleteCourse(id) {
     }
 }
 
-async function editCourse(id, currentTitle) {
+async function editCourse(id, currentTitle, version) {
     const newTitle = prompt("Введите новое название курса:", currentTitle);
     if (!newTitle || newTitle === currentTitle) return;
 
     try {
         const res = await fetch(`${API_BASE}/courses/${id}`, {
             method: "PATCH",
-            headers: { "Content-Type": "application/json" },
+            headers: { "Content-Type": "application/json", "If-Match": courseETag(version) },
             body: JSON.stringify({ title: newTitle })
         });
 
         if (res.ok) {
             loadCourses();
+        } else if (res.status === 412) {
+            alert("Курс был изменён, список обновлён.");
+            loadCourses();
         } else {
             alert("Ошибка при обновлении");
         }
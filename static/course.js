@@ -12,6 +12,24 @@ function escapeHtml(s) {
         .replaceAll("'", "&#039;");
 }
 
+function readCachedCourse(courseId) {
+    try {
+        const raw = localStorage.getItem(`course:${courseId}`);
+        return raw ? JSON.parse(raw) : null;
+    } catch (e) {
+        return null;
+    }
+}
+
+function writeCachedCourse(courseId, etag, course) {
+    if (!etag) return;
+    try {
+        localStorage.setItem(`course:${courseId}`, JSON.stringify({ etag, course }));
+    } catch (e) {
+        // quota exceeded or storage disabled: skip caching
+    }
+}
+
 function getCourseId() {
     const parts = window.location.pathname.split("/").filter(Boolean);
     return parts[1] || "";
@@ -28,13 +46,22 @@ async function loadCourse() {
     modulesEl.innerHTML = "";
 
     try {
-        const res = await fetch(`/courses/${courseId}`, { headers: { "Accept": "application/json" } });
-        if (!res.ok) {
+        const cached = readCachedCourse(courseId);
+        const headers = { "Accept": "application/json" };
+        if (cached) headers["If-None-Match"] = cached.etag;
+
+        const res = await fetch(`/courses/${courseId}`, { headers, cache: "no-store" });
+        let course;
+        if (res.status === 304 && cached) {
+            course = cached.course;
+        } else if (res.ok) {
+            course = await res.json();
+            writeCachedCourse(courseId, res.headers.get("ETag"), course);
+        } else {
             statusEl.textContent = `Ошибка загрузки: ${res.status}`;
             return;
         }
 
-        const course = await res.json();
         titleEl.textContent = course.title || "Курс";
         metaEl.textContent = `Категория: ${course.category || "—"} | ID: ${course.id}`;
 
@@ -64,9 +91,17 @@ async function loadCourse() {
                         <div class="item__title">${escapeHtml(item.title || "Элемент")}</div>
                         <div class="item__meta">Тип: ${escapeHtml(item.type || "—")} | MaxScore: ${item.maxScore ?? 0}</div>
                     </div>
-                    <button class="btn" data-item-id="${item.id}">Update progress</button>
+                    <button class="btn" data-item-id="${item.id}" ${item.locked ? "disabled" : ""}>${item.locked ? "Недоступно" : "Update progress"}</button>
                 `;
-                row.querySelector("button").addEventListener("click", () => updateProgress(course.id, item.id));
+                if ((item.type === "scorm" || item.type === "lti") && !item.locked) {
+                    const open = document.createElement("a");
+                    open.className = "btn";
+                    open.href = `/courses/${course.id}/items/${item.id}/${item.type}`;
+                    open.textContent = "Открыть";
+                    row.querySelector("button").replaceWith(open);
+                } else if (!item.locked) {
+                    row.querySelector("button").addEventListener("click", () => updateProgress(course.id, item.id));
+                }
                 list.appendChild(row);
             });
 
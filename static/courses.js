@@ -5,13 +5,17 @@ const statusEl = document.getElementById("status");
 const searchInput = document.getElementById("searchInput");
 const categoryInput = document.getElementById("categoryInput");
 const teacherInput = document.getElementById("teacherInput");
+const tagsInput = document.getElementById("tagsInput");
+const matchSelect = document.getElementById("matchSelect");
 const sortSelect = document.getElementById("sortSelect");
+const facetsEl = document.getElementById("facets");
 const prevBtn = document.getElementById("prevBtn");
 const nextBtn = document.getElementById("nextBtn");
 const pageLabel = document.getElementById("pageLabel");
 
 let currentPage = 1;
-let lastPage = 1;
+let nextCursor = "";
+let prevCursor = "";
 
 function escapeHtml(s) {
     return String(s)
@@ -22,18 +26,100 @@ function escapeHtml(s) {
         .replaceAll("'", "&#039;");
 }
 
-async function loadCourses(page = 1) {
+// Snippets come from the server already escaped, with matches in <mark>.
+function renderHighlights(highlights) {
+    return (highlights || [])
+        .filter(h => h.field !== "title")
+        .slice(0, 3)
+        .map(h => `<div class="card__snippet">${h.snippet}</div>`)
+        .join("");
+}
+
+function renderTags(tags) {
+    if (!tags || tags.length === 0) return "";
+    return `<div class="card__meta">${tags.map(t => `#${escapeHtml(t)}`).join(" ")}</div>`;
+}
+
+function renderFacets(facets) {
+    facetsEl.innerHTML = "";
+    if (!facets) return;
+
+    const groups = [
+        {
+            title: "Категории",
+            items: (facets.categories || []).filter(f => f.value),
+            label: f => f.value,
+            apply: f => { categoryInput.value = categoryInput.value === f.value ? "" : f.value; },
+            active: f => categoryInput.value.trim() === f.value
+        },
+        {
+            title: "Преподаватели",
+            items: facets.teachers || [],
+            label: f => f.username || f.teacherId,
+            apply: f => { teacherInput.value = teacherInput.value === f.teacherId ? "" : f.teacherId; },
+            active: f => teacherInput.value.trim() === f.teacherId
+        }
+    ];
+
+    groups.forEach(group => {
+        if (group.items.length === 0) return;
+        const row = document.createElement("div");
+        row.className = "facets__group";
+        row.innerHTML = `<span class="muted">${group.title}:</span>`;
+        group.items.forEach(f => {
+            const chip = document.createElement("button");
+            chip.type = "button";
+            chip.className = "chip" + (group.active(f) ? " chip--active" : "");
+            chip.textContent = `${group.label(f)} (${f.count})`;
+            chip.addEventListener("click", () => {
+                group.apply(f);
+                resetAndLoad();
+            });
+            row.appendChild(chip);
+        });
+        facetsEl.appendChild(row);
+    });
+}
+
+// Fills the category suggestions from the taxonomy tree; subcategories are
+// indented under their parents.
+async function loadCategories() {
+    try {
+        const res = await fetch(`${API_BASE}/categories`, { headers: { "Accept": "application/json" } });
+        if (!res.ok) return;
+        const tree = await res.json();
+        const list = document.getElementById("categoryList");
+        const add = (nodes, depth) => nodes.forEach(node => {
+            const option = document.createElement("option");
+            option.value = node.slug;
+            option.textContent = `${"— ".repeat(depth)}${node.name} (${node.totalCount})`;
+            list.appendChild(option);
+            add(node.children || [], depth + 1);
+        });
+        add(tree, 0);
+    } catch (e) {
+        // Suggestions are optional; the filter still accepts free text.
+    }
+}
+
+async function loadCourses(cursor = "", page = 1) {
     const search = searchInput.value.trim();
     const category = categoryInput.value.trim();
     const teacherId = teacherInput.value.trim();
+    const tags = tagsInput.value.trim();
     const sort = sortSelect.value;
 
     const params = new URLSearchParams();
-    params.set("page", page);
     params.set("limit", 9);
+    params.set("includeTotal", "true");
+    if (cursor) params.set("cursor", cursor);
     if (search) params.set("search", search);
     if (category) params.set("category", category);
     if (teacherId) params.set("teacherId", teacherId);
+    if (tags) {
+        params.set("tags", tags);
+        params.set("match", matchSelect.value);
+    }
     if (sort) params.set("sort", sort);
 
     statusEl.textContent = "Загрузка...";
@@ -52,7 +138,8 @@ async function loadCourses(page = 1) {
 
         const data = await res.json();
         const items = data.items || [];
-        const total = data.total || 0;
+        const total = Number(res.headers.get("X-Total-Count")) || 0;
+        renderFacets(data.facets);
 
         if (items.length === 0) {
             statusEl.textContent = "Курсы не найдены.";
@@ -64,38 +151,44 @@ async function loadCourses(page = 1) {
             const card = document.createElement("a");
             card.className = "card";
             card.href = `/courses/${course.id}`;
+            const titleHit = (course.highlights || []).find(h => h.field === "title");
+            const titleHtml = titleHit ? titleHit.snippet : escapeHtml(course.title);
             card.innerHTML = `
-                <div class="card__title">${escapeHtml(course.title)}</div>
+                <div class="card__title">${titleHtml}</div>
                 <div class="card__meta">Категория: ${escapeHtml(course.category || "—")}</div>
                 <div class="card__meta">ID: ${escapeHtml(course.id)}</div>
+                ${renderTags(course.tags)}
+                ${renderHighlights(course.highlights)}
             `;
             coursesGrid.appendChild(card);
         });
 
-        currentPage = data.page || page;
-        lastPage = Math.max(1, Math.ceil(total / (data.limit || 9)));
-        pageLabel.textContent = `Страница ${currentPage} из ${lastPage}`;
-        prevBtn.disabled = currentPage <= 1;
-        nextBtn.disabled = currentPage >= lastPage;
+        currentPage = page;
+        nextCursor = data.nextCursor || "";
+        prevCursor = data.prevCursor || "";
+        const lastPage = Math.max(1, Math.ceil(total / (data.limit || 9)));
+        pageLabel.textContent = `Страница ${currentPage} из ${lastPage} · найдено: ${total}`;
+        prevBtn.disabled = !prevCursor;
+        nextBtn.disabled = !nextCursor;
     } catch (e) {
         statusEl.textContent = "Ошибка подключения к API.";
     }
 }
 
 function resetAndLoad() {
-    currentPage = 1;
-    loadCourses(1);
+    loadCategories();
+loadCourses();
 }
 
 prevBtn.addEventListener("click", () => {
-    if (currentPage > 1) loadCourses(currentPage - 1);
+    if (prevCursor) loadCourses(prevCursor, currentPage - 1);
 });
 
 nextBtn.addEventListener("click", () => {
-    if (currentPage < lastPage) loadCourses(currentPage + 1);
+    if (nextCursor) loadCourses(nextCursor, currentPage + 1);
 });
 
-[searchInput, categoryInput, teacherInput].forEach(el => {
+[searchInput, categoryInput, tagsInput, teacherInput].forEach(el => {
     el.addEventListener("input", () => {
         clearTimeout(el._t);
         el._t = setTimeout(resetAndLoad, 300);
@@ -103,6 +196,7 @@ nextBtn.addEventListener("click", () => {
 });
 
 sortSelect.addEventListener("change", resetAndLoad);
+matchSelect.addEventListener("change", resetAndLoad);
 
 document.getElementById("searchBtn").addEventListener("click", resetAndLoad);
 
@@ -110,8 +204,11 @@ document.getElementById("resetBtn").addEventListener("click", () => {
     searchInput.value = "";
     categoryInput.value = "";
     teacherInput.value = "";
-    sortSelect.value = "createdAt_desc";
+    tagsInput.value = "";
+    matchSelect.value = "all";
+    sortSelect.value = "";
     resetAndLoad();
 });
 
+loadCategories();
 loadCourses();
@@ -0,0 +1,97 @@
+// SCORM player page. The SCO runs sandboxed in an iframe, where scorm-sco.js
+// provides the runtime API; this side loads and saves the CMI data through
+// /courses/{id}/items/{id}/scorm/runtime on its behalf.
+const statusEl = document.getElementById("status");
+const frameEl = document.getElementById("scoFrame");
+const { courseId, itemId, version, launchUrl } = document.body.dataset;
+const runtimeUrl = `/courses/${courseId}/items/${itemId}/scorm/runtime`;
+
+const state = {
+    data: {},
+    dirty: {},
+    initialized: false,
+    terminated: false
+};
+
+async function save(finish) {
+    const cmi = state.dirty;
+    state.dirty = {};
+    try {
+        const res = await fetch(runtimeUrl, {
+            method: "PUT",
+            keepalive: true,
+            headers: { "Content-Type": "application/json", "Accept": "application/json" },
+            body: JSON.stringify({ cmi, finish })
+        });
+        if (!res.ok) {
+            Object.assign(state.dirty, cmi);
+            statusEl.textContent = `Не удалось сохранить прогресс: ${res.status}`;
+        }
+    } catch (e) {
+        Object.assign(state.dirty, cmi);
+        statusEl.textContent = "Ошибка сети при сохранении прогресса.";
+    }
+}
+
+// fromSco reports whether a message comes from the SCO frame or a frame
+// nested in it.
+function fromSco(source) {
+    for (let win = source; win; win = win.parent) {
+        if (win === frameEl.contentWindow) return true;
+        if (win === win.parent) break;
+    }
+    return false;
+}
+
+window.addEventListener("message", event => {
+    const message = event.data;
+    if (!message || message.scorm !== true || !fromSco(event.source)) return;
+    switch (message.type) {
+    case "hello":
+        event.source.postMessage({ scorm: true, type: "state", version, cmi: state.data }, "*");
+        break;
+    case "initialize":
+        state.initialized = true;
+        state.terminated = false;
+        break;
+    case "set":
+        if (typeof message.element !== "string" || typeof message.value !== "string") return;
+        state.data[message.element] = message.value;
+        state.dirty[message.element] = message.value;
+        break;
+    case "commit":
+        if (Object.keys(state.dirty).length > 0) save(false);
+        break;
+    case "terminate":
+        if (!state.initialized || state.terminated) return;
+        state.terminated = true;
+        save(true);
+        break;
+    }
+});
+
+window.addEventListener("pagehide", () => {
+    if (state.initialized && !state.terminated) {
+        state.terminated = true;
+        save(true);
+    }
+});
+
+async function launch() {
+    try {
+        const res = await fetch(runtimeUrl, { headers: { "Accept": "application/json" } });
+        if (!res.ok) {
+            statusEl.textContent = `Ошибка загрузки: ${res.status}`;
+            return;
+        }
+        const runtime = await res.json();
+        state.data = runtime.cmi || {};
+        statusEl.textContent = "";
+        const seed = encodeURIComponent(JSON.stringify({ version, cmi: state.data }));
+        frameEl.src = `${launchUrl}#scorm=${seed}`;
+    } catch (e) {
+        statusEl.textContent = "Ошибка подключения к API.";
+    }
+}
+
+launch();
@@ -0,0 +1,188 @@
+// SCORM runtime API inside a package page. Package files are served in a
+// sandbox (opaque origin), so the SCO cannot reach the player's window; this
+// script, injected into every package page, exposes window.API (SCORM 1.2)
+// and window.API_1484_11 (SCORM 2004) and reports every change to the player
+// (scorm-api.js) with postMessage. The player passes the stored CMI data in
+// the launch URL's fragment, or sends it when asked.
+(() => {
+    let version = "";
+
+    function post(message) {
+        window.top.postMessage(Object.assign({ scorm: true }, message), "*");
+    }
+
+    function seed() {
+        const match = /[#&]scorm=([^&]*)/.exec(location.hash);
+        if (!match) {
+            post({ type: "hello" });
+            return {};
+        }
+        try {
+            const seeded = JSON.parse(decodeURIComponent(match[1]));
+            version = seeded.version || "";
+            return seeded.cmi || {};
+        } catch (e) {
+            post({ type: "hello" });
+            return {};
+        }
+    }
+
+    const ERRORS_12 = {
+        "0": "No error",
+        "101": "General exception",
+        "201": "Invalid argument error",
+        "301": "Not initialized",
+        "401": "Not implemented error",
+        "403": "Element is read only",
+        "404": "Element is write only",
+        "405": "Incorrect data type"
+    };
+
+    const ERRORS_2004 = {
+        "0": "No error",
+        "101": "General exception",
+        "103": "Already initialized",
+        "104": "Content instance terminated",
+        "112": "Termination before initialization",
+        "113": "Termination after termination",
+        "122": "Retrieve data before initialization",
+        "123": "Retrieve data after termination",
+        "132": "Store data before initialization",
+        "133": "Store data after termination",
+        "142": "Commit before initialization",
+        "143": "Commit after termination",
+        "201": "General argument error",
+        "401": "Undefined data model element",
+        "403": "Data model element value not initialized",
+        "404": "Data model element is read only",
+        "405": "Data model element is write only"
+    };
+
+    const READ_ONLY = new Set([
+        "cmi._version", "cmi.learner_id", "cmi.learner_name", "cmi.credit", "cmi.mode", "cmi.entry",
+        "cmi.core._children", "cmi.core.student_id", "cmi.core.student_name", "cmi.core.credit",
+        "cmi.core.lesson_mode", "cmi.core.entry"
+    ]);
+
+    const WRITE_ONLY = new Set(["cmi.core.exit", "cmi.core.session_time", "cmi.exit", "cmi.session_time"]);
+
+    const state = {
+        data: seed(),
+        initialized: false,
+        terminated: false,
+        lastError: "0"
+    };
+
+    function fail(code) {
+        state.lastError = code;
+        return "false";
+    }
+
+    function ok(value) {
+        state.lastError = "0";
+        return value;
+    }
+
+    function initialize(arg, errs) {
+        if (arg !== "") return fail("201");
+        if (state.terminated) return fail(errs.afterTerminate);
+        if (state.initialized) return fail(errs.alreadyInitialized);
+        state.initialized = true;
+        post({ type: "initialize" });
+        return ok("true");
+    }
+
+    function terminate(arg, errs) {
+        if (arg !== "") return fail("201");
+        if (!state.initialized) return fail(errs.terminateBeforeInit);
+        if (state.terminated) return fail(errs.terminateAfterTerminate);
+        state.terminated = true;
+        post({ type: "terminate" });
+        return ok("true");
+    }
+
+    function getValue(element, errs) {
+        if (!state.initialized) { state.lastError = errs.getBeforeInit; return ""; }
+        if (state.terminated) { state.lastError = errs.getAfterTerminate; return ""; }
+        if (WRITE_ONLY.has(element)) { state.lastError = errs.writeOnly; return ""; }
+        if (element.endsWith("._count")) {
+            const prefix = element.slice(0, -"_count".length);
+            const indexes = new Set();
+            Object.keys(state.data).forEach(k => {
+                if (k.startsWith(prefix)) indexes.add(k.slice(prefix.length).split(".")[0]);
+            });
+            return ok(String(indexes.size));
+        }
+        if (!(element in state.data)) {
+            state.lastError = version === "2004" ? "403" : "0";
+            return "";
+        }
+        return ok(state.data[element]);
+    }
+
+    function setValue(element, value, errs) {
+        if (!state.initialized) return fail(errs.setBeforeInit);
+        if (state.terminated) return fail(errs.setAfterTerminate);
+        if (!element.startsWith("cmi.")) return fail(errs.undefinedElement);
+        if (READ_ONLY.has(element)) return fail(errs.readOnly);
+        state.data[element] = String(value);
+        post({ type: "set", element, value: String(value) });
+        return ok("true");
+    }
+
+    function commit(arg, errs) {
+        if (arg !== "") return fail("201");
+        if (!state.initialized) return fail(errs.commitBeforeInit);
+        if (state.terminated) return fail(errs.commitAfterTerminate);
+        post({ type: "commit" });
+        return ok("true");
+    }
+
+    const codes12 = {
+        alreadyInitialized: "101", afterTerminate: "101", terminateBeforeInit: "301", terminateAfterTerminate: "101",
+        getBeforeInit: "301", getAfterTerminate: "101", setBeforeInit: "301", setAfterTerminate: "101",
+        commitBeforeInit: "301", commitAfterTerminate: "101", readOnly: "403", writeOnly: "404", undefinedElement: "201"
+    };
+
+    const codes2004 = {
+        alreadyInitialized: "103", afterTerminate: "104", terminateBeforeInit: "112", terminateAfterTerminate: "113",
+        getBeforeInit: "122", getAfterTerminate: "123", setBeforeInit: "132", setAfterTerminate: "133",
+        commitBeforeInit: "142", commitAfterTerminate: "143", readOnly: "404", writeOnly: "405", undefinedElement: "401"
+    };
+
+    window.API = {
+        LMSInitialize: arg => initialize(arg, codes12),
+        LMSFinish: arg => terminate(arg, codes12),
+        LMSGetValue: element => getValue(element, codes12),
+        LMSSetValue: (element, value) => setValue(element, value, codes12),
+        LMSCommit: arg => commit(arg, codes12),
+        LMSGetLastError: () => state.lastError,
+        LMSGetErrorString: code => ERRORS_12[code] || "",
+        LMSGetDiagnostic: code => ERRORS_12[code || state.lastError] || ""
+    };
+
+    window.API_1484_11 = {
+        Initialize: arg => initialize(arg, codes2004),
+        Terminate: arg => terminate(arg, codes2004),
+        GetValue: element => getValue(element, codes2004),
+        SetValue: (element, value) => setValue(element, value, codes2004),
+        Commit: arg => commit(arg, codes2004),
+        GetLastError: () => state.lastError,
+        GetErrorString: code => ERRORS_2004[code] || "",
+        GetDiagnostic: code => ERRORS_2004[code || state.lastError] || ""
+    };
+
+    window.addEventListener("message", event => {
+        const message = event.data;
+        if (event.source !== window.top || !message || message.scorm !== true || message.type !== "state") return;
+        version = message.version || version;
+        if (!state.initialized) state.data = message.cmi || {};
+    });
+
+    window.addEventListener("pagehide", () => {
+        if (state.initialized && !state.terminated) {
+            state.terminated = true;
+            post({ type: "terminate" });
+        }
+    });
+})();